@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// adminToken enables token access to the admin routes: callers send it as
+// X-Admin-Token. Unset, only members of the "admin" group of the API Gateway
+// authorizer get in.
+var adminToken = os.Getenv("ADMIN_TOKEN")
+
+// isAdmin reports whether the request carries elevated auth: an authorizer
+// claim cognito:groups containing "admin", or the configured admin token.
+func isAdmin(request events.APIGatewayProxyRequest) bool {
+	if claims, ok := request.RequestContext.Authorizer["claims"].(map[string]interface{}); ok {
+		var groups []string
+		switch v := claims["cognito:groups"].(type) {
+		case string:
+			// REST API authorizers flatten the list, e.g. "[admin editors]" or "admin,editors".
+			groups = strings.FieldsFunc(strings.Trim(v, "[]"), func(r rune) bool { return r == ',' || r == ' ' })
+		case []interface{}:
+			for _, g := range v {
+				if s, ok := g.(string); ok {
+					groups = append(groups, s)
+				}
+			}
+		}
+		for _, g := range groups {
+			if g == "admin" {
+				return true
+			}
+		}
+	}
+	token := headerValue(request, "X-Admin-Token")
+	return adminToken != "" && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// Default page size of the admin item listing; ?limit= goes up to storyapi.MaxPageLimit.
+const defaultAdminItemsLimit = 50
+
+// storyPartitions are the partitions holding a story's records, in listing
+// order: story, paragraphs, details and history; graph nodes and edges;
+// graph versions.
+func storyPartitions(storyID string) []string {
+	return []string{"STORY#" + storyID, storyID, graphVersionPartitionPrefix + storyID}
+}
+
+// storyItemsPage reads up to limit raw items of a story starting at cursor,
+// partition after partition in sort key order. The cursor holds the index of
+// the partition and the last sort key read from it ("" to start the
+// partition from the beginning). The returned cursor is nil
+// once the last partition is exhausted; a page ending exactly at a
+// partition boundary may be followed by an empty one.
+func storyItemsPage(ctx context.Context, storyID string, cursor storyapi.Cursor, limit int) ([]map[string]interface{}, *storyapi.Cursor, error) {
+	partitions := storyPartitions(storyID)
+	items := []map[string]interface{}{}
+	for p, after := cursor.Partition, cursor.SK; p < len(partitions); p, after = p+1, "" {
+		for {
+			if len(items) == limit {
+				return items, &storyapi.Cursor{Partition: p, SK: after}, nil
+			}
+			input := &dynamodb.QueryInput{
+				TableName:                aws.String(tableName),
+				KeyConditionExpression:   aws.String(keySchema.PartitionCondition()),
+				ExpressionAttributeNames: keySchema.Names(false),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":sid": &types.AttributeValueMemberS{Value: partitions[p]},
+				},
+				Limit: aws.Int32(int32(limit - len(items))),
+			}
+			if after != "" {
+				input.ExclusiveStartKey = keySchema.Key(partitions[p], after)
+			}
+			res, err := svc.Query(ctx, input)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, it := range res.Items {
+				var raw map[string]interface{}
+				if err := attributevalue.UnmarshalMap(it, &raw); err != nil {
+					return nil, nil, err
+				}
+				items = append(items, raw)
+			}
+			last, ok := res.LastEvaluatedKey[keySchema.SortKey].(*types.AttributeValueMemberS)
+			if !ok {
+				break
+			}
+			after = last.Value
+		}
+	}
+	return items, nil, nil
+}
+
+// adminStoryItemsHandler pages through the raw DynamoDB items of one story,
+// for support work without console access. Items are returned as stored,
+// physical key names included and nothing redacted, so the route requires
+// admin auth (see isAdmin). Pass nextCursor back as ?cursor=.
+// Route: GET /api/admin/stories/{storyId}/items?limit=&cursor=
+func adminStoryItemsHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if !isAdmin(req) {
+		return events.APIGatewayProxyResponse{StatusCode: 403, Headers: corsHeaders(), Body: "Admin access required"}, nil
+	}
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	limit := defaultAdminItemsLimit
+	if v := req.QueryStringParameters["limit"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return badInput("limit must be a positive integer"), nil
+		}
+		limit = min(n, storyapi.MaxPageLimit)
+	}
+	cursor, err := storyapi.DecodeCursor(req.QueryStringParameters["cursor"])
+	if err != nil {
+		return badInput(err.Error()), nil
+	}
+
+	items, next, err := storyItemsPage(ctx, storyID, cursor, limit)
+	if err != nil {
+		log.Printf("❌ Admin item listing of %s failed: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	log.Printf("ℹ️ Admin %q listed %d items of %s", actorFromRequest(req), len(items), storyID)
+	out := struct {
+		StoryID    string                   `json:"storyId"`
+		Items      []map[string]interface{} `json:"items"`
+		Count      int                      `json:"count"`
+		HasMore    bool                     `json:"hasMore"`
+		NextCursor string                   `json:"nextCursor,omitempty"`
+	}{StoryID: storyID, Items: items, Count: len(items), HasMore: next != nil}
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	if next != nil {
+		out.NextCursor = next.Encode()
+		h["X-Next-Cursor"] = out.NextCursor
+	}
+	body, _ := json.Marshal(out)
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
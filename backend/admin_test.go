@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestAdminStoryItemsPagination(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	const storyID = "story-admin"
+
+	var paragraphs []string
+	for i := 1; i <= 12; i++ {
+		paragraphs = append(paragraphs, fmt.Sprintf(`{"index":%d,"title":"P%d","bodyMd":"x"}`, i, i))
+	}
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: `{"story":{"storyId":"story-admin","schoolId":"s","title":"Admin"},
+		"paragraphs":[` + strings.Join(paragraphs, ",") + `]}`}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var nodes []string
+	for i := 1; i <= 9; i++ {
+		nodes = append(nodes, fmt.Sprintf(`{"id":"n%d"}`, i))
+	}
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-admin","nodes":[` + strings.Join(nodes, ",") + `]}`}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	list := func(headers map[string]string, query map[string]string) events.APIGatewayProxyResponse {
+		t.Helper()
+		resp, err := lambdaHandler(ctx, events.APIGatewayProxyRequest{
+			HTTPMethod: "GET", Path: "/api/admin/stories/" + storyID + "/items",
+			Headers: headers, QueryStringParameters: query,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	defer func(old string) { adminToken = old }(adminToken)
+	adminToken = "secret"
+	if resp := list(nil, nil); resp.StatusCode != 403 {
+		t.Fatalf("without auth: %d, want 403", resp.StatusCode)
+	}
+	if resp := list(map[string]string{"X-Admin-Token": "guess"}, nil); resp.StatusCode != 403 {
+		t.Fatalf("wrong token: %d, want 403", resp.StatusCode)
+	}
+	if resp := list(map[string]string{"X-Admin-Token": "secret"}, map[string]string{"cursor": "%%%"}); resp.StatusCode != 400 {
+		t.Fatalf("bad cursor: %d, want 400", resp.StatusCode)
+	}
+
+	seen := map[string]bool{}
+	pages, cursor := 0, ""
+	for {
+		query := map[string]string{"limit": "5"}
+		if cursor != "" {
+			query["cursor"] = cursor
+		}
+		resp := list(map[string]string{"X-Admin-Token": "secret"}, query)
+		if resp.StatusCode != 200 {
+			t.Fatalf("page %d: %d %s", pages, resp.StatusCode, resp.Body)
+		}
+		var page struct {
+			Items      []map[string]interface{} `json:"items"`
+			Count      int                      `json:"count"`
+			HasMore    bool                     `json:"hasMore"`
+			NextCursor string                   `json:"nextCursor"`
+		}
+		if err := json.Unmarshal([]byte(resp.Body), &page); err != nil {
+			t.Fatalf("decode page: %v", err)
+		}
+		if page.Count != len(page.Items) || page.Count > 5 {
+			t.Fatalf("page %d has %d items (count %d), want at most 5", pages, len(page.Items), page.Count)
+		}
+		for _, it := range page.Items {
+			key := fmt.Sprint(it[keySchema.PartitionKey], "|", it[keySchema.SortKey])
+			if seen[key] {
+				t.Fatalf("item %s listed twice", key)
+			}
+			seen[key] = true
+		}
+		pages++
+		if !page.HasMore {
+			break
+		}
+		if page.NextCursor == "" || resp.Headers["X-Next-Cursor"] != page.NextCursor {
+			t.Fatalf("page %d: hasMore without a matching cursor: %q / %q", pages, page.NextCursor, resp.Headers["X-Next-Cursor"])
+		}
+		cursor = page.NextCursor
+		if pages > 20 {
+			t.Fatal("pagination does not terminate")
+		}
+	}
+
+	// 1 story header + 12 paragraphs + 9 nodes, at least one graph version.
+	if len(seen) < 23 || pages < 5 {
+		t.Fatalf("listed %d items over %d pages, want at least 23 over 5", len(seen), pages)
+	}
+	for _, key := range []string{"STORY#story-admin|STORY#story-admin", "story-admin|n9"} {
+		if !seen[key] {
+			t.Errorf("missing item %s in %v", key, seen)
+		}
+	}
+
+	groupAdmin := events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": storyID}}
+	groupAdmin.RequestContext.Authorizer = map[string]interface{}{"claims": map[string]interface{}{"cognito:groups": "[editors admin]"}}
+	adminToken = ""
+	if resp, _ := adminStoryItemsHandler(ctx, groupAdmin); resp.StatusCode != 200 {
+		t.Fatalf("admin group: %d, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// GET /api/analytics/summary reads every story, so it is bounded to
+// maxAnalyticsStories and served from a short-lived cache.
+const (
+	maxAnalyticsStories = 200
+	analyticsWorkers    = 5
+	analyticsTopTypes   = 10
+)
+
+var analyticsTTL = time.Duration(envInt("ANALYTICS_CACHE_SECONDS", 60)) * time.Second
+
+// countBuckets are the histogram bins for per-story node and edge counts;
+// each is an inclusive lower bound, the last one is open-ended.
+var countBuckets = []int{0, 1, 6, 11, 21, 51}
+
+type histogramBin struct {
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+type countStats struct {
+	Total     int            `json:"total"`
+	Average   float64        `json:"average"`
+	Histogram []histogramBin `json:"histogram,omitempty"`
+}
+
+type typeCount struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+type analyticsSummary struct {
+	Stories     int         `json:"stories"`
+	Truncated   bool        `json:"truncated"`
+	Nodes       countStats  `json:"nodes"`
+	Edges       countStats  `json:"edges"`
+	Paragraphs  countStats  `json:"paragraphs"`
+	Degree      degreeStats `json:"degree"`
+	NodeTypes   []typeCount `json:"nodeTypes"`
+	GeneratedAt string      `json:"generatedAt"`
+}
+
+// degreeStats counts relations per node; the weighted figures sum edge
+// weights instead, see graphWeightedDegrees.
+type degreeStats struct {
+	Average         float64 `json:"average"`
+	Max             int     `json:"max"`
+	WeightedAverage float64 `json:"weightedAverage"`
+	WeightedMax     float64 `json:"weightedMax"`
+}
+
+// storyStats is what the summary needs from one story.
+type storyStats struct {
+	nodes, edges, paragraphs int
+	degreeSum, maxDegree     int
+	weightedSum, maxWeighted float64
+	types                    map[string]int
+}
+
+// analyticsCache holds the last summary until analyticsTTL passes.
+var analyticsCache struct {
+	sync.Mutex
+	at      time.Time
+	summary *analyticsSummary
+}
+
+// analyticsSummaryHandler aggregates graph and narrative sizes over all stories.
+// Route: GET /api/analytics/summary
+func analyticsSummaryHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	analyticsCache.Lock()
+	defer analyticsCache.Unlock()
+	if analyticsCache.summary == nil || time.Since(analyticsCache.at) > analyticsTTL {
+		summary, err := summarizeStories(ctx)
+		if err != nil {
+			log.Printf("❌ Analytics summary failed: %v", err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to build summary"}, nil
+		}
+		analyticsCache.summary, analyticsCache.at = &summary, time.Now()
+	}
+	body, _ := json.Marshal(analyticsCache.summary)
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
+
+func summarizeStories(ctx context.Context) (analyticsSummary, error) {
+	stories, err := storySvc.ListStories(ctx)
+	if err != nil {
+		return analyticsSummary{}, err
+	}
+	summary := analyticsSummary{NodeTypes: []typeCount{}, GeneratedAt: storyapi.NowRFC3339UTC()}
+	if len(stories) > maxAnalyticsStories {
+		stories = stories[:maxAnalyticsStories]
+		summary.Truncated = true
+	}
+
+	stats := make([]storyStats, len(stories))
+	errs := make([]error, len(stories))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, analyticsWorkers)
+	for i, st := range stories {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, storyID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			stats[i], errs[i] = collectStoryStats(ctx, storyID)
+		}(i, st.StoryID)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return analyticsSummary{}, err
+	}
+
+	summary.Stories = len(stats)
+	var nodeCounts, edgeCounts []int
+	types := map[string]int{}
+	degreeSum, weightedSum := 0, 0.0
+	for _, s := range stats {
+		degreeSum += s.degreeSum
+		weightedSum += s.weightedSum
+		summary.Degree.Max = max(summary.Degree.Max, s.maxDegree)
+		summary.Degree.WeightedMax = max(summary.Degree.WeightedMax, s.maxWeighted)
+		nodeCounts = append(nodeCounts, s.nodes)
+		edgeCounts = append(edgeCounts, s.edges)
+		summary.Paragraphs.Total += s.paragraphs
+		for t, n := range s.types {
+			types[t] += n
+		}
+	}
+	summary.Nodes = summarizeCounts(nodeCounts)
+	summary.Edges = summarizeCounts(edgeCounts)
+	if summary.Nodes.Total > 0 {
+		summary.Degree.Average = float64(degreeSum) / float64(summary.Nodes.Total)
+		summary.Degree.WeightedAverage = weightedSum / float64(summary.Nodes.Total)
+	}
+	if summary.Stories > 0 {
+		summary.Paragraphs.Average = float64(summary.Paragraphs.Total) / float64(summary.Stories)
+	}
+	for t, n := range types {
+		summary.NodeTypes = append(summary.NodeTypes, typeCount{t, n})
+	}
+	sort.Slice(summary.NodeTypes, func(i, j int) bool {
+		a, b := summary.NodeTypes[i], summary.NodeTypes[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Type < b.Type)
+	})
+	if len(summary.NodeTypes) > analyticsTopTypes {
+		summary.NodeTypes = summary.NodeTypes[:analyticsTopTypes]
+	}
+	return summary, nil
+}
+
+func collectStoryStats(ctx context.Context, storyID string) (storyStats, error) {
+	nodes, edges, err := loadGraph(ctx, storyID)
+	if err != nil {
+		return storyStats{}, fmt.Errorf("graph %s: %w", storyID, err)
+	}
+	s := storyStats{nodes: len(nodes), edges: len(edges), types: map[string]int{}}
+	for _, n := range nodes {
+		if n.Type != "" {
+			s.types[n.Type]++
+		}
+	}
+	for _, d := range graphDegrees(edges) {
+		s.degreeSum += d
+		s.maxDegree = max(s.maxDegree, d)
+	}
+	for _, d := range graphWeightedDegrees(edges) {
+		s.weightedSum += d
+		s.maxWeighted = max(s.maxWeighted, d)
+	}
+	full, err := storySvc.GetFullStory(ctx, storyID)
+	switch {
+	case err == nil:
+		s.paragraphs = len(full.Paragraphs)
+	case !errors.Is(err, storyapi.ErrStoryNotFound):
+		return storyStats{}, fmt.Errorf("story %s: %w", storyID, err)
+	}
+	return s, nil
+}
+
+// summarizeCounts totals counts and bins them into countBuckets; all bins
+// are present, so an empty dataset yields zeros rather than an empty list.
+func summarizeCounts(counts []int) countStats {
+	out := countStats{Histogram: make([]histogramBin, len(countBuckets))}
+	for i, lo := range countBuckets {
+		switch {
+		case i == len(countBuckets)-1:
+			out.Histogram[i].Bucket = fmt.Sprintf("%d+", lo)
+		case countBuckets[i+1]-1 == lo:
+			out.Histogram[i].Bucket = fmt.Sprint(lo)
+		default:
+			out.Histogram[i].Bucket = fmt.Sprintf("%d-%d", lo, countBuckets[i+1]-1)
+		}
+	}
+	for _, c := range counts {
+		out.Total += c
+		bin := sort.Search(len(countBuckets), func(i int) bool { return countBuckets[i] > c }) - 1
+		out.Histogram[bin].Count++
+	}
+	if len(counts) > 0 {
+		out.Average = float64(out.Total) / float64(len(counts))
+	}
+	return out
+}
+
+// graphDegrees counts the relations each node takes part in. An undirected
+// edge stored in both directions is one relation, not two.
+func graphDegrees(edges []Edge) map[string]int {
+	degrees := map[string]int{}
+	for _, e := range distinctRelations(edges) {
+		degrees[e.From]++
+		if e.To != e.From {
+			degrees[e.To]++
+		}
+	}
+	return degrees
+}
+
+// graphWeightedDegrees sums the weights of the relations each node takes
+// part in (node strength); unweighted edges count defaultEdgeWeight.
+func graphWeightedDegrees(edges []Edge) map[string]float64 {
+	degrees := map[string]float64{}
+	for _, e := range distinctRelations(edges) {
+		w := e.EffectiveWeight()
+		degrees[e.From] += w
+		if e.To != e.From {
+			degrees[e.To] += w
+		}
+	}
+	return degrees
+}
+
+// distinctRelations drops the second copy of an undirected edge stored in
+// both directions.
+func distinctRelations(edges []Edge) []Edge {
+	out := make([]Edge, 0, len(edges))
+	seen := map[[2]string]bool{}
+	for _, e := range edges {
+		if !e.IsDirected() {
+			pair := [2]string{min(e.From, e.To), max(e.From, e.To)}
+			if seen[pair] {
+				continue
+			}
+			seen[pair] = true
+		}
+		out = append(out, e)
+	}
+	return out
+}
@@ -0,0 +1,19 @@
+package api
+
+import "context"
+
+type actorKey struct{}
+
+// WithActor attaches the identity of the caller to ctx; handlers record it as updatedBy.
+func WithActor(ctx context.Context, actor string) context.Context {
+	if actor == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the caller stored by WithActor, or "".
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Detail kinds. Attachment details point at an image or file instead of
+// quoting the transcript.
+const (
+	DetailKindQuote      = "quote"
+	DetailKindAttachment = "attachment"
+)
+
+// Attachment references a file by URL or by key in the attachments bucket.
+// Exactly one of URL and S3Key is set.
+type Attachment struct {
+	URL      string `json:"url,omitempty" dynamodbav:"url,omitempty"`
+	S3Key    string `json:"s3Key,omitempty" dynamodbav:"s3Key,omitempty"`
+	MimeType string `json:"mimeType" dynamodbav:"mimeType"`
+}
+
+const maxS3KeyLength = 1024
+
+var s3KeyPattern = regexp.MustCompile(`^[A-Za-z0-9!_.*'()/-]+$`)
+
+// validateDetailAttachment checks the attachment against the detail's kind:
+// attachment details need one, quotes must not carry one.
+func validateDetailAttachment(kind string, a *Attachment) error {
+	switch kind {
+	case DetailKindQuote:
+		if a != nil {
+			return errors.New("attachment is only allowed on attachment details")
+		}
+		return nil
+	case DetailKindAttachment:
+	default:
+		return fmt.Errorf("kind must be '%s' or '%s'", DetailKindQuote, DetailKindAttachment)
+	}
+	if a == nil {
+		return errors.New("attachment is required for attachment details")
+	}
+	a.URL, a.S3Key, a.MimeType = strings.TrimSpace(a.URL), strings.TrimSpace(a.S3Key), strings.TrimSpace(a.MimeType)
+	switch {
+	case a.URL != "" && a.S3Key != "":
+		return errors.New("attachment needs either url or s3Key, not both")
+	case a.URL != "":
+		u, err := url.Parse(a.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("attachment.url must be an absolute http or https URL")
+		}
+	case a.S3Key != "":
+		if len(a.S3Key) > maxS3KeyLength || !s3KeyPattern.MatchString(a.S3Key) ||
+			strings.HasPrefix(a.S3Key, "/") || strings.Contains(a.S3Key, "..") {
+			return errors.New("attachment.s3Key is not a valid object key")
+		}
+	default:
+		return errors.New("attachment needs a url or an s3Key")
+	}
+	mediaType, _, err := mime.ParseMediaType(a.MimeType)
+	if err != nil || !strings.Contains(mediaType, "/") {
+		return errors.New("attachment.mimeType must be a type/subtype such as image/png")
+	}
+	a.MimeType = mediaType
+	return nil
+}
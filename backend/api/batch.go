@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// batchWriteLimit is the most requests one BatchWriteItem call accepts.
+const batchWriteLimit = 25
+
+// batchDeleteAttempts bounds how often keys DynamoDB returns unprocessed
+// (e.g. when throttled) are sent again.
+const batchDeleteAttempts = 5
+
+// batchRetryDelay is the wait before the first retry; it doubles per attempt.
+var batchRetryDelay = 50 * time.Millisecond
+
+// BatchDelete removes keys from table with BatchWriteItem, 25 keys per call.
+// Keys handed back as UnprocessedItems are retried with a growing delay;
+// any still unprocessed after batchDeleteAttempts make it fail.
+func BatchDelete(ctx context.Context, client DynamoClient, table string, keys []map[string]types.AttributeValue) error {
+	for start := 0; start < len(keys); start += batchWriteLimit {
+		end := min(start+batchWriteLimit, len(keys))
+		requests := make([]types.WriteRequest, 0, end-start)
+		for _, key := range keys[start:end] {
+			requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}})
+		}
+		pending := map[string][]types.WriteRequest{table: requests}
+		delay := batchRetryDelay
+		for attempt := 1; len(pending[table]) > 0; attempt++ {
+			if attempt > batchDeleteAttempts {
+				return fmt.Errorf("%d keys still unprocessed after %d attempts", len(pending[table]), batchDeleteAttempts)
+			}
+			if attempt > 1 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(delay):
+				}
+				delay *= 2
+			}
+			out, err := client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return err
+			}
+			pending = out.UnprocessedItems
+		}
+	}
+	return nil
+}
+
+// batchDelete removes the items with the given sort keys from partition pk.
+func (s *StoryService) batchDelete(ctx context.Context, pk string, sortKeys []string) error {
+	keys := make([]map[string]types.AttributeValue, len(sortKeys))
+	for i, sk := range sortKeys {
+		keys[i] = s.keys.Key(pk, sk)
+	}
+	return BatchDelete(ctx, s.dynamo, s.tableName, keys)
+}
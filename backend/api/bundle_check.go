@@ -0,0 +1,106 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// storyProblems runs the import checks on a story header.
+func (s *StoryService) storyProblems(st Story) []string {
+	var problems []string
+	if strings.TrimSpace(st.SchoolID) == "" || strings.TrimSpace(st.Title) == "" {
+		problems = append(problems, "story.schoolId and story.title are required")
+	}
+	if st.TimeAnchor != "" {
+		if _, err := ParseTimelineDate(st.TimeAnchor); err != nil {
+			problems = append(problems, fmt.Sprintf("story.timeAnchor: %v", err))
+		}
+	}
+	if err := CheckLength("story.title", st.Title, s.textLimits.Title); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// paragraphProblems runs the import checks on one paragraph. seenIndex holds
+// the indexes of the paragraphs before it, and the paragraph's index is
+// added.
+func (s *StoryService) paragraphProblems(index int, title, bodyMd string, citations []Citation, seenIndex map[int]bool) []string {
+	var problems []string
+	if index < 1 {
+		problems = append(problems, fmt.Sprintf("paragraph index must be >= 1, got %d", index))
+	} else if seenIndex[index] {
+		// Paragraphs are keyed by index; a second one would silently
+		// replace the first.
+		problems = append(problems, fmt.Sprintf("duplicate paragraph index %d", index))
+	}
+	seenIndex[index] = true
+	if err := s.checkParagraphText(fmt.Sprintf("paragraph %d ", index), &title, &bodyMd); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := validateCitations(citations); err != nil {
+		problems = append(problems, fmt.Sprintf("paragraph %d: %v", index, err))
+	}
+	return problems
+}
+
+// detailProblems runs the import checks on one detail; owner names it in
+// the messages.
+func detailProblems(owner, kind string, attachment *Attachment, startMinute, endMinute int) []string {
+	var problems []string
+	if err := validateDetailAttachment(kind, attachment); err != nil {
+		problems = append(problems, fmt.Sprintf("%s: %v", owner, err))
+	}
+	if startMinute < 0 || endMinute < 0 {
+		problems = append(problems, fmt.Sprintf("%s: minutes must be >= 0", owner))
+	}
+	return problems
+}
+
+// CheckStoryFull runs the import checks over a story in the shape GET
+// /api/stories/{storyId}/full returns and lists every problem rather than
+// stopping at the first. Problems would make HandleImportStory reject the
+// story; warnings are accepted by a default import. Nothing is read or
+// written, and full may be changed in place (trimmed attachment fields).
+func (s *StoryService) CheckStoryFull(full *StoryFull) (problems, warnings []string) {
+	problems = s.storyProblems(full.Story)
+	if len(full.Paragraphs) > s.maxParagraphs {
+		problems = append(problems, fmt.Sprintf("story has %d paragraphs (limit %d)", len(full.Paragraphs), s.maxParagraphs))
+	}
+
+	seenIndex := map[int]bool{}
+	seenID := map[string]bool{}
+	indexes := make([]int, 0, len(full.Paragraphs))
+	for _, p := range full.Paragraphs {
+		indexes = append(indexes, p.Index)
+		problems = append(problems, s.paragraphProblems(p.Index, p.Title, p.BodyMd, p.Citations, seenIndex)...)
+		// The import stores both, but details and node links of the two
+		// can no longer be told apart.
+		if pid := strings.TrimSpace(p.ParagraphID); pid != "" {
+			if seenID[pid] {
+				warnings = append(warnings, fmt.Sprintf("paragraphId %s appears more than once", pid))
+			}
+			seenID[pid] = true
+		}
+	}
+	if sorted, ok := contiguousIndexes(indexes); !ok && len(indexes) > 0 {
+		warnings = append(warnings, fmt.Sprintf("paragraph indexes %v are not 1..%d; ?requireContiguous=true would reject them", sorted, len(indexes)))
+	}
+
+	pids := make([]string, 0, len(full.DetailsByParagraph))
+	for pid := range full.DetailsByParagraph {
+		pids = append(pids, pid)
+	}
+	sort.Strings(pids)
+	for _, pid := range pids {
+		details := full.DetailsByParagraph[pid]
+		if len(details) > s.maxDetails {
+			problems = append(problems, fmt.Sprintf("paragraph %s has %d details (limit %d)", pid, len(details), s.maxDetails))
+		}
+		for _, d := range details {
+			problems = append(problems, detailProblems("detail "+d.DetailID, d.Kind, d.Attachment, d.StartMinute, d.EndMinute)...)
+		}
+	}
+	return problems, warnings
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// MinuteRange is an inclusive span of transcript minutes, encoded as [start, end].
+type MinuteRange [2]int
+
+// TranscriptCoverage lists which minutes of one transcript the story cites.
+// Gaps are the uncited spans between the first and last covered minute; the
+// transcript length is unknown, so nothing is reported beyond those.
+type TranscriptCoverage struct {
+	TranscriptID   string        `json:"transcriptId"`
+	Covered        []MinuteRange `json:"covered"`
+	Gaps           []MinuteRange `json:"gaps"`
+	MinutesCovered int           `json:"minutesCovered"`
+}
+
+// HandleCoverage reports per-transcript minute coverage of a story.
+// Route: GET /api/stories/{storyId}/coverage
+func (s *StoryService) HandleCoverage(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return s.badInput("Missing storyId in path")
+	}
+	full, err := s.GetFullStory(ctx, storyID)
+	if errors.Is(err, ErrStoryNotFound) {
+		return s.errorResponse(404, err.Error())
+	}
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to load story: %v", err))
+	}
+	return s.jsonResponse(200, map[string]interface{}{
+		"storyId":     storyID,
+		"transcripts": StoryCoverage(full),
+	})
+}
+
+// StoryCoverage merges paragraph citation minutes and detail ranges into
+// sorted, non-overlapping ranges per transcript. Adjacent minutes join.
+func StoryCoverage(full *StoryFull) []TranscriptCoverage {
+	spans := map[string][]MinuteRange{}
+	add := func(transcriptID string, start, end int) {
+		transcriptID = strings.TrimSpace(transcriptID)
+		if transcriptID == "" || start < 0 {
+			return
+		}
+		if end < start {
+			end = start
+		}
+		spans[transcriptID] = append(spans[transcriptID], MinuteRange{start, end})
+	}
+	for _, p := range full.Paragraphs {
+		for _, c := range p.Citations {
+			for _, m := range c.Minutes {
+				add(c.TranscriptID, m, m)
+			}
+		}
+		for _, d := range full.DetailsByParagraph[p.ParagraphID] {
+			add(d.TranscriptID, d.StartMinute, d.EndMinute)
+		}
+	}
+
+	out := make([]TranscriptCoverage, 0, len(spans))
+	for id, rs := range spans {
+		covered := mergeRanges(rs)
+		tc := TranscriptCoverage{TranscriptID: id, Covered: covered, Gaps: []MinuteRange{}}
+		for i, r := range covered {
+			tc.MinutesCovered += r[1] - r[0] + 1
+			if i > 0 {
+				tc.Gaps = append(tc.Gaps, MinuteRange{covered[i-1][1] + 1, r[0] - 1})
+			}
+		}
+		out = append(out, tc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TranscriptID < out[j].TranscriptID })
+	return out
+}
+
+func mergeRanges(rs []MinuteRange) []MinuteRange {
+	sort.Slice(rs, func(i, j int) bool { return rs[i][0] < rs[j][0] })
+	var merged []MinuteRange
+	for _, r := range rs {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1]+1 {
+			merged[n-1][1] = max(merged[n-1][1], r[1])
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidJSON wraps every DecodeJSON error: a body that is not JSON or does
+// not fit the expected shape, which is a 400 under the status policy in status.go.
+var ErrInvalidJSON = errors.New("Invalid JSON payload")
+
+// DecodeJSON unmarshals body into v. Syntax and type errors are rewritten to
+// name the offending field and its line/column, so a 400 tells the client
+// what to fix instead of quoting a raw byte offset.
+func DecodeJSON(body string, v interface{}) error {
+	err := json.Unmarshal([]byte(body), v)
+	if err == nil {
+		return nil
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		// Offset counts the offending byte as already read.
+		line, col := lineColumn(body, syntaxErr.Offset-1)
+		return fmt.Errorf("%w: %s at line %d, column %d", ErrInvalidJSON, syntaxErr.Error(), line, col)
+	case errors.As(err, &typeErr):
+		line, col := lineColumn(body, typeErr.Offset)
+		field := typeErr.Field
+		if field == "" {
+			field = "(root)"
+		}
+		return fmt.Errorf("%w: field %q must be %s, got %s at line %d, column %d", ErrInvalidJSON, field, typeErr.Type.String(), typeErr.Value, line, col)
+	default:
+		return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+}
+
+// lineColumn converts a byte offset into 1-based line and column numbers.
+func lineColumn(body string, offset int64) (int, int) {
+	offset = max(0, min(offset, int64(len(body))))
+	before := body[:offset]
+	line := strings.Count(before, "\n") + 1
+	col := int(offset) - strings.LastIndex(before, "\n")
+	return line, col
+}
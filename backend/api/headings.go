@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HeadingMode selects how paragraph bodies are normalized on write.
+type HeadingMode string
+
+const (
+	// HeadingsKeep stores bodies as sent.
+	HeadingsKeep HeadingMode = ""
+	// HeadingsStrip drops a leading heading that repeats the paragraph title.
+	HeadingsStrip HeadingMode = "strip"
+	// HeadingsDemote moves a leading heading that repeats the paragraph title
+	// below it (level 3); the rest of the body is left alone.
+	HeadingsDemote HeadingMode = "demote"
+)
+
+// bodyHeadingLevel is the shallowest heading level a paragraph body may use:
+// the story title is h1 and the paragraph title h2 in the reader exports.
+const bodyHeadingLevel = 3
+
+// ParseHeadingMode validates a PARAGRAPH_HEADINGS value.
+func ParseHeadingMode(v string) (HeadingMode, error) {
+	switch m := HeadingMode(strings.ToLower(strings.TrimSpace(v))); m {
+	case HeadingsKeep, HeadingsStrip, HeadingsDemote:
+		return m, nil
+	}
+	return HeadingsKeep, fmt.Errorf("unknown heading mode %q (want strip or demote)", v)
+}
+
+// SetHeadingMode turns on heading normalization for paragraph writes.
+func (s *StoryService) SetHeadingMode(m HeadingMode) {
+	s.headingMode = m
+}
+
+// NormalizeHeadings returns the canonical body for a paragraph titled title.
+func NormalizeHeadings(title, body string, mode HeadingMode) string {
+	switch mode {
+	case HeadingsStrip:
+		return stripTitleHeading(title, body)
+	case HeadingsDemote:
+		return demoteTitleHeading(title, body)
+	}
+	return body
+}
+
+// markdownHeading splits "## Text" into its level and text; level 0 means
+// the line is not an ATX heading.
+func markdownHeading(line string) (int, string) {
+	t := strings.TrimSpace(line)
+	level := len(t) - len(strings.TrimLeft(t, "#"))
+	if level == 0 || level > 6 {
+		return 0, ""
+	}
+	rest := t[level:]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return 0, ""
+	}
+	return level, strings.TrimSpace(strings.TrimRight(strings.TrimSpace(rest), "#"))
+}
+
+// leadingTitleHeading returns the body's lines and the index of its first
+// non-blank line when that line is a heading repeating title; -1 otherwise.
+func leadingTitleHeading(title, body string) ([]string, int) {
+	title = strings.TrimSpace(title)
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	if title == "" {
+		return lines, -1
+	}
+	first := 0
+	for first < len(lines) && strings.TrimSpace(lines[first]) == "" {
+		first++
+	}
+	if first == len(lines) {
+		return lines, -1
+	}
+	if level, text := markdownHeading(lines[first]); level == 0 || !strings.EqualFold(text, title) {
+		return lines, -1
+	}
+	return lines, first
+}
+
+func stripTitleHeading(title, body string) string {
+	lines, first := leadingTitleHeading(title, body)
+	if first < 0 {
+		return body
+	}
+	rest := lines[first+1:]
+	for len(rest) > 0 && strings.TrimSpace(rest[0]) == "" {
+		rest = rest[1:]
+	}
+	return strings.Join(rest, "\n")
+}
+
+func demoteTitleHeading(title, body string) string {
+	lines, first := leadingTitleHeading(title, body)
+	if first < 0 {
+		return body
+	}
+	level, text := markdownHeading(lines[first])
+	if level >= bodyHeadingLevel {
+		return body
+	}
+	lines[first] = strings.Repeat("#", bodyHeadingLevel) + " " + text
+	return strings.Join(lines, "\n")
+}
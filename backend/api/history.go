@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Paragraph history lives in its own partition HIST#<storyId> under
+// <paragraphId>#<unix nanoseconds>, so it sorts by time per paragraph
+// (changedAt only has second precision) and never adds to the reads of the
+// story partition. DeleteStory removes it with the story.
+const historyPrefix = "HIST#"
+
+// Fields a ParagraphChange can name.
+const (
+	FieldTitle     = "title"
+	FieldBody      = "bodyMd"
+	FieldIndex     = "index"
+	FieldCitations = "citations"
+)
+
+// ParagraphChange records which fields one paragraph update changed.
+type ParagraphChange struct {
+	ParagraphID string   `json:"paragraphId" dynamodbav:"paragraphId"`
+	ChangedAt   string   `json:"changedAt" dynamodbav:"changedAt"`
+	ChangedBy   string   `json:"changedBy,omitempty" dynamodbav:"changedBy,omitempty"`
+	Fields      []string `json:"fields" dynamodbav:"fields"`
+}
+
+type historyRecord struct {
+	StoryKey string `dynamodbav:"storyId"`
+	ID       string `dynamodbav:"id"`
+	ParagraphChange
+}
+
+func historyPartition(storyID string) string {
+	return historyPrefix + storyID
+}
+
+func historyKeyPrefix(paragraphID string) string {
+	return paragraphID + "#"
+}
+
+// changedParagraphFields compares two versions of a paragraph record.
+func changedParagraphFields(before, after paragraphRecord) []string {
+	var fields []string
+	if before.Title != after.Title {
+		fields = append(fields, FieldTitle)
+	}
+	if before.BodyMd != after.BodyMd {
+		fields = append(fields, FieldBody)
+	}
+	if before.Index != after.Index {
+		fields = append(fields, FieldIndex)
+	}
+	if !reflect.DeepEqual(citationsOrEmpty(before.Citations), citationsOrEmpty(after.Citations)) {
+		fields = append(fields, FieldCitations)
+	}
+	return fields
+}
+
+// recordParagraphChange stores a history entry for an update of before into
+// after. It is best-effort: the update already happened, so a failure is
+// only logged.
+func (s *StoryService) recordParagraphChange(ctx context.Context, before, after paragraphRecord) {
+	fields := changedParagraphFields(before, after)
+	if len(fields) == 0 {
+		return
+	}
+	rec := historyRecord{
+		StoryKey: historyPartition(strings.TrimPrefix(after.StoryKey, "STORY#")),
+		ID:       fmt.Sprintf("%s%019d", historyKeyPrefix(after.ParagraphID), time.Now().UnixNano()),
+		ParagraphChange: ParagraphChange{
+			ParagraphID: after.ParagraphID,
+			ChangedAt:   after.UpdatedAt,
+			ChangedBy:   after.UpdatedBy,
+			Fields:      fields,
+		},
+	}
+	item, err := attributevalue.MarshalMap(rec)
+	if err == nil {
+		_, err = s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: &s.tableName,
+			Item:      s.keys.ToItem(item),
+		})
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to record history of paragraph %s: %v", after.ParagraphID, err)
+	}
+}
+
+// HandleParagraphHistory lists the recorded changes of a paragraph, oldest first.
+// Route: GET /api/paragraphs/{paragraphId}/history?storyId=
+func (s *StoryService) HandleParagraphHistory(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	paragraphID := req.PathParameters["paragraphId"]
+	if paragraphID == "" {
+		return s.badInput("Missing paragraphId in path")
+	}
+	storyID := strings.TrimSpace(req.QueryStringParameters["storyId"])
+	if storyID == "" {
+		return s.badInput("storyId query parameter is required")
+	}
+	if _, err := s.getParagraph(ctx, storyID, paragraphID); errors.Is(err, ErrParagraphNotFound) {
+		return s.errorResponse(404, err.Error())
+	} else if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to load paragraph: %v", err))
+	}
+	changes := []ParagraphChange{}
+	var startKey map[string]types.AttributeValue
+	for {
+		res, err := s.dynamo.Query(ctx, &dynamodb.QueryInput{
+			TableName:                &s.tableName,
+			KeyConditionExpression:   awsString(s.keys.PrefixCondition()),
+			ExpressionAttributeNames: s.keys.Names(true),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":sid":      &types.AttributeValueMemberS{Value: historyPartition(storyID)},
+				":skPrefix": &types.AttributeValueMemberS{Value: historyKeyPrefix(paragraphID)},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return s.errorResponse(500, fmt.Sprintf("Failed to load history: %v", err))
+		}
+		for _, item := range res.Items {
+			var rec historyRecord
+			if err := attributevalue.UnmarshalMap(s.keys.FromItem(item), &rec); err != nil {
+				return s.errorResponse(500, fmt.Sprintf("Failed to read history: %v", err))
+			}
+			changes = append(changes, rec.ParagraphChange)
+		}
+		if len(res.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = res.LastEvaluatedKey
+	}
+	return s.jsonResponse(200, changes)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// IDPrefixes are put in front of the random part of generated ids.
+type IDPrefixes struct {
+	Story     string
+	Paragraph string
+	Detail    string
+}
+
+// DefaultIDPrefixes are the prefixes ids have always carried.
+var DefaultIDPrefixes = IDPrefixes{Story: "story-", Paragraph: "para-", Detail: "det-"}
+
+// tenantPattern keeps tenants safe inside URL paths and STORY#/PARA# sort keys.
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// TenantIDPrefixes returns the default prefixes led by tenant, e.g.
+// "staging-story-", so ids from different environments never collide when
+// their data is merged. An empty tenant keeps the defaults.
+func TenantIDPrefixes(tenant string) (IDPrefixes, error) {
+	if tenant == "" {
+		return DefaultIDPrefixes, nil
+	}
+	if !tenantPattern.MatchString(tenant) {
+		return DefaultIDPrefixes, fmt.Errorf("tenant %q may only contain letters, digits, '-' and '_'", tenant)
+	}
+	return IDPrefixes{
+		Story:     tenant + "-" + DefaultIDPrefixes.Story,
+		Paragraph: tenant + "-" + DefaultIDPrefixes.Paragraph,
+		Detail:    tenant + "-" + DefaultIDPrefixes.Detail,
+	}, nil
+}
+
+// SetIDPrefixes overrides the prefixes of generated ids; empty fields keep the default.
+func (s *StoryService) SetIDPrefixes(p IDPrefixes) {
+	if p.Story == "" {
+		p.Story = DefaultIDPrefixes.Story
+	}
+	if p.Paragraph == "" {
+		p.Paragraph = DefaultIDPrefixes.Paragraph
+	}
+	if p.Detail == "" {
+		p.Detail = DefaultIDPrefixes.Detail
+	}
+	s.idPrefixes = p
+}
+
+// newID returns a fresh id starting with prefix.
+func newID(prefix string) string {
+	return prefix + uuid.New().String()
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// UnmarshalItem is attributevalue.UnmarshalMap for a stored item with logical
+// key names (see KeySchema.FromItem). An error names the item's sort key and
+// every number attribute that does not parse, e.g. a corrupt x position, so
+// the record that was skipped can be found and fixed.
+func UnmarshalItem(item map[string]types.AttributeValue, out interface{}) error {
+	err := attributevalue.UnmarshalMap(item, out)
+	if err == nil {
+		return nil
+	}
+	id := "(no id)"
+	if v, ok := item[logicalSortKey].(*types.AttributeValueMemberS); ok {
+		id = v.Value
+	}
+	var bad []string
+	for name, v := range item {
+		bad = append(bad, badNumbers(name, v)...)
+	}
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return fmt.Errorf("item %s: non-numeric %s: %w", id, strings.Join(bad, ", "), err)
+	}
+	return fmt.Errorf("item %s: %w", id, err)
+}
+
+// badNumbers lists the number attributes at or below path whose value is not
+// a number, as paths like "waypoints[1].x".
+func badNumbers(path string, v types.AttributeValue) []string {
+	var bad []string
+	switch v := v.(type) {
+	case *types.AttributeValueMemberN:
+		if _, err := strconv.ParseFloat(v.Value, 64); err != nil {
+			bad = append(bad, fmt.Sprintf("%s=%q", path, v.Value))
+		}
+	case *types.AttributeValueMemberM:
+		for name, child := range v.Value {
+			bad = append(bad, badNumbers(path+"."+name, child)...)
+		}
+	case *types.AttributeValueMemberL:
+		for i, child := range v.Value {
+			bad = append(bad, badNumbers(fmt.Sprintf("%s[%d]", path, i), child)...)
+		}
+	}
+	return bad
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// KeySchema names the table's partition and sort key attributes. Records are
+// marshaled with the logical names "storyId" and "id"; ToItem and FromItem
+// translate between those and the physical names, so the same code runs
+// against tables with a different key layout.
+type KeySchema struct {
+	PartitionKey string
+	SortKey      string
+}
+
+// Logical key attribute names used by the dynamodbav struct tags.
+const (
+	logicalPartitionKey = "storyId"
+	logicalSortKey      = "id"
+)
+
+// DefaultKeySchema matches the table created by terraform/main.tf.
+var DefaultKeySchema = KeySchema{PartitionKey: logicalPartitionKey, SortKey: logicalSortKey}
+
+// KeySchemaFromEnv reads TABLE_PARTITION_KEY / TABLE_SORT_KEY, falling back to the defaults.
+func KeySchemaFromEnv() KeySchema {
+	k := DefaultKeySchema
+	if v := os.Getenv("TABLE_PARTITION_KEY"); v != "" {
+		k.PartitionKey = v
+	}
+	if v := os.Getenv("TABLE_SORT_KEY"); v != "" {
+		k.SortKey = v
+	}
+	return k
+}
+
+// Key builds a primary key map for GetItem/DeleteItem.
+func (k KeySchema) Key(pk, sk string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		k.PartitionKey: &types.AttributeValueMemberS{Value: pk},
+		k.SortKey:      &types.AttributeValueMemberS{Value: sk},
+	}
+}
+
+// PartitionCondition is the key condition for a whole partition; bind the value to ":sid".
+func (k KeySchema) PartitionCondition() string {
+	return "#pk = :sid"
+}
+
+// ItemCondition selects one item; bind the values to ":sid" and ":sk".
+func (k KeySchema) ItemCondition() string {
+	return "#pk = :sid AND #sk = :sk"
+}
+
+// PrefixCondition selects the items of a partition whose sort key starts with
+// a prefix; bind the values to ":sid" and ":skPrefix".
+func (k KeySchema) PrefixCondition() string {
+	return "#pk = :sid AND begins_with(#sk, :skPrefix)"
+}
+
+// Names returns the ExpressionAttributeNames for "#pk" and, if withSort, "#sk".
+// DynamoDB rejects names that an expression does not use, hence the flag.
+func (k KeySchema) Names(withSort bool) map[string]string {
+	names := map[string]string{"#pk": k.PartitionKey}
+	if withSort {
+		names["#sk"] = k.SortKey
+	}
+	return names
+}
+
+// SortKeyNames returns the ExpressionAttributeNames for expressions that only use "#sk".
+func (k KeySchema) SortKeyNames() map[string]string {
+	return map[string]string{"#sk": k.SortKey}
+}
+
+// ToItem renames the logical key attributes of a marshaled record to the physical ones.
+func (k KeySchema) ToItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	return renameKeys(item, logicalPartitionKey, k.PartitionKey, logicalSortKey, k.SortKey)
+}
+
+// FromItem renames the physical key attributes of a stored item to the logical ones.
+func (k KeySchema) FromItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	return renameKeys(item, k.PartitionKey, logicalPartitionKey, k.SortKey, logicalSortKey)
+}
+
+func renameKeys(item map[string]types.AttributeValue, fromPK, toPK, fromSK, toSK string) map[string]types.AttributeValue {
+	if fromPK == toPK && fromSK == toSK {
+		return item
+	}
+	out := make(map[string]types.AttributeValue, len(item))
+	for name, v := range item {
+		switch name {
+		case fromPK:
+			out[toPK] = v
+		case fromSK:
+			out[toSK] = v
+		case toPK, toSK:
+			// A plain attribute shadowed by a key name; the key wins.
+			if _, exists := out[name]; !exists {
+				out[name] = v
+			}
+		default:
+			out[name] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// TextLimits caps the length, in characters, of story and paragraph text.
+type TextLimits struct {
+	Title  int
+	BodyMd int
+}
+
+// DefaultTextLimits are generous; a body at the limit still leaves room in a
+// 400 KB DynamoDB item.
+var DefaultTextLimits = TextLimits{Title: 500, BodyMd: 100000}
+
+// SetTextLimits overrides the text length limits; fields < 1 keep the default.
+func (s *StoryService) SetTextLimits(l TextLimits) {
+	if l.Title < 1 {
+		l.Title = DefaultTextLimits.Title
+	}
+	if l.BodyMd < 1 {
+		l.BodyMd = DefaultTextLimits.BodyMd
+	}
+	s.textLimits = l
+}
+
+// LengthError is a text field longer than its limit.
+type LengthError struct {
+	Field string
+	Len   int
+	Limit int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("%s is %d characters (limit %d)", e.Field, e.Len, e.Limit)
+}
+
+// CheckLength reports a field longer than limit characters as a *LengthError.
+func CheckLength(field, v string, limit int) error {
+	if n := utf8.RuneCountInString(v); n > limit {
+		return &LengthError{Field: field, Len: n, Limit: limit}
+	}
+	return nil
+}
+
+// checkParagraphText applies the title and body limits; nil values are skipped.
+func (s *StoryService) checkParagraphText(prefix string, title, bodyMd *string) error {
+	if title != nil {
+		if err := CheckLength(prefix+"title", *title, s.textLimits.Title); err != nil {
+			return err
+		}
+	}
+	if bodyMd != nil {
+		if err := CheckLength(prefix+"bodyMd", *bodyMd, s.textLimits.BodyMd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
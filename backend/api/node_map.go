@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// NodeMap is a story's paragraph-to-node links in both directions.
+type NodeMap struct {
+	StoryID          string              `json:"storyId"`
+	ParagraphNodeMap map[string][]string `json:"paragraphNodeMap"`
+	// NodeParagraphs lists, per node, the paragraphs linked to it, sorted by id.
+	NodeParagraphs map[string][]string `json:"nodeParagraphs"`
+}
+
+// HandleNodeMap returns only the paragraphNodeMap and its reverse index, for
+// the editor's linking panel. It reads the story header alone, so neither
+// paragraph bodies nor the graph are loaded.
+// Route: GET /api/stories/{storyId}/node-map
+func (s *StoryService) HandleNodeMap(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return s.badInput("Missing storyId in path")
+	}
+	story, err := s.getStory(ctx, storyID)
+	if errors.Is(err, ErrStoryNotFound) {
+		return s.errorResponse(404, err.Error())
+	}
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to load story: %v", err))
+	}
+	out := NodeMap{StoryID: storyID, ParagraphNodeMap: map[string][]string{}, NodeParagraphs: map[string][]string{}}
+	for pid, nodeIDs := range story.ParagraphNodeMap {
+		out.ParagraphNodeMap[pid] = nodeIDs
+		for _, nid := range nodeIDs {
+			out.NodeParagraphs[nid] = append(out.NodeParagraphs[nid], pid)
+		}
+	}
+	for _, pids := range out.NodeParagraphs {
+		sort.Strings(pids)
+	}
+	return s.jsonResponse(200, out)
+}
+
+// getStory reads the header record of storyID with a single GetItem.
+func (s *StoryService) getStory(ctx context.Context, storyID string) (Story, error) {
+	key := fmt.Sprintf("STORY#%s", storyID)
+	res, err := s.dynamo.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &s.tableName,
+		Key:       s.keys.Key(key, key),
+	})
+	if err != nil {
+		return Story{}, err
+	}
+	if len(res.Item) == 0 {
+		return Story{}, ErrStoryNotFound
+	}
+	var rec storyRecord
+	if err := attributevalue.UnmarshalMap(s.keys.FromItem(res.Item), &rec); err != nil {
+		return Story{}, err
+	}
+	return rec.Story, nil
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// OutlineEntry is a paragraph without its body, for the editor's outline.
+type OutlineEntry struct {
+	ParagraphID string `json:"paragraphId"`
+	Index       int    `json:"index"`
+	Title       string `json:"title"`
+	HasBody     bool   `json:"hasBody"`
+	DetailCount int    `json:"detailCount"`
+	BodyPreview string `json:"bodyPreview,omitempty"`
+	Truncated   bool   `json:"truncated,omitempty"`
+}
+
+// HandleOutline lists a story's paragraphs in index order without BodyMd;
+// ?bodyPreview=N adds the first N characters of each body.
+// Route: GET /api/stories/{storyId}/outline
+func (s *StoryService) HandleOutline(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return s.badInput("Missing storyId in path")
+	}
+	preview, err := ParseBodyPreview(req.QueryStringParameters)
+	if err != nil {
+		return s.badInput(err.Error())
+	}
+	_, paragraphs, details, err := s.fetchStoryBundle(ctx, storyID)
+	if errors.Is(err, ErrStoryNotFound) {
+		return s.errorResponse(404, err.Error())
+	}
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to load story: %v", err))
+	}
+	counts := map[string]int{}
+	for _, d := range details {
+		counts[d.ParagraphID]++
+	}
+	outline := make([]OutlineEntry, 0, len(paragraphs))
+	for _, p := range paragraphs {
+		entry := OutlineEntry{
+			ParagraphID: p.ParagraphID,
+			Index:       p.Index,
+			Title:       p.Title,
+			HasBody:     strings.TrimSpace(p.BodyMd) != "",
+			DetailCount: counts[p.ParagraphID],
+		}
+		if preview > 0 {
+			entry.BodyPreview, entry.Truncated = TruncateBody(p.BodyMd, preview)
+		}
+		outline = append(outline, entry)
+	}
+	return s.jsonResponse(200, outline)
+}
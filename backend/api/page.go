@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// MaxPageLimit caps ?limit= on paginated list endpoints.
+const MaxPageLimit = 200
+
+// errInvalidCursor is what every listing answers a cursor it did not hand out with.
+var errInvalidCursor = errors.New("Invalid cursor")
+
+// Cursor is where a paginated listing resumes. Every listing hands it out in
+// the same opaque form, base64url-encoded JSON, whatever it pages by:
+// listings of a sorted slice set Offset, listings that follow DynamoDB keys
+// set the key read last (PK and SK). Partition counts the partitions a
+// listing over several of them has finished.
+type Cursor struct {
+	Offset    int    `json:"o,omitempty"`
+	Partition int    `json:"p,omitempty"`
+	PK        string `json:"pk,omitempty"`
+	SK        string `json:"sk,omitempty"`
+}
+
+// Encode returns the cursor as handed out in nextCursor.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a ?cursor= value; "" is the start of the listing.
+func DecodeCursor(v string) (Cursor, error) {
+	var c Cursor
+	if v == "" {
+		return c, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.Offset < 0 || c.Partition < 0 {
+		return Cursor{}, errInvalidCursor
+	}
+	return c, nil
+}
+
+// ListPage is the envelope of paginated list responses. Count is the number
+// of items in this page, Total the number of matches across all pages.
+// NextCursor is set exactly when HasMore is true; pass it back as ?cursor=.
+type ListPage[T any] struct {
+	Items      []T    `json:"items"`
+	Count      int    `json:"count"`
+	Total      int    `json:"total"`
+	HasMore    bool   `json:"hasMore"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// ParsePageParams reads ?limit= and ?cursor=. A zero limit means "all remaining".
+func ParsePageParams(query map[string]string) (limit, offset int, err error) {
+	if v := query["limit"]; v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return 0, 0, errors.New("limit must be a positive integer")
+		}
+		limit = min(limit, MaxPageLimit)
+	}
+	cursor, err := DecodeCursor(query["cursor"])
+	if err != nil {
+		return 0, 0, err
+	}
+	return limit, cursor.Offset, nil
+}
+
+// Paginate slices all into the page starting at offset. Items is never nil,
+// so an empty page encodes as [].
+func Paginate[T any](all []T, limit, offset int) ListPage[T] {
+	page := ListPage[T]{Items: []T{}, Total: len(all)}
+	if offset < len(all) {
+		page.Items = all[offset:]
+	}
+	if limit > 0 && len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.HasMore = true
+		page.NextCursor = Cursor{Offset: offset + limit}.Encode()
+	}
+	page.Count = len(page.Items)
+	return page
+}
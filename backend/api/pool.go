@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"sync"
+)
+
+// importWorkers bounds concurrent DynamoDB calls during an import.
+const importWorkers = 8
+
+// forEachBounded calls fn(ctx, i) for i in [0, n) with at most workers calls
+// in flight. The first error cancels the context passed to the remaining
+// calls and is returned once all started calls have finished.
+func forEachBounded(ctx context.Context, workers, n int, fn func(context.Context, int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	sem := make(chan struct{}, workers)
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			fail(ctx.Err())
+			wg.Wait()
+			return firstErr
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, i); err != nil {
+				fail(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseBodyPreview reads ?bodyPreview=N, the number of characters of BodyMd a
+// listing should carry; 0 means full bodies.
+func ParseBodyPreview(q map[string]string) (int, error) {
+	v := q["bodyPreview"]
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("bodyPreview must be a positive integer")
+	}
+	return n, nil
+}
+
+// TruncateBody shortens body to at most limit characters and reports whether
+// anything was cut. It counts runes, so multibyte characters are never split,
+// prefers ending at a word boundary, and drops Markdown that the cut left
+// open: a half-written link or an unpaired **, __ or ` marker.
+func TruncateBody(body string, limit int) (string, bool) {
+	runes := []rune(body)
+	if limit < 1 || len(runes) <= limit {
+		return body, false
+	}
+	cut := runes[:limit]
+	if !unicode.IsSpace(runes[limit]) {
+		// Back off to the last space, unless the word is so long that the
+		// preview would lose more than half its length.
+		for i := len(cut) - 1; i >= limit/2; i-- {
+			if unicode.IsSpace(cut[i]) {
+				cut = cut[:i]
+				break
+			}
+		}
+	}
+	out := string(cut)
+	if open := strings.LastIndex(out, "["); open >= 0 && unclosedLink(out[open:]) {
+		out = out[:open]
+	}
+	for _, marker := range []string{"**", "__", "`"} {
+		if strings.Count(out, marker)%2 == 1 {
+			i := strings.LastIndex(out, marker)
+			out = out[:i] + out[i+len(marker):]
+		}
+	}
+	return strings.TrimRightFunc(out, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune("#>-*_[(!", r)
+	}), true
+}
+
+// unclosedLink reports whether tail, starting at a "[", stops inside the link
+// text or its "(target)".
+func unclosedLink(tail string) bool {
+	end := strings.Index(tail, "]")
+	if end < 0 {
+		return true
+	}
+	rest := tail[end+1:]
+	return strings.HasPrefix(rest, "(") && !strings.Contains(rest, ")")
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandleReaderMarkdown renders the story bundle as one printable Markdown document.
+// Route: GET /api/stories/{storyId}/reader.md
+func (s *StoryService) HandleReaderMarkdown(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return s.badInput("Missing storyId in path")
+	}
+	full, err := s.GetFullStory(ctx, storyID)
+	if errors.Is(err, ErrStoryNotFound) {
+		return s.errorResponse(404, err.Error())
+	}
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to load story: %v", err))
+	}
+	return s.textResponse(200, "text/markdown; charset=utf-8", RenderReaderMarkdown(full))
+}
+
+// RenderReaderMarkdown concatenates paragraphs in index order. Paragraph titles
+// become headings, quote details follow as blockquotes and citations are
+// collected as footnotes at the end of the document.
+func RenderReaderMarkdown(full *StoryFull) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", strings.TrimSpace(full.Story.Title))
+
+	var footnotes []string
+	for _, p := range full.Paragraphs {
+		if title := strings.TrimSpace(p.Title); title != "" {
+			fmt.Fprintf(&b, "## %s\n\n", title)
+		}
+		b.WriteString(strings.TrimSpace(p.BodyMd))
+		for _, c := range p.Citations {
+			footnotes = append(footnotes, formatCitation(c))
+			fmt.Fprintf(&b, "[^%d]", len(footnotes))
+		}
+		b.WriteString("\n\n")
+		for _, d := range full.DetailsByParagraph[p.ParagraphID] {
+			if d.Kind != DetailKindQuote || strings.TrimSpace(d.Text) == "" {
+				continue
+			}
+			for _, line := range strings.Split(strings.TrimSpace(d.Text), "\n") {
+				fmt.Fprintf(&b, "> %s\n", line)
+			}
+			fmt.Fprintf(&b, ">\n> — %s\n\n", formatMinuteRange(d.TranscriptID, d.StartMinute, d.EndMinute))
+		}
+	}
+
+	for i, note := range footnotes {
+		fmt.Fprintf(&b, "[^%d]: %s\n", i+1, note)
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+func formatCitation(c Citation) string {
+	if len(c.Minutes) == 0 {
+		return c.TranscriptID
+	}
+	mins := make([]string, len(c.Minutes))
+	for i, m := range c.Minutes {
+		mins[i] = strconv.Itoa(m)
+	}
+	return fmt.Sprintf("%s, min. %s", c.TranscriptID, strings.Join(mins, ", "))
+}
+
+func formatMinuteRange(transcriptID string, start, end int) string {
+	if end <= start {
+		return fmt.Sprintf("%s, min. %d", transcriptID, start)
+	}
+	return fmt.Sprintf("%s, min. %d–%d", transcriptID, start, end)
+}
+
+// RenderReaderHTML renders the story bundle as a standalone HTML document.
+// Paragraph bodies pass through markdownToHTML, which escapes all input before
+// applying formatting. graphMermaid, when non-empty, is embedded as a Mermaid
+// diagram rendered client-side; the source stays readable without scripts.
+func RenderReaderHTML(full *StoryFull, graphMermaid string) string {
+	title := html.EscapeString(strings.TrimSpace(full.Story.Title))
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html lang=\"de\">\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n", title)
+	b.WriteString("<style>body{font-family:system-ui,sans-serif;max-width:46rem;margin:2rem auto;line-height:1.55;color:#111827}" +
+		"blockquote{border-left:3px solid #9ca3af;margin:1rem 0;padding:.25rem 1rem;color:#374151}" +
+		"blockquote footer{font-size:.85em;color:#6b7280}.footnotes{font-size:.85em;border-top:1px solid #e5e7eb}</style>\n")
+	b.WriteString("</head>\n<body>\n")
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", title)
+
+	var footnotes []string
+	for _, p := range full.Paragraphs {
+		b.WriteString("<section>\n")
+		if t := strings.TrimSpace(p.Title); t != "" {
+			fmt.Fprintf(&b, "<h2>%s</h2>\n", html.EscapeString(t))
+		}
+		b.WriteString(markdownToHTML(p.BodyMd))
+		if len(p.Citations) > 0 {
+			b.WriteString("<p>")
+			for _, c := range p.Citations {
+				footnotes = append(footnotes, formatCitation(c))
+				n := len(footnotes)
+				fmt.Fprintf(&b, "<sup id=\"ref-%d\"><a href=\"#fn-%d\">%d</a></sup>", n, n, n)
+			}
+			b.WriteString("</p>\n")
+		}
+		for _, d := range full.DetailsByParagraph[p.ParagraphID] {
+			if d.Kind != DetailKindQuote || strings.TrimSpace(d.Text) == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "<blockquote><p>%s</p><footer>— %s</footer></blockquote>\n",
+				strings.ReplaceAll(html.EscapeString(strings.TrimSpace(d.Text)), "\n", "<br>"),
+				html.EscapeString(formatMinuteRange(d.TranscriptID, d.StartMinute, d.EndMinute)))
+		}
+		b.WriteString("</section>\n")
+	}
+
+	if strings.TrimSpace(graphMermaid) != "" {
+		b.WriteString("<section>\n<h2>Strukturbild</h2>\n<pre class=\"mermaid\">\n")
+		b.WriteString(html.EscapeString(graphMermaid))
+		b.WriteString("</pre>\n<script type=\"module\">import mermaid from 'https://cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.esm.min.mjs';mermaid.initialize({startOnLoad:true});</script>\n</section>\n")
+	}
+
+	if len(footnotes) > 0 {
+		b.WriteString("<ol class=\"footnotes\">\n")
+		for i, note := range footnotes {
+			fmt.Fprintf(&b, "<li id=\"fn-%d\">%s <a href=\"#ref-%d\">↩</a></li>\n", i+1, html.EscapeString(note), i+1)
+		}
+		b.WriteString("</ol>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+var (
+	mdBold   = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	mdItalic = regexp.MustCompile(`\*(.+?)\*`)
+	mdCode   = regexp.MustCompile("`([^`]+)`")
+	mdLink   = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^\s)]+)\)`)
+)
+
+// markdownToHTML handles the subset of Markdown used in paragraph bodies:
+// headings, blockquotes, bullet lists, paragraphs and inline emphasis, code
+// and http(s) links. Raw HTML in the source is escaped, never passed through.
+func markdownToHTML(src string) string {
+	var b strings.Builder
+	var para []string
+	inList := false
+	flush := func() {
+		if len(para) > 0 {
+			fmt.Fprintf(&b, "<p>%s</p>\n", strings.Join(para, "<br>\n"))
+			para = nil
+		}
+	}
+	closeList := func() {
+		if inList {
+			b.WriteString("</ul>\n")
+			inList = false
+		}
+	}
+	for _, raw := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		switch {
+		case line == "":
+			flush()
+			closeList()
+		case strings.HasPrefix(line, "#"):
+			flush()
+			closeList()
+			level := len(line) - len(strings.TrimLeft(line, "#"))
+			// Paragraph bodies sit below the h2 paragraph title.
+			level = min(max(level+2, 3), 6)
+			fmt.Fprintf(&b, "<h%d>%s</h%d>\n", level, inlineMarkdown(strings.TrimSpace(strings.TrimLeft(line, "#"))), level)
+		case strings.HasPrefix(line, ">"):
+			flush()
+			closeList()
+			fmt.Fprintf(&b, "<blockquote><p>%s</p></blockquote>\n", inlineMarkdown(strings.TrimSpace(strings.TrimPrefix(line, ">"))))
+		case strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* "):
+			flush()
+			if !inList {
+				b.WriteString("<ul>\n")
+				inList = true
+			}
+			fmt.Fprintf(&b, "<li>%s</li>\n", inlineMarkdown(strings.TrimSpace(line[2:])))
+		default:
+			closeList()
+			para = append(para, inlineMarkdown(line))
+		}
+	}
+	flush()
+	closeList()
+	return b.String()
+}
+
+func inlineMarkdown(s string) string {
+	s = html.EscapeString(s)
+	s = mdCode.ReplaceAllString(s, "<code>$1</code>")
+	s = mdLink.ReplaceAllString(s, `<a href="$2" rel="noopener noreferrer">$1</a>`)
+	s = mdBold.ReplaceAllString(s, "<strong>$1</strong>")
+	s = mdItalic.ReplaceAllString(s, "<em>$1</em>")
+	return s
+}
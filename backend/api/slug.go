@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxSlugLength keeps slugs readable in URLs; a collision counter may follow.
+const maxSlugLength = 80
+
+// slugFolds spells out the letters common in school story titles.
+var slugFolds = map[rune]string{
+	'ä': "ae", 'ö': "oe", 'ü': "ue", 'ß': "ss",
+	'à': "a", 'á': "a", 'â': "a", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ò': "o", 'ó': "o", 'ô': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ç': "c", 'ñ': "n",
+}
+
+// Slugify turns a title into a URL segment: lower case ASCII letters and
+// digits separated by single hyphens ("Soziokratie: Prüfstein" becomes
+// "soziokratie-pruefstein"). A title without any letters or digits gives "story".
+func Slugify(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(title) {
+		var part string
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			part = string(r)
+		default:
+			part = slugFolds[r]
+		}
+		if part == "" {
+			hyphen = b.Len() > 0
+			continue
+		}
+		if hyphen {
+			b.WriteByte('-')
+			hyphen = false
+		}
+		b.WriteString(part)
+	}
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+	if slug == "" {
+		return "story"
+	}
+	return slug
+}
+
+// slugReservationGrace is how long a reservation whose story was never
+// written still blocks its slug. It covers the time between reserving a slug
+// and writing the story.
+const slugReservationGrace = 5 * time.Minute
+
+// slugKey is the partition and sort key of the item that reserves slug
+// within schoolID for one story.
+func slugKey(schoolID, slug string) string {
+	return fmt.Sprintf("SLUG#%s#%s", schoolID, slug)
+}
+
+// slugRecord reserves a slug for the story OwnerID. StoryKey and ID are
+// both slugKey.
+type slugRecord struct {
+	StoryKey   string `dynamodbav:"storyId"`
+	ID         string `dynamodbav:"id"`
+	OwnerID    string `dynamodbav:"ownerId"`
+	ReservedAt int64  `dynamodbav:"reservedAt"`
+}
+
+// uniqueSlug slugifies title and reserves the slug for storyID, appending
+// -2, -3, ... while another story of the school holds it. A slug storyID
+// already holds counts as free.
+func (s *StoryService) uniqueSlug(ctx context.Context, schoolID, title, storyID string) (string, error) {
+	base := Slugify(title)
+	slug := base
+	for n := 2; ; n++ {
+		ok, err := s.claimSlug(ctx, schoolID, slug, storyID)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// claimSlug reserves slug within schoolID for storyID with a conditional put
+// and reports whether it got it. A reservation older than
+// slugReservationGrace that its story does not carry, left by a create that
+// failed, is taken over.
+func (s *StoryService) claimSlug(ctx context.Context, schoolID, slug, storyID string) (bool, error) {
+	key := slugKey(schoolID, slug)
+	item, err := attributevalue.MarshalMap(slugRecord{StoryKey: key, ID: key, OwnerID: storyID, ReservedAt: time.Now().Unix()})
+	if err != nil {
+		return false, err
+	}
+	item = s.keys.ToItem(item)
+	_, err = s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                &s.tableName,
+		Item:                     item,
+		ConditionExpression:      awsString("attribute_not_exists(#pk) OR ownerId = :sid"),
+		ExpressionAttributeNames: s.keys.Names(false),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sid": &types.AttributeValueMemberS{Value: storyID},
+		},
+	})
+	if !IsConditionalCheckFailed(err) {
+		return err == nil, err
+	}
+	held, err := s.slugReservation(ctx, schoolID, slug)
+	if err != nil || held == nil {
+		// Released in the meantime: try the next slug rather than race again.
+		return false, err
+	}
+	if time.Since(time.Unix(held.ReservedAt, 0)) < slugReservationGrace {
+		return false, nil
+	}
+	owner, err := s.getStory(ctx, held.OwnerID)
+	switch {
+	case errors.Is(err, ErrStoryNotFound):
+	case err != nil:
+		return false, err
+	case owner.SchoolID == schoolID && owner.Slug == slug:
+		return false, nil
+	}
+	_, err = s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           &s.tableName,
+		Item:                item,
+		ConditionExpression: awsString("ownerId = :owner"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: held.OwnerID},
+		},
+	})
+	if IsConditionalCheckFailed(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// slugReservation reads the reservation of slug within schoolID, nil if
+// there is none.
+func (s *StoryService) slugReservation(ctx context.Context, schoolID, slug string) (*slugRecord, error) {
+	key := slugKey(schoolID, slug)
+	res, err := s.dynamo.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &s.tableName,
+		Key:       s.keys.Key(key, key),
+	})
+	if err != nil || len(res.Item) == 0 {
+		return nil, err
+	}
+	var rec slugRecord
+	if err := attributevalue.UnmarshalMap(s.keys.FromItem(res.Item), &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// releaseSlug drops the reservation of slug within schoolID if storyID
+// holds it.
+func (s *StoryService) releaseSlug(ctx context.Context, schoolID, slug, storyID string) error {
+	if slug == "" {
+		return nil
+	}
+	key := slugKey(schoolID, slug)
+	_, err := s.dynamo.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           &s.tableName,
+		Key:                 s.keys.Key(key, key),
+		ConditionExpression: awsString("ownerId = :owner"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: storyID},
+		},
+	})
+	if IsConditionalCheckFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// StoryBySlug finds the story of schoolID that holds the reservation of slug.
+// Stories saved before slugs were reserved answer once they are re-imported.
+func (s *StoryService) StoryBySlug(ctx context.Context, schoolID, slug string) (Story, error) {
+	held, err := s.slugReservation(ctx, schoolID, slug)
+	if err != nil {
+		return Story{}, err
+	}
+	if held == nil {
+		return Story{}, ErrStoryNotFound
+	}
+	st, err := s.getStory(ctx, held.OwnerID)
+	if err != nil {
+		return Story{}, err
+	}
+	// A reservation not yet or no longer backed by its story.
+	if st.SchoolID != schoolID || st.Slug != slug {
+		return Story{}, ErrStoryNotFound
+	}
+	return st, nil
+}
+
+// HandleGetStoryBySlug returns the full story a school's slug resolves to,
+// for clean URLs in place of story ids.
+// Route: GET /api/schools/{schoolId}/stories/{slug}
+func (s *StoryService) HandleGetStoryBySlug(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	schoolID, slug := req.PathParameters["schoolId"], req.PathParameters["slug"]
+	if schoolID == "" || slug == "" {
+		return s.badInput("Missing schoolId or slug in path")
+	}
+	st, err := s.StoryBySlug(ctx, schoolID, strings.ToLower(slug))
+	if errors.Is(err, ErrStoryNotFound) {
+		return s.errorResponse(404, err.Error())
+	}
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to resolve slug: %v", err))
+	}
+	full, err := s.GetFullStory(ctx, st.StoryID)
+	if errors.Is(err, ErrStoryNotFound) {
+		return s.errorResponse(404, err.Error())
+	}
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to load story: %v", err))
+	}
+	return s.jsonResponse(200, full)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Status policy for rejected requests, shared by package main:
+//   - 400 Bad Request: the request cannot be read. The body is not JSON or
+//     does not fit the expected shape (ErrInvalidJSON), a path parameter is
+//     missing, or a query parameter or header has an invalid value.
+//   - 422 Unprocessable Entity: the body was read, but its content is not
+//     acceptable: a required field is missing or empty, a value is out of
+//     range or in the wrong format, a limit is exceeded, or it references
+//     something that does not exist.
+//
+// 404 and 409 keep their meaning for missing and conflicting resources.
+
+// StatusForBodyError classifies an error from decoding or checking a body
+// under the status policy.
+func StatusForBodyError(err error) int {
+	if errors.Is(err, ErrInvalidJSON) {
+		return 400
+	}
+	return 422
+}
+
+// badInput answers a request that cannot be read.
+func (s *StoryService) badInput(message string) (events.APIGatewayProxyResponse, error) {
+	return s.errorResponse(400, message)
+}
+
+// unprocessable answers a readable request whose content is not acceptable.
+func (s *StoryService) unprocessable(message string) (events.APIGatewayProxyResponse, error) {
+	return s.errorResponse(422, message)
+}
+
+// bodyError answers err with the status StatusForBodyError picks.
+func (s *StoryService) bodyError(err error) (events.APIGatewayProxyResponse, error) {
+	return s.errorResponse(StatusForBodyError(err), err.Error())
+}
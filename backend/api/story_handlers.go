@@ -5,15 +5,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/google/uuid"
 )
 
 // DynamoClient defines the subset of DynamoDB operations used by the story service.
@@ -23,22 +25,124 @@ type DynamoClient interface {
 	DeleteItem(context.Context, *dynamodb.DeleteItemInput, ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
 	GetItem(context.Context, *dynamodb.GetItemInput, ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
 	Scan(context.Context, *dynamodb.ScanInput, ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	TransactWriteItems(context.Context, *dynamodb.TransactWriteItemsInput, ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	BatchWriteItem(context.Context, *dynamodb.BatchWriteItemInput, ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
 }
 
 // StoryService bundles the handlers for the Story API.
 type StoryService struct {
-	dynamo     DynamoClient
-	tableName  string
-	corsSource func() map[string]string
+	dynamo         DynamoClient
+	tableName      string
+	corsSource     func() map[string]string
+	maxParagraphs  int
+	maxDetails     int
+	textLimits     TextLimits
+	keys           KeySchema
+	webhookURL     string
+	webhookClient  HTTPDoer
+	changeListener func(eventType, storyID string)
+	graphNodeIDs   func(context.Context, string) ([]string, error)
+	storyIndex     string
+	headingMode    HeadingMode
+	idPrefixes     IDPrefixes
 }
 
-func NewStoryService(client DynamoClient, tableName string, cors func() map[string]string) *StoryService {
-	return &StoryService{dynamo: client, tableName: tableName, corsSource: cors}
+// DefaultMaxParagraphs caps paragraphs per story, which all come back with
+// the full story.
+const DefaultMaxParagraphs = 500
+
+// DefaultMaxDetails caps details per paragraph, which all come back with the
+// full story.
+const DefaultMaxDetails = 200
+
+// NewStoryService requires a client and a table name. A nil cors falls back
+// to DefaultCORSHeaders, so responses never lose their CORS headers.
+func NewStoryService(client DynamoClient, tableName string, cors func() map[string]string) (*StoryService, error) {
+	if client == nil {
+		return nil, errors.New("story service needs a DynamoDB client")
+	}
+	if strings.TrimSpace(tableName) == "" {
+		return nil, errors.New("story service needs a table name")
+	}
+	if cors == nil {
+		cors = DefaultCORSHeaders
+	}
+	return &StoryService{dynamo: client, tableName: tableName, corsSource: cors, maxParagraphs: DefaultMaxParagraphs, maxDetails: DefaultMaxDetails, textLimits: DefaultTextLimits, keys: DefaultKeySchema, idPrefixes: DefaultIDPrefixes}, nil
+}
+
+// DefaultCORSHeaders allows any origin; it is used when no cors source is given.
+func DefaultCORSHeaders() map[string]string {
+	return map[string]string{
+		"Access-Control-Allow-Origin":  "*",
+		"Access-Control-Allow-Headers": "Content-Type, Authorization",
+		"Access-Control-Allow-Methods": "OPTIONS,GET,POST,DELETE,PATCH",
+	}
+}
+
+// SetKeySchema points the service at a table whose key attributes are named differently.
+func (s *StoryService) SetKeySchema(k KeySchema) {
+	s.keys = k
+}
+
+// SetGraphNodeSource lets the service look up the node ids of a story's graph,
+// which lives outside the STORY# partition. Without it no node checks are made.
+func (s *StoryService) SetGraphNodeSource(fn func(ctx context.Context, storyID string) ([]string, error)) {
+	s.graphNodeIDs = fn
+}
+
+// SetStoryIndex names a GSI keyed on recordType that lists story headers;
+// ListStories queries it instead of scanning the table. Story records written
+// before the index existed must be re-saved (e.g. re-imported) to appear.
+func (s *StoryService) SetStoryIndex(name string) {
+	s.storyIndex = name
+}
+
+// SetMaxParagraphs overrides the per-story paragraph limit; n < 1 keeps the default.
+func (s *StoryService) SetMaxParagraphs(n int) {
+	if n < 1 {
+		n = DefaultMaxParagraphs
+	}
+	s.maxParagraphs = n
+}
+
+// SetMaxDetails overrides the per-paragraph detail limit; n < 1 keeps the default.
+func (s *StoryService) SetMaxDetails(n int) {
+	if n < 1 {
+		n = DefaultMaxDetails
+	}
+	s.maxDetails = n
 }
 
 // ErrStoryNotFound is returned when no story bundle exists for the requested ID.
 var ErrStoryNotFound = errors.New("story not found")
 
+// ErrParagraphNotFound is returned when a paragraph does not exist within the
+// story it was addressed through.
+var ErrParagraphNotFound = errors.New("paragraph not found")
+
+// ErrStoryIncomplete is returned when a new story lacks its schoolId or title.
+var ErrStoryIncomplete = errors.New("schoolId and title are required")
+
+// IsConditionalCheckFailed reports whether err is DynamoDB rejecting a write
+// because its ConditionExpression did not hold. Callers map it to 404, 409 or
+// 412 depending on what the condition guarded, instead of a generic 500.
+// A transaction cancelled by a failed condition counts as well.
+func IsConditionalCheckFailed(err error) bool {
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return true
+	}
+	var tce *types.TransactionCanceledException
+	if errors.As(err, &tce) {
+		for _, r := range tce.CancellationReasons {
+			if r.Code != nil && *r.Code == "ConditionalCheckFailed" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Data model payloads --------------------------------------------------------
 
 type Story struct {
@@ -47,7 +151,26 @@ type Story struct {
 	Title            string              `json:"title"`
 	CreatedAt        string              `json:"createdAt,omitempty"`
 	UpdatedAt        string              `json:"updatedAt,omitempty"`
+	UpdatedBy        string              `json:"updatedBy,omitempty" dynamodbav:"updatedBy,omitempty"`
 	ParagraphNodeMap map[string][]string `json:"paragraphNodeMap,omitempty" dynamodbav:"paragraphNodeMap,omitempty"`
+	Status           string              `json:"status,omitempty" dynamodbav:"status,omitempty"`
+	// TimeAnchor is the calendar date of T0 for relative node times.
+	TimeAnchor string `json:"timeAnchor,omitempty" dynamodbav:"timeAnchor,omitempty"`
+	// Slug names the story within its school in clean URLs; it is set once
+	// and kept when the title changes, so links stay valid.
+	Slug string `json:"slug,omitempty" dynamodbav:"slug,omitempty"`
+}
+
+// Story visibility states. Stories stored before statuses existed have no
+// status and are treated as published.
+const (
+	StoryStatusDraft     = "draft"
+	StoryStatusPublished = "published"
+)
+
+// IsDraft reports whether the story is hidden from default listings.
+func (st Story) IsDraft() bool {
+	return st.Status == StoryStatusDraft
 }
 
 type Citation struct {
@@ -64,6 +187,9 @@ type Paragraph struct {
 	Citations   []Citation `json:"citations"`
 	CreatedAt   string     `json:"createdAt,omitempty"`
 	UpdatedAt   string     `json:"updatedAt,omitempty"`
+	UpdatedBy   string     `json:"updatedBy,omitempty"`
+	// Truncated marks a BodyMd shortened by ?bodyPreview=.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 type Detail struct {
@@ -75,22 +201,41 @@ type Detail struct {
 	StartMinute  int    `json:"startMinute"`
 	EndMinute    int    `json:"endMinute"`
 	Text         string `json:"text"`
+	UpdatedBy    string `json:"updatedBy,omitempty"`
+	// Attachment is set on details of kind "attachment".
+	Attachment *Attachment `json:"attachment,omitempty"`
 }
 
 type StoryFull struct {
 	Story              Story               `json:"story"`
 	Paragraphs         []Paragraph         `json:"paragraphs"`
 	DetailsByParagraph map[string][]Detail `json:"detailsByParagraph"`
+	// DetailTotals is set by ?detailLimit= for paragraphs whose details were
+	// cut; the rest is paged via GET /api/paragraphs/{paragraphId}/details.
+	DetailTotals map[string]int `json:"detailTotals,omitempty"`
 }
 
 // Internal representations used for DynamoDB marshaling ----------------------
 
 type storyRecord struct {
-	StoryKey string `dynamodbav:"storyId"`
-	ID       string `dynamodbav:"id"`
+	StoryKey   string `dynamodbav:"storyId"`
+	ID         string `dynamodbav:"id"`
+	RecordType string `dynamodbav:"recordType,omitempty"`
 	Story
 }
 
+// storyRecordType marks story headers; it is the partition key of the sparse
+// stories index, which paragraphs, details and graph items never enter.
+const storyRecordType = "STORY"
+
+// maxListPages bounds how many Query/Scan pages a story listing follows.
+const maxListPages = 100
+
+func newStoryRecord(storyID string, story Story) storyRecord {
+	key := fmt.Sprintf("STORY#%s", storyID)
+	return storyRecord{StoryKey: key, ID: key, RecordType: storyRecordType, Story: story}
+}
+
 type paragraphRecord struct {
 	StoryKey    string     `dynamodbav:"storyId"`
 	ID          string     `dynamodbav:"id"`
@@ -102,87 +247,146 @@ type paragraphRecord struct {
 	Citations   []Citation `dynamodbav:"citations"`
 	CreatedAt   string     `dynamodbav:"createdAt"`
 	UpdatedAt   string     `dynamodbav:"updatedAt"`
+	UpdatedBy   string     `dynamodbav:"updatedBy,omitempty"`
 }
 
 type detailRecord struct {
-	StoryKey     string `dynamodbav:"storyId"`
-	ID           string `dynamodbav:"id"`
-	DetailID     string `dynamodbav:"detailId"`
-	StoryID      string `dynamodbav:"storyIdPlain,omitempty"`
-	ParagraphID  string `dynamodbav:"paragraphId"`
-	Kind         string `dynamodbav:"kind"`
-	TranscriptID string `dynamodbav:"transcriptId"`
-	StartMinute  int    `dynamodbav:"startMinute"`
-	EndMinute    int    `dynamodbav:"endMinute"`
-	Text         string `dynamodbav:"text"`
+	StoryKey     string      `dynamodbav:"storyId"`
+	ID           string      `dynamodbav:"id"`
+	DetailID     string      `dynamodbav:"detailId"`
+	StoryID      string      `dynamodbav:"storyIdPlain,omitempty"`
+	ParagraphID  string      `dynamodbav:"paragraphId"`
+	Kind         string      `dynamodbav:"kind"`
+	TranscriptID string      `dynamodbav:"transcriptId"`
+	StartMinute  int         `dynamodbav:"startMinute"`
+	EndMinute    int         `dynamodbav:"endMinute"`
+	Text         string      `dynamodbav:"text"`
+	UpdatedBy    string      `dynamodbav:"updatedBy,omitempty"`
+	Attachment   *Attachment `dynamodbav:"attachment,omitempty"`
 }
 
 // Handler entrypoints --------------------------------------------------------
 
+// NewStoryPut validates a story about to be created and returns its id with
+// the put that writes it, guarded so it cannot overwrite an existing story.
+// A blank storyID gets a generated one, and the story a slug unique within
+// its school. Validation fails with ErrStoryIncomplete or a *LengthError.
+func (s *StoryService) NewStoryPut(ctx context.Context, storyID, schoolID, title string) (string, *types.Put, error) {
+	if strings.TrimSpace(schoolID) == "" || strings.TrimSpace(title) == "" {
+		return "", nil, ErrStoryIncomplete
+	}
+	if err := CheckLength("title", title, s.textLimits.Title); err != nil {
+		return "", nil, err
+	}
+	if strings.TrimSpace(storyID) == "" {
+		storyID = newID(s.idPrefixes.Story)
+	}
+	slug, err := s.uniqueSlug(ctx, schoolID, title, storyID)
+	if err != nil {
+		return "", nil, err
+	}
+	now := NowRFC3339UTC()
+	record := newStoryRecord(storyID, Story{
+		StoryID:   storyID,
+		SchoolID:  schoolID,
+		Title:     title,
+		Slug:      slug,
+		CreatedAt: now,
+		UpdatedAt: now,
+		UpdatedBy: ActorFromContext(ctx),
+		Status:    StoryStatusDraft,
+	})
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return "", nil, err
+	}
+	return storyID, &types.Put{
+		TableName:                &s.tableName,
+		Item:                     s.keys.ToItem(item),
+		ConditionExpression:      awsString("attribute_not_exists(#pk)"),
+		ExpressionAttributeNames: s.keys.Names(false),
+	}, nil
+}
+
 func (s *StoryService) HandleCreateStory(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var payload struct {
 		StoryID  string `json:"storyId"`
 		SchoolID string `json:"schoolId"`
 		Title    string `json:"title"`
 	}
-	if err := json.Unmarshal([]byte(req.Body), &payload); err != nil {
-		return s.errorResponse(400, "Invalid JSON payload")
-	}
-	if strings.TrimSpace(payload.SchoolID) == "" || strings.TrimSpace(payload.Title) == "" {
-		return s.errorResponse(400, "schoolId and title are required")
+	if err := DecodeJSON(req.Body, &payload); err != nil {
+		return s.badInput(err.Error())
 	}
-	storyID := payload.StoryID
-	if strings.TrimSpace(storyID) == "" {
-		storyID = fmt.Sprintf("story-%s", uuid.New().String())
-	}
-	now := time.Now().UTC().Format(time.RFC3339)
-	record := storyRecord{
-		StoryKey: fmt.Sprintf("STORY#%s", storyID),
-		ID:       fmt.Sprintf("STORY#%s", storyID),
-		Story: Story{
-			StoryID:   storyID,
-			SchoolID:  payload.SchoolID,
-			Title:     payload.Title,
-			CreatedAt: now,
-			UpdatedAt: now,
-		},
-	}
-	item, err := attributevalue.MarshalMap(record)
-	if err != nil {
-		return s.errorResponse(500, "Failed to marshal story")
+	storyID, put, err := s.NewStoryPut(ctx, payload.StoryID, payload.SchoolID, payload.Title)
+	var lengthErr *LengthError
+	switch {
+	case errors.Is(err, ErrStoryIncomplete):
+		return s.unprocessable(err.Error())
+	case errors.As(err, &lengthErr):
+		return s.unprocessable(err.Error())
+	case err != nil:
+		return s.errorResponse(500, fmt.Sprintf("Failed to prepare story: %v", err))
 	}
+	// An explicit storyId must not overwrite an existing story.
 	_, err = s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: &s.tableName,
-		Item:      item,
+		TableName:                put.TableName,
+		Item:                     put.Item,
+		ConditionExpression:      put.ConditionExpression,
+		ExpressionAttributeNames: put.ExpressionAttributeNames,
 	})
+	if IsConditionalCheckFailed(err) {
+		return s.errorResponse(409, fmt.Sprintf("story %s already exists", storyID))
+	}
 	if err != nil {
 		return s.errorResponse(500, fmt.Sprintf("Failed to save story: %v", err))
 	}
-	return s.jsonResponse(200, map[string]string{"id": storyID})
+	s.NotifyChange(ctx, EventStoryCreated, storyID)
+	return s.createdResponse(storyID, nil)
 }
 
 func (s *StoryService) HandleCreateParagraph(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	storyID := req.PathParameters["storyId"]
 	if storyID == "" {
-		return s.errorResponse(400, "Missing storyId in path")
+		return s.badInput("Missing storyId in path")
+	}
+	version, err := RequestAPIVersion(req)
+	if err != nil {
+		return s.badInput(err.Error())
 	}
 	var payload struct {
-		Index     int        `json:"index"`
-		Title     string     `json:"title"`
-		BodyMd    string     `json:"bodyMd"`
-		Citations []Citation `json:"citations"`
+		Index     int             `json:"index"`
+		Title     string          `json:"title"`
+		BodyMd    string          `json:"bodyMd"`
+		Citations json.RawMessage `json:"citations"`
 	}
-	if err := json.Unmarshal([]byte(req.Body), &payload); err != nil {
-		return s.errorResponse(400, "Invalid JSON payload")
+	if err := DecodeJSON(req.Body, &payload); err != nil {
+		return s.badInput(err.Error())
 	}
 	if payload.Index < 1 {
-		return s.errorResponse(400, "index must be >= 1")
+		return s.unprocessable("index must be >= 1")
+	}
+	if err := s.checkParagraphText("", &payload.Title, &payload.BodyMd); err != nil {
+		return s.unprocessable(err.Error())
 	}
-	if err := validateCitations(payload.Citations); err != nil {
-		return s.errorResponse(400, err.Error())
+	citations, err := decodeCitations(version, payload.Citations)
+	if err != nil {
+		return s.bodyError(err)
+	}
+	if err := validateCitations(citations); err != nil {
+		return s.unprocessable(err.Error())
+	}
+	_, existing, _, err := s.fetchStoryBundle(ctx, storyID)
+	if errors.Is(err, ErrStoryNotFound) {
+		return s.errorResponse(404, err.Error())
+	}
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to load story: %v", err))
 	}
-	paragraphID := fmt.Sprintf("para-%s", uuid.New().String())
-	now := time.Now().UTC().Format(time.RFC3339)
+	if len(existing) >= s.maxParagraphs {
+		return s.unprocessable(fmt.Sprintf("story already has %d paragraphs (limit %d)", len(existing), s.maxParagraphs))
+	}
+	paragraphID := newID(s.idPrefixes.Paragraph)
+	now := NowRFC3339UTC()
 	record := paragraphRecord{
 		StoryKey:    fmt.Sprintf("STORY#%s", storyID),
 		ID:          paragraphSortKey(payload.Index, paragraphID),
@@ -190,10 +394,11 @@ func (s *StoryService) HandleCreateParagraph(ctx context.Context, req events.API
 		StoryID:     storyID,
 		Index:       payload.Index,
 		Title:       strings.TrimSpace(payload.Title),
-		BodyMd:      payload.BodyMd,
-		Citations:   payload.Citations,
+		BodyMd:      NormalizeHeadings(payload.Title, payload.BodyMd, s.headingMode),
+		Citations:   citationsOrEmpty(citations),
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		UpdatedBy:   ActorFromContext(ctx),
 	}
 	item, err := attributevalue.MarshalMap(record)
 	if err != nil {
@@ -201,26 +406,33 @@ func (s *StoryService) HandleCreateParagraph(ctx context.Context, req events.API
 	}
 	_, err = s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: &s.tableName,
-		Item:      item,
+		Item:      s.keys.ToItem(item),
 	})
 	if err != nil {
 		return s.errorResponse(500, fmt.Sprintf("Failed to save paragraph: %v", err))
 	}
+	s.NotifyChange(ctx, EventStoryUpdated, storyID)
 	return s.jsonResponse(200, map[string]string{"id": paragraphID})
 }
 
 func (s *StoryService) HandleUpdateStory(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	storyID := req.PathParameters["storyId"]
 	if strings.TrimSpace(storyID) == "" {
-		return s.errorResponse(400, "Missing storyId in path")
+		return s.badInput("Missing storyId in path")
 	}
 
 	var payload struct {
 		Title            *string              `json:"title"`
 		ParagraphNodeMap *map[string][]string `json:"paragraphNodeMap"`
+		TimeAnchor       *string              `json:"timeAnchor"`
+	}
+	if err := DecodeJSON(req.Body, &payload); err != nil {
+		return s.badInput(err.Error())
 	}
-	if err := json.Unmarshal([]byte(req.Body), &payload); err != nil {
-		return s.errorResponse(400, "Invalid JSON payload")
+	if payload.TimeAnchor != nil && strings.TrimSpace(*payload.TimeAnchor) != "" {
+		if _, err := ParseTimelineDate(*payload.TimeAnchor); err != nil {
+			return s.unprocessable(fmt.Sprintf("timeAnchor: %v", err))
+		}
 	}
 
 	story, paragraphs, _, err := s.fetchStoryBundle(ctx, storyID)
@@ -234,7 +446,10 @@ func (s *StoryService) HandleUpdateStory(ctx context.Context, req events.APIGate
 	if payload.Title != nil {
 		newTitle := strings.TrimSpace(*payload.Title)
 		if newTitle == "" {
-			return s.errorResponse(400, "title cannot be empty")
+			return s.unprocessable("title cannot be empty")
+		}
+		if err := CheckLength("title", newTitle, s.textLimits.Title); err != nil {
+			return s.unprocessable(err.Error())
 		}
 		if newTitle != story.Title {
 			updated.Title = newTitle
@@ -242,6 +457,13 @@ func (s *StoryService) HandleUpdateStory(ctx context.Context, req events.APIGate
 		}
 	}
 
+	if payload.TimeAnchor != nil {
+		if anchor := strings.TrimSpace(*payload.TimeAnchor); anchor != story.TimeAnchor {
+			updated.TimeAnchor = anchor
+			changed = true
+		}
+	}
+
 	if cleaned, apply := sanitizeParagraphNodeMap(payload.ParagraphNodeMap, paragraphs); apply {
 		updated.ParagraphNodeMap = cleaned
 		changed = true
@@ -252,15 +474,12 @@ func (s *StoryService) HandleUpdateStory(ctx context.Context, req events.APIGate
 	}
 
 	if strings.TrimSpace(updated.CreatedAt) == "" {
-		updated.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+		updated.CreatedAt = NowRFC3339UTC()
 	}
-	updated.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	updated.UpdatedAt = NowRFC3339UTC()
+	updated.UpdatedBy = ActorFromContext(ctx)
 
-	record := storyRecord{
-		StoryKey: fmt.Sprintf("STORY#%s", storyID),
-		ID:       fmt.Sprintf("STORY#%s", storyID),
-		Story:    updated,
-	}
+	record := newStoryRecord(storyID, updated)
 
 	item, err := attributevalue.MarshalMap(record)
 	if err != nil {
@@ -269,45 +488,71 @@ func (s *StoryService) HandleUpdateStory(ctx context.Context, req events.APIGate
 
 	if _, err := s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: &s.tableName,
-		Item:      item,
+		Item:      s.keys.ToItem(item),
 	}); err != nil {
 		return s.errorResponse(500, fmt.Sprintf("Failed to save story: %v", err))
 	}
+	s.NotifyChange(ctx, EventStoryUpdated, storyID)
 
 	return s.jsonResponse(200, map[string]string{"id": storyID})
 }
 
+// HandleUpdateParagraph patches a paragraph. Moving it to an index another
+// paragraph holds answers 409, unless ?swap=true, which exchanges the two
+// indexes in one transaction.
 func (s *StoryService) HandleUpdateParagraph(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	paragraphID := req.PathParameters["paragraphId"]
 	if paragraphID == "" {
-		return s.errorResponse(400, "Missing paragraphId in path")
+		return s.badInput("Missing paragraphId in path")
+	}
+	version, err := RequestAPIVersion(req)
+	if err != nil {
+		return s.badInput(err.Error())
 	}
 	var payload struct {
-		StoryID   string      `json:"storyId"`
-		Index     *int        `json:"index"`
-		Title     *string     `json:"title"`
-		BodyMd    *string     `json:"bodyMd"`
-		Citations *[]Citation `json:"citations"`
+		StoryID   string          `json:"storyId"`
+		Index     *int            `json:"index"`
+		Title     *string         `json:"title"`
+		BodyMd    *string         `json:"bodyMd"`
+		Citations json.RawMessage `json:"citations"`
 	}
-	if err := json.Unmarshal([]byte(req.Body), &payload); err != nil {
-		return s.errorResponse(400, "Invalid JSON payload")
+	if err := DecodeJSON(req.Body, &payload); err != nil {
+		return s.badInput(err.Error())
 	}
 	if strings.TrimSpace(payload.StoryID) == "" {
-		return s.errorResponse(400, "storyId is required in body")
+		return s.unprocessable("storyId is required in body")
 	}
 	if payload.Index != nil && *payload.Index < 1 {
-		return s.errorResponse(400, "index must be >= 1")
+		return s.unprocessable("index must be >= 1")
 	}
-	if payload.Citations != nil {
-		if err := validateCitations(*payload.Citations); err != nil {
-			return s.errorResponse(400, err.Error())
-		}
+	if err := s.checkParagraphText("", payload.Title, payload.BodyMd); err != nil {
+		return s.unprocessable(err.Error())
 	}
-	existing, err := s.getParagraph(ctx, payload.StoryID, paragraphID)
+	citations, err := decodeCitations(version, payload.Citations)
 	if err != nil {
+		return s.bodyError(err)
+	}
+	if err := validateCitations(citations); err != nil {
+		return s.unprocessable(err.Error())
+	}
+	existing, err := s.getParagraph(ctx, payload.StoryID, paragraphID)
+	if errors.Is(err, ErrParagraphNotFound) {
 		return s.errorResponse(404, err.Error())
 	}
-	if payload.Index != nil {
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to load paragraph: %v", err))
+	}
+	before := *existing
+	oldIndex := existing.Index
+	var displaced *paragraphRecord
+	if payload.Index != nil && *payload.Index != oldIndex {
+		displaced, err = s.paragraphAtIndex(ctx, existing.StoryID, *payload.Index, existing.ParagraphID)
+		if err != nil {
+			return s.errorResponse(500, fmt.Sprintf("Failed to check paragraph index: %v", err))
+		}
+		if displaced != nil && req.QueryStringParameters["swap"] != "true" {
+			return s.errorResponse(409, fmt.Sprintf("index %d is taken by paragraph %s (use ?swap=true to exchange)", *payload.Index, displaced.ParagraphID))
+		}
 		existing.Index = *payload.Index
 	}
 	if payload.Title != nil {
@@ -316,10 +561,14 @@ func (s *StoryService) HandleUpdateParagraph(ctx context.Context, req events.API
 	if payload.BodyMd != nil {
 		existing.BodyMd = *payload.BodyMd
 	}
-	if payload.Citations != nil {
-		existing.Citations = *payload.Citations
+	if payload.Title != nil || payload.BodyMd != nil {
+		existing.BodyMd = NormalizeHeadings(existing.Title, existing.BodyMd, s.headingMode)
 	}
-	existing.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if citations != nil {
+		existing.Citations = citations
+	}
+	existing.UpdatedAt = NowRFC3339UTC()
+	existing.UpdatedBy = ActorFromContext(ctx)
 	newID := paragraphSortKey(existing.Index, existing.ParagraphID)
 	newRecord := paragraphRecord{
 		StoryKey:    fmt.Sprintf("STORY#%s", existing.StoryID),
@@ -329,17 +578,28 @@ func (s *StoryService) HandleUpdateParagraph(ctx context.Context, req events.API
 		Index:       existing.Index,
 		Title:       existing.Title,
 		BodyMd:      existing.BodyMd,
-		Citations:   existing.Citations,
+		Citations:   citationsOrEmpty(existing.Citations),
 		CreatedAt:   existing.CreatedAt,
 		UpdatedAt:   existing.UpdatedAt,
+		UpdatedBy:   existing.UpdatedBy,
 	}
 	item, err := attributevalue.MarshalMap(newRecord)
 	if err != nil {
 		return s.errorResponse(500, "Failed to marshal paragraph")
 	}
+	if displaced != nil {
+		displacedBefore := *displaced
+		if err := s.swapParagraphIndexes(ctx, existing.ID, item, displaced, oldIndex); err != nil {
+			return s.errorResponse(500, fmt.Sprintf("Failed to swap paragraphs: %v", err))
+		}
+		s.recordParagraphChange(ctx, before, newRecord)
+		s.recordParagraphChange(ctx, displacedBefore, *displaced)
+		s.NotifyChange(ctx, EventStoryUpdated, existing.StoryID)
+		return s.jsonResponse(200, map[string]string{"id": existing.ParagraphID, "swappedWith": displaced.ParagraphID})
+	}
 	_, err = s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: &s.tableName,
-		Item:      item,
+		Item:      s.keys.ToItem(item),
 	})
 	if err != nil {
 		return s.errorResponse(500, fmt.Sprintf("Failed to update paragraph: %v", err))
@@ -347,41 +607,101 @@ func (s *StoryService) HandleUpdateParagraph(ctx context.Context, req events.API
 	if newID != existing.ID {
 		_, _ = s.dynamo.DeleteItem(ctx, &dynamodb.DeleteItemInput{
 			TableName: &s.tableName,
-			Key: map[string]types.AttributeValue{
-				"storyId": &types.AttributeValueMemberS{Value: fmt.Sprintf("STORY#%s", existing.StoryID)},
-				"id":      &types.AttributeValueMemberS{Value: existing.ID},
-			},
+			Key:       s.keys.Key(fmt.Sprintf("STORY#%s", existing.StoryID), existing.ID),
 		})
 	}
+	s.recordParagraphChange(ctx, before, newRecord)
+	s.NotifyChange(ctx, EventStoryUpdated, existing.StoryID)
 	return s.jsonResponse(200, map[string]string{"id": existing.ParagraphID})
 }
 
+// paragraphAtIndex returns the paragraph of storyID at index other than
+// exclude, or nil if the index is free.
+func (s *StoryService) paragraphAtIndex(ctx context.Context, storyID string, index int, exclude string) (*paragraphRecord, error) {
+	_, paragraphs, _, err := s.fetchStoryBundle(ctx, storyID)
+	if err != nil && !errors.Is(err, ErrStoryNotFound) {
+		return nil, err
+	}
+	for _, p := range paragraphs {
+		if p.Index == index && p.ParagraphID != exclude {
+			return s.getParagraph(ctx, storyID, p.ParagraphID)
+		}
+	}
+	return nil, nil
+}
+
+// swapParagraphIndexes writes the moved paragraph (item, previously stored
+// under oldKey) and moves other to index in a single transaction, so readers
+// never see both paragraphs at the same index.
+func (s *StoryService) swapParagraphIndexes(ctx context.Context, oldKey string, item map[string]types.AttributeValue, other *paragraphRecord, index int) error {
+	pk := other.StoryKey
+	otherOldKey := other.ID
+	other.Index = index
+	other.ID = paragraphSortKey(index, other.ParagraphID)
+	other.UpdatedAt = NowRFC3339UTC()
+	other.UpdatedBy = ActorFromContext(ctx)
+	otherItem, err := attributevalue.MarshalMap(other)
+	if err != nil {
+		return err
+	}
+	_, err = s.dynamo.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{TableName: &s.tableName, Item: s.keys.ToItem(item)}},
+			{Delete: &types.Delete{TableName: &s.tableName, Key: s.keys.Key(pk, oldKey)}},
+			{Put: &types.Put{TableName: &s.tableName, Item: s.keys.ToItem(otherItem)}},
+			{Delete: &types.Delete{TableName: &s.tableName, Key: s.keys.Key(pk, otherOldKey)}},
+		},
+	})
+	return err
+}
+
 func (s *StoryService) HandleCreateDetail(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	paragraphID := req.PathParameters["paragraphId"]
 	if paragraphID == "" {
-		return s.errorResponse(400, "Missing paragraphId in path")
+		return s.badInput("Missing paragraphId in path")
 	}
-	var payload struct {
-		StoryID      string `json:"storyId"`
-		Kind         string `json:"kind"`
-		TranscriptID string `json:"transcriptId"`
-		StartMinute  int    `json:"startMinute"`
-		EndMinute    int    `json:"endMinute"`
-		Text         string `json:"text"`
+	version, err := RequestAPIVersion(req)
+	if err != nil {
+		return s.badInput(err.Error())
 	}
-	if err := json.Unmarshal([]byte(req.Body), &payload); err != nil {
-		return s.errorResponse(400, "Invalid JSON payload")
+	var payload struct {
+		StoryID      string      `json:"storyId"`
+		Kind         string      `json:"kind"`
+		TranscriptID string      `json:"transcriptId"`
+		StartMinute  int         `json:"startMinute"`
+		EndMinute    int         `json:"endMinute"`
+		Range        *TimeRange  `json:"range"`
+		Text         string      `json:"text"`
+		Attachment   *Attachment `json:"attachment"`
+	}
+	if err := DecodeJSON(req.Body, &payload); err != nil {
+		return s.badInput(err.Error())
 	}
 	if strings.TrimSpace(payload.StoryID) == "" {
-		return s.errorResponse(400, "storyId is required in body")
+		return s.unprocessable("storyId is required in body")
+	}
+	payload.Kind = strings.TrimSpace(payload.Kind)
+	if err := validateDetailAttachment(payload.Kind, payload.Attachment); err != nil {
+		return s.unprocessable(err.Error())
 	}
-	if strings.TrimSpace(payload.Kind) != "quote" {
-		return s.errorResponse(400, "kind must be 'quote'")
+	payload.StartMinute, payload.EndMinute, err = decodeDetailMinutes(version, payload.StartMinute, payload.EndMinute, payload.Range)
+	if err != nil {
+		return s.unprocessable(fmt.Sprintf("range: %v", err))
 	}
 	if payload.StartMinute < 0 || payload.EndMinute < 0 {
-		return s.errorResponse(400, "startMinute and endMinute must be >= 0")
+		return s.unprocessable("startMinute and endMinute must be >= 0")
 	}
-	detailID := fmt.Sprintf("det-%s", uuid.New().String())
+	if _, err := s.getParagraph(ctx, payload.StoryID, paragraphID); errors.Is(err, ErrParagraphNotFound) {
+		return s.errorResponse(404, err.Error())
+	} else if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to load paragraph: %v", err))
+	}
+	if n, err := s.countDetails(ctx, payload.StoryID, paragraphID); err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to count details: %v", err))
+	} else if n >= s.maxDetails {
+		return s.unprocessable(fmt.Sprintf("paragraph already has %d details (limit %d)", n, s.maxDetails))
+	}
+	detailID := newID(s.idPrefixes.Detail)
 	record := detailRecord{
 		StoryKey:     fmt.Sprintf("STORY#%s", payload.StoryID),
 		ID:           fmt.Sprintf("DET#%s#%s", paragraphID, detailID),
@@ -393,6 +713,8 @@ func (s *StoryService) HandleCreateDetail(ctx context.Context, req events.APIGat
 		StartMinute:  payload.StartMinute,
 		EndMinute:    payload.EndMinute,
 		Text:         payload.Text,
+		UpdatedBy:    ActorFromContext(ctx),
+		Attachment:   payload.Attachment,
 	}
 	item, err := attributevalue.MarshalMap(record)
 	if err != nil {
@@ -400,42 +722,184 @@ func (s *StoryService) HandleCreateDetail(ctx context.Context, req events.APIGat
 	}
 	_, err = s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: &s.tableName,
-		Item:      item,
+		Item:      s.keys.ToItem(item),
 	})
 	if err != nil {
 		return s.errorResponse(500, fmt.Sprintf("Failed to save detail: %v", err))
 	}
+	s.NotifyChange(ctx, EventStoryUpdated, payload.StoryID)
 	return s.jsonResponse(200, map[string]string{"id": detailID})
 }
 
+// Sections of a full story that ?include= can select. The graph lives outside
+// the story partition and is added by the router (see getFullStoryHandler).
+const (
+	SectionParagraphs = "paragraphs"
+	SectionDetails    = "details"
+	SectionGraph      = "graph"
+	SectionNodeMap    = "nodeMap"
+)
+
+// ParseFullStoryInclude reads ?include=paragraphs,details,graph,nodeMap. An
+// absent or empty value selects the sections the response always had:
+// everything but the graph.
+func ParseFullStoryInclude(query map[string]string) (map[string]bool, error) {
+	raw := strings.TrimSpace(query["include"])
+	if raw == "" {
+		return map[string]bool{SectionParagraphs: true, SectionDetails: true, SectionNodeMap: true}, nil
+	}
+	include := map[string]bool{}
+	for _, token := range strings.Split(raw, ",") {
+		switch token = strings.TrimSpace(token); token {
+		case SectionParagraphs, SectionDetails, SectionGraph, SectionNodeMap:
+			include[token] = true
+		case "":
+		default:
+			return nil, fmt.Errorf("Unknown include %q (supported: %s, %s, %s, %s)", token, SectionParagraphs, SectionDetails, SectionGraph, SectionNodeMap)
+		}
+	}
+	return include, nil
+}
+
+// HandleGetFullStory returns a story with its paragraphs, details and
+// paragraphNodeMap. ?include= narrows the response to the listed sections;
+// the story header is always sent.
+// Route: GET /api/stories/{storyId}/full?include=&detailLimit=&bodyPreview=
 func (s *StoryService) HandleGetFullStory(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	storyID := req.PathParameters["storyId"]
 	if storyID == "" {
-		return s.errorResponse(400, "Missing storyId in path")
+		return s.badInput("Missing storyId in path")
+	}
+	include, err := ParseFullStoryInclude(req.QueryStringParameters)
+	if err != nil {
+		return s.badInput(err.Error())
+	}
+	detailLimit := 0
+	if v := req.QueryStringParameters["detailLimit"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return s.badInput("detailLimit must be a positive integer")
+		}
+		detailLimit = n
+	}
+	preview, err := ParseBodyPreview(req.QueryStringParameters)
+	if err != nil {
+		return s.badInput(err.Error())
 	}
 	full, err := s.GetFullStory(ctx, storyID)
 	if err != nil {
 		return s.errorResponse(404, err.Error())
 	}
-	return s.jsonResponse(200, full)
+	if preview > 0 {
+		for i := range full.Paragraphs {
+			full.Paragraphs[i].BodyMd, full.Paragraphs[i].Truncated = TruncateBody(full.Paragraphs[i].BodyMd, preview)
+		}
+	}
+	if detailLimit > 0 {
+		for pid, details := range full.DetailsByParagraph {
+			if len(details) <= detailLimit {
+				continue
+			}
+			if full.DetailTotals == nil {
+				full.DetailTotals = map[string]int{}
+			}
+			full.DetailTotals[pid] = len(details)
+			full.DetailsByParagraph[pid] = details[:detailLimit]
+		}
+	}
+	if strings.TrimSpace(req.QueryStringParameters["include"]) == "" {
+		return s.jsonResponse(200, full)
+	}
+	// A projection lists exactly the requested sections, empty ones included;
+	// the node map stays part of the story header.
+	if !include[SectionNodeMap] {
+		full.Story.ParagraphNodeMap = nil
+	}
+	out := map[string]interface{}{"story": full.Story}
+	if include[SectionParagraphs] {
+		out["paragraphs"] = full.Paragraphs
+	}
+	if include[SectionDetails] {
+		out["detailsByParagraph"] = full.DetailsByParagraph
+		if full.DetailTotals != nil {
+			out["detailTotals"] = full.DetailTotals
+		}
+	}
+	return s.jsonResponse(200, out)
 }
 
+// HandleListDetails pages the details of one paragraph with ?limit=&cursor=.
+// Route: GET /api/paragraphs/{paragraphId}/details?storyId=
+func (s *StoryService) HandleListDetails(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	paragraphID := req.PathParameters["paragraphId"]
+	if paragraphID == "" {
+		return s.badInput("Missing paragraphId in path")
+	}
+	storyID := strings.TrimSpace(req.QueryStringParameters["storyId"])
+	if storyID == "" {
+		return s.badInput("storyId query parameter is required")
+	}
+	limit, offset, err := ParsePageParams(req.QueryStringParameters)
+	if err != nil {
+		return s.badInput(err.Error())
+	}
+	_, paragraphs, details, err := s.fetchStoryBundle(ctx, storyID)
+	if err != nil && !errors.Is(err, ErrStoryNotFound) {
+		return s.errorResponse(500, fmt.Sprintf("Failed to load story: %v", err))
+	}
+	found := false
+	for _, p := range paragraphs {
+		found = found || p.ParagraphID == paragraphID
+	}
+	if !found {
+		return s.errorResponse(404, ErrParagraphNotFound.Error())
+	}
+	var matching []Detail
+	for _, d := range details {
+		if d.ParagraphID == paragraphID {
+			matching = append(matching, d)
+		}
+	}
+	return s.jsonResponse(200, Paginate(matching, limit, offset))
+}
+
+// HandleListStories lists published stories; ?includeDrafts=true adds drafts.
+// The response is a ListPage paged with ?limit=&cursor=; ?legacy=true returns
+// the former {"stories":[...]} shape with every match instead.
 func (s *StoryService) HandleListStories(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	scanInput := &dynamodb.ScanInput{
-		TableName:        &s.tableName,
-		FilterExpression: awsString("begins_with(id, :storyPrefix)"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":storyPrefix": &types.AttributeValueMemberS{Value: "STORY#"},
-		},
+	limit, offset, err := ParsePageParams(req.QueryStringParameters)
+	if err != nil {
+		return s.badInput(err.Error())
 	}
-	result, err := s.dynamo.Scan(ctx, scanInput)
+	stories, err := s.ListStories(ctx)
 	if err != nil {
 		return s.errorResponse(500, fmt.Sprintf("Failed to list stories: %v", err))
 	}
-	stories := make([]Story, 0, len(result.Items))
-	for _, item := range result.Items {
+	if req.QueryStringParameters["includeDrafts"] != "true" {
+		visible := stories[:0]
+		for _, st := range stories {
+			if !st.IsDraft() {
+				visible = append(visible, st)
+			}
+		}
+		stories = visible
+	}
+	if req.QueryStringParameters["legacy"] == "true" {
+		return s.jsonResponse(200, map[string][]Story{"stories": stories})
+	}
+	return s.jsonResponse(200, Paginate(stories, limit, offset))
+}
+
+// ListStories returns all story headers sorted by title, then storyId.
+func (s *StoryService) ListStories(ctx context.Context) ([]Story, error) {
+	items, err := s.storyHeaderItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stories := make([]Story, 0, len(items))
+	for _, item := range items {
 		var rec storyRecord
-		if err := attributevalue.UnmarshalMap(item, &rec); err != nil {
+		if err := attributevalue.UnmarshalMap(s.keys.FromItem(item), &rec); err != nil {
 			continue
 		}
 		stories = append(stories, rec.Story)
@@ -448,76 +912,105 @@ func (s *StoryService) HandleListStories(ctx context.Context, req events.APIGate
 		}
 		return titleI < titleJ
 	})
-	payload := map[string][]Story{"stories": stories}
-	return s.jsonResponse(200, payload)
+	return stories, nil
+}
+
+// contiguousIndexes sorts a copy of indexes and reports whether it is exactly
+// 1..len(indexes).
+func contiguousIndexes(indexes []int) ([]int, bool) {
+	sorted := append([]int{}, indexes...)
+	sort.Ints(sorted)
+	for i, idx := range sorted {
+		if idx != i+1 {
+			return sorted, false
+		}
+	}
+	return sorted, true
 }
 
+// HandleImportStory saves a story with its paragraphs and details in one
+// request. ?strict=true rejects a paragraphNodeMap naming unknown nodes;
+// ?requireContiguous=true rejects paragraph indexes that are not 1..N.
 func (s *StoryService) HandleImportStory(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	version, err := RequestAPIVersion(req)
+	if err != nil {
+		return s.badInput(err.Error())
+	}
 	var payload struct {
 		Story      Story `json:"story"`
 		Paragraphs []struct {
-			ParagraphID string     `json:"paragraphId,omitempty"`
-			Index       int        `json:"index"`
-			Title       string     `json:"title"`
-			BodyMd      string     `json:"bodyMd"`
-			Citations   []Citation `json:"citations"`
+			ParagraphID string          `json:"paragraphId,omitempty"`
+			Index       int             `json:"index"`
+			Title       string          `json:"title"`
+			BodyMd      string          `json:"bodyMd"`
+			Citations   json.RawMessage `json:"citations"`
 		} `json:"paragraphs"`
 		Details []struct {
-			ParagraphIndex int    `json:"paragraphIndex"`
-			Kind           string `json:"kind"`
-			TranscriptID   string `json:"transcriptId"`
-			StartMinute    int    `json:"startMinute"`
-			EndMinute      int    `json:"endMinute"`
-			Text           string `json:"text"`
+			ParagraphIndex int         `json:"paragraphIndex"`
+			Kind           string      `json:"kind"`
+			TranscriptID   string      `json:"transcriptId"`
+			StartMinute    int         `json:"startMinute"`
+			EndMinute      int         `json:"endMinute"`
+			Range          *TimeRange  `json:"range"`
+			Text           string      `json:"text"`
+			Attachment     *Attachment `json:"attachment"`
 		} `json:"details"`
 	}
-	if err := json.Unmarshal([]byte(req.Body), &payload); err != nil {
-		return s.errorResponse(400, "Invalid JSON payload")
+	if err := DecodeJSON(req.Body, &payload); err != nil {
+		return s.badInput(err.Error())
+	}
+	// The checks are shared with CheckStoryFull, which reports all problems
+	// where the import stops at the first.
+	if problems := s.storyProblems(payload.Story); len(problems) > 0 {
+		return s.unprocessable(problems[0])
+	}
+	if len(payload.Paragraphs) > s.maxParagraphs {
+		return s.unprocessable(fmt.Sprintf("import has %d paragraphs (limit %d)", len(payload.Paragraphs), s.maxParagraphs))
 	}
-	if strings.TrimSpace(payload.Story.SchoolID) == "" || strings.TrimSpace(payload.Story.Title) == "" {
-		return s.errorResponse(400, "story.schoolId and story.title are required")
+	if req.QueryStringParameters["requireContiguous"] == "true" {
+		indexes := make([]int, len(payload.Paragraphs))
+		for i, p := range payload.Paragraphs {
+			indexes[i] = p.Index
+		}
+		if sorted, ok := contiguousIndexes(indexes); !ok {
+			return s.jsonResponse(422, struct {
+				Error   string `json:"error"`
+				Indexes []int  `json:"indexes"`
+			}{fmt.Sprintf("paragraph indexes must be 1..%d without gaps or duplicates", len(indexes)), sorted})
+		}
 	}
 	storyID := strings.TrimSpace(payload.Story.StoryID)
 	if storyID == "" {
-		storyID = fmt.Sprintf("story-%s", uuid.New().String())
+		storyID = newID(s.idPrefixes.Story)
 	}
 	payload.Story.StoryID = storyID
-	now := time.Now().UTC().Format(time.RFC3339)
-	existingStory, existingParagraphs, existingDetails, _ := s.fetchStoryBundle(ctx, storyID)
+	now := NowRFC3339UTC()
+	existingStory, _, _, _ := s.fetchStoryBundle(ctx, storyID)
 	paragraphNodeMap := payload.Story.ParagraphNodeMap
 	if paragraphNodeMap == nil && len(existingStory.ParagraphNodeMap) > 0 {
 		paragraphNodeMap = existingStory.ParagraphNodeMap
 	}
-	// Remove existing paragraphs and details before recreating to avoid duplicates
-	for _, detail := range existingDetails {
-		_, _ = s.dynamo.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-			TableName: &s.tableName,
-			Key: map[string]types.AttributeValue{
-				"storyId": &types.AttributeValueMemberS{Value: fmt.Sprintf("STORY#%s", storyID)},
-				"id":      &types.AttributeValueMemberS{Value: fmt.Sprintf("DET#%s#%s", detail.ParagraphID, detail.DetailID)},
-			},
-		})
+	unknownNodes, err := s.unknownNodeIDs(ctx, storyID, payload.Story.ParagraphNodeMap)
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to read graph: %v", err))
 	}
-	for _, paragraph := range existingParagraphs {
-		_, _ = s.dynamo.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-			TableName: &s.tableName,
-			Key: map[string]types.AttributeValue{
-				"storyId": &types.AttributeValueMemberS{Value: fmt.Sprintf("STORY#%s", storyID)},
-				"id":      &types.AttributeValueMemberS{Value: paragraphSortKey(paragraph.Index, paragraph.ParagraphID)},
-			},
-		})
+	if len(unknownNodes) > 0 && req.QueryStringParameters["strict"] == "true" {
+		return s.unprocessable(fmt.Sprintf("paragraphNodeMap references unknown nodes: %s", strings.Join(unknownNodes, ", ")))
 	}
 	paragraphByIndex := map[int]paragraphRecord{}
+	seenIndex := map[int]bool{}
+	var records []interface{}
 	for _, p := range payload.Paragraphs {
-		if p.Index < 1 {
-			return s.errorResponse(400, "paragraph index must be >= 1")
+		citations, err := decodeCitations(version, p.Citations)
+		if err != nil {
+			return s.bodyError(err)
 		}
-		if err := validateCitations(p.Citations); err != nil {
-			return s.errorResponse(400, err.Error())
+		if problems := s.paragraphProblems(p.Index, p.Title, p.BodyMd, citations, seenIndex); len(problems) > 0 {
+			return s.unprocessable(problems[0])
 		}
 		pid := strings.TrimSpace(p.ParagraphID)
 		if pid == "" {
-			pid = fmt.Sprintf("para-%s", uuid.New().String())
+			pid = newID(s.idPrefixes.Paragraph)
 		}
 		record := paragraphRecord{
 			StoryKey:    fmt.Sprintf("STORY#%s", storyID),
@@ -525,41 +1018,37 @@ func (s *StoryService) HandleImportStory(ctx context.Context, req events.APIGate
 			StoryID:     storyID,
 			Index:       p.Index,
 			Title:       strings.TrimSpace(p.Title),
-			BodyMd:      p.BodyMd,
-			Citations:   p.Citations,
+			BodyMd:      NormalizeHeadings(p.Title, p.BodyMd, s.headingMode),
+			Citations:   citationsOrEmpty(citations),
 			CreatedAt:   now,
 			UpdatedAt:   now,
+			UpdatedBy:   ActorFromContext(ctx),
 		}
 		record.ID = paragraphSortKey(record.Index, record.ParagraphID)
-		item, err := attributevalue.MarshalMap(record)
-		if err != nil {
-			return s.errorResponse(500, "Failed to marshal paragraph")
-		}
-		_, err = s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
-			TableName: &s.tableName,
-			Item:      item,
-		})
-		if err != nil {
-			return s.errorResponse(500, fmt.Sprintf("Failed to save paragraph: %v", err))
-		}
+		records = append(records, record)
 		paragraphByIndex[p.Index] = record
 	}
+	detailsPerParagraph := map[int]int{}
 	for _, det := range payload.Details {
-		if det.Kind != "quote" {
-			return s.errorResponse(400, "detail.kind must be 'quote'")
+		if detailsPerParagraph[det.ParagraphIndex]++; detailsPerParagraph[det.ParagraphIndex] > s.maxDetails {
+			return s.unprocessable(fmt.Sprintf("import has more than %d details for paragraph %d", s.maxDetails, det.ParagraphIndex))
 		}
 		if det.ParagraphIndex < 1 {
-			return s.errorResponse(400, "detail.paragraphIndex must be >= 1")
+			return s.unprocessable("detail.paragraphIndex must be >= 1")
 		}
 		paraRecord, ok := paragraphByIndex[det.ParagraphIndex]
 		if !ok {
-			return s.errorResponse(400, fmt.Sprintf("No paragraph for index %d", det.ParagraphIndex))
+			return s.unprocessable(fmt.Sprintf("No paragraph for index %d", det.ParagraphIndex))
+		}
+		startMinute, endMinute, err := decodeDetailMinutes(version, det.StartMinute, det.EndMinute, det.Range)
+		if err != nil {
+			return s.unprocessable(fmt.Sprintf("detail range: %v", err))
 		}
-		if det.StartMinute < 0 || det.EndMinute < 0 {
-			return s.errorResponse(400, "detail minutes must be >= 0")
+		if problems := detailProblems("detail", det.Kind, det.Attachment, startMinute, endMinute); len(problems) > 0 {
+			return s.unprocessable(problems[0])
 		}
-		detailID := fmt.Sprintf("det-%s", uuid.New().String())
-		record := detailRecord{
+		detailID := newID(s.idPrefixes.Detail)
+		records = append(records, detailRecord{
 			StoryKey:     fmt.Sprintf("STORY#%s", storyID),
 			ID:           fmt.Sprintf("DET#%s#%s", paraRecord.ParagraphID, detailID),
 			DetailID:     detailID,
@@ -567,23 +1056,15 @@ func (s *StoryService) HandleImportStory(ctx context.Context, req events.APIGate
 			ParagraphID:  paraRecord.ParagraphID,
 			Kind:         det.Kind,
 			TranscriptID: det.TranscriptID,
-			StartMinute:  det.StartMinute,
-			EndMinute:    det.EndMinute,
+			StartMinute:  startMinute,
+			EndMinute:    endMinute,
 			Text:         det.Text,
-		}
-		item, err := attributevalue.MarshalMap(record)
-		if err != nil {
-			return s.errorResponse(500, "Failed to marshal detail")
-		}
-		_, err = s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
-			TableName: &s.tableName,
-			Item:      item,
+			UpdatedBy:    ActorFromContext(ctx),
+			Attachment:   det.Attachment,
 		})
-		if err != nil {
-			return s.errorResponse(500, fmt.Sprintf("Failed to save detail: %v", err))
-		}
 	}
-	// --- sanitize and save story last (after paragraphs exist) ---
+
+	// The paragraphNodeMap keeps only paragraphs of this import.
 	existingPIDs := map[string]struct{}{}
 	for _, rec := range paragraphByIndex {
 		existingPIDs[rec.ParagraphID] = struct{}{}
@@ -614,33 +1095,457 @@ func (s *StoryService) HandleImportStory(ctx context.Context, req events.APIGate
 		}
 	}
 
-	storyRec := storyRecord{
-		StoryKey: fmt.Sprintf("STORY#%s", storyID),
-		ID:       fmt.Sprintf("STORY#%s", storyID),
-		Story: Story{
-			StoryID:          storyID,
-			SchoolID:         payload.Story.SchoolID,
-			Title:            payload.Story.Title,
-			CreatedAt:        chooseNonEmpty(existingStory.CreatedAt, now),
-			UpdatedAt:        now,
-			ParagraphNodeMap: cleanPNM,
-		},
+	// A re-import keeps the slug unless the story moves to another school or
+	// another story holds it, which happens to stories saved before slugs
+	// were reserved.
+	slug := existingStory.Slug
+	sameSchool := existingStory.SchoolID == payload.Story.SchoolID
+	if slug != "" && sameSchool {
+		kept, err := s.claimSlug(ctx, payload.Story.SchoolID, slug, storyID)
+		if err != nil {
+			return s.errorResponse(500, fmt.Sprintf("Failed to reserve slug: %v", err))
+		}
+		if !kept {
+			slug = ""
+		}
+	}
+	if slug == "" || !sameSchool {
+		if slug, err = s.uniqueSlug(ctx, payload.Story.SchoolID, payload.Story.Title, storyID); err != nil {
+			return s.errorResponse(500, fmt.Sprintf("Failed to reserve slug: %v", err))
+		}
+	}
+
+	// Remove existing paragraphs and details before recreating to avoid
+	// duplicates. All deletes finish before the first write, so a re-import
+	// that keeps a paragraphId cannot have its new record deleted. They are
+	// read from the partition rather than the bundle, which also catches
+	// content a failed import left without a story record.
+	sortKeys, err := s.partitionSortKeys(ctx, fmt.Sprintf("STORY#%s", storyID))
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to read previous story content: %v", err))
+	}
+	var staleKeys []string
+	for _, sk := range sortKeys {
+		if strings.HasPrefix(sk, "PARA#") || strings.HasPrefix(sk, "DET#") {
+			staleKeys = append(staleKeys, sk)
+		}
+	}
+	if err := s.batchDelete(ctx, fmt.Sprintf("STORY#%s", storyID), staleKeys); err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to remove previous story content: %v", err))
 	}
+
+	err = forEachBounded(ctx, importWorkers, len(records), func(ctx context.Context, i int) error {
+		item, err := attributevalue.MarshalMap(records[i])
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+		_, err = s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: &s.tableName,
+			Item:      s.keys.ToItem(item),
+		})
+		return err
+	})
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to save story content: %v", err))
+	}
+
+	// The story record is written last, not first. It is what lists the
+	// story, so a first import that fails midway stays invisible instead of
+	// showing a story with part of its content. Repeating the import removes
+	// what the failed one wrote and finishes it.
+	storyRec := newStoryRecord(storyID, Story{
+		StoryID:          storyID,
+		SchoolID:         payload.Story.SchoolID,
+		Title:            payload.Story.Title,
+		Slug:             slug,
+		CreatedAt:        chooseNonEmpty(existingStory.CreatedAt, now),
+		UpdatedAt:        now,
+		UpdatedBy:        ActorFromContext(ctx),
+		ParagraphNodeMap: cleanPNM,
+		Status:           importStatus(payload.Story.Status, existingStory),
+		TimeAnchor:       chooseNonEmpty(payload.Story.TimeAnchor, existingStory.TimeAnchor),
+	})
 	item, err := attributevalue.MarshalMap(storyRec)
 	if err != nil {
 		return s.errorResponse(500, "Failed to marshal story")
 	}
 	if _, err := s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: &s.tableName,
-		Item:      item,
+		Item:      s.keys.ToItem(item),
 	}); err != nil {
 		return s.errorResponse(500, fmt.Sprintf("Failed to save story: %v", err))
 	}
-	return s.jsonResponse(200, map[string]string{"id": storyID})
+	if !sameSchool {
+		if err := s.releaseSlug(ctx, existingStory.SchoolID, existingStory.Slug, storyID); err != nil {
+			log.Printf("⚠️ Failed to release slug %q of %s: %v", existingStory.Slug, storyID, err)
+		}
+	}
+	s.NotifyChange(ctx, EventStoryImported, storyID)
+	if len(unknownNodes) > 0 {
+		return s.createdResponse(storyID, map[string]interface{}{
+			"warnings": []string{fmt.Sprintf("paragraphNodeMap references unknown nodes: %s", strings.Join(unknownNodes, ", "))},
+		})
+	}
+	return s.createdResponse(storyID, nil)
+}
+
+// HandlePublishStory flips a story from draft to published. Publishing an
+// already published story is a no-op.
+func (s *StoryService) HandlePublishStory(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if strings.TrimSpace(storyID) == "" {
+		return s.badInput("Missing storyId in path")
+	}
+	story, _, _, err := s.fetchStoryBundle(ctx, storyID)
+	if err != nil {
+		return s.errorResponse(404, err.Error())
+	}
+	if story.Status != StoryStatusPublished {
+		story.Status = StoryStatusPublished
+		story.UpdatedAt = NowRFC3339UTC()
+		story.UpdatedBy = ActorFromContext(ctx)
+		record := newStoryRecord(storyID, story)
+		item, err := attributevalue.MarshalMap(record)
+		if err != nil {
+			return s.errorResponse(500, "Failed to marshal story")
+		}
+		if _, err := s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: &s.tableName,
+			Item:      s.keys.ToItem(item),
+		}); err != nil {
+			return s.errorResponse(500, fmt.Sprintf("Failed to save story: %v", err))
+		}
+		s.NotifyChange(ctx, EventStoryUpdated, storyID)
+	}
+	return s.jsonResponse(200, map[string]string{"id": storyID, "status": story.Status})
+}
+
+// storyHeaderItems reads every story record. With a stories index it queries
+// only the story headers; otherwise it falls back to a filtered Scan, which
+// reads (and bills) the whole table. Both follow LastEvaluatedKey for at most
+// maxListPages pages and stop early if the key does not advance, so a corrupt
+// index cannot keep the Lambda paging until it times out.
+func (s *StoryService) storyHeaderItems(ctx context.Context) ([]map[string]types.AttributeValue, error) {
+	var out []map[string]types.AttributeValue
+	err := s.eachStoryHeaderPage(ctx, func(items []map[string]types.AttributeValue) error {
+		out = append(out, items...)
+		return nil
+	})
+	return out, err
+}
+
+// ForEachStory calls fn with every story header, one Query/Scan page at a
+// time and in store order, so callers can stream without holding the list.
+// An error from fn stops the walk and is returned.
+func (s *StoryService) ForEachStory(ctx context.Context, fn func(Story) error) error {
+	return s.eachStoryHeaderPage(ctx, func(items []map[string]types.AttributeValue) error {
+		for _, item := range items {
+			var rec storyRecord
+			if err := attributevalue.UnmarshalMap(s.keys.FromItem(item), &rec); err != nil {
+				continue
+			}
+			if err := fn(rec.Story); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// eachStoryHeaderPage hands fn the story header items page by page, from the
+// story index when configured and a filtered scan otherwise.
+func (s *StoryService) eachStoryHeaderPage(ctx context.Context, fn func([]map[string]types.AttributeValue) error) error {
+	var startKey map[string]types.AttributeValue
+	var seen []map[string]types.AttributeValue
+	for page := 1; ; page++ {
+		var items []map[string]types.AttributeValue
+		var next map[string]types.AttributeValue
+		if s.storyIndex != "" {
+			res, err := s.dynamo.Query(ctx, &dynamodb.QueryInput{
+				TableName:                &s.tableName,
+				IndexName:                &s.storyIndex,
+				KeyConditionExpression:   awsString("#rt = :rt"),
+				ExpressionAttributeNames: map[string]string{"#rt": "recordType"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":rt": &types.AttributeValueMemberS{Value: storyRecordType},
+				},
+				ExclusiveStartKey: startKey,
+			})
+			if err != nil {
+				return err
+			}
+			items, next = res.Items, res.LastEvaluatedKey
+		} else {
+			res, err := s.dynamo.Scan(ctx, &dynamodb.ScanInput{
+				TableName:                &s.tableName,
+				FilterExpression:         awsString("begins_with(#sk, :storyPrefix)"),
+				ExpressionAttributeNames: s.keys.SortKeyNames(),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":storyPrefix": &types.AttributeValueMemberS{Value: "STORY#"},
+				},
+				ExclusiveStartKey: startKey,
+			})
+			if err != nil {
+				return err
+			}
+			items, next = res.Items, res.LastEvaluatedKey
+		}
+		// A page that hands back a key already seen repeats an earlier page,
+		// so its items are dropped rather than listed twice.
+		for _, k := range seen {
+			if reflect.DeepEqual(next, k) {
+				log.Printf("⚠️ Story list stopped: LastEvaluatedKey repeated on page %d", page)
+				return nil
+			}
+		}
+		if err := fn(items); err != nil {
+			return err
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		seen = append(seen, next)
+		if page >= maxListPages {
+			log.Printf("⚠️ Story list stopped after %d pages; results may be incomplete", page)
+			return nil
+		}
+		startKey = next
+	}
+}
+
+// ClearParagraphNodeMap drops all paragraph-to-node links of a story, e.g.
+// after its graph was cleared. Missing stories and empty maps are a no-op.
+func (s *StoryService) ClearParagraphNodeMap(ctx context.Context, storyID string) error {
+	return s.SetParagraphNodeMap(ctx, storyID, map[string][]string{})
+}
+
+// SetParagraphNodeMap replaces a story's paragraph-to-node links as given,
+// without validation. Missing stories and unchanged empty maps are a no-op.
+func (s *StoryService) SetParagraphNodeMap(ctx context.Context, storyID string, pnm map[string][]string) error {
+	story, _, _, err := s.fetchStoryBundle(ctx, storyID)
+	if errors.Is(err, ErrStoryNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(story.ParagraphNodeMap) == 0 && len(pnm) == 0 {
+		return nil
+	}
+	story.ParagraphNodeMap = pnm
+	story.UpdatedAt = NowRFC3339UTC()
+	story.UpdatedBy = ActorFromContext(ctx)
+	item, err := attributevalue.MarshalMap(newStoryRecord(storyID, story))
+	if err != nil {
+		return err
+	}
+	_, err = s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &s.tableName,
+		Item:      s.keys.ToItem(item),
+	})
+	return err
+}
+
+// PutStoryFull stores a story in the shape GetFullStory returns, with its ids
+// and timestamps as given, in place of the stored story, paragraphs and
+// details. Nothing is validated; it copies stories between tables. The new
+// records are written before the stale ones are removed.
+func (s *StoryService) PutStoryFull(ctx context.Context, full *StoryFull) error {
+	storyID := strings.TrimSpace(full.Story.StoryID)
+	if storyID == "" {
+		return errors.New("storyId is required")
+	}
+	pk := fmt.Sprintf("STORY#%s", storyID)
+	_, oldParagraphs, oldDetails, err := s.fetchStoryBundle(ctx, storyID)
+	if err != nil && !errors.Is(err, ErrStoryNotFound) {
+		return err
+	}
+
+	story := full.Story
+	story.StoryID = storyID
+	records := []interface{}{newStoryRecord(storyID, story)}
+	written := map[string]bool{}
+	for _, p := range full.Paragraphs {
+		rec := paragraphRecord{
+			StoryKey:    pk,
+			ID:          paragraphSortKey(p.Index, p.ParagraphID),
+			ParagraphID: p.ParagraphID,
+			StoryID:     storyID,
+			Index:       p.Index,
+			Title:       p.Title,
+			BodyMd:      p.BodyMd,
+			Citations:   citationsOrEmpty(p.Citations),
+			CreatedAt:   p.CreatedAt,
+			UpdatedAt:   p.UpdatedAt,
+			UpdatedBy:   p.UpdatedBy,
+		}
+		records = append(records, rec)
+		written[rec.ID] = true
+	}
+	for pid, details := range full.DetailsByParagraph {
+		for _, d := range details {
+			rec := detailRecord{
+				StoryKey:     pk,
+				ID:           fmt.Sprintf("DET#%s#%s", pid, d.DetailID),
+				DetailID:     d.DetailID,
+				StoryID:      storyID,
+				ParagraphID:  pid,
+				Kind:         d.Kind,
+				TranscriptID: d.TranscriptID,
+				StartMinute:  d.StartMinute,
+				EndMinute:    d.EndMinute,
+				Text:         d.Text,
+				UpdatedBy:    d.UpdatedBy,
+				Attachment:   d.Attachment,
+			}
+			records = append(records, rec)
+			written[rec.ID] = true
+		}
+	}
+	for _, rec := range records {
+		item, err := attributevalue.MarshalMap(rec)
+		if err != nil {
+			return err
+		}
+		if _, err := s.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: &s.tableName,
+			Item:      s.keys.ToItem(item),
+		}); err != nil {
+			return err
+		}
+	}
+
+	var stale []string
+	for _, p := range oldParagraphs {
+		if sk := paragraphSortKey(p.Index, p.ParagraphID); !written[sk] {
+			stale = append(stale, sk)
+		}
+	}
+	for _, d := range oldDetails {
+		if sk := fmt.Sprintf("DET#%s#%s", d.ParagraphID, d.DetailID); !written[sk] {
+			stale = append(stale, sk)
+		}
+	}
+	return s.batchDelete(ctx, pk, stale)
+}
+
+// DeleteStory removes a story with all its paragraphs, details and paragraph
+// history and returns how many items were deleted. ErrStoryNotFound if
+// nothing is stored.
+func (s *StoryService) DeleteStory(ctx context.Context, storyID string) (int, error) {
+	pk := fmt.Sprintf("STORY#%s", storyID)
+	sortKeys, err := s.partitionSortKeys(ctx, pk)
+	if err != nil {
+		return 0, err
+	}
+	if len(sortKeys) == 0 {
+		return 0, ErrStoryNotFound
+	}
+	histKeys, err := s.partitionSortKeys(ctx, historyPartition(storyID))
+	if err != nil {
+		return 0, err
+	}
+	story, err := s.getStory(ctx, storyID)
+	if err != nil && !errors.Is(err, ErrStoryNotFound) {
+		return 0, err
+	}
+	if err := s.batchDelete(ctx, pk, sortKeys); err != nil {
+		return 0, err
+	}
+	if err := s.batchDelete(ctx, historyPartition(storyID), histKeys); err != nil {
+		return 0, err
+	}
+	if err := s.releaseSlug(ctx, story.SchoolID, story.Slug, storyID); err != nil {
+		log.Printf("⚠️ Failed to release slug %q of %s: %v", story.Slug, storyID, err)
+	}
+	return len(sortKeys) + len(histKeys), nil
+}
+
+// partitionSortKeys lists the sort keys of every item under pk.
+func (s *StoryService) partitionSortKeys(ctx context.Context, pk string) ([]string, error) {
+	var sortKeys []string
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := s.dynamo.Query(ctx, &dynamodb.QueryInput{
+			TableName:                &s.tableName,
+			KeyConditionExpression:   awsString(s.keys.PartitionCondition()),
+			ExpressionAttributeNames: s.keys.Names(false),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":sid": &types.AttributeValueMemberS{Value: pk},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range result.Items {
+			if sk, ok := item[s.keys.SortKey].(*types.AttributeValueMemberS); ok {
+				sortKeys = append(sortKeys, sk.Value)
+			}
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
+	}
+	return sortKeys, nil
+}
+
+// DeleteDetail removes one detail record of a story.
+func (s *StoryService) DeleteDetail(ctx context.Context, storyID, paragraphID, detailID string) error {
+	_, err := s.dynamo.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: &s.tableName,
+		Key:       s.keys.Key(fmt.Sprintf("STORY#%s", storyID), fmt.Sprintf("DET#%s#%s", paragraphID, detailID)),
+	})
+	return err
 }
 
 // Helpers --------------------------------------------------------------------
 
+// unknownNodeIDs lists the node ids in pnm that the story's graph does not
+// contain, sorted. Stories without a graph yet are not checked: the map may
+// legitimately be written before the diagram.
+func (s *StoryService) unknownNodeIDs(ctx context.Context, storyID string, pnm map[string][]string) ([]string, error) {
+	if s.graphNodeIDs == nil || len(pnm) == 0 {
+		return nil, nil
+	}
+	ids, err := s.graphNodeIDs(ctx, storyID)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	known := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		known[id] = true
+	}
+	seen := map[string]bool{}
+	var unknown []string
+	for _, nodeIDs := range pnm {
+		for _, id := range nodeIDs {
+			id = strings.TrimSpace(id)
+			if id == "" || known[id] || seen[id] {
+				continue
+			}
+			seen[id] = true
+			unknown = append(unknown, id)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+// importStatus keeps an explicit valid status from the payload, then the
+// stored one; new stories start as drafts.
+func importStatus(requested string, existing Story) string {
+	switch requested {
+	case StoryStatusDraft, StoryStatusPublished:
+		return requested
+	}
+	if existing.StoryID != "" {
+		return existing.Status
+	}
+	return StoryStatusDraft
+}
+
 func (s *StoryService) jsonResponse(status int, payload interface{}) (events.APIGatewayProxyResponse, error) {
 	body, err := json.Marshal(payload)
 	if err != nil {
@@ -649,6 +1554,38 @@ func (s *StoryService) jsonResponse(status int, payload interface{}) (events.API
 	return events.APIGatewayProxyResponse{StatusCode: status, Headers: s.corsSource(), Body: string(body)}, nil
 }
 
+// createdResponse answers a create or import with the story id, under both
+// "id" and "storyId", plus extra fields. Location points at the story bundle
+// and a Link header at the graph, so REST clients can follow either.
+func (s *StoryService) createdResponse(storyID string, extra map[string]interface{}) (events.APIGatewayProxyResponse, error) {
+	payload := map[string]interface{}{"id": storyID, "storyId": storyID}
+	for k, v := range extra {
+		payload[k] = v
+	}
+	resp, err := s.jsonResponse(200, payload)
+	if resp.StatusCode == 200 {
+		resp.Headers["Location"] = StoryLocation(storyID)
+		resp.Headers["Link"] = fmt.Sprintf("<%s>; rel=\"related\"", GraphLocation(storyID))
+	}
+	return resp, err
+}
+
+// StoryLocation is the canonical URL path of a story's full bundle.
+func StoryLocation(storyID string) string {
+	return "/api/stories/" + url.PathEscape(storyID) + "/full"
+}
+
+// GraphLocation is the URL path of a story's graph.
+func GraphLocation(storyID string) string {
+	return "/struktur/" + url.PathEscape(storyID)
+}
+
+func (s *StoryService) textResponse(status int, contentType, body string) (events.APIGatewayProxyResponse, error) {
+	headers := s.corsSource()
+	headers["Content-Type"] = contentType
+	return events.APIGatewayProxyResponse{StatusCode: status, Headers: headers, Body: body}, nil
+}
+
 func (s *StoryService) errorResponse(status int, message string) (events.APIGatewayProxyResponse, error) {
 	payload := map[string]string{"error": message}
 	body, _ := json.Marshal(payload)
@@ -659,9 +1596,10 @@ func (s *StoryService) getParagraph(ctx context.Context, storyID, paragraphID st
 	pk := fmt.Sprintf("STORY#%s", storyID)
 	filter := "paragraphId = :paragraphId"
 	result, err := s.dynamo.Query(ctx, &dynamodb.QueryInput{
-		TableName:              &s.tableName,
-		KeyConditionExpression: awsString("storyId = :sid"),
-		FilterExpression:       &filter,
+		TableName:                &s.tableName,
+		KeyConditionExpression:   awsString(s.keys.PartitionCondition()),
+		ExpressionAttributeNames: s.keys.Names(false),
+		FilterExpression:         &filter,
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":sid":         &types.AttributeValueMemberS{Value: pk},
 			":paragraphId": &types.AttributeValueMemberS{Value: paragraphID},
@@ -672,42 +1610,79 @@ func (s *StoryService) getParagraph(ctx context.Context, storyID, paragraphID st
 	}
 	for _, item := range result.Items {
 		var record paragraphRecord
-		if err := attributevalue.UnmarshalMap(item, &record); err != nil {
+		if err := attributevalue.UnmarshalMap(s.keys.FromItem(item), &record); err != nil {
 			return nil, err
 		}
+		// Details carry the paragraphId too; only the paragraph record
+		// itself counts, and only if it belongs to the addressed story
+		// (older records lack storyIdPlain and are trusted by partition).
+		if !strings.HasPrefix(record.ID, "PARA#") || (record.StoryID != "" && record.StoryID != storyID) {
+			continue
+		}
 		return &record, nil
 	}
-	return nil, errors.New("paragraph not found")
+	return nil, ErrParagraphNotFound
+}
+
+// ParagraphStoryID returns the story a paragraph record belongs to, looking
+// for it in the partition of storyID; ErrParagraphNotFound if it is not
+// there.
+func (s *StoryService) ParagraphStoryID(ctx context.Context, storyID, paragraphID string) (string, error) {
+	rec, err := s.getParagraph(ctx, storyID, paragraphID)
+	if err != nil {
+		return "", err
+	}
+	if rec.StoryID != "" {
+		return rec.StoryID, nil
+	}
+	return strings.TrimPrefix(rec.StoryKey, "STORY#"), nil
 }
 
 func (s *StoryService) fetchStoryBundle(ctx context.Context, storyID string) (Story, []Paragraph, []Detail, error) {
 	pk := fmt.Sprintf("STORY#%s", storyID)
-	result, err := s.dynamo.Query(ctx, &dynamodb.QueryInput{
-		TableName:              &s.tableName,
-		KeyConditionExpression: awsString("storyId = :sid"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":sid": &types.AttributeValueMemberS{Value: pk},
-		},
-	})
-	if err != nil {
-		return Story{}, nil, nil, err
+	// A long story with many details does not fit in one 1 MB page.
+	var items []map[string]types.AttributeValue
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := s.dynamo.Query(ctx, &dynamodb.QueryInput{
+			TableName:                &s.tableName,
+			KeyConditionExpression:   awsString(s.keys.PartitionCondition()),
+			ExpressionAttributeNames: s.keys.Names(false),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":sid": &types.AttributeValueMemberS{Value: pk},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return Story{}, nil, nil, err
+		}
+		items = append(items, result.Items...)
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
 	}
 	var story Story
 	var storyFound bool
 	var paragraphs []Paragraph
 	var details []Detail
-	for _, item := range result.Items {
+	for _, item := range items {
+		item = s.keys.FromItem(item)
 		if idAttr, ok := item["id"].(*types.AttributeValueMemberS); ok {
 			switch {
 			case strings.HasPrefix(idAttr.Value, "STORY#"):
 				var rec storyRecord
-				if err := attributevalue.UnmarshalMap(item, &rec); err == nil {
+				if err := UnmarshalItem(item, &rec); err != nil {
+					log.Printf("⚠️ Skipping unreadable story record of %s: %v", storyID, err)
+				} else {
 					story = rec.Story
 					storyFound = true
 				}
 			case strings.HasPrefix(idAttr.Value, "PARA#"):
 				var rec paragraphRecord
-				if err := attributevalue.UnmarshalMap(item, &rec); err == nil {
+				if err := UnmarshalItem(item, &rec); err != nil {
+					log.Printf("⚠️ Skipping unreadable paragraph record of %s: %v", storyID, err)
+				} else {
 					sid := rec.StoryID
 					if sid == "" && strings.HasPrefix(rec.StoryKey, "STORY#") {
 						sid = strings.TrimPrefix(rec.StoryKey, "STORY#")
@@ -718,14 +1693,17 @@ func (s *StoryService) fetchStoryBundle(ctx context.Context, storyID string) (St
 						Index:       rec.Index,
 						Title:       rec.Title,
 						BodyMd:      rec.BodyMd,
-						Citations:   rec.Citations,
+						Citations:   citationsOrEmpty(rec.Citations),
 						CreatedAt:   rec.CreatedAt,
 						UpdatedAt:   rec.UpdatedAt,
+						UpdatedBy:   rec.UpdatedBy,
 					})
 				}
 			case strings.HasPrefix(idAttr.Value, "DET#"):
 				var rec detailRecord
-				if err := attributevalue.UnmarshalMap(item, &rec); err == nil {
+				if err := UnmarshalItem(item, &rec); err != nil {
+					log.Printf("⚠️ Skipping unreadable detail record of %s: %v", storyID, err)
+				} else {
 					sid := rec.StoryID
 					if sid == "" && strings.HasPrefix(rec.StoryKey, "STORY#") {
 						sid = strings.TrimPrefix(rec.StoryKey, "STORY#")
@@ -739,6 +1717,8 @@ func (s *StoryService) fetchStoryBundle(ctx context.Context, storyID string) (St
 						StartMinute:  rec.StartMinute,
 						EndMinute:    rec.EndMinute,
 						Text:         rec.Text,
+						UpdatedBy:    rec.UpdatedBy,
+						Attachment:   rec.Attachment,
 					})
 				}
 			}
@@ -750,9 +1730,43 @@ func (s *StoryService) fetchStoryBundle(ctx context.Context, storyID string) (St
 	sort.Slice(paragraphs, func(i, j int) bool {
 		return paragraphs[i].Index < paragraphs[j].Index
 	})
+	// Query order is not stable across fetches; readers and detail pages
+	// need the same order every time.
+	sort.Slice(details, func(i, j int) bool {
+		if details[i].StartMinute != details[j].StartMinute {
+			return details[i].StartMinute < details[j].StartMinute
+		}
+		return details[i].DetailID < details[j].DetailID
+	})
 	return story, paragraphs, details, nil
 }
 
+// countDetails counts the details stored under one paragraph.
+func (s *StoryService) countDetails(ctx context.Context, storyID, paragraphID string) (int, error) {
+	count := 0
+	var startKey map[string]types.AttributeValue
+	for {
+		res, err := s.dynamo.Query(ctx, &dynamodb.QueryInput{
+			TableName:                &s.tableName,
+			KeyConditionExpression:   awsString(s.keys.PrefixCondition()),
+			ExpressionAttributeNames: s.keys.Names(true),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":sid":      &types.AttributeValueMemberS{Value: fmt.Sprintf("STORY#%s", storyID)},
+				":skPrefix": &types.AttributeValueMemberS{Value: fmt.Sprintf("DET#%s#", paragraphID)},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return 0, err
+		}
+		count += len(res.Items)
+		if len(res.LastEvaluatedKey) == 0 {
+			return count, nil
+		}
+		startKey = res.LastEvaluatedKey
+	}
+}
+
 // GetFullStory returns the structured story bundle for the provided story ID.
 func (s *StoryService) GetFullStory(ctx context.Context, storyID string) (*StoryFull, error) {
 	story, paragraphs, details, err := s.fetchStoryBundle(ctx, storyID)
@@ -774,6 +1788,15 @@ func paragraphSortKey(index int, paragraphID string) string {
 	return fmt.Sprintf("PARA#%04d#%s", index, paragraphID)
 }
 
+// citationsOrEmpty turns nil into an empty slice so citations serialize as []
+// rather than null, both when stored and in responses.
+func citationsOrEmpty(citations []Citation) []Citation {
+	if citations == nil {
+		return []Citation{}
+	}
+	return citations
+}
+
 func validateCitations(citations []Citation) error {
 	for _, c := range citations {
 		if strings.TrimSpace(c.TranscriptID) == "" {
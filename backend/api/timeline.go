@@ -0,0 +1,77 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Node times are either calendar values or relative tokens T0..Tn. A story's
+// TimeAnchor is the date of T0; each further step is one ISO week, so T2 is
+// two weeks after the anchor.
+const timeStep = 7 * 24 * time.Hour
+
+var (
+	isoWeek       = regexp.MustCompile(`^(\d{4})-W(\d{2})(?:-([1-7]))?$`)
+	relativeToken = regexp.MustCompile(`^[Tt](-?\d+)$`)
+)
+
+// ParseTimelineDate reads a calendar time: YYYY-MM-DD, YYYY-MM, an ISO week
+// (YYYY-Www or YYYY-Www-D, Monday if no day is given) or RFC 3339.
+func ParseTimelineDate(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if m := isoWeek.FindStringSubmatch(v); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		week, _ := strconv.Atoi(m[2])
+		day := 1
+		if m[3] != "" {
+			day, _ = strconv.Atoi(m[3])
+		}
+		if week < 1 || week > 53 {
+			return time.Time{}, fmt.Errorf("invalid ISO week %q", v)
+		}
+		// January 4th is always in week 1.
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+		monday := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + 6) % 7))
+		t := monday.AddDate(0, 0, (week-1)*7+day-1)
+		if _, w := t.ISOWeek(); w != week {
+			return time.Time{}, fmt.Errorf("invalid ISO week %q", v)
+		}
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01", time.RFC3339} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (want YYYY-MM-DD, YYYY-Www or RFC 3339)", v)
+}
+
+// ParseRelativeToken returns n for a token "Tn".
+func ParseRelativeToken(v string) (int, bool) {
+	m := relativeToken.FindStringSubmatch(strings.TrimSpace(v))
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	return n, err == nil
+}
+
+// ResolveTime maps a node time onto the calendar. Relative tokens need an
+// anchor; without one (or for unparseable values) ok is false.
+func ResolveTime(v, anchor string) (t time.Time, ok bool) {
+	if n, rel := ParseRelativeToken(v); rel {
+		if anchor == "" {
+			return time.Time{}, false
+		}
+		base, err := ParseTimelineDate(anchor)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return base.Add(time.Duration(n) * timeStep), true
+	}
+	t, err := ParseTimelineDate(v)
+	return t, err == nil
+}
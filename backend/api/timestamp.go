@@ -0,0 +1,19 @@
+package api
+
+import "time"
+
+// NowRFC3339UTC is the single source of stored timestamps. Always UTC, so
+// values from different Lambdas sort and compare as plain strings.
+func NowRFC3339UTC() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// NormalizeRFC3339 parses a client-supplied timestamp and returns it in the
+// stored form (UTC, second precision).
+func NormalizeRFC3339(v string) (string, error) {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// transcriptScanLimit is how many table items one page of a transcript lookup
+// evaluates. Only paragraph records match, so a page may return fewer
+// paragraphs, or none, and still have a next page.
+const transcriptScanLimit = 1000
+
+// CitingParagraph is a paragraph citing a transcript, with the minutes it
+// cites from it.
+type CitingParagraph struct {
+	ParagraphID string `json:"paragraphId"`
+	Index       int    `json:"index"`
+	Title       string `json:"title,omitempty"`
+	Minutes     []int  `json:"minutes"`
+}
+
+// CitingStory groups the citing paragraphs of one story by index.
+type CitingStory struct {
+	StoryID    string            `json:"storyId"`
+	Paragraphs []CitingParagraph `json:"paragraphs"`
+}
+
+// encodeScanCursor is the cursor of a transcript scan resuming after last,
+// "" when there is nothing to resume.
+func encodeScanCursor(keys KeySchema, last map[string]types.AttributeValue) string {
+	pk, _ := last[keys.PartitionKey].(*types.AttributeValueMemberS)
+	sk, _ := last[keys.SortKey].(*types.AttributeValueMemberS)
+	if pk == nil || sk == nil {
+		return ""
+	}
+	return Cursor{PK: pk.Value, SK: sk.Value}.Encode()
+}
+
+func decodeScanCursor(keys KeySchema, v string) (map[string]types.AttributeValue, error) {
+	c, err := DecodeCursor(v)
+	if err != nil || c.PK == "" || c.SK == "" {
+		return nil, errInvalidCursor
+	}
+	return keys.Key(c.PK, c.SK), nil
+}
+
+// ParagraphsCitingTranscript scans one page of paragraph records, starting
+// after startKey, for citations of transcriptID. It returns the matches
+// grouped by story (stories by id, paragraphs by index) and the key to
+// resume after, nil once the table is exhausted.
+func (s *StoryService) ParagraphsCitingTranscript(ctx context.Context, transcriptID string, startKey map[string]types.AttributeValue) ([]CitingStory, map[string]types.AttributeValue, error) {
+	limit := int32(transcriptScanLimit)
+	res, err := s.dynamo.Scan(ctx, &dynamodb.ScanInput{
+		TableName:                &s.tableName,
+		FilterExpression:         awsString("begins_with(#sk, :paraPrefix)"),
+		ExpressionAttributeNames: s.keys.SortKeyNames(),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":paraPrefix": &types.AttributeValueMemberS{Value: "PARA#"},
+		},
+		Limit:             &limit,
+		ExclusiveStartKey: startKey,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	byStory := map[string][]CitingParagraph{}
+	for _, item := range res.Items {
+		var rec paragraphRecord
+		if err := UnmarshalItem(s.keys.FromItem(item), &rec); err != nil {
+			log.Printf("⚠️ Skipping unreadable paragraph record: %v", err)
+			continue
+		}
+		seen := map[int]bool{}
+		minutes := []int{}
+		cited := false
+		for _, c := range rec.Citations {
+			if c.TranscriptID != transcriptID {
+				continue
+			}
+			cited = true
+			for _, m := range c.Minutes {
+				if !seen[m] {
+					seen[m] = true
+					minutes = append(minutes, m)
+				}
+			}
+		}
+		if !cited {
+			continue
+		}
+		sort.Ints(minutes)
+		sid := rec.StoryID
+		if sid == "" {
+			sid = strings.TrimPrefix(rec.StoryKey, "STORY#")
+		}
+		byStory[sid] = append(byStory[sid], CitingParagraph{ParagraphID: rec.ParagraphID, Index: rec.Index, Title: rec.Title, Minutes: minutes})
+	}
+
+	stories := make([]CitingStory, 0, len(byStory))
+	for sid, paragraphs := range byStory {
+		sort.Slice(paragraphs, func(i, j int) bool { return paragraphs[i].Index < paragraphs[j].Index })
+		stories = append(stories, CitingStory{StoryID: sid, Paragraphs: paragraphs})
+	}
+	sort.Slice(stories, func(i, j int) bool { return stories[i].StoryID < stories[j].StoryID })
+	if len(res.LastEvaluatedKey) == 0 {
+		return stories, nil, nil
+	}
+	return stories, res.LastEvaluatedKey, nil
+}
+
+// HandleTranscriptParagraphs lists the paragraphs of all stories that cite a
+// transcript, for research across stories. The lookup scans the table one
+// page per request; while hasMore is true, pass nextCursor back as ?cursor=.
+// A story can appear on more than one page. An unreferenced transcript gives
+// an empty list.
+// Route: GET /api/transcripts/{transcriptId}/paragraphs?cursor=
+func (s *StoryService) HandleTranscriptParagraphs(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	transcriptID := req.PathParameters["transcriptId"]
+	if transcriptID == "" {
+		return s.badInput("Missing transcriptId in path")
+	}
+	var startKey map[string]types.AttributeValue
+	if v := req.QueryStringParameters["cursor"]; v != "" {
+		var err error
+		if startKey, err = decodeScanCursor(s.keys, v); err != nil {
+			return s.badInput(err.Error())
+		}
+	}
+	stories, next, err := s.ParagraphsCitingTranscript(ctx, transcriptID, startKey)
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to scan paragraphs: %v", err))
+	}
+	count := 0
+	for _, st := range stories {
+		count += len(st.Paragraphs)
+	}
+	out := struct {
+		TranscriptID string        `json:"transcriptId"`
+		Stories      []CitingStory `json:"stories"`
+		Count        int           `json:"count"`
+		HasMore      bool          `json:"hasMore"`
+		NextCursor   string        `json:"nextCursor,omitempty"`
+	}{TranscriptID: transcriptID, Stories: stories, Count: count}
+	if next != nil {
+		out.NextCursor = encodeScanCursor(s.keys, next)
+		out.HasMore = out.NextCursor != ""
+	}
+	return s.jsonResponse(200, out)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Reasons an UnlinkedParagraph is listed.
+const (
+	UnlinkedUnmapped     = "unmapped"
+	UnlinkedNodesDeleted = "nodesDeleted"
+)
+
+// UnlinkedParagraph is a paragraph that points at no node of the graph.
+type UnlinkedParagraph struct {
+	ParagraphID string `json:"paragraphId"`
+	Index       int    `json:"index"`
+	Title       string `json:"title"`
+	Reason      string `json:"reason"`
+}
+
+// HandleUnlinkedParagraphs lists the paragraphs without a paragraphNodeMap
+// entry, in index order, as a QA check for incomplete analysis. With
+// ?includeDeleted=true paragraphs whose mapped nodes no longer exist in the
+// graph are listed too.
+// Route: GET /api/stories/{storyId}/unlinked-paragraphs
+func (s *StoryService) HandleUnlinkedParagraphs(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return s.badInput("Missing storyId in path")
+	}
+	story, paragraphs, _, err := s.fetchStoryBundle(ctx, storyID)
+	if errors.Is(err, ErrStoryNotFound) {
+		return s.errorResponse(404, err.Error())
+	}
+	if err != nil {
+		return s.errorResponse(500, fmt.Sprintf("Failed to load story: %v", err))
+	}
+	var known map[string]bool
+	if req.QueryStringParameters["includeDeleted"] == "true" && s.graphNodeIDs != nil {
+		ids, err := s.graphNodeIDs(ctx, storyID)
+		if err != nil {
+			return s.errorResponse(500, fmt.Sprintf("Failed to load graph: %v", err))
+		}
+		known = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			known[id] = true
+		}
+	}
+	out := []UnlinkedParagraph{}
+	for _, p := range paragraphs {
+		reason := ""
+		nodeIDs := story.ParagraphNodeMap[p.ParagraphID]
+		switch {
+		case len(nodeIDs) == 0:
+			reason = UnlinkedUnmapped
+		case known != nil && !anyKnown(nodeIDs, known):
+			reason = UnlinkedNodesDeleted
+		default:
+			continue
+		}
+		out = append(out, UnlinkedParagraph{ParagraphID: p.ParagraphID, Index: p.Index, Title: p.Title, Reason: reason})
+	}
+	return s.jsonResponse(200, out)
+}
+
+func anyKnown(ids []string, known map[string]bool) bool {
+	for _, id := range ids {
+		if known[id] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Request body versions. A client names the shape it sends with the
+// X-Api-Version header or ?v=; without either the v1 shape is assumed, so
+// existing clients keep working.
+//
+//	v1: citations carry "minutes": [1, 2, 3]; details "startMinute"/"endMinute"
+//	v2: citations carry "ranges": [{"start": "PT1M", "end": "PT3M"}];
+//	    details a single "range"
+//
+// Both decode into the same Citation/Detail records; responses are unchanged.
+const (
+	APIVersion1       = 1
+	APIVersion2       = 2
+	DefaultAPIVersion = APIVersion1
+)
+
+// maxRangeMinutes bounds how many minutes one v2 range may expand to.
+const maxRangeMinutes = 24 * 60
+
+// HeaderValue looks up a request header case-insensitively; API Gateway does
+// not normalise header casing for payload format 1.0.
+func HeaderValue(req events.APIGatewayProxyRequest, name string) string {
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	for k, vs := range req.MultiValueHeaders {
+		if strings.EqualFold(k, name) && len(vs) > 0 {
+			return strings.Join(vs, ",")
+		}
+	}
+	return ""
+}
+
+// RequestAPIVersion returns the body version requested via X-Api-Version or
+// ?v= ("2" and "v2" are equivalent). The header wins if both are set.
+func RequestAPIVersion(req events.APIGatewayProxyRequest) (int, error) {
+	raw := strings.TrimSpace(HeaderValue(req, "X-Api-Version"))
+	if raw == "" {
+		raw = strings.TrimSpace(req.QueryStringParameters["v"])
+	}
+	if raw == "" {
+		return DefaultAPIVersion, nil
+	}
+	v, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(raw), "v"))
+	if err != nil || v < APIVersion1 || v > APIVersion2 {
+		return 0, fmt.Errorf("unsupported API version %q (supported: 1, 2)", raw)
+	}
+	return v, nil
+}
+
+// TimeRange is a v2 time span: ISO 8601 durations from the start of the
+// transcript, e.g. {"start": "PT1M", "end": "PT2M30S"}.
+type TimeRange struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Minutes converts the range to whole minutes (truncating seconds).
+func (r TimeRange) Minutes() (int, int, error) {
+	start, err := parseDurationMinutes(r.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseDurationMinutes(r.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("range end %s is before start %s", r.End, r.Start)
+	}
+	return start, end, nil
+}
+
+type citationV2 struct {
+	TranscriptID string      `json:"transcriptId"`
+	Ranges       []TimeRange `json:"ranges"`
+}
+
+// decodeCitations reads a citations array in the given body version. A
+// missing or null field yields nil.
+func decodeCitations(version int, raw json.RawMessage) ([]Citation, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if version == APIVersion1 {
+		var out []Citation
+		if err := DecodeJSON(string(raw), &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+	var in []citationV2
+	if err := DecodeJSON(string(raw), &in); err != nil {
+		return nil, err
+	}
+	out := make([]Citation, 0, len(in))
+	for _, c := range in {
+		citation := Citation{TranscriptID: c.TranscriptID, Minutes: []int{}}
+		seen := map[int]bool{}
+		for _, r := range c.Ranges {
+			start, end, err := r.Minutes()
+			if err != nil {
+				return nil, fmt.Errorf("citation %s: %w", c.TranscriptID, err)
+			}
+			if end-start >= maxRangeMinutes {
+				return nil, fmt.Errorf("citation %s: range %s-%s exceeds %d minutes", c.TranscriptID, r.Start, r.End, maxRangeMinutes)
+			}
+			for m := start; m <= end; m++ {
+				if !seen[m] {
+					seen[m] = true
+					citation.Minutes = append(citation.Minutes, m)
+				}
+			}
+		}
+		out = append(out, citation)
+	}
+	return out, nil
+}
+
+// decodeDetailMinutes returns a detail's start/end minutes: the v1 integer
+// fields, or the v2 range when one is given.
+func decodeDetailMinutes(version int, startMinute, endMinute int, r *TimeRange) (int, int, error) {
+	if version == APIVersion1 || r == nil {
+		return startMinute, endMinute, nil
+	}
+	return r.Minutes()
+}
+
+var isoDuration = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?$`)
+
+// parseDurationMinutes parses the time part of an ISO 8601 duration
+// ("PT1H2M3S") into whole minutes.
+func parseDurationMinutes(s string) (int, error) {
+	m := isoDuration.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil || (m[1] == "" && m[2] == "" && m[3] == "") {
+		return 0, fmt.Errorf("invalid duration %q (want ISO 8601, e.g. PT1M30S)", s)
+	}
+	hours, _ := strconv.Atoi(m[1])
+	minutes, _ := strconv.Atoi(m[2])
+	seconds, _ := strconv.ParseFloat(m[3], 64)
+	return hours*60 + minutes + int(seconds)/60, nil
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Event types sent to the webhook.
+const (
+	EventStoryCreated  = "story.created"
+	EventStoryUpdated  = "story.updated"
+	EventStoryImported = "story.imported"
+	EventStoryDeleted  = "story.deleted"
+	EventGraphUpdated  = "graph.updated"
+	EventGraphDeleted  = "graph.deleted"
+)
+
+// webhookTimeout bounds each delivery so a slow receiver cannot stall the request.
+const webhookTimeout = 2 * time.Second
+
+// HTTPDoer is the subset of *http.Client used for webhook delivery.
+type HTTPDoer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// ChangeEvent is the JSON body POSTed to WEBHOOK_URL.
+type ChangeEvent struct {
+	Type    string `json:"type"`
+	StoryID string `json:"storyId"`
+	At      string `json:"at"`
+}
+
+// SetWebhook enables change notifications to url. A nil client uses
+// http.DefaultClient; an empty url disables delivery.
+func (s *StoryService) SetWebhook(url string, client HTTPDoer) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	s.webhookURL = url
+	s.webhookClient = client
+}
+
+// SetChangeListener registers fn to run synchronously on every change, before
+// webhook delivery; main uses it to drop cached graph responses.
+func (s *StoryService) SetChangeListener(fn func(eventType, storyID string)) {
+	s.changeListener = fn
+}
+
+// NotifyChange informs the change listener and POSTs a ChangeEvent to the
+// configured webhook. Delivery is best-effort: failures are logged and never
+// surface to the caller. It runs synchronously because Lambda freezes the
+// process once the response is sent.
+func (s *StoryService) NotifyChange(ctx context.Context, eventType, storyID string) {
+	if s == nil {
+		return
+	}
+	if s.changeListener != nil {
+		s.changeListener(eventType, storyID)
+	}
+	if s.webhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(ChangeEvent{Type: eventType, StoryID: storyID, At: NowRFC3339UTC()})
+	if err != nil {
+		log.Printf("⚠️ Webhook %s for %s: %v", eventType, storyID, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("⚠️ Webhook %s for %s: %v", eventType, storyID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		log.Printf("⚠️ Webhook %s for %s failed: %v", eventType, storyID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("⚠️ Webhook %s for %s returned %d", eventType, storyID, resp.StatusCode)
+	}
+}
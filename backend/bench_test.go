@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// BenchmarkConcurrentSubmitAndGet mixes graph writes and reads across
+// benchStories stories, one write per four requests, through the handlers.
+// Run with -cpu=1,4,8 to see how the in-memory table scales with goroutines.
+func BenchmarkConcurrentSubmitAndGet(b *testing.B) {
+	const benchStories = 16
+	setupTestServices()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	ctx := context.Background()
+	bodies := make([]string, benchStories)
+	for i := range bodies {
+		bodies[i] = fmt.Sprintf(`{"storyId":"bench-%d","nodes":[{"id":"a","label":"A"},{"id":"b","label":"B"}],"edges":[{"id":"e1","from":"a","to":"b"}]}`, i)
+		if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: bodies[i]}); resp.StatusCode != 200 {
+			b.Fatalf("seed %d: %d %s", i, resp.StatusCode, resp.Body)
+		}
+	}
+	var seq atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := seq.Add(1)
+			story := int(n % benchStories)
+			if n%4 == 0 {
+				if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: bodies[story]}); resp.StatusCode != 200 {
+					b.Errorf("submit: %d", resp.StatusCode)
+				}
+				continue
+			}
+			id := fmt.Sprintf("bench-%d", story)
+			if resp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": id}}); resp.StatusCode != 200 {
+				b.Errorf("get: %d", resp.StatusCode)
+			}
+		}
+	})
+}
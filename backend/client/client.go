@@ -0,0 +1,279 @@
+// Package client calls the strukturbild API from other Go services. Story
+// payloads reuse the model types of package api; graph nodes and edges are
+// declared here in their wire form, as the server keeps them in its main
+// package.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	storyapi "strukturbild/api"
+)
+
+// Client is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	apiKey     string
+	user       string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithBearerToken sends token as "Authorization: Bearer", for APIs behind a
+// JWT authorizer.
+func WithBearerToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithAPIKey sends key as X-Api-Key, for API Gateway usage plans.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithUser sends user as X-User; the server records it as updatedBy when no
+// authorizer claim names the caller.
+func WithUser(user string) Option {
+	return func(c *Client) { c.user = user }
+}
+
+// New returns a client for the API at baseURL, e.g.
+// "https://abc.execute-api.eu-central-1.amazonaws.com".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimRight(baseURL, "/"), httpClient: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is a response with a status of 300 or above. Message is the "error"
+// field of a JSON body, otherwise the body text.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("strukturbild: %d %s", e.StatusCode, e.Message)
+}
+
+// Node is a graph node as the API sends and accepts it.
+type Node struct {
+	ID        string            `json:"id"`
+	Label     string            `json:"label"`
+	Detail    string            `json:"detail,omitempty"`
+	Type      string            `json:"type,omitempty"`
+	Time      string            `json:"time,omitempty"`
+	Color     string            `json:"color,omitempty"`
+	Shape     string            `json:"shape,omitempty"`
+	Icon      string            `json:"icon,omitempty"`
+	X         int               `json:"x"`
+	Y         int               `json:"y"`
+	UpdatedBy string            `json:"updatedBy,omitempty"`
+	CreatedAt string            `json:"createdAt,omitempty"`
+	UpdatedAt string            `json:"updatedAt,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty"`
+	Evidence  []string          `json:"evidence,omitempty"`
+	LabelI18n map[string]string `json:"labelI18n,omitempty"`
+}
+
+// Point is an edge waypoint.
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Edge is a graph edge as the API sends and accepts it.
+type Edge struct {
+	ID        string            `json:"id,omitempty"`
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Label     string            `json:"label"`
+	Detail    string            `json:"detail,omitempty"`
+	Type      string            `json:"type,omitempty"`
+	UpdatedBy string            `json:"updatedBy,omitempty"`
+	Waypoints []Point           `json:"waypoints,omitempty"`
+	Directed  *bool             `json:"directed,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty"`
+	Weight    *float64          `json:"weight,omitempty"`
+}
+
+// Graph is the body of SubmitGraph.
+type Graph struct {
+	StoryID string `json:"storyId"`
+	Nodes   []Node `json:"nodes"`
+	Edges   []Edge `json:"edges"`
+}
+
+// SubmitResult is the answer to SubmitGraph: the board size after the submit.
+type SubmitResult struct {
+	Message          string   `json:"message"`
+	StoryID          string   `json:"storyId"`
+	Nodes            int      `json:"nodes"`
+	Edges            int      `json:"edges"`
+	AutoCreatedNodes []string `json:"autoCreatedNodes,omitempty"`
+}
+
+// CreateStoryRequest is the body of CreateStory. StoryID is optional; the
+// server generates one when it is empty.
+type CreateStoryRequest struct {
+	StoryID  string `json:"storyId,omitempty"`
+	SchoolID string `json:"schoolId"`
+	Title    string `json:"title"`
+}
+
+// ImportParagraph is one paragraph of an import.
+type ImportParagraph struct {
+	ParagraphID string              `json:"paragraphId,omitempty"`
+	Index       int                 `json:"index"`
+	Title       string              `json:"title,omitempty"`
+	BodyMd      string              `json:"bodyMd"`
+	Citations   []storyapi.Citation `json:"citations,omitempty"`
+}
+
+// ImportDetail is one detail of an import, attached to the paragraph with
+// index ParagraphIndex.
+type ImportDetail struct {
+	ParagraphIndex int                  `json:"paragraphIndex"`
+	Kind           string               `json:"kind"`
+	TranscriptID   string               `json:"transcriptId,omitempty"`
+	StartMinute    int                  `json:"startMinute,omitempty"`
+	EndMinute      int                  `json:"endMinute,omitempty"`
+	Range          *storyapi.TimeRange  `json:"range,omitempty"`
+	Text           string               `json:"text,omitempty"`
+	Attachment     *storyapi.Attachment `json:"attachment,omitempty"`
+}
+
+// ImportRequest is the body of ImportStory. Nodes and edges, if any,
+// replace the story's graph.
+type ImportRequest struct {
+	Story      storyapi.Story    `json:"story"`
+	Paragraphs []ImportParagraph `json:"paragraphs"`
+	Details    []ImportDetail    `json:"details,omitempty"`
+	Nodes      []Node            `json:"nodes,omitempty"`
+	Edges      []Edge            `json:"edges,omitempty"`
+}
+
+// ImportResult is the answer to ImportStory.
+type ImportResult struct {
+	StoryID  string   `json:"storyId"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// CreateStory creates an empty story and returns its id.
+func (c *Client) CreateStory(ctx context.Context, in CreateStoryRequest) (string, error) {
+	var out struct {
+		StoryID string `json:"storyId"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/stories", in, &out); err != nil {
+		return "", err
+	}
+	return out.StoryID, nil
+}
+
+// ImportStory saves a story with its paragraphs and details in one request.
+func (c *Client) ImportStory(ctx context.Context, in ImportRequest) (*ImportResult, error) {
+	var out ImportResult
+	if err := c.do(ctx, http.MethodPost, "/api/stories/import", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetFullStory returns a story with its paragraphs and details.
+func (c *Client) GetFullStory(ctx context.Context, storyID string) (*storyapi.StoryFull, error) {
+	var out storyapi.StoryFull
+	if err := c.do(ctx, http.MethodGet, "/api/stories/"+url.PathEscape(storyID)+"/full", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SubmitGraph upserts the nodes and edges of a story's graph.
+func (c *Client) SubmitGraph(ctx context.Context, g Graph) (*SubmitResult, error) {
+	var out SubmitResult
+	if err := c.do(ctx, http.MethodPost, "/submit", g, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteNode removes one node of a story's graph.
+func (c *Client) DeleteNode(ctx context.Context, storyID, nodeID string) error {
+	return c.do(ctx, http.MethodDelete, "/struktur/"+url.PathEscape(storyID)+"/"+url.PathEscape(nodeID), nil, nil)
+}
+
+// do sends in as JSON (if not nil) and decodes a successful response into
+// out (if not nil).
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	// Citations are sent and read in the v1 shape of storyapi.Citation.
+	req.Header.Set("X-Api-Version", strconv.Itoa(storyapi.APIVersion1))
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-Api-Key", c.apiKey)
+	}
+	if c.user != "" {
+		req.Header.Set("X-User", c.user)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(data))
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			msg = e.Error
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("strukturbild: decode %s %s: %w", method, path, err)
+	}
+	return nil
+}
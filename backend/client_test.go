@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	storyapi "strukturbild/api"
+	"strukturbild/client"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// lambdaServer serves lambdaHandler over HTTP the way API Gateway maps requests.
+func lambdaServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := events.APIGatewayProxyRequest{
+			HTTPMethod:            r.Method,
+			Path:                  r.URL.Path,
+			Headers:               map[string]string{},
+			QueryStringParameters: map[string]string{},
+			Body:                  string(body),
+		}
+		for k := range r.Header {
+			req.Headers[k] = r.Header.Get(k)
+		}
+		for k, v := range r.URL.Query() {
+			req.QueryStringParameters[k] = v[0]
+		}
+		resp, err := lambdaHandler(r.Context(), req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		for k, v := range resp.Headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.WriteString(w, resp.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClientAgainstServer(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	srv := lambdaServer(t)
+	c := client.New(srv.URL+"/", client.WithUser("client-test"), client.WithBearerToken("t0ken"))
+
+	id, err := c.CreateStory(ctx, client.CreateStoryRequest{SchoolID: "s1", Title: "Created"})
+	if err != nil || id == "" {
+		t.Fatalf("CreateStory = %q, %v", id, err)
+	}
+	if _, err := c.CreateStory(ctx, client.CreateStoryRequest{StoryID: id, SchoolID: "s1", Title: "Again"}); !isStatus(err, 409) {
+		t.Fatalf("duplicate CreateStory: %v, want 409", err)
+	}
+	if _, err := c.CreateStory(ctx, client.CreateStoryRequest{SchoolID: "s1"}); !isStatus(err, 422) {
+		t.Fatalf("CreateStory without title: %v, want 422", err)
+	}
+
+	imported, err := c.ImportStory(ctx, client.ImportRequest{
+		Story: storyapi.Story{StoryID: "story-client", SchoolID: "s1", Title: "Imported"},
+		Paragraphs: []client.ImportParagraph{
+			{Index: 1, Title: "Eins", BodyMd: "Erster", Citations: []storyapi.Citation{{TranscriptID: "t1", Minutes: []int{3}}}},
+			{Index: 2, BodyMd: "Zweiter"},
+		},
+		Details: []client.ImportDetail{{ParagraphIndex: 1, Kind: "quote", TranscriptID: "t1", StartMinute: 3, EndMinute: 4, Text: "Zitat"}},
+	})
+	if err != nil || imported.StoryID != "story-client" {
+		t.Fatalf("ImportStory = %+v, %v", imported, err)
+	}
+
+	full, err := c.GetFullStory(ctx, "story-client")
+	if err != nil {
+		t.Fatalf("GetFullStory: %v", err)
+	}
+	if full.Story.Title != "Imported" || full.Story.UpdatedBy != "client-test" || len(full.Paragraphs) != 2 {
+		t.Fatalf("GetFullStory = %+v", full)
+	}
+	p1 := full.Paragraphs[0]
+	if len(p1.Citations) != 1 || p1.Citations[0].TranscriptID != "t1" || len(full.DetailsByParagraph[p1.ParagraphID]) != 1 {
+		t.Fatalf("paragraph 1 = %+v, details %+v", p1, full.DetailsByParagraph)
+	}
+	if _, err := c.GetFullStory(ctx, "no-such-story"); !isStatus(err, 404) {
+		t.Fatalf("GetFullStory of unknown story: %v, want 404", err)
+	}
+
+	res, err := c.SubmitGraph(ctx, client.Graph{
+		StoryID: "story-client",
+		Nodes:   []client.Node{{ID: "n1", Label: "A"}, {ID: "n2", Label: "B", Evidence: []string{p1.ParagraphID}}},
+		Edges:   []client.Edge{{ID: "e1", From: "n1", To: "n2", Label: "führt zu"}},
+	})
+	if err != nil || res.Nodes != 2 || res.Edges != 1 {
+		t.Fatalf("SubmitGraph = %+v, %v", res, err)
+	}
+	if _, err := c.SubmitGraph(ctx, client.Graph{Nodes: []client.Node{{ID: "n1"}}}); !isStatus(err, 422) {
+		t.Fatalf("SubmitGraph without storyId: %v, want 422", err)
+	}
+
+	if err := c.DeleteNode(ctx, "story-client", "n1"); err != nil {
+		t.Fatalf("DeleteNode: %v", err)
+	}
+	var apiErr *client.Error
+	if err := c.DeleteNode(ctx, "story-client", "n1"); !errors.As(err, &apiErr) || apiErr.StatusCode != 404 || apiErr.Message == "" {
+		t.Fatalf("second DeleteNode: %v, want 404 with a message", err)
+	}
+	nodes, _, err := loadGraph(ctx, "story-client")
+	if err != nil || len(nodes) != 1 || nodes[0].ID != "n2" || len(nodes[0].Evidence) != 1 {
+		t.Fatalf("graph after delete = %+v, %v", nodes, err)
+	}
+}
+
+func isStatus(err error, status int) bool {
+	var apiErr *client.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
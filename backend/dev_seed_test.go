@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestDevSeed(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	t.Setenv("LOCAL", "")
+	if resp, _ := dispatch(ctx, events.APIGatewayProxyRequest{}, "POST", "/api/dev/seed"); resp.StatusCode != 404 {
+		t.Fatalf("seed must be disabled without LOCAL=true, got %d", resp.StatusCode)
+	}
+
+	t.Setenv("LOCAL", "true")
+	resp, _ := dispatch(ctx, events.APIGatewayProxyRequest{}, "POST", "/api/dev/seed")
+	if resp.StatusCode != 200 {
+		t.Fatalf("seed failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if !strings.Contains(resp.Body, `"storyId":"story-rychenberg"`) {
+		t.Errorf("seed response should name the story: %s", resp.Body)
+	}
+	full, err := storySvc.GetFullStory(ctx, "story-rychenberg")
+	if err != nil || len(full.Paragraphs) == 0 {
+		t.Fatalf("seeded story not readable: %v", err)
+	}
+	nodes, edges, err := loadGraph(ctx, "story-rychenberg")
+	if err != nil || len(nodes) != 7 || len(edges) != 6 {
+		t.Fatalf("seeded graph: %d nodes, %d edges, err %v", len(nodes), len(edges), err)
+	}
+}
+
+func TestReloadFixturesOnlyWhenChanged(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	story, _ := seedFS.ReadFile("seed/story-rychenberg.json")
+	graph, _ := seedFS.ReadFile("seed/graph-rychenberg.json")
+	fsys := fstest.MapFS{
+		"story-rychenberg.json": {Data: story},
+		"graph-rychenberg.json": {Data: graph},
+	}
+	loader := newFixtureLoader(fsys)
+
+	first, err := loader.ReloadFixtures(ctx, false)
+	if err != nil || len(first) != 1 || first[0].Skipped || first[0].Nodes != 7 {
+		t.Fatalf("first load: %+v %v", first, err)
+	}
+	again, err := loader.ReloadFixtures(ctx, false)
+	if err != nil || len(again) != 1 || !again[0].Skipped || again[0].StoryID != "story-rychenberg" {
+		t.Fatalf("unchanged fixtures should be skipped: %+v %v", again, err)
+	}
+
+	var g Strukturbild
+	if err := json.Unmarshal(graph, &g); err != nil {
+		t.Fatal(err)
+	}
+	g.Nodes = append(g.Nodes, Node{ID: "n-extra", Label: "Neu"})
+	changed, _ := json.Marshal(g)
+	fsys["graph-rychenberg.json"] = &fstest.MapFile{Data: changed}
+
+	reloaded, err := loader.ReloadFixtures(ctx, false)
+	if err != nil || len(reloaded) != 1 || reloaded[0].Skipped || reloaded[0].Nodes != 8 {
+		t.Fatalf("changed fixture not reloaded: %+v %v", reloaded, err)
+	}
+	if nodes, _, _ := loadGraph(ctx, "story-rychenberg"); len(nodes) != 8 {
+		t.Fatalf("expected the new node in the table, got %d nodes", len(nodes))
+	}
+	if forced, _ := loader.ReloadFixtures(ctx, true); len(forced) != 1 || forced[0].Skipped {
+		t.Fatalf("force should reload: %+v", forced)
+	}
+}
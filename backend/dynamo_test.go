@@ -2,174 +2,194 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"sort"
+	"errors"
 	"strings"
-	"sync"
+	"testing"
 
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	storyapi "strukturbild/api"
 )
 
-type memoryDynamo struct {
-	mu    sync.Mutex
-	items map[string]map[string]map[string]types.AttributeValue
+func setupTestServices() {
+	keySchema = storyapi.DefaultKeySchema
+	if err := useStore(newMemoryDynamo()); err != nil {
+		panic(err)
+	}
+	strukturCache = nil
+	devFixtures = newFixtureLoader(defaultSeedFS())
+	analyticsCache.summary = nil
 }
 
-func newMemoryDynamo() *memoryDynamo {
-	return &memoryDynamo{items: make(map[string]map[string]map[string]types.AttributeValue)}
-}
+func TestStoreBackendSelection(t *testing.T) {
+	ctx := context.Background()
+	keySchema = storyapi.DefaultKeySchema
 
-func cloneAttrMap(src map[string]types.AttributeValue) map[string]types.AttributeValue {
-	cloned := make(map[string]types.AttributeValue, len(src))
-	for k, v := range src {
-		cloned[k] = cloneAttr(v)
+	mem, err := newStore(ctx, "Memory")
+	if err != nil {
+		t.Fatalf("memory: %v", err)
+	}
+	key := keySchema.Key("story-store", "n1")
+	item := keySchema.Key("story-store", "n1")
+	item["label"] = &types.AttributeValueMemberS{Value: "A"}
+	if _, err := mem.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: item}); err != nil {
+		t.Fatalf("memory put: %v", err)
+	}
+	got, err := mem.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(tableName), Key: key})
+	if err != nil || getStringAttr(got.Item["label"]) != "A" {
+		t.Fatalf("memory get: %v %v", got, err)
+	}
+	if _, err := mem.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: aws.String(tableName), Key: key}); err != nil {
+		t.Fatalf("memory delete: %v", err)
+	}
+	if got, _ := mem.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(tableName), Key: key}); got.Item != nil {
+		t.Fatalf("memory item survived delete: %v", got.Item)
+	}
+	if other, _ := newStore(ctx, storeMemory); other == mem {
+		t.Fatalf("each memory store must be separate")
 	}
-	return cloned
-}
 
-func cloneAttr(attr types.AttributeValue) types.AttributeValue {
-	switch v := attr.(type) {
-	case *types.AttributeValueMemberS:
-		return &types.AttributeValueMemberS{Value: v.Value}
-	case *types.AttributeValueMemberN:
-		return &types.AttributeValueMemberN{Value: v.Value}
-	case *types.AttributeValueMemberBOOL:
-		return &types.AttributeValueMemberBOOL{Value: v.Value}
-	case *types.AttributeValueMemberL:
-		out := make([]types.AttributeValue, len(v.Value))
-		for i, child := range v.Value {
-			out[i] = cloneAttr(child)
+	t.Setenv("AWS_REGION", "eu-central-1")
+	for _, backend := range []string{"", "dynamo"} {
+		store, err := newStore(ctx, backend)
+		if err != nil {
+			t.Fatalf("%q: %v", backend, err)
+		}
+		if _, ok := store.(*dynamodb.Client); !ok {
+			t.Fatalf("%q should select DynamoDB, got %T", backend, store)
 		}
-		return &types.AttributeValueMemberL{Value: out}
-	case *types.AttributeValueMemberM:
-		return &types.AttributeValueMemberM{Value: cloneAttrMap(v.Value)}
-	default:
-		return attr
 	}
-}
 
-func (m *memoryDynamo) PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
-	pk := getStringAttr(input.Item["storyId"])
-	sk := getStringAttr(input.Item["id"])
-	if pk == "" || sk == "" {
-		return nil, fmt.Errorf("missing keys")
-	}
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	bucket, ok := m.items[pk]
-	if !ok {
-		bucket = make(map[string]map[string]types.AttributeValue)
-		m.items[pk] = bucket
-	}
-	bucket[sk] = cloneAttrMap(input.Item)
-	return &dynamodb.PutItemOutput{}, nil
-}
-
-func (m *memoryDynamo) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
-	pk := getStringAttr(input.ExpressionAttributeValues[":sid"])
-	m.mu.Lock()
-	bucket := m.items[pk]
-	m.mu.Unlock()
-	if bucket == nil {
-		return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{}}, nil
-	}
-	items := make([]map[string]types.AttributeValue, 0, len(bucket))
-	for _, item := range bucket {
-		if matchesFilter(item, input.FilterExpression, input.ExpressionAttributeValues) {
-			items = append(items, cloneAttrMap(item))
+	for _, backend := range []string{"hybrid", "redis"} {
+		if _, err := newStore(ctx, backend); err == nil || !strings.Contains(err.Error(), backend) {
+			t.Fatalf("%q should be rejected by name, got %v", backend, err)
 		}
 	}
-	sort.Slice(items, func(i, j int) bool {
-		return getStringAttr(items[i]["id"]) < getStringAttr(items[j]["id"])
-	})
-	return &dynamodb.QueryOutput{Items: items}, nil
 }
 
-func (m *memoryDynamo) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
-	pk := getStringAttr(input.Key["storyId"])
-	sk := getStringAttr(input.Key["id"])
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if bucket, ok := m.items[pk]; ok {
-		delete(bucket, sk)
-		if len(bucket) == 0 {
-			delete(m.items, pk)
+func TestHandlersOnMemoryBackend(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	db, err := newStore(ctx, storeMemory)
+	if err != nil {
+		t.Fatalf("memory: %v", err)
+	}
+	if err := useStore(db); err != nil {
+		t.Fatalf("use memory store: %v", err)
+	}
+	call := func(method, path, body string, want int) string {
+		t.Helper()
+		resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: method, Path: path, Body: body})
+		if resp.StatusCode != want {
+			t.Fatalf("%s %s: want %d, got %d %s", method, path, want, resp.StatusCode, resp.Body)
 		}
+		return resp.Body
 	}
-	return &dynamodb.DeleteItemOutput{}, nil
-}
 
-func (m *memoryDynamo) GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
-	pk := getStringAttr(input.Key["storyId"])
-	sk := getStringAttr(input.Key["id"])
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if bucket, ok := m.items[pk]; ok {
-		if item, ok := bucket[sk]; ok {
-			return &dynamodb.GetItemOutput{Item: cloneAttrMap(item)}, nil
-		}
+	call("POST", "/api/stories/import", `{"story":{"storyId":"story-mem","schoolId":"s","title":"Mem"},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins"}],
+		"nodes":[{"id":"n1","label":"A"},{"id":"n2","label":"B"}],"edges":[{"from":"n1","to":"n2"}]}`, 200)
+	call("POST", "/submit", `{"storyId":"story-mem","nodes":[{"id":"n3","label":"C"}]}`, 200)
+	if body := call("GET", "/struktur/story-mem", "", 200); !strings.Contains(body, `"id":"n3"`) || !strings.Contains(body, `"title":"Mem"`) {
+		t.Fatalf("graph and story should come back together: %s", body)
+	}
+	if body := call("GET", "/api/stories/story-mem/full", "", 200); !strings.Contains(body, `"paragraphId":"para-1"`) {
+		t.Fatalf("full story incomplete: %s", body)
 	}
-	return &dynamodb.GetItemOutput{}, nil
+	call("DELETE", "/struktur/story-mem/n3", "", 200)
+	call("DELETE", "/struktur/story-mem/n3", "", 404)
+	call("DELETE", "/api/stories/story-mem", "", 200)
+	call("GET", "/struktur/story-mem", "", 404)
 }
 
-func (m *memoryDynamo) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	var items []map[string]types.AttributeValue
-	for _, bucket := range m.items {
-		for _, item := range bucket {
-			if matchesFilter(item, input.FilterExpression, input.ExpressionAttributeValues) {
-				items = append(items, cloneAttrMap(item))
-			}
-		}
+func TestUseStoreSwitchesHandlersTogether(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	first := svc
+	body := `{"story":{"storyId":"story-a","schoolId":"s","title":"A"},"paragraphs":[{"index":1,"bodyMd":"Eins"}],"nodes":[{"id":"n1","label":"A"}]}`
+	if resp, _ := importStoryHandler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
 	}
-	sort.Slice(items, func(i, j int) bool {
-		return getStringAttr(items[i]["id"]) < getStringAttr(items[j]["id"])
-	})
-	return &dynamodb.ScanOutput{Items: items}, nil
-}
 
-func matchesFilter(item map[string]types.AttributeValue, filter *string, expr map[string]types.AttributeValue) bool {
-	if filter == nil || *filter == "" {
-		return true
-	}
-	trimmed := strings.TrimSpace(*filter)
-	switch {
-	case trimmed == "paragraphId = :paragraphId":
-		want := getStringAttr(expr[":paragraphId"])
-		return getStringAttr(item["paragraphId"]) == want
-	case strings.HasPrefix(trimmed, "begins_with(") && strings.HasSuffix(trimmed, ")"):
-		inner := strings.TrimSuffix(strings.TrimPrefix(trimmed, "begins_with("), ")")
-		parts := strings.Split(inner, ",")
-		if len(parts) != 2 {
-			return true
-		}
-		field := strings.TrimSpace(parts[0])
-		token := strings.TrimSpace(parts[1])
-		attr := item[field]
-		prefix := getStringAttr(expr[token])
-		if v, ok := attr.(*types.AttributeValueMemberS); ok {
-			return strings.HasPrefix(v.Value, prefix)
-		}
-		return false
-	default:
-		return true
+	if err := useStore(newMemoryDynamo()); err != nil {
+		t.Fatalf("use second store: %v", err)
+	}
+	if _, err := storySvc.GetFullStory(ctx, "story-a"); !errors.Is(err, storyapi.ErrStoryNotFound) {
+		t.Fatalf("story leaked into the second store: %v", err)
+	}
+	if nodes, _, _ := loadGraph(ctx, "story-a"); len(nodes) != 0 {
+		t.Fatalf("graph leaked into the second store: %v", nodes)
 	}
-}
 
-func getStringAttr(attr types.AttributeValue) string {
-	if v, ok := attr.(*types.AttributeValueMemberS); ok {
-		return v.Value
+	if err := useStore(first); err != nil {
+		t.Fatalf("use first store: %v", err)
+	}
+	if _, err := storySvc.GetFullStory(ctx, "story-a"); err != nil {
+		t.Fatalf("story missing from the first store: %v", err)
+	}
+	if nodes, _, _ := loadGraph(ctx, "story-a"); len(nodes) != 1 {
+		t.Fatalf("graph missing from the first store: %v", nodes)
 	}
-	return ""
 }
 
-func setupTestServices() {
-	mem := newMemoryDynamo()
-	svc = mem
-	storySvc = storyapi.NewStoryService(svc, tableName, corsHeaders)
-}
+func TestHandlersUseTheStoreTheyAreGiven(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	installed := currentStore()
+	// A second table with its own story service, next to the installed one.
+	other := &tableStore{db: newMemoryDynamo(), table: tableName, keys: keySchema}
+	stories, err := storyapi.NewStoryService(other.db, tableName, corsHeaders)
+	if err != nil {
+		t.Fatalf("story service: %v", err)
+	}
+	other.stories = stories
+
+	full := &storyapi.StoryFull{
+		Story:      storyapi.Story{StoryID: "story-inj", SchoolID: "school-inj", Title: "Injected"},
+		Paragraphs: []storyapi.Paragraph{{ParagraphID: "para-1", Index: 1, BodyMd: "Eins"}},
+	}
+	if err := other.SetStoryBundle(ctx, full); err != nil {
+		t.Fatalf("set story bundle: %v", err)
+	}
+	if err := other.UpsertGraph(ctx, []DBItem{
+		{ID: "n1", StoryID: "story-inj", Label: "A", IsNode: true},
+		{ID: "n2", StoryID: "story-inj", Label: "B", IsNode: true},
+		{ID: "e1", StoryID: "story-inj", From: "n1", To: "n2"},
+	}); err != nil {
+		t.Fatalf("upsert graph: %v", err)
+	}
 
-var _ storyapi.DynamoClient = (*memoryDynamo)(nil)
+	school := events.APIGatewayProxyRequest{PathParameters: map[string]string{"schoolId": "school-inj"}}
+	if resp, _ := schoolGraphsHandler(installed, ctx, school); resp.StatusCode != 404 {
+		t.Fatalf("installed store has no such school, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := schoolGraphsHandler(other, ctx, school); resp.StatusCode != 200 || !strings.Contains(resp.Body, `"id":"n2"`) {
+		t.Fatalf("expected the graph of the given store, got %d %s", resp.StatusCode, resp.Body)
+	}
+
+	del := events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "story-inj", "nodeId": "n2"}}
+	if resp, _ := deleteHandler(installed, ctx, del); resp.StatusCode != 404 {
+		t.Fatalf("delete in the installed store should miss, got %d", resp.StatusCode)
+	}
+	if resp, _ := deleteHandler(other, ctx, del); resp.StatusCode != 200 {
+		t.Fatalf("delete failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if nodes, edges, err := other.GetGraph(ctx, "story-inj"); err != nil || len(nodes) != 1 || len(edges) != 1 {
+		t.Fatalf("expected n1 and e1 left, got %+v %+v %v", nodes, edges, err)
+	}
+
+	// A bundle replaces the stored narrative, paragraphs included.
+	full.Paragraphs = []storyapi.Paragraph{{ParagraphID: "para-2", Index: 1, BodyMd: "Neu"}}
+	if err := other.SetStoryBundle(ctx, full); err != nil {
+		t.Fatalf("set story bundle: %v", err)
+	}
+	got, err := other.GetStoryFull(ctx, "story-inj")
+	if err != nil || got.Story.Title != "Injected" || len(got.Paragraphs) != 1 || got.Paragraphs[0].ParagraphID != "para-2" {
+		t.Fatalf("unexpected story %+v, %v", got, err)
+	}
+	if _, err := installed.GetStoryFull(ctx, "story-inj"); !errors.Is(err, storyapi.ErrStoryNotFound) {
+		t.Fatalf("installed store should not see the story, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// writeAllStoriesNDJSON writes every story, with its graph, as one JSON line
+// (the storyBundle of the school zip export). Story headers are read page by
+// page and each bundle is loaded only when it is written, so memory stays at
+// one story; flush runs after every line. It returns the number of lines.
+func writeAllStoriesNDJSON(ctx context.Context, w io.Writer, flush func()) (int, error) {
+	enc := json.NewEncoder(w)
+	written := 0
+	err := storySvc.ForEachStory(ctx, func(st storyapi.Story) error {
+		full, err := storySvc.GetFullStory(ctx, st.StoryID)
+		if err != nil {
+			return err
+		}
+		nodes, edges, err := loadGraph(ctx, st.StoryID)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(storyBundle{StoryFull: *full, Nodes: nodes, Edges: edges}); err != nil {
+			return err
+		}
+		written++
+		flush()
+		return nil
+	})
+	return written, err
+}
+
+// exportAllNDJSONHandler exports the whole deployment as NDJSON, one story per
+// line. API Gateway proxy integrations cannot stream a Lambda response, so
+// here the lines are collected first and the export is bounded by the 6 MB
+// response limit; deployments that need more serve exportAllNDJSONHTTP from
+// an HTTP server, which streams.
+// Route: GET /api/export/all.ndjson
+func exportAllNDJSONHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var buf bytes.Buffer
+	if _, err := writeAllStoriesNDJSON(ctx, &buf, func() {}); err != nil {
+		log.Printf("❌ Failed to export stories: %v", err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to export stories"}, nil
+	}
+	h := corsHeaders()
+	h["Content-Type"] = "application/x-ndjson"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: buf.String()}, nil
+}
+
+// exportAllNDJSONHTTP streams the same export over net/http, flushing after
+// every story. A failure after the first line cannot change the status, so
+// the connection is aborted and the client sees a truncated response rather
+// than a complete-looking one.
+func exportAllNDJSONHTTP(w http.ResponseWriter, r *http.Request) {
+	h := corsHeaders()
+	setCORSOrigin(h, r.Header.Get("Origin"))
+	for k, v := range h {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flush := func() {}
+	if f, ok := w.(http.Flusher); ok {
+		flush = f.Flush
+	}
+	written, err := writeAllStoriesNDJSON(r.Context(), w, flush)
+	if err == nil {
+		return
+	}
+	log.Printf("❌ Story export failed after %d stories: %v", written, err)
+	if written == 0 {
+		http.Error(w, "Failed to export stories", http.StatusInternalServerError)
+		return
+	}
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// adjacencyEntry is one outgoing relation in an adjacency list.
+type adjacencyEntry struct {
+	To    string `json:"to"`
+	Type  string `json:"type,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+// adjacencyHandler serves a story graph as adjacency lists keyed by node id,
+// for analysis tools that prefer them over node and edge arrays. An edge is
+// listed under its source, and under its target as well when it is undirected
+// (see Edge.IsDirected); ?directed=false lists every edge both ways. Nodes
+// without any edge are listed in isolatedNodes.
+// Route: GET /api/stories/{storyId}/adjacency?directed=
+func adjacencyHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	symmetric := false
+	switch req.QueryStringParameters["directed"] {
+	case "", "true":
+	case "false":
+		symmetric = true
+	default:
+		return badInput("directed must be true or false"), nil
+	}
+	nodes, edges, err := loadGraph(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to load graph for %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	adjacency, isolated := adjacencyLists(nodes, edges, symmetric)
+	body, _ := json.Marshal(struct {
+		StoryID       string                      `json:"storyId"`
+		Directed      bool                        `json:"directed"`
+		Adjacency     map[string][]adjacencyEntry `json:"adjacency"`
+		IsolatedNodes []string                    `json:"isolatedNodes"`
+	}{storyID, !symmetric, adjacency, isolated})
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
+
+// adjacencyLists builds the lists with entries sorted by target, type and
+// label; isolated node ids keep the graph's node order.
+func adjacencyLists(nodes []Node, edges []Edge, symmetric bool) (map[string][]adjacencyEntry, []string) {
+	adjacency := map[string][]adjacencyEntry{}
+	touched := map[string]bool{}
+	for _, e := range edges {
+		adjacency[e.From] = append(adjacency[e.From], adjacencyEntry{To: e.To, Type: e.Type, Label: e.Label})
+		if e.To != e.From && (symmetric || !e.IsDirected()) {
+			adjacency[e.To] = append(adjacency[e.To], adjacencyEntry{To: e.From, Type: e.Type, Label: e.Label})
+		}
+		touched[e.From], touched[e.To] = true, true
+	}
+	for _, list := range adjacency {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].To != list[j].To {
+				return list[i].To < list[j].To
+			}
+			if list[i].Type != list[j].Type {
+				return list[i].Type < list[j].Type
+			}
+			return list[i].Label < list[j].Label
+		})
+	}
+	isolated := []string{}
+	for _, n := range nodes {
+		if !touched[n.ID] {
+			isolated = append(isolated, n.ID)
+		}
+	}
+	return adjacency, isolated
+}
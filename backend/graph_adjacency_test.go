@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestAdjacencyLists(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	seedSchoolStory(t, ctx, "story-adj", "s", []Node{{ID: "a", Label: "A"}, {ID: "b", Label: "B"}, {ID: "c", Label: "C"}, {ID: "d", Label: "D"}},
+		[]Edge{{From: "a", To: "b", Label: "treibt", Type: "causes"}, {From: "b", To: "c", Label: "nah", Type: "relates"}, {From: "c", To: "a", Label: "hemmt", Type: "blocks"}})
+
+	type result struct {
+		Adjacency     map[string][]adjacencyEntry `json:"adjacency"`
+		IsolatedNodes []string                    `json:"isolatedNodes"`
+	}
+	fetch := func(storyID, directed string) result {
+		t.Helper()
+		resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"directed": directed}},
+			"GET", "/api/stories/"+storyID+"/adjacency")
+		var out result
+		if err := json.Unmarshal([]byte(resp.Body), &out); err != nil || resp.StatusCode != 200 {
+			t.Fatalf("adjacency failed: %d %s", resp.StatusCode, resp.Body)
+		}
+		return out
+	}
+
+	got := fetch("story-adj", "")
+	want := map[string][]adjacencyEntry{
+		"a": {{To: "b", Type: "causes", Label: "treibt"}},
+		"b": {{To: "c", Type: "relates", Label: "nah"}},
+		// "relates" is undirected, so c reaches b as well.
+		"c": {{To: "a", Type: "blocks", Label: "hemmt"}, {To: "b", Type: "relates", Label: "nah"}},
+	}
+	if !reflect.DeepEqual(got.Adjacency, want) || !reflect.DeepEqual(got.IsolatedNodes, []string{"d"}) {
+		t.Fatalf("unexpected directed adjacency: %+v", got)
+	}
+
+	got = fetch("story-adj", "false")
+	want = map[string][]adjacencyEntry{
+		"a": {{To: "b", Type: "causes", Label: "treibt"}, {To: "c", Type: "blocks", Label: "hemmt"}},
+		"b": {{To: "a", Type: "causes", Label: "treibt"}, {To: "c", Type: "relates", Label: "nah"}},
+		"c": {{To: "a", Type: "blocks", Label: "hemmt"}, {To: "b", Type: "relates", Label: "nah"}},
+	}
+	if !reflect.DeepEqual(got.Adjacency, want) {
+		t.Fatalf("unexpected symmetric adjacency: %+v", got.Adjacency)
+	}
+
+	if got := fetch("story-empty", ""); got.Adjacency == nil || len(got.Adjacency) != 0 || got.IsolatedNodes == nil || len(got.IsolatedNodes) != 0 {
+		t.Fatalf("expected empty structures for an empty graph, got %+v", got)
+	}
+	if resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"directed": "nein"}},
+		"GET", "/api/stories/story-adj/adjacency"); resp.StatusCode != 400 {
+		t.Fatalf("expected 400 for an invalid directed value, got %d", resp.StatusCode)
+	}
+}
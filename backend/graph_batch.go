@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// POST /api/graphs/batch: ids per request, concurrent reads and the inline
+// error reported for ids without a graph.
+const (
+	maxBatchGraphs     = 25
+	batchGraphWorkers  = 5
+	batchGraphNotFound = "not found"
+)
+
+// batchGraph is one entry of the batch response; Error is set instead of
+// Nodes/Edges when that story could not be read.
+type batchGraph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+	Error string `json:"error,omitempty"`
+}
+
+// batchGraphsHandler loads several graphs in one call for comparative views.
+// Route: POST /api/graphs/batch  {"storyIds":[...]}
+func batchGraphsHandler(st Store, ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var in struct {
+		StoryIDs []string `json:"storyIds"`
+	}
+	if err := storyapi.DecodeJSON(req.Body, &in); err != nil {
+		return badInput(err.Error()), nil
+	}
+	seen := map[string]bool{}
+	var ids []string
+	for _, id := range in.StoryIDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return unprocessable("storyIds must not be empty"), nil
+	}
+	if len(ids) > maxBatchGraphs {
+		return unprocessable(fmt.Sprintf("Too many storyIds: %d (limit %d)", len(ids), maxBatchGraphs)), nil
+	}
+
+	graphs := loadGraphs(ctx, st, ids, batchGraphWorkers)
+
+	body, err := json.Marshal(map[string]map[string]batchGraph{"graphs": graphs})
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to encode response"}, nil
+	}
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
+
+// loadGraphs reads each story's graph with at most workers concurrent reads.
+// Once ctx is done, the remaining ids are reported with the context error.
+func loadGraphs(ctx context.Context, st Store, ids []string, workers int) map[string]batchGraph {
+	out := make(map[string]batchGraph, len(ids))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for _, id := range ids {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			out[id] = batchGraph{Error: ctx.Err().Error()}
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var g batchGraph
+			nodes, edges, err := st.GetGraph(ctx, id)
+			switch {
+			case err != nil:
+				log.Printf("❌ Batch load of graph %s failed: %v", id, err)
+				g.Error = "Failed to fetch data"
+			case len(nodes) == 0 && len(edges) == 0:
+				g.Error = batchGraphNotFound
+			default:
+				g.Nodes, g.Edges = nodes, edges
+			}
+			mu.Lock()
+			out[id] = g
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return out
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// strukturCache holds assembled GET /struktur/{id} responses. It is off unless
+// STRUKTUR_CACHE_SIZE > 0. Invalidation only reaches this process, so another
+// Lambda instance may serve a stale board for up to STRUKTUR_CACHE_TTL_SECONDS.
+var strukturCache = newGraphCache(envInt("STRUKTUR_CACHE_SIZE", 0), time.Duration(envInt("STRUKTUR_CACHE_TTL_SECONDS", 30))*time.Second)
+
+// graphCache is a bounded LRU with per-entry expiry, keyed by storyId.
+// A nil *graphCache is a valid, disabled cache.
+type graphCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	order   *list.List // front = most recently used
+	entries map[string]*list.Element
+}
+
+type graphCacheEntry struct {
+	storyID string
+	value   Strukturbild
+	expires time.Time
+}
+
+func newGraphCache(size int, ttl time.Duration) *graphCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &graphCache{size: size, ttl: ttl, now: time.Now, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *graphCache) get(storyID string) (Strukturbild, bool) {
+	if c == nil {
+		return Strukturbild{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[storyID]
+	if !ok {
+		return Strukturbild{}, false
+	}
+	entry := el.Value.(*graphCacheEntry)
+	if c.now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, storyID)
+		return Strukturbild{}, false
+	}
+	c.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (c *graphCache) put(storyID string, sb Strukturbild) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.entries[storyID]; ok {
+		el.Value = &graphCacheEntry{storyID: storyID, value: sb, expires: expires}
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[storyID] = c.order.PushFront(&graphCacheEntry{storyID: storyID, value: sb, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*graphCacheEntry).storyID)
+	}
+}
+
+func (c *graphCache) invalidate(storyID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[storyID]; ok {
+		c.order.Remove(el)
+		delete(c.entries, storyID)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Per-response cap on stories in a school export; clients page with ?cursor=.
+const (
+	defaultSchoolGraphLimit = 20
+	maxSchoolGraphLimit     = 50
+)
+
+type storyGraph struct {
+	Title string `json:"title,omitempty"`
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// schoolGraphsHandler exports the graphs of all stories belonging to a school.
+// Route: GET /api/schools/{schoolId}/graphs?format=json|dot|mermaid&limit=&cursor=
+func schoolGraphsHandler(st Store, ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	schoolID := req.PathParameters["schoolId"]
+	if strings.TrimSpace(schoolID) == "" {
+		return badInput("Missing schoolId"), nil
+	}
+	format := strings.ToLower(req.QueryStringParameters["format"])
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "dot" && format != "mermaid" {
+		return badInput("format must be json, dot or mermaid"), nil
+	}
+	limit := defaultSchoolGraphLimit
+	if v := req.QueryStringParameters["limit"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return badInput("limit must be a positive integer"), nil
+		}
+		limit = min(n, maxSchoolGraphLimit)
+	}
+	cursor, err := storyapi.DecodeCursor(req.QueryStringParameters["cursor"])
+	if err != nil {
+		return badInput(err.Error()), nil
+	}
+	offset := cursor.Offset
+
+	stories, err := st.ListStories(ctx)
+	if err != nil {
+		log.Printf("❌ Failed to list stories for school %s: %v", schoolID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to list stories"}, nil
+	}
+	var storyIDs []string
+	titles := map[string]string{}
+	for _, story := range stories {
+		if story.SchoolID == schoolID {
+			storyIDs = append(storyIDs, story.StoryID)
+			titles[story.StoryID] = story.Title
+		}
+	}
+	if len(storyIDs) == 0 {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "No stories for school"}, nil
+	}
+
+	nextCursor := ""
+	if offset >= len(storyIDs) {
+		storyIDs = nil
+	} else {
+		storyIDs = storyIDs[offset:]
+		if len(storyIDs) > limit {
+			storyIDs = storyIDs[:limit]
+			nextCursor = storyapi.Cursor{Offset: offset + limit}.Encode()
+		}
+	}
+
+	graphs := make(map[string]storyGraph, len(storyIDs))
+	for _, id := range storyIDs {
+		nodes, edges, err := st.GetGraph(ctx, id)
+		if err != nil {
+			log.Printf("❌ Failed to load graph for %s: %v", id, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+		}
+		graphs[id] = storyGraph{Title: titles[id], Nodes: nodes, Edges: edges}
+	}
+
+	h := corsHeaders()
+	if nextCursor != "" {
+		h["X-Next-Cursor"] = nextCursor
+	}
+	switch format {
+	case "dot":
+		h["Content-Type"] = "text/vnd.graphviz"
+		return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: graphsToDOT(storyIDs, graphs)}, nil
+	case "mermaid":
+		h["Content-Type"] = "text/plain; charset=utf-8"
+		return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: graphsToMermaid(storyIDs, graphs)}, nil
+	}
+
+	body, err := json.Marshal(struct {
+		SchoolID   string                `json:"schoolId"`
+		Graphs     map[string]storyGraph `json:"graphs"`
+		HasMore    bool                  `json:"hasMore"`
+		NextCursor string                `json:"nextCursor,omitempty"`
+	}{schoolID, graphs, nextCursor != "", nextCursor})
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to encode response"}, nil
+	}
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
+
+// graphsToDOT renders one Graphviz cluster per story; node ids are prefixed
+// with the storyId so that equal ids in different stories stay distinct.
+func graphsToDOT(order []string, graphs map[string]storyGraph) string {
+	var b strings.Builder
+	b.WriteString("digraph strukturbild {\n")
+	for _, sid := range order {
+		g := graphs[sid]
+		fmt.Fprintf(&b, "  subgraph %s {\n", strconv.Quote("cluster_"+sid))
+		fmt.Fprintf(&b, "    label=%s;\n", strconv.Quote(chooseTitle(g.Title, sid)))
+		for _, n := range g.Nodes {
+			fmt.Fprintf(&b, "    %s [label=%s%s];\n", strconv.Quote(sid+"/"+n.ID), strconv.Quote(n.Label), dotShapes[styleFor(n).Shape])
+		}
+		for _, e := range g.Edges {
+			attrs := "label=" + strconv.Quote(e.Label)
+			if !e.IsDirected() {
+				attrs += ", dir=none"
+			}
+			if e.Weight != nil {
+				attrs += ", penwidth=" + strconv.FormatFloat(*e.Weight, 'g', -1, 64)
+			}
+			fmt.Fprintf(&b, "    %s -> %s [%s];\n", strconv.Quote(sid+"/"+e.From), strconv.Quote(sid+"/"+e.To), attrs)
+		}
+		b.WriteString("  }\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotShapes maps node shapes to Graphviz attributes.
+var dotShapes = map[string]string{
+	"rectangle":       ", shape=box",
+	"round-rectangle": ", shape=box, style=rounded",
+	"ellipse":         ", shape=ellipse",
+	"diamond":         ", shape=diamond",
+	"hexagon":         ", shape=hexagon",
+}
+
+// storyBundle is one file of a school export: the full story plus its graph.
+type storyBundle struct {
+	storyapi.StoryFull
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+var zipNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// zipEntryName is the file name of a story in the school archive. Ids that
+// only differ in characters unsafe for file names get -2, -3, ... so that no
+// story replaces another on extraction.
+func zipEntryName(used map[string]bool, storyID string) string {
+	base := zipNameUnsafe.ReplaceAllString(storyID, "_")
+	name := base + ".json"
+	for n := 2; used[name]; n++ {
+		name = fmt.Sprintf("%s-%d.json", base, n)
+	}
+	used[name] = true
+	return name
+}
+
+// schoolExportZipHandler archives every story of a school as one JSON bundle
+// per story. Stories are loaded and written one at a time, so only the zip
+// itself grows with the school. The body is base64-encoded for API Gateway.
+// Route: GET /api/schools/{schoolId}/export.zip
+func schoolExportZipHandler(st Store, ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	schoolID := req.PathParameters["schoolId"]
+	if strings.TrimSpace(schoolID) == "" {
+		return badInput("Missing schoolId"), nil
+	}
+	stories, err := st.ListStories(ctx)
+	if err != nil {
+		log.Printf("❌ Failed to list stories for school %s: %v", schoolID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to list stories"}, nil
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	written := 0
+	used := map[string]bool{}
+	for _, story := range stories {
+		if story.SchoolID != schoolID {
+			continue
+		}
+		full, err := st.GetStoryFull(ctx, story.StoryID)
+		if err != nil {
+			log.Printf("❌ Failed to load story %s for export: %v", story.StoryID, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+		}
+		nodes, edges, err := st.GetGraph(ctx, story.StoryID)
+		if err != nil {
+			log.Printf("❌ Failed to load graph for %s: %v", story.StoryID, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+		}
+		w, err := zw.Create(zipEntryName(used, story.StoryID))
+		if err == nil {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(storyBundle{StoryFull: *full, Nodes: nodes, Edges: edges})
+		}
+		if err != nil {
+			log.Printf("❌ Failed to write %s to export: %v", story.StoryID, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to build archive"}, nil
+		}
+		written++
+	}
+	if written == 0 {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "No stories for school"}, nil
+	}
+	if err := zw.Close(); err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to build archive"}, nil
+	}
+
+	h := corsHeaders()
+	h["Content-Type"] = "application/zip"
+	h["Content-Disposition"] = fmt.Sprintf(`attachment; filename="%s.zip"`, zipNameUnsafe.ReplaceAllString(schoolID, "_"))
+	return events.APIGatewayProxyResponse{
+		StatusCode:      200,
+		Headers:         h,
+		Body:            base64.StdEncoding.EncodeToString(buf.Bytes()),
+		IsBase64Encoded: true,
+	}, nil
+}
+
+var mermaidUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func mermaidID(storyID, nodeID string) string {
+	return mermaidUnsafe.ReplaceAllString(storyID+"__"+nodeID, "_")
+}
+
+func mermaidText(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
+
+// graphsToMermaid renders one flowchart subgraph per story.
+func graphsToMermaid(order []string, graphs map[string]storyGraph) string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, sid := range order {
+		g := graphs[sid]
+		fmt.Fprintf(&b, "  subgraph %s[\"%s\"]\n", mermaidID(sid, ""), mermaidText(chooseTitle(g.Title, sid)))
+		for _, n := range g.Nodes {
+			fmt.Fprintf(&b, "    %s[\"%s\"]\n", mermaidID(sid, n.ID), mermaidText(n.Label))
+		}
+		for _, e := range g.Edges {
+			link := "-->"
+			if !e.IsDirected() {
+				link = "---"
+			}
+			if e.Label != "" {
+				fmt.Fprintf(&b, "    %s %s|\"%s\"| %s\n", mermaidID(sid, e.From), link, mermaidText(e.Label), mermaidID(sid, e.To))
+			} else {
+				fmt.Fprintf(&b, "    %s %s %s\n", mermaidID(sid, e.From), link, mermaidID(sid, e.To))
+			}
+		}
+		b.WriteString("  end\n")
+	}
+	return b.String()
+}
+
+func chooseTitle(title, fallback string) string {
+	if strings.TrimSpace(title) != "" {
+		return title
+	}
+	return fallback
+}
+
+// readerHTMLHandler renders the story bundle plus its graph as a standalone page.
+// Route: GET /api/stories/{storyId}/reader.html
+func readerHTMLHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	full, err := storySvc.GetFullStory(ctx, storyID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "Story not found"}, nil
+	}
+	nodes, edges, err := loadGraph(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to load graph for %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	mermaid := ""
+	if len(nodes) > 0 {
+		mermaid = graphsToMermaid([]string{storyID}, map[string]storyGraph{
+			storyID: {Title: full.Story.Title, Nodes: nodes, Edges: edges},
+		})
+	}
+	h := corsHeaders()
+	h["Content-Type"] = "text/html; charset=utf-8"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: storyapi.RenderReaderHTML(full, mermaid)}, nil
+}
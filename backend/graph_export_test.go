@@ -0,0 +1,374 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func seedSchoolStory(t *testing.T, ctx context.Context, storyID, schoolID string, nodes []Node, edges []Edge) {
+	t.Helper()
+	storyBody, _ := json.Marshal(map[string]string{"storyId": storyID, "schoolId": schoolID, "title": storyID})
+	if resp, err := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: string(storyBody)}); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("create story %s failed: %v status=%d", storyID, err, resp.StatusCode)
+	}
+	body, _ := json.Marshal(Strukturbild{StoryID: storyID, Nodes: nodes, Edges: edges})
+	if resp, err := handler(ctx, events.APIGatewayProxyRequest{Body: string(body)}); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("submit graph %s failed: %v status=%d", storyID, err, resp.StatusCode)
+	}
+}
+
+func TestSchoolGraphsExport(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	seedSchoolStory(t, ctx, "story-a", "school-1", []Node{{ID: "n1", Label: "A1"}, {ID: "n2", Label: "A2"}}, []Edge{{From: "n1", To: "n2", Label: "x"}})
+	seedSchoolStory(t, ctx, "story-b", "school-1", []Node{{ID: "n1", Label: "B1"}}, nil)
+	seedSchoolStory(t, ctx, "story-c", "school-2", []Node{{ID: "n1", Label: "C1"}}, nil)
+
+	resp, err := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/schools/school-1/graphs")
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("export failed: %v status=%d body=%s", err, resp.StatusCode, resp.Body)
+	}
+	var payload struct {
+		Graphs map[string]storyGraph `json:"graphs"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &payload); err != nil {
+		t.Fatalf("unmarshal export: %v", err)
+	}
+	if len(payload.Graphs) != 2 || len(payload.Graphs["story-a"].Nodes) != 2 || len(payload.Graphs["story-a"].Edges) != 1 {
+		t.Fatalf("unexpected graphs: %+v", payload.Graphs)
+	}
+	if _, ok := payload.Graphs["story-c"]; ok {
+		t.Fatalf("story of another school leaked into export")
+	}
+
+	resp, _ = handleStoryRoutes(ctx, events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{"format": "dot", "limit": "1"},
+	}, "GET", "/api/schools/school-1/graphs")
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Body, "digraph") {
+		t.Fatalf("unexpected dot export: %d %s", resp.StatusCode, resp.Body)
+	}
+	next := resp.Headers["X-Next-Cursor"]
+	if next != (storyapi.Cursor{Offset: 1}).Encode() {
+		t.Fatalf("expected the cursor of offset 1, got %q", next)
+	}
+	if strings.Count(resp.Body, "subgraph") != 1 {
+		t.Fatalf("expected a single story per page: %s", resp.Body)
+	}
+	resp, _ = handleStoryRoutes(ctx, events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{"limit": "1", "cursor": next},
+	}, "GET", "/api/schools/school-1/graphs")
+	var last struct {
+		Graphs     map[string]storyGraph `json:"graphs"`
+		HasMore    bool                  `json:"hasMore"`
+		NextCursor string                `json:"nextCursor"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &last); err != nil || len(last.Graphs) != 1 || last.HasMore || last.NextCursor != "" {
+		t.Fatalf("unexpected last page: %v %s", err, resp.Body)
+	}
+	if resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{"cursor": "1"},
+	}, "GET", "/api/schools/school-1/graphs"); resp.StatusCode != 400 {
+		t.Fatalf("a bare offset is not a cursor, got %d", resp.StatusCode)
+	}
+}
+
+func TestReaderHTMLEscapesBodies(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	importJSON := `{
+  "story": { "storyId": "story-html", "schoolId": "s", "title": "HTML <Story>" },
+  "paragraphs": [
+    { "index": 1, "title": "Intro", "bodyMd": "Hello **world** <script>alert(1)</script>", "citations": [] }
+  ],
+  "details": [
+    { "paragraphIndex": 1, "kind": "quote", "transcriptId": "t1", "startMinute": 1, "endMinute": 2, "text": "Zitat" }
+  ]
+}`
+	if resp, err := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: importJSON}); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("import failed: %v status=%d", err, resp.StatusCode)
+	}
+	seedGraph := Strukturbild{StoryID: "story-html", Nodes: []Node{{ID: "n1", Label: "Ziel"}}}
+	body, _ := json.Marshal(seedGraph)
+	handler(ctx, events.APIGatewayProxyRequest{Body: string(body)})
+
+	resp, err := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/story-html/reader.html")
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("reader.html failed: %v status=%d body=%s", err, resp.StatusCode, resp.Body)
+	}
+	page := resp.Body
+	if strings.Contains(page, "<script>alert") {
+		t.Fatalf("raw HTML from paragraph body was not escaped:\n%s", page)
+	}
+	for _, want := range []string{"<h1>HTML &lt;Story&gt;</h1>", "<strong>world</strong>", "<blockquote>", "class=\"mermaid\"", "Ziel"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected %q in page", want)
+		}
+	}
+}
+
+func TestAnalyticsSummary(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	decode := func() analyticsSummary {
+		t.Helper()
+		resp, err := analyticsSummaryHandler(ctx, events.APIGatewayProxyRequest{})
+		if err != nil || resp.StatusCode != 200 {
+			t.Fatalf("summary failed: %v status=%d body=%s", err, resp.StatusCode, resp.Body)
+		}
+		var s analyticsSummary
+		if err := json.Unmarshal([]byte(resp.Body), &s); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return s
+	}
+
+	empty := decode()
+	if empty.Stories != 0 || empty.Nodes.Total != 0 || empty.Nodes.Average != 0 || len(empty.Nodes.Histogram) != len(countBuckets) {
+		t.Fatalf("empty dataset should report zeros: %+v", empty)
+	}
+
+	// The empty summary is cached; drop it before seeding.
+	analyticsCache.summary = nil
+	seedSchoolStory(t, ctx, "story-a", "school-1", []Node{
+		{ID: "n1", Label: "A1", Type: "ursache"}, {ID: "n2", Label: "A2", Type: "ursache"}, {ID: "n3", Label: "A3", Type: "ergebnis"},
+	}, []Edge{{From: "n1", To: "n3"}, {From: "n2", To: "n3"}})
+	seedSchoolStory(t, ctx, "story-b", "school-2", []Node{{ID: "n1", Label: "B1", Type: "ergebnis"}}, nil)
+
+	s := decode()
+	if s.Stories != 2 || s.Truncated {
+		t.Fatalf("unexpected story count: %+v", s)
+	}
+	if s.Nodes.Total != 4 || s.Nodes.Average != 2 || s.Edges.Total != 2 || s.Edges.Average != 1 {
+		t.Fatalf("unexpected totals: nodes=%+v edges=%+v", s.Nodes, s.Edges)
+	}
+	if s.Nodes.Histogram[1] != (histogramBin{"1-5", 2}) || s.Edges.Histogram[0] != (histogramBin{"0", 1}) {
+		t.Fatalf("unexpected histograms: nodes=%+v edges=%+v", s.Nodes.Histogram, s.Edges.Histogram)
+	}
+	if len(s.NodeTypes) != 2 || s.NodeTypes[0] != (typeCount{"ergebnis", 2}) {
+		t.Fatalf("unexpected node types: %+v", s.NodeTypes)
+	}
+
+	seedSchoolStory(t, ctx, "story-c", "school-1", nil, nil)
+	if cached := decode(); cached.Stories != 2 {
+		t.Fatalf("summary should be served from cache, got %d stories", cached.Stories)
+	}
+}
+
+func TestSymmetricEdges(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	no := false
+	seedSchoolStory(t, ctx, "story-sym", "school-1",
+		[]Node{{ID: "a", Label: "A"}, {ID: "b", Label: "B"}, {ID: "c", Label: "C"}},
+		[]Edge{{From: "a", To: "b", Type: "relates"}, {From: "b", To: "c", Type: "supports"}, {From: "a", To: "c", Directed: &no}})
+
+	_, edges, err := loadGraph(ctx, "story-sym")
+	if err != nil {
+		t.Fatalf("load graph: %v", err)
+	}
+	directed := map[string]bool{}
+	for _, e := range edges {
+		directed[e.From+e.To] = e.IsDirected()
+		if e.From == "a" && e.To == "c" && (e.Directed == nil || *e.Directed) {
+			t.Fatalf("explicit directed=false did not round-trip: %+v", e)
+		}
+	}
+	if directed["ab"] || !directed["bc"] || directed["ac"] {
+		t.Fatalf("unexpected directions: %v", directed)
+	}
+
+	// The reverse of a symmetric edge is the same relation: rejected on
+	// submit and counted once if it is already stored.
+	body := `{"storyId":"story-sym","nodes":[{"id":"a"},{"id":"b"}],"edges":[{"from":"a","to":"b","type":"relates"},{"from":"b","to":"a","type":"relates"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 422 {
+		t.Fatalf("expected 422 for a duplicated undirected edge, got %d %s", resp.StatusCode, resp.Body)
+	}
+	degrees := graphDegrees([]Edge{{From: "a", To: "b", Type: "relates"}, {From: "b", To: "a", Type: "relates"}, {From: "a", To: "b"}})
+	if degrees["a"] != 2 || degrees["b"] != 2 {
+		t.Fatalf("symmetric pair double-counted: %v", degrees)
+	}
+
+	dot := graphsToDOT([]string{"story-sym"}, map[string]storyGraph{"story-sym": {Edges: edges}})
+	if !strings.Contains(dot, `"story-sym/a" -> "story-sym/b" [label="", dir=none]`) || !strings.Contains(dot, `"story-sym/b" -> "story-sym/c" [label=""];`) {
+		t.Fatalf("DOT direction attributes wrong:\n%s", dot)
+	}
+	nodes := []Node{{ID: "a", X: 0}, {ID: "b", X: 300}}
+	if svg := renderGraphSVG(nodes, []Edge{{From: "a", To: "b", Type: "relates"}}); strings.Contains(svg, "marker-end") {
+		t.Fatalf("undirected edge drawn with an arrowhead:\n%s", svg)
+	}
+}
+
+func TestSchoolExportZip(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	seedSchoolStory(t, ctx, "story-a", "school-1", []Node{{ID: "n1", Label: "A1"}, {ID: "n2", Label: "A2"}}, []Edge{{From: "n1", To: "n2"}})
+	seedSchoolStory(t, ctx, "story-b", "school-1", []Node{{ID: "n1", Label: "B1"}}, nil)
+	seedSchoolStory(t, ctx, "story-c", "school-2", []Node{{ID: "n1", Label: "C1"}}, nil)
+	// Both ids are story_d as file names.
+	seedSchoolStory(t, ctx, "story d", "school-1", []Node{{ID: "n1", Label: "D1"}}, nil)
+	seedSchoolStory(t, ctx, "story:d", "school-1", []Node{{ID: "n1", Label: "D2"}}, nil)
+	if resp, _ := storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"storyId": "story-a"}, Body: `{"index":1,"bodyMd":"Absatz"}`}); resp.StatusCode != 200 {
+		t.Fatalf("create paragraph failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, err := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/schools/school-1/export.zip")
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("export failed: %v status=%d body=%s", err, resp.StatusCode, resp.Body)
+	}
+	if !resp.IsBase64Encoded || resp.Headers["Content-Type"] != "application/zip" {
+		t.Fatalf("expected a base64 zip body, got encoded=%v type=%q", resp.IsBase64Encoded, resp.Headers["Content-Type"])
+	}
+	raw, err := base64.StdEncoding.DecodeString(resp.Body)
+	if err != nil {
+		t.Fatalf("decode base64: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	if len(files) != 4 || files["story-a.json"] == nil || files["story-b.json"] == nil || files["story_d.json"] == nil || files["story_d-2.json"] == nil {
+		t.Fatalf("unexpected entries: %v", files)
+	}
+	rc, err := files["story-a.json"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var bundle storyBundle
+	if err := json.NewDecoder(rc).Decode(&bundle); err != nil {
+		t.Fatalf("decode bundle: %v", err)
+	}
+	if bundle.Story.StoryID != "story-a" || len(bundle.Paragraphs) != 1 || len(bundle.Nodes) != 2 || len(bundle.Edges) != 1 {
+		t.Fatalf("incomplete bundle: %+v", bundle)
+	}
+
+	if resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/schools/none/export.zip"); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for an unknown school, got %d", resp.StatusCode)
+	}
+}
+
+func TestEdgeWeights(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	body := `{"storyId":"story-w","nodes":[{"id":"a"},{"id":"b"},{"id":"c"}],"edges":[{"id":"e1","from":"a","to":"b","weight":2.5},{"id":"e2","from":"a","to":"c"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	stored, _ := svc.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(tableName), Key: keySchema.Key("story-w", "e1")})
+	if n, ok := stored.Item["weight"].(*types.AttributeValueMemberN); !ok || n.Value != "2.5" {
+		t.Fatalf("weight not stored as a number: %#v", stored.Item["weight"])
+	}
+	_, edges, _ := loadGraph(ctx, "story-w")
+	if len(edges) != 2 || edges[0].Weight == nil || *edges[0].Weight != 2.5 || edges[1].Weight != nil {
+		t.Fatalf("weights did not round-trip: %+v", edges)
+	}
+
+	bad := `{"storyId":"story-w","edges":[{"from":"a","to":"b","weight":7}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: bad}); resp.StatusCode != 422 || !strings.Contains(resp.Body, "weight") {
+		t.Fatalf("expected 422 for an out-of-range weight, got %d %s", resp.StatusCode, resp.Body)
+	}
+	patch := func(body string) int {
+		resp, _ := updateEdgeHandler(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"storyId": "story-w", "edgeId": "e2"}, Body: body})
+		return resp.StatusCode
+	}
+	if code := patch(`{"weight":0}`); code != 422 {
+		t.Fatalf("expected 422 for weight 0, got %d", code)
+	}
+	if code := patch(`{"weight":4}`); code != 200 {
+		t.Fatalf("weight patch failed: %d", code)
+	}
+
+	// a: 2.5 + 4, b: 2.5, c: 4; the unweighted count stays 2/1/1.
+	_, edges, _ = loadGraph(ctx, "story-w")
+	weighted := graphWeightedDegrees(edges)
+	if weighted["a"] != 6.5 || weighted["b"] != 2.5 || weighted["c"] != 4 {
+		t.Fatalf("weighted degree wrong: %v", weighted)
+	}
+	if plain := graphWeightedDegrees([]Edge{{From: "x", To: "y"}}); plain["x"] != defaultEdgeWeight {
+		t.Fatalf("unweighted edge should count %g: %v", defaultEdgeWeight, plain)
+	}
+	if dot := graphsToDOT([]string{"story-w"}, map[string]storyGraph{"story-w": {Edges: edges}}); !strings.Contains(dot, `[label="", penwidth=2.5]`) {
+		t.Fatalf("DOT lacks penwidth:\n%s", dot)
+	}
+
+	// The edge inspector saves {id,from,to,label,type,detail} only.
+	save := `{"storyId":"story-w","edges":[{"id":"e2","from":"a","to":"c","label":"neu","type":"causes","detail":""}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: save}); resp.StatusCode != 200 {
+		t.Fatalf("inspector save failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	_, edges, _ = loadGraph(ctx, "story-w")
+	if edges[1].Label != "neu" || edges[1].Weight == nil || *edges[1].Weight != 4 {
+		t.Fatalf("a save without weight must keep it: %+v", edges[1])
+	}
+}
+
+func TestExportAllNDJSON(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	seedSchoolStory(t, ctx, "story-a", "school-1", []Node{{ID: "n1", Label: "A1"}, {ID: "n2", Label: "A2"}}, []Edge{{From: "n1", To: "n2", Label: "x"}})
+	seedSchoolStory(t, ctx, "story-b", "school-1", []Node{{ID: "n1", Label: "B1"}}, nil)
+	seedSchoolStory(t, ctx, "story-c", "school-2", nil, nil)
+
+	srv := httptest.NewServer(http.HandlerFunc(exportAllNDJSONHTTP))
+	defer srv.Close()
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("export request failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 || res.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("unexpected response: %d %v", res.StatusCode, res.Header)
+	}
+	lines := map[string]storyBundle{}
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var b storyBundle
+		if err := json.Unmarshal(scanner.Bytes(), &b); err != nil {
+			t.Fatalf("line is not a story bundle: %v %s", err, scanner.Text())
+		}
+		lines[b.Story.StoryID] = b
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	stories, _ := storySvc.ListStories(ctx)
+	if len(lines) != len(stories) || len(lines) != 3 {
+		t.Fatalf("expected one line per story (%d), got %d", len(stories), len(lines))
+	}
+	if a := lines["story-a"]; len(a.Nodes) != 2 || len(a.Edges) != 1 {
+		t.Fatalf("story-a lost its graph: %+v", a)
+	}
+
+	resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/export/all.ndjson")
+	if resp.StatusCode != 200 || strings.Count(resp.Body, "\n") != 3 {
+		t.Fatalf("lambda export: %d %q", resp.StatusCode, resp.Body)
+	}
+}
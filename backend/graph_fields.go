@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// nodeFieldNames are the JSON names a ?fields= projection may select.
+var nodeFieldNames = jsonFieldNames(reflect.TypeOf(Node{}))
+
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// parseNodeFields reads ?fields=id,x,y; nil means "all fields".
+func parseNodeFields(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !nodeFieldNames[f] {
+			known := make([]string, 0, len(nodeFieldNames))
+			for n := range nodeFieldNames {
+				known = append(known, n)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown node field %q (known: %s)", f, strings.Join(known, ", "))
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// marshalStruktur encodes sb, keeping only the given fields on each node.
+// Fields that are empty and tagged omitempty stay absent.
+func marshalStruktur(sb Strukturbild, fields []string) ([]byte, error) {
+	if fields == nil {
+		return json.Marshal(sb)
+	}
+	nodes := make([]map[string]json.RawMessage, 0, len(sb.Nodes))
+	for _, n := range sb.Nodes {
+		raw, err := json.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &all); err != nil {
+			return nil, err
+		}
+		picked := make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				picked[f] = v
+			}
+		}
+		nodes = append(nodes, picked)
+	}
+	raw, err := json.Marshal(sb)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	if doc["nodes"], err = json.Marshal(nodes); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// typeColors mirrors TYPE_COLORS in frontend/script.js.
+var typeColors = map[string]string{
+	"prozess":       "#2563eb",
+	"praxis":        "#7c3aed",
+	"ergebnis":      "#16a34a",
+	"schwierigkeit": "#dc2626",
+	"beschäftigung": "#f59e0b",
+}
+
+const (
+	svgNodeWidth    = 150
+	svgLineHeight   = 16
+	svgWrapAt       = 20
+	svgPadding      = 40
+	svgDefaultColor = "#6b7280"
+)
+
+// graphSVGHandler renders a story graph as a standalone SVG document.
+// Route: GET /api/stories/{storyId}/graph.svg
+func graphSVGHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	nodes, edges, err := loadGraph(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to load graph for %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	h := corsHeaders()
+	h["Content-Type"] = "image/svg+xml"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: renderGraphSVG(nodes, edges)}, nil
+}
+
+func nodeFill(n Node) string {
+	if n.Color != "" {
+		return n.Color
+	}
+	if c, ok := typeColors[strings.ToLower(strings.TrimSpace(n.Type))]; ok {
+		return c
+	}
+	return svgDefaultColor
+}
+
+// wrapLabel breaks a label into lines of at most svgWrapAt runes on word boundaries.
+func wrapLabel(label string) []string {
+	var lines []string
+	cur := ""
+	for _, word := range strings.Fields(label) {
+		switch {
+		case cur == "":
+			cur = word
+		case utf8.RuneCountInString(cur)+1+utf8.RuneCountInString(word) <= svgWrapAt:
+			cur += " " + word
+		default:
+			lines = append(lines, cur)
+			cur = word
+		}
+	}
+	if cur != "" {
+		lines = append(lines, cur)
+	}
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+	return lines
+}
+
+func nodeHeight(lines []string) int {
+	return len(lines)*svgLineHeight + 12
+}
+
+// renderGraphSVG draws nodes centred on their stored X/Y and edges as arrows
+// that stop at the target node's border; undirected edges get no arrowhead.
+// Empty graphs get a placeholder.
+func renderGraphSVG(nodes []Node, edges []Edge) string {
+	var b strings.Builder
+	if len(nodes) == 0 {
+		b.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="320" height="80" viewBox="0 0 320 80">` + "\n")
+		b.WriteString(`<text x="160" y="45" text-anchor="middle" font-family="sans-serif" font-size="14" fill="#6b7280">Kein Strukturbild vorhanden</text>` + "\n")
+		b.WriteString("</svg>\n")
+		return b.String()
+	}
+
+	labels := make(map[string][]string, len(nodes))
+	byID := make(map[string]Node, len(nodes))
+	minX, minY := math.MaxInt, math.MaxInt
+	maxX, maxY := math.MinInt, math.MinInt
+	for _, n := range nodes {
+		lines := wrapLabel(n.Label)
+		labels[n.ID] = lines
+		byID[n.ID] = n
+		hh := nodeHeight(lines) / 2
+		minX, maxX = min(minX, n.X-svgNodeWidth/2), max(maxX, n.X+svgNodeWidth/2)
+		minY, maxY = min(minY, n.Y-hh), max(maxY, n.Y+hh)
+	}
+	minX, minY = minX-svgPadding, minY-svgPadding
+	width, height := maxX-minX+svgPadding, maxY-minY+svgPadding
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="%d %d %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		width, height, minX, minY, width, height)
+	b.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M 0 0 L 10 5 L 0 10 z" fill="#374151"/></marker></defs>` + "\n")
+
+	for _, e := range edges {
+		from, okF := byID[e.From]
+		to, okT := byID[e.To]
+		if !okF || !okT {
+			continue
+		}
+		x1, y1 := float64(from.X), float64(from.Y)
+		x2, y2 := float64(to.X), float64(to.Y)
+		dx, dy := x2-x1, y2-y1
+		if dx != 0 || dy != 0 {
+			hw, hh := float64(svgNodeWidth)/2, float64(nodeHeight(labels[to.ID]))/2
+			t := math.Inf(1)
+			if dx != 0 {
+				t = math.Min(t, hw/math.Abs(dx))
+			}
+			if dy != 0 {
+				t = math.Min(t, hh/math.Abs(dy))
+			}
+			x2, y2 = x2-dx*t, y2-dy*t
+		}
+		marker := ` marker-end="url(#arrow)"`
+		if !e.IsDirected() {
+			marker = ""
+		}
+		b.WriteString(`<g class="edge">`)
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#374151" stroke-width="1.5"%s/>`, x1, y1, x2, y2, marker)
+		if e.Label != "" {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="#374151">%s</text>`, (x1+x2)/2, (y1+y2)/2-4, html.EscapeString(e.Label))
+		}
+		b.WriteString("</g>\n")
+	}
+
+	for _, n := range nodes {
+		lines := labels[n.ID]
+		h := nodeHeight(lines)
+		st := styleFor(n)
+		fmt.Fprintf(&b, `<g class="node" data-id="%s" data-shape="%s"`, html.EscapeString(n.ID), st.Shape)
+		if st.Icon != "" {
+			fmt.Fprintf(&b, ` data-icon="%s"`, st.Icon)
+		}
+		b.WriteString(">")
+		writeSVGShape(&b, st, n.X, n.Y, h)
+		fmt.Fprintf(&b, `<text x="%d" text-anchor="middle" fill="#ffffff">`, n.X)
+		top := n.Y - h/2 + 6 + svgLineHeight - 4
+		for i, line := range lines {
+			fmt.Fprintf(&b, `<tspan x="%d" y="%d">%s</tspan>`, n.X, top+i*svgLineHeight, html.EscapeString(line))
+		}
+		b.WriteString("</text></g>\n")
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// writeSVGShape draws the outline of a node of height h centred on (x, y).
+func writeSVGShape(b *strings.Builder, st nodeStyle, x, y, h int) {
+	w := svgNodeWidth
+	fill := html.EscapeString(st.Color)
+	switch st.Shape {
+	case "rectangle":
+		fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`, x-w/2, y-h/2, w, h, fill)
+	case "ellipse":
+		fmt.Fprintf(b, `<ellipse cx="%d" cy="%d" rx="%d" ry="%d" fill="%s"/>`, x, y, w/2, h/2, fill)
+	case "diamond":
+		fmt.Fprintf(b, `<polygon points="%d,%d %d,%d %d,%d %d,%d" fill="%s"/>`, x, y-h/2, x+w/2, y, x, y+h/2, x-w/2, y, fill)
+	case "hexagon":
+		fmt.Fprintf(b, `<polygon points="%d,%d %d,%d %d,%d %d,%d %d,%d %d,%d" fill="%s"/>`,
+			x-w/2, y, x-w/4, y-h/2, x+w/4, y-h/2, x+w/2, y, x+w/4, y+h/2, x-w/4, y+h/2, fill)
+	default:
+		fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" rx="6" fill="%s"/>`, x-w/2, y-h/2, w, h, fill)
+	}
+}
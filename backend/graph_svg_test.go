@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func countSVGNodes(t *testing.T, svg string) int {
+	t.Helper()
+	dec := xml.NewDecoder(strings.NewReader(svg))
+	count := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return count
+		}
+		if err != nil {
+			t.Fatalf("SVG is not well-formed: %v\n%s", err, svg)
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "g" {
+			for _, a := range se.Attr {
+				if a.Name.Local == "class" && a.Value == "node" {
+					count++
+				}
+			}
+		}
+	}
+}
+
+func TestGraphSVG(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	payload := Strukturbild{
+		StoryID: "svg-test",
+		Nodes: []Node{
+			{ID: "a", Label: "Ein ziemlich langes Label <mit> Sonderzeichen & so", Type: "prozess", X: 0, Y: 0},
+			{ID: "b", Label: "B", Type: "ergebnis", X: 300, Y: 120},
+			{ID: "c", Label: "C", X: -200, Y: 80},
+		},
+		Edges: []Edge{{From: "a", To: "b", Label: "führt zu"}, {From: "c", To: "a"}},
+	}
+	body, _ := json.Marshal(payload)
+	if _, err := handler(ctx, events.APIGatewayProxyRequest{Body: string(body)}); err != nil {
+		t.Fatalf("failed to seed strukturbild: %v", err)
+	}
+
+	resp, err := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/svg-test/graph.svg")
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("graph.svg failed: %v status=%d", err, resp.StatusCode)
+	}
+	if resp.Headers["Content-Type"] != "image/svg+xml" {
+		t.Fatalf("unexpected content type: %s", resp.Headers["Content-Type"])
+	}
+	if n := countSVGNodes(t, resp.Body); n != 3 {
+		t.Fatalf("expected 3 nodes in SVG, got %d", n)
+	}
+	if strings.Count(resp.Body, `class="edge"`) != 2 {
+		t.Fatalf("expected 2 edges in SVG:\n%s", resp.Body)
+	}
+
+	resp, _ = handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/empty/graph.svg")
+	if resp.StatusCode != 200 || countSVGNodes(t, resp.Body) != 0 {
+		t.Fatalf("expected placeholder SVG for empty graph: %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestNodeShapeAndIcon(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	body := `{"storyId":"story-shape","nodes":[{"id":"a","type":"prozess","shape":"diamond","icon":"person"},{"id":"b","type":"ergebnis"},{"id":"c"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	nodes, _, _ := loadGraph(ctx, "story-shape")
+	if len(nodes) != 3 || nodes[0].Shape != "diamond" || nodes[0].Icon != "person" || nodes[1].Shape != "" {
+		t.Fatalf("shape/icon did not round-trip: %+v", nodes)
+	}
+	for _, bad := range []string{`{"id":"x","shape":"star"}`, `{"id":"x","icon":"rocket"}`} {
+		resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-shape","nodes":[` + bad + `]}`})
+		if resp.StatusCode != 422 {
+			t.Fatalf("expected 422 for %s, got %d %s", bad, resp.StatusCode, resp.Body)
+		}
+	}
+
+	// The node's own shape wins; b falls back to its type, c to the default.
+	svg := renderGraphSVG(nodes, nil)
+	if countSVGNodes(t, svg) != 3 {
+		t.Fatalf("expected 3 nodes:\n%s", svg)
+	}
+	for _, want := range []string{`data-id="a" data-shape="diamond" data-icon="person"><polygon`, `data-id="b" data-shape="hexagon" data-icon="flag"><polygon`, `data-id="c" data-shape="round-rectangle"><rect`} {
+		if !strings.Contains(svg, want) {
+			t.Fatalf("SVG lacks %s:\n%s", want, svg)
+		}
+	}
+	dot := graphsToDOT([]string{"story-shape"}, map[string]storyGraph{"story-shape": {Nodes: nodes}})
+	if !strings.Contains(dot, `"story-shape/a" [label="", shape=diamond];`) || !strings.Contains(dot, `"story-shape/c" [label="", shape=box, style=rounded];`) {
+		t.Fatalf("DOT shapes wrong:\n%s", dot)
+	}
+
+	resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/node-styles")
+	var styles struct {
+		Types   map[string]nodeStyle `json:"types"`
+		Default nodeStyle            `json:"default"`
+		Shapes  []string             `json:"shapes"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &styles); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("node-styles failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if styles.Types["schwierigkeit"] != (nodeStyle{Shape: "diamond", Icon: "warning", Color: typeColors["schwierigkeit"]}) || styles.Default.Shape != defaultNodeShape || len(styles.Shapes) != len(nodeShapes) {
+		t.Fatalf("unexpected node styles: %+v", styles)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Every graph change stores a snapshot of the whole graph under its own
+// partition, GRAPHVER#<storyId>, with sort keys V#<version> counting up from 1.
+// Only the latest maxGraphVersions are kept.
+// Keeping snapshots out of the story's partition means loadGraph never sees them.
+const (
+	graphVersionPartitionPrefix = "GRAPHVER#"
+	graphVersionSortPrefix      = "V#"
+	graphVersionAttempts        = 3
+)
+
+// maxGraphVersions is how many versions a story keeps; older ones are
+// deleted as new ones are recorded. Override with MAX_GRAPH_VERSIONS.
+var maxGraphVersions = envInt("MAX_GRAPH_VERSIONS", 50)
+
+// maxGraphVersionBytes bounds the JSON of one snapshot, so that the record
+// stays below DynamoDB's 400 KB item limit with room for its other
+// attributes. Larger graphs are not versioned.
+const maxGraphVersionBytes = 350 << 10
+
+// errGraphVersionNotFound is returned for a version that was never recorded.
+var errGraphVersionNotFound = errors.New("graph version not found")
+
+// errGraphTooLargeToVersion is returned when a snapshot would exceed
+// maxGraphVersionBytes.
+var errGraphTooLargeToVersion = errors.New("graph too large to version")
+
+// graphVersionRecord is one stored snapshot; Graph holds the nodes and edges
+// as JSON so the record stays a flat item.
+type graphVersionRecord struct {
+	Partition string `dynamodbav:"storyId"`
+	SortKey   string `dynamodbav:"id"`
+	Version   int    `dynamodbav:"version"`
+	CreatedAt string `dynamodbav:"createdAt"`
+	UpdatedBy string `dynamodbav:"updatedBy,omitempty"`
+	Graph     string `dynamodbav:"graph"`
+}
+
+type graphSnapshot struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+func graphVersionKey(version int) string {
+	return fmt.Sprintf("%s%06d", graphVersionSortPrefix, version)
+}
+
+// latestGraphVersion returns the highest recorded version of storyID, 0 if none.
+func latestGraphVersion(ctx context.Context, storyID string) (int, error) {
+	res, err := svc.Query(ctx, &dynamodb.QueryInput{
+		TableName:                aws.String(tableName),
+		KeyConditionExpression:   aws.String(keySchema.PartitionCondition()),
+		ExpressionAttributeNames: keySchema.Names(false),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sid": &types.AttributeValueMemberS{Value: graphVersionPartitionPrefix + storyID},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(1),
+	})
+	if err != nil || len(res.Items) == 0 {
+		return 0, err
+	}
+	var rec graphVersionRecord
+	if err := attributevalue.UnmarshalMap(keySchema.FromItem(res.Items[0]), &rec); err != nil {
+		return 0, err
+	}
+	return rec.Version, nil
+}
+
+// recordGraphVersion snapshots the current graph of storyID as its next
+// version and drops versions beyond maxGraphVersions. Concurrent writers race
+// for the same number; the conditional put lets one win and the other retry
+// with the following number.
+func recordGraphVersion(ctx context.Context, storyID string) (int, error) {
+	nodes, edges, err := loadGraph(ctx, storyID)
+	if err != nil {
+		return 0, err
+	}
+	graph, err := json.Marshal(graphSnapshot{Nodes: nodes, Edges: edges})
+	if err != nil {
+		return 0, err
+	}
+	if len(graph) > maxGraphVersionBytes {
+		return 0, fmt.Errorf("%w: %d bytes (limit %d)", errGraphTooLargeToVersion, len(graph), maxGraphVersionBytes)
+	}
+	for attempt := 0; attempt < graphVersionAttempts; attempt++ {
+		latest, err := latestGraphVersion(ctx, storyID)
+		if err != nil {
+			return 0, err
+		}
+		rec := graphVersionRecord{
+			Partition: graphVersionPartitionPrefix + storyID,
+			SortKey:   graphVersionKey(latest + 1),
+			Version:   latest + 1,
+			CreatedAt: storyapi.NowRFC3339UTC(),
+			UpdatedBy: storyapi.ActorFromContext(ctx),
+			Graph:     string(graph),
+		}
+		av, err := attributevalue.MarshalMap(rec)
+		if err != nil {
+			return 0, err
+		}
+		_, err = svc.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                aws.String(tableName),
+			Item:                     keySchema.ToItem(av),
+			ConditionExpression:      aws.String("attribute_not_exists(#pk)"),
+			ExpressionAttributeNames: keySchema.Names(false),
+		})
+		if storyapi.IsConditionalCheckFailed(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err := pruneGraphVersions(ctx, storyID, rec.Version); err != nil {
+			log.Printf("⚠️ Failed to prune graph versions of %s: %v", storyID, err)
+		}
+		return rec.Version, nil
+	}
+	return 0, fmt.Errorf("version number still taken after %d attempts", graphVersionAttempts)
+}
+
+// pruneGraphVersions deletes the oldest versions of storyID until only the
+// maxGraphVersions up to latest remain. It reads one key at a time from the
+// old end, so a prune after each record usually costs one read and one
+// delete. A limit of 0 or less keeps every version.
+func pruneGraphVersions(ctx context.Context, storyID string, latest int) error {
+	if maxGraphVersions <= 0 {
+		return nil
+	}
+	for {
+		res, err := svc.Query(ctx, &dynamodb.QueryInput{
+			TableName:                aws.String(tableName),
+			KeyConditionExpression:   aws.String(keySchema.PartitionCondition()),
+			ProjectionExpression:     aws.String("#pk, #sk"),
+			ExpressionAttributeNames: keySchema.Names(true),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":sid": &types.AttributeValueMemberS{Value: graphVersionPartitionPrefix + storyID},
+			},
+			Limit: aws.Int32(1),
+		})
+		if err != nil || len(res.Items) == 0 {
+			return err
+		}
+		sk, _ := res.Items[0][keySchema.SortKey].(*types.AttributeValueMemberS)
+		if sk == nil {
+			return fmt.Errorf("version item without sort key")
+		}
+		oldest, err := strconv.Atoi(strings.TrimPrefix(sk.Value, graphVersionSortPrefix))
+		if err != nil {
+			return fmt.Errorf("unreadable version key %q", sk.Value)
+		}
+		if oldest > latest-maxGraphVersions {
+			return nil
+		}
+		if _, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(tableName),
+			Key:       keySchema.Key(graphVersionPartitionPrefix+storyID, sk.Value),
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// graphVersionKeys returns the primary keys of every stored version of storyID.
+func graphVersionKeys(ctx context.Context, storyID string) ([]map[string]types.AttributeValue, error) {
+	var keys []map[string]types.AttributeValue
+	var startKey map[string]types.AttributeValue
+	for {
+		res, err := svc.Query(ctx, &dynamodb.QueryInput{
+			TableName:                aws.String(tableName),
+			KeyConditionExpression:   aws.String(keySchema.PartitionCondition()),
+			ExpressionAttributeNames: keySchema.Names(false),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":sid": &types.AttributeValueMemberS{Value: graphVersionPartitionPrefix + storyID},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range res.Items {
+			keys = append(keys, map[string]types.AttributeValue{
+				keySchema.PartitionKey: item[keySchema.PartitionKey],
+				keySchema.SortKey:      item[keySchema.SortKey],
+			})
+		}
+		if len(res.LastEvaluatedKey) == 0 {
+			return keys, nil
+		}
+		startKey = res.LastEvaluatedKey
+	}
+}
+
+// graphVersionInfo describes a stored version without its graph.
+type graphVersionInfo struct {
+	Version   int    `json:"version" dynamodbav:"version"`
+	CreatedAt string `json:"createdAt" dynamodbav:"createdAt"`
+	UpdatedBy string `json:"updatedBy,omitempty" dynamodbav:"updatedBy,omitempty"`
+}
+
+// listGraphVersions returns the stored versions of storyID, newest first.
+// The snapshots themselves are not read.
+func listGraphVersions(ctx context.Context, storyID string) ([]graphVersionInfo, error) {
+	versions := []graphVersionInfo{}
+	var startKey map[string]types.AttributeValue
+	for {
+		res, err := svc.Query(ctx, &dynamodb.QueryInput{
+			TableName:                aws.String(tableName),
+			KeyConditionExpression:   aws.String(keySchema.PartitionCondition()),
+			ProjectionExpression:     aws.String("#v, createdAt, updatedBy"),
+			ExpressionAttributeNames: map[string]string{"#pk": keySchema.PartitionKey, "#v": "version"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":sid": &types.AttributeValueMemberS{Value: graphVersionPartitionPrefix + storyID},
+			},
+			ScanIndexForward:  aws.Bool(false),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range res.Items {
+			var v graphVersionInfo
+			if err := attributevalue.UnmarshalMap(item, &v); err != nil {
+				return nil, err
+			}
+			versions = append(versions, v)
+		}
+		if len(res.LastEvaluatedKey) == 0 {
+			return versions, nil
+		}
+		startKey = res.LastEvaluatedKey
+	}
+}
+
+// graphVersionsHandler lists the stored graph versions of a story, newest
+// first, as a ListPage paged with ?limit=&cursor=. Load one with
+// GET /struktur/{storyId}?version=.
+// Route: GET /api/stories/{storyId}/graph-versions?limit=&cursor=
+func graphVersionsHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	limit, offset, err := storyapi.ParsePageParams(req.QueryStringParameters)
+	if err != nil {
+		return badInput(err.Error()), nil
+	}
+	versions, err := listGraphVersions(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to list graph versions of %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	body, _ := json.Marshal(storyapi.Paginate(versions, limit, offset))
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
+
+// loadGraphVersion returns the snapshot stored as version of storyID.
+func loadGraphVersion(ctx context.Context, storyID string, version int) ([]Node, []Edge, error) {
+	res, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       keySchema.Key(graphVersionPartitionPrefix+storyID, graphVersionKey(version)),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(res.Item) == 0 {
+		return nil, nil, errGraphVersionNotFound
+	}
+	var rec graphVersionRecord
+	if err := attributevalue.UnmarshalMap(keySchema.FromItem(res.Item), &rec); err != nil {
+		return nil, nil, err
+	}
+	var snap graphSnapshot
+	if err := json.Unmarshal([]byte(rec.Graph), &snap); err != nil {
+		return nil, nil, err
+	}
+	if snap.Nodes == nil {
+		snap.Nodes = []Node{}
+	}
+	if snap.Edges == nil {
+		snap.Edges = []Edge{}
+	}
+	backfillEdgeIDs(snap.Edges)
+	return snap.Nodes, snap.Edges, nil
+}
+
+// backfillEdgeIDs gives edges without an id one derived from from|to|type, so
+// snapshot edges stored without ids can still be referenced. The same edge
+// gets the same id on every read; repeats of one relation are numbered in
+// order. Stored edges always have an id, as it is their sort key.
+func backfillEdgeIDs(edges []Edge) {
+	seen := map[string]int{}
+	for i := range edges {
+		if edges[i].ID != "" {
+			continue
+		}
+		sum := sha256.Sum256([]byte(edges[i].From + "|" + edges[i].To + "|" + edges[i].Type))
+		id := "e-" + hex.EncodeToString(sum[:6])
+		if seen[id]++; seen[id] > 1 {
+			id += "-" + strconv.Itoa(seen[id])
+		}
+		edges[i].ID = id
+	}
+}
+
+// parseGraphVersion reads ?version=; 0 means the latest graph.
+func parseGraphVersion(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("version must be a positive integer")
+	}
+	return v, nil
+}
+
+// logGraphVersion records a snapshot after a change; a failure only costs
+// history, never the change itself.
+func logGraphVersion(ctx context.Context, storyID string) {
+	_, err := recordGraphVersion(ctx, storyID)
+	switch {
+	case errors.Is(err, errGraphTooLargeToVersion):
+		log.Printf("ℹ️ Not versioning graph of %s: %v", storyID, err)
+	case err != nil:
+		log.Printf("⚠️ Failed to record graph version for %s: %v", storyID, err)
+	}
+}
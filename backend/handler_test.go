@@ -3,10 +3,20 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	storyapi "strukturbild/api"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
 func TestHandler(t *testing.T) {
@@ -84,6 +94,34 @@ func TestGetHandler(t *testing.T) {
 	}
 }
 
+func TestGetHandlerStoryWithoutGraph(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-nograph","schoolId":"s","title":"Leer"}`}); resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-nograph"}})
+	if resp.StatusCode != 200 {
+		t.Fatalf("story without graph should return 200, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if !strings.Contains(resp.Body, `"nodes":[]`) || !strings.Contains(resp.Body, `"edges":[]`) {
+		t.Errorf("expected empty node and edge arrays, got %s", resp.Body)
+	}
+	var returned Strukturbild
+	if err := json.Unmarshal([]byte(resp.Body), &returned); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if returned.Story == nil || returned.Story.Title != "Leer" {
+		t.Errorf("story bundle missing: %+v", returned.Story)
+	}
+
+	resp, _ = getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-unknown"}})
+	if resp.StatusCode != 404 || resp.Body != "Story not found" {
+		t.Fatalf("expected 404 Story not found, got %d %q", resp.StatusCode, resp.Body)
+	}
+}
+
 func TestGetHandlerIncludesStoryBundle(t *testing.T) {
 	setupTestServices()
 	ctx := context.Background()
@@ -135,9 +173,10 @@ func TestGetHandlerIncludesStoryBundle(t *testing.T) {
 	}
 
 	resp, err := getHandler(ctx, events.APIGatewayProxyRequest{
-		HTTPMethod:     "GET",
-		Path:           "/struktur/" + storyID,
-		PathParameters: map[string]string{"id": storyID},
+		HTTPMethod:            "GET",
+		Path:                  "/struktur/" + storyID,
+		PathParameters:        map[string]string{"id": storyID},
+		QueryStringParameters: map[string]string{"includeDetails": "true"},
 	})
 	if err != nil {
 		t.Fatalf("getHandler returned error: %v", err)
@@ -165,4 +204,1490 @@ func TestGetHandlerIncludesStoryBundle(t *testing.T) {
 	if len(returned.DetailsByParagraph[paragraphID]) != 1 {
 		t.Fatalf("expected detail for paragraph, got %+v", returned.DetailsByParagraph)
 	}
+
+	// Details are opt-in; the default response carries paragraphs only.
+	resp, _ = getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": storyID}})
+	if resp.StatusCode != 200 || strings.Contains(resp.Body, "detailsByParagraph") || !strings.Contains(resp.Body, paragraphID) {
+		t.Fatalf("default response should omit details: %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestGetHandlerNDJSON(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	storyID := "ndjson-test"
+
+	payload := Strukturbild{
+		StoryID: storyID,
+		Nodes: []Node{
+			{ID: "a", Label: "A"},
+			{ID: "b", Label: "B"},
+		},
+		Edges: []Edge{{From: "a", To: "b", Label: "ab"}},
+	}
+	body, _ := json.Marshal(payload)
+	if _, err := handler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/submit", Body: string(body)}); err != nil {
+		t.Fatalf("failed to seed strukturbild: %v", err)
+	}
+
+	resp, err := getHandler(ctx, events.APIGatewayProxyRequest{
+		HTTPMethod:     "GET",
+		Path:           "/struktur/" + storyID,
+		PathParameters: map[string]string{"id": storyID},
+		Headers:        map[string]string{"accept": "application/x-ndjson"},
+	})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("getHandler failed: %v, response: %+v", err, resp)
+	}
+	if ct := resp.Headers["Content-Type"]; ct != "application/x-ndjson" {
+		t.Fatalf("unexpected content type: %s", ct)
+	}
+
+	lines := strings.Split(strings.TrimSpace(resp.Body), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines (story, 2 nodes, 1 edge), got %d: %q", len(lines), resp.Body)
+	}
+	wantKinds := []string{"story", "node", "node", "edge"}
+	for i, line := range lines {
+		var obj struct {
+			Kind string `json:"kind"`
+		}
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			t.Fatalf("line %d is not valid JSON: %v (%s)", i, err, line)
+		}
+		if obj.Kind != wantKinds[i] {
+			t.Errorf("line %d: expected kind %s, got %s", i, wantKinds[i], obj.Kind)
+		}
+	}
+}
+
+func TestUpdatePositionsHandler(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	storyID := "positions-test"
+
+	payload := Strukturbild{
+		StoryID: storyID,
+		Nodes: []Node{
+			{ID: "a", Label: "A", Detail: "keep", X: 1, Y: 1},
+			{ID: "b", Label: "B", X: 2, Y: 2},
+		},
+	}
+	body, _ := json.Marshal(payload)
+	if _, err := handler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/submit", Body: string(body)}); err != nil {
+		t.Fatalf("failed to seed strukturbild: %v", err)
+	}
+
+	resp, err := lambdaHandler(ctx, events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Path:       "/struktur/" + storyID + "/positions",
+		Body:       `{"positions":{"a":{"x":100,"y":200}}}`,
+	})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("positions update failed: %v, response: %+v", err, resp)
+	}
+	if resp.Body != `{"updated":1}` {
+		t.Fatalf("unexpected body: %s", resp.Body)
+	}
+
+	resp, _ = lambdaHandler(ctx, events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Path:       "/struktur/" + storyID + "/positions",
+		Body:       `{"positions":{"missing":{"x":1,"y":1}}}`,
+	})
+	if resp.StatusCode != 422 {
+		t.Fatalf("expected 422 for unknown node, got %d", resp.StatusCode)
+	}
+
+	getResp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": storyID}})
+	var returned Strukturbild
+	if err := json.Unmarshal([]byte(getResp.Body), &returned); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	for _, n := range returned.Nodes {
+		switch n.ID {
+		case "a":
+			if n.X != 100 || n.Y != 200 || n.Detail != "keep" || n.Label != "A" {
+				t.Errorf("unexpected node a after update: %+v", n)
+			}
+		case "b":
+			if n.X != 2 || n.Y != 2 {
+				t.Errorf("node b should be untouched: %+v", n)
+			}
+		}
+	}
+}
+
+func TestUpdatePositionsIsAllOrNothing(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"positions-tx","nodes":[{"id":"a","label":"A"},{"id":"b","label":"B"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("seed submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	mem := svc.(*memoryDynamo)
+	svc = failingTransactDynamo{mem}
+	defer func() { svc = mem }()
+	resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Path:       "/struktur/positions-tx/positions",
+		Body:       `{"positions":{"a":{"x":10,"y":10},"b":{"x":20,"y":20}}}`,
+	})
+	if resp.StatusCode != 500 {
+		t.Fatalf("expected 500 when the save fails, got %d %s", resp.StatusCode, resp.Body)
+	}
+	svc = mem
+	nodes, _, _ := loadGraph(ctx, "positions-tx")
+	for _, n := range nodes {
+		if n.X != 0 || n.Y != 0 {
+			t.Errorf("node %s moved although the save failed: %+v", n.ID, n)
+		}
+	}
+}
+
+// failingTransactDynamo fails every transaction.
+type failingTransactDynamo struct {
+	*memoryDynamo
+}
+
+func (f failingTransactDynamo) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return nil, errors.New("transaction conflict")
+}
+
+func TestHandlerClampsExtremeCoordinates(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	storyID := "clamp-test"
+
+	payload := Strukturbild{
+		StoryID: storyID,
+		Nodes:   []Node{{ID: "far", Label: "Far", X: 5000000, Y: -5000000}},
+	}
+	body, _ := json.Marshal(payload)
+
+	resp, _ := handler(ctx, events.APIGatewayProxyRequest{
+		HTTPMethod:            "POST",
+		Path:                  "/submit",
+		Body:                  string(body),
+		QueryStringParameters: map[string]string{"strict": "true"},
+	})
+	if resp.StatusCode != 422 {
+		t.Fatalf("expected 422 in strict mode, got %d", resp.StatusCode)
+	}
+
+	resp, err := handler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/submit", Body: string(body)})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("lenient submit failed: %v, response: %+v", err, resp)
+	}
+
+	getResp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": storyID}})
+	var returned Strukturbild
+	if err := json.Unmarshal([]byte(getResp.Body), &returned); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(returned.Nodes) != 1 || returned.Nodes[0].X != coordMax || returned.Nodes[0].Y != coordMin {
+		t.Fatalf("expected clamped coordinates, got %+v", returned.Nodes)
+	}
+}
+
+func TestHandlerEdgeLimit(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	prev := maxEdges
+	maxEdges = 2
+	defer func() { maxEdges = prev }()
+
+	payload := Strukturbild{
+		StoryID: "edge-limit",
+		Nodes:   []Node{{ID: "a", Label: "A"}, {ID: "b", Label: "B"}},
+		Edges:   []Edge{{From: "a", To: "b"}, {From: "b", To: "a"}},
+	}
+	body, _ := json.Marshal(payload)
+	resp, err := handler(ctx, events.APIGatewayProxyRequest{Body: string(body)})
+	if err != nil || resp.StatusCode != 200 || resp.Body != "Strukturbild received successfully" {
+		t.Fatalf("submit within limit failed: %v, response: %+v", err, resp)
+	}
+	// An edge id sent twice is stored once and counts once.
+	body, _ = json.Marshal(Strukturbild{
+		StoryID: "edge-dup",
+		Nodes:   []Node{{ID: "a", Label: "A"}, {ID: "b", Label: "B"}},
+		Edges:   []Edge{{ID: "e1", From: "a", To: "b"}, {ID: "e1", From: "a", To: "b"}},
+	})
+	resp, err = handler(ctx, events.APIGatewayProxyRequest{Body: string(body), Headers: map[string]string{"Accept": "application/json"}})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("submit with a repeated edge id failed: %v, response: %+v", err, resp)
+	}
+	var summary struct {
+		Nodes int `json:"nodes"`
+		Edges int `json:"edges"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &summary); err != nil {
+		t.Fatalf("submit response is not JSON: %v (%s)", err, resp.Body)
+	}
+	if summary.Nodes != 2 || summary.Edges != 1 {
+		t.Fatalf("unexpected counts: %+v", summary)
+	}
+
+	body, _ = json.Marshal(Strukturbild{StoryID: "edge-limit", Edges: []Edge{{From: "a", To: "a"}}})
+	resp, _ = handler(ctx, events.APIGatewayProxyRequest{Body: string(body)})
+	if resp.StatusCode != 422 {
+		t.Fatalf("expected 422 beyond the edge limit, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(resp.Body, "currently 2") {
+		t.Fatalf("expected current count in body: %s", resp.Body)
+	}
+}
+
+func TestBatchGraphsHandler(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	for _, id := range []string{"story-a", "story-b"} {
+		body := fmt.Sprintf(`{"storyId":%q,"nodes":[{"id":"n1","label":"A"},{"id":"n2","label":"B"}],"edges":[{"from":"n1","to":"n2"}]}`, id)
+		if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+			t.Fatalf("submit %s failed: %d %s", id, resp.StatusCode, resp.Body)
+		}
+	}
+
+	resp, _ := dispatch(ctx, events.APIGatewayProxyRequest{Body: `{"storyIds":["story-a","story-b","story-missing","story-a"]}`}, "POST", "/api/graphs/batch")
+	if resp.StatusCode != 200 {
+		t.Fatalf("batch failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var out struct {
+		Graphs map[string]batchGraph `json:"graphs"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(out.Graphs) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", out.Graphs)
+	}
+	for _, id := range []string{"story-a", "story-b"} {
+		if g := out.Graphs[id]; len(g.Nodes) != 2 || len(g.Edges) != 1 || g.Error != "" {
+			t.Errorf("unexpected graph for %s: %+v", id, g)
+		}
+	}
+	if g := out.Graphs["story-missing"]; g.Error != batchGraphNotFound {
+		t.Errorf("missing story should carry an inline error, got %+v", g)
+	}
+
+	ids := make([]string, maxBatchGraphs+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("s%d", i)
+	}
+	body, _ := json.Marshal(map[string][]string{"storyIds": ids})
+	if resp, _ := dispatch(ctx, events.APIGatewayProxyRequest{Body: string(body)}, "POST", "/api/graphs/batch"); resp.StatusCode != 422 {
+		t.Fatalf("expected 422 above the batch cap, got %d", resp.StatusCode)
+	}
+}
+
+func TestTimestampsAreUTC(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+	time.Local = time.FixedZone("CEST", 2*60*60)
+
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-tz","nodes":[{"id":"n1","label":"A"}],"edges":[]}`}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-tz","schoolId":"s","title":"TZ"}`}); resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	mem := svc.(*memoryDynamo)
+	checked := 0
+	for _, partition := range mem.items {
+		for _, item := range partition {
+			// Story records carry no dynamodbav tags and keep the Go field names.
+			for _, attr := range []string{"timestamp", "createdAt", "updatedAt", "CreatedAt", "UpdatedAt"} {
+				v := getStringAttr(item[attr])
+				if v == "" {
+					continue
+				}
+				ts, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					t.Fatalf("%s=%q does not parse: %v", attr, v, err)
+				}
+				if _, offset := ts.Zone(); offset != 0 || !strings.HasSuffix(v, "Z") {
+					t.Errorf("%s=%q is not UTC", attr, v)
+				}
+				checked++
+			}
+		}
+	}
+	if checked < 3 {
+		t.Fatalf("expected node and story timestamps, checked %d", checked)
+	}
+}
+
+func TestClearGraphKeepsNarrative(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	graph := `{"storyId":"story-clear","nodes":[{"id":"n1","label":"A"},{"id":"n2","label":"B"}],"edges":[{"from":"n1","to":"n2"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: graph}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	imp := `{"story":{"storyId":"story-clear","schoolId":"s","title":"Clear","paragraphNodeMap":{"para-1":["n1"]}},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins","citations":[]}],
+		"details":[{"paragraphIndex":1,"kind":"quote","transcriptId":"t","startMinute":1,"endMinute":2,"text":"Zitat"}]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: imp}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "DELETE", Path: "/api/stories/story-clear/graph"})
+	if resp.StatusCode != 200 {
+		t.Fatalf("clear failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var counts struct {
+		NodesRemoved int `json:"nodesRemoved"`
+		EdgesRemoved int `json:"edgesRemoved"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &counts); err != nil || counts.NodesRemoved != 2 || counts.EdgesRemoved != 1 {
+		t.Fatalf("unexpected counts %+v (%v)", counts, err)
+	}
+
+	nodes, edges, err := loadGraph(ctx, "story-clear")
+	if err != nil || len(nodes) != 0 || len(edges) != 0 {
+		t.Fatalf("graph should be empty, got %d nodes, %d edges (%v)", len(nodes), len(edges), err)
+	}
+	full, err := storySvc.GetFullStory(ctx, "story-clear")
+	if err != nil {
+		t.Fatalf("story should survive: %v", err)
+	}
+	if len(full.Paragraphs) != 1 || len(full.DetailsByParagraph["para-1"]) != 1 {
+		t.Fatalf("paragraphs/details should survive: %+v", full)
+	}
+	if len(full.Story.ParagraphNodeMap) != 0 {
+		t.Fatalf("paragraphNodeMap should be cleared, got %+v", full.Story.ParagraphNodeMap)
+	}
+}
+
+func TestDeleteNodeNamedGraph(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	graph := `{"storyId":"story-graph-node","nodes":[{"id":"graph","label":"A"},{"id":"n1","label":"B"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: graph}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "DELETE", Path: "/struktur/story-graph-node/graph"})
+	if resp.StatusCode != 200 {
+		t.Fatalf("delete failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	nodes, _, err := loadGraph(ctx, "story-graph-node")
+	if err != nil || len(nodes) != 1 || nodes[0].ID != "n1" {
+		t.Fatalf("only the node named graph should be gone, got %+v (%v)", nodes, err)
+	}
+}
+
+func TestDeleteNodeReportsMissing(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	graph := `{"storyId":"story-del","nodes":[{"id":"n1","label":"A"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: graph}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "DELETE", Path: "/struktur/story-del/missing"})
+	if resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for unknown node, got %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ = lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "DELETE", Path: "/struktur/story-del/n1"})
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200 for existing node, got %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ = lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "DELETE", Path: "/struktur/story-del/n1"})
+	if resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for repeated delete, got %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestSubmitDryRunWritesNothing(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	graph := `{"storyId":"story-dry","nodes":[{"id":"n1","label":"A","type":"unbekannt","x":9999999},{"id":"n2","label":"B"}],
+		"edges":[{"from":"n1","to":"n2"},{"from":"n2","to":"n2"}]}`
+	resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: graph, QueryStringParameters: map[string]string{"dryRun": "true"}})
+	if resp.StatusCode != 200 {
+		t.Fatalf("dry run failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var report struct {
+		DryRun   bool     `json:"dryRun"`
+		Nodes    int      `json:"nodes"`
+		Edges    int      `json:"edges"`
+		Writes   int      `json:"writes"`
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &report); err != nil {
+		t.Fatalf("unmarshal report: %v", err)
+	}
+	if !report.DryRun || report.Nodes != 2 || report.Edges != 2 || report.Writes != 4 || len(report.Warnings) != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	nodes, edges, err := loadGraph(ctx, "story-dry")
+	if err != nil || len(nodes) != 0 || len(edges) != 0 {
+		t.Fatalf("dry run wrote %d nodes, %d edges (%v)", len(nodes), len(edges), err)
+	}
+	if v, err := latestGraphVersion(ctx, "story-dry"); err != nil || v != 0 {
+		t.Fatalf("dry run recorded graph version %d (%v)", v, err)
+	}
+
+	// Validation failures are reported exactly like a real submit.
+	bad := `{"storyId":"story-dry","nodes":[{"id":"n1"}],"edges":[{"from":"n1","to":"ghost"}]}`
+	resp, _ = handler(ctx, events.APIGatewayProxyRequest{Body: bad, QueryStringParameters: map[string]string{"dryRun": "true"}})
+	if resp.StatusCode != 422 {
+		t.Fatalf("expected 422 for unknown endpoint, got %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestGetSortsNodes(t *testing.T) {
+	setupTestServices()
+	strukturCache = newGraphCache(4, time.Minute)
+	defer func() { strukturCache = nil }()
+	ctx := context.Background()
+
+	graph := `{"storyId":"story-sort","nodes":[{"id":"n1","label":"charlie"},{"id":"n2","label":"Alpha"},{"id":"n3","label":"bravo"},{"id":"n4","label":"delta"}],
+		"edges":[{"from":"n3","to":"n1"},{"from":"n3","to":"n2"},{"from":"n3","to":"n4"},{"from":"n4","to":"n1"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: graph}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	order := func(query map[string]string) []string {
+		t.Helper()
+		resp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-sort"}, QueryStringParameters: query})
+		if resp.StatusCode != 200 {
+			t.Fatalf("get %v failed: %d %s", query, resp.StatusCode, resp.Body)
+		}
+		var sb Strukturbild
+		if err := json.Unmarshal([]byte(resp.Body), &sb); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		var ids []string
+		for _, n := range sb.Nodes {
+			ids = append(ids, n.ID)
+		}
+		return ids
+	}
+
+	before := order(nil)
+	if got := order(map[string]string{"sortNodes": "label"}); !reflect.DeepEqual(got, []string{"n2", "n3", "n1", "n4"}) {
+		t.Fatalf("label order: %v", got)
+	}
+	// n3 has three relations, n1 and n4 two (ties by label), n2 one.
+	if got := order(map[string]string{"sortNodes": "degree"}); !reflect.DeepEqual(got, []string{"n3", "n1", "n4", "n2"}) {
+		t.Fatalf("degree order: %v", got)
+	}
+	if got := order(nil); !reflect.DeepEqual(got, before) {
+		t.Fatalf("sorting changed the default order: %v, was %v", got, before)
+	}
+
+	resp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-sort"}, QueryStringParameters: map[string]string{"sortNodes": "size"}})
+	if resp.StatusCode != 400 {
+		t.Fatalf("expected 400 for unknown sort key, got %d", resp.StatusCode)
+	}
+}
+
+func TestStrukturCache(t *testing.T) {
+	setupTestServices()
+	strukturCache = newGraphCache(2, time.Minute)
+	defer func() { strukturCache = nil }()
+	ctx := context.Background()
+	mem := svc.(*memoryDynamo)
+
+	submit := func(label string) {
+		body := fmt.Sprintf(`{"storyId":"story-cache","nodes":[{"id":"n1","label":%q}],"edges":[]}`, label)
+		if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+			t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+		}
+	}
+	get := func() Strukturbild {
+		resp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-cache"}})
+		if resp.StatusCode != 200 {
+			t.Fatalf("get failed: %d %s", resp.StatusCode, resp.Body)
+		}
+		var sb Strukturbild
+		if err := json.Unmarshal([]byte(resp.Body), &sb); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return sb
+	}
+
+	submit("Alt")
+	get()
+	mem.itemsRead = 0
+	if sb := get(); sb.Nodes[0].Label != "Alt" {
+		t.Fatalf("unexpected cached graph: %+v", sb.Nodes)
+	}
+	if mem.itemsRead != 0 {
+		t.Fatalf("cache hit should skip DynamoDB, read %d items", mem.itemsRead)
+	}
+
+	submit("Neu")
+	if sb := get(); sb.Nodes[0].Label != "Neu" {
+		t.Fatalf("submit should invalidate the cached graph, got %+v", sb.Nodes)
+	}
+
+	storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-cache","schoolId":"s","title":"Cache"}`})
+	if sb := get(); sb.Story == nil || sb.Story.Title != "Cache" {
+		t.Fatalf("story writes should invalidate the cached graph, got %+v", sb.Story)
+	}
+
+	now := time.Now()
+	strukturCache.now = func() time.Time { return now.Add(2 * time.Minute) }
+	mem.itemsRead = 0
+	get()
+	if mem.itemsRead == 0 {
+		t.Fatalf("expired entry should be reloaded")
+	}
+}
+
+func TestEdgeWaypointsRoundTrip(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	body := `{"storyId":"story-wp","nodes":[{"id":"n1","label":"A"},{"id":"n2","label":"B","x":300}],
+		"edges":[{"from":"n1","to":"n2","waypoints":[{"x":100,"y":-40},{"x":200,"y":-40}]},{"from":"n2","to":"n1"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	_, edges, err := loadGraph(ctx, "story-wp")
+	if err != nil || len(edges) != 2 {
+		t.Fatalf("load graph: %v %+v", err, edges)
+	}
+	for _, e := range edges {
+		switch e.From {
+		case "n1":
+			if len(e.Waypoints) != 2 || e.Waypoints[0] != (Point{100, -40}) || e.Waypoints[1] != (Point{200, -40}) {
+				t.Errorf("waypoints did not round-trip: %+v", e.Waypoints)
+			}
+		case "n2":
+			if e.Waypoints != nil {
+				t.Errorf("straight edge gained waypoints: %+v", e.Waypoints)
+			}
+		}
+	}
+
+	many := make([]Point, maxWaypoints+1)
+	tooMany, _ := json.Marshal(Strukturbild{StoryID: "story-wp", Edges: []Edge{{From: "n1", To: "n2", Waypoints: many}}})
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: string(tooMany)}); resp.StatusCode != 422 {
+		t.Fatalf("expected 422 above the waypoint limit, got %d", resp.StatusCode)
+	}
+}
+
+func TestSubmitRejectsDanglingEdges(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	submit := func(body string, query map[string]string) events.APIGatewayProxyResponse {
+		t.Helper()
+		resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body, QueryStringParameters: query, Headers: map[string]string{"Accept": "application/json"}})
+		return resp
+	}
+	if resp := submit(`{"storyId":"story-dangle","nodes":[{"id":"n1","label":"A"}]}`, nil); resp.StatusCode != 200 {
+		t.Fatalf("seed submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	// n1 is only stored, n2 only submitted; both count.
+	if resp := submit(`{"storyId":"story-dangle","nodes":[{"id":"n2","label":"B"}],"edges":[{"from":"n1","to":"n2"}]}`, nil); resp.StatusCode != 200 {
+		t.Fatalf("edge between stored and submitted node rejected: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	dangling := `{"storyId":"story-dangle","edges":[{"from":"n1","to":"ghost"},{"from":"n2","to":"n1"}]}`
+	resp := submit(dangling, nil)
+	if resp.StatusCode != 422 || !strings.Contains(resp.Body, "ghost") || !strings.Contains(resp.Body, "n1->ghost") || strings.Contains(resp.Body, "n2->n1") {
+		t.Fatalf("expected 422 naming edge n1->ghost only, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if _, edges, _ := loadGraph(ctx, "story-dangle"); len(edges) != 1 {
+		t.Fatalf("rejected submit stored edges: %+v", edges)
+	}
+
+	resp = submit(dangling, map[string]string{"allowDanglingEdges": "true"})
+	var out struct {
+		DanglingEdges []string `json:"danglingEdges"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil || resp.StatusCode != 200 || !reflect.DeepEqual(out.DanglingEdges, []string{"n1->ghost"}) {
+		t.Fatalf("allowDanglingEdges should store and report the edge, got %d %s", resp.StatusCode, resp.Body)
+	}
+	nodes, edges, _ := loadGraph(ctx, "story-dangle")
+	if len(nodes) != 2 || len(edges) != 3 {
+		t.Fatalf("expected the dangling edge without new nodes, got %d nodes %d edges", len(nodes), len(edges))
+	}
+
+	// The edge is marked, so repair reports it apart and keeps it.
+	marked := ""
+	for _, e := range edges {
+		if e.Dangling != (e.To == "ghost") {
+			t.Fatalf("only n1->ghost should be marked dangling: %+v", edges)
+		}
+		if e.Dangling {
+			marked = e.ID
+		}
+	}
+	repair, _ := repairHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "story-dangle"},
+		QueryStringParameters: map[string]string{"apply": "true"}})
+	if repair.StatusCode != 200 || !strings.Contains(repair.Body, `"danglingEdges":[]`) || !strings.Contains(repair.Body, `"allowedDanglingEdges":["`+marked+`"]`) {
+		t.Fatalf("repair should report %s as allowed, got %d %s", marked, repair.StatusCode, repair.Body)
+	}
+	if _, edges, _ := loadGraph(ctx, "story-dangle"); len(edges) != 3 {
+		t.Fatalf("repair removed an allowed dangling edge: %+v", edges)
+	}
+
+	if resp := submit(dangling, map[string]string{"allowDanglingEdges": "true", "autoCreateNodes": "true"}); resp.StatusCode != 400 {
+		t.Fatalf("conflicting flags should be 400, got %d %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, _ = createStoryWithGraphHandler(ctx, events.APIGatewayProxyRequest{
+		Body:                  `{"storyId":"story-dangle-new","schoolId":"s","title":"T","nodes":[{"id":"a","label":"A"}],"edges":[{"from":"a","to":"ghost"}]}`,
+		QueryStringParameters: map[string]string{"allowDanglingEdges": "true"},
+	})
+	if resp.StatusCode != 200 || !strings.Contains(resp.Body, `"danglingEdges":["a-\u003eghost"]`) {
+		t.Fatalf("with-graph should report dangling edges, got %d %s", resp.StatusCode, resp.Body)
+	}
+
+	// Without the stored graph nothing can be checked, so nothing is written.
+	mem := svc.(*memoryDynamo)
+	svc = failingQueryDynamo{mem}
+	defer func() { svc = mem }()
+	if resp := submit(`{"storyId":"story-dangle","nodes":[{"id":"n3","label":"C"}],"edges":[{"from":"n3","to":"ghost"}]}`, map[string]string{"allowDanglingEdges": "true"}); resp.StatusCode != 503 {
+		t.Fatalf("failed pre-scan should be 503, got %d %s", resp.StatusCode, resp.Body)
+	}
+	svc = mem
+	if nodes, _, _ := loadGraph(ctx, "story-dangle"); len(nodes) != 2 {
+		t.Fatalf("submit wrote without a pre-scan: %+v", nodes)
+	}
+}
+
+// failingQueryDynamo fails every Query, like a throttled table.
+type failingQueryDynamo struct {
+	*memoryDynamo
+}
+
+func (f failingQueryDynamo) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return nil, errors.New("throughput exceeded")
+}
+
+func TestAutoCreatedNodesCannotTakeEdgeIDs(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	auto := map[string]string{"autoCreateNodes": "true"}
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-clash","nodes":[{"id":"a","label":"A"},{"id":"b","label":"B"}],"edges":[{"from":"a","to":"b"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("seed submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	// e1 is the stored edge a->b.
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-clash","edges":[{"from":"a","to":"e1"}]}`, QueryStringParameters: auto}); resp.StatusCode != 409 {
+		t.Fatalf("placeholder for a stored edge id should be 409, got %d %s", resp.StatusCode, resp.Body)
+	}
+	// e2 would be the id assigned to the incoming edge itself.
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-clash","edges":[{"from":"a","to":"e2"}]}`, QueryStringParameters: auto}); resp.StatusCode != 200 {
+		t.Fatalf("placeholder e2 should push the new edge to another id, got %d %s", resp.StatusCode, resp.Body)
+	}
+	nodes, edges, _ := loadGraph(ctx, "story-clash")
+	if len(nodes) != 3 || len(edges) != 2 {
+		t.Fatalf("expected 3 nodes and 2 edges, got %+v %+v", nodes, edges)
+	}
+	for _, e := range edges {
+		if e.ID == "e2" {
+			t.Fatalf("edge took the id of node e2: %+v", e)
+		}
+	}
+	// An explicit edge id naming the placeholder collides too.
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-clash","edges":[{"id":"e9","from":"a","to":"e9"}]}`, QueryStringParameters: auto}); resp.StatusCode != 409 {
+		t.Fatalf("edge and placeholder with one id should be 409, got %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestSubmitAutoCreatesMissingEdgeNodes(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	body := `{"storyId":"story-auto","nodes":[{"id":"n1","label":"A"}],"edges":[{"from":"n1","to":"ext-1"},{"from":"ext-2","to":"ext-1"}]}`
+
+	resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body})
+	if resp.StatusCode != 422 || !strings.Contains(resp.Body, "ext-1, ext-2") {
+		t.Fatalf("expected dangling edges to be rejected, got %d %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, _ = handler(ctx, events.APIGatewayProxyRequest{Body: body, QueryStringParameters: map[string]string{"autoCreateNodes": "true"}, Headers: map[string]string{"Accept": "application/json"}})
+	if resp.StatusCode != 200 {
+		t.Fatalf("auto-create submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var out struct {
+		Nodes            int      `json:"nodes"`
+		AutoCreatedNodes []string `json:"autoCreatedNodes"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !reflect.DeepEqual(out.AutoCreatedNodes, []string{"ext-1", "ext-2"}) || out.Nodes != 3 {
+		t.Fatalf("unexpected result: %+v", out)
+	}
+	nodes, edges, err := loadGraph(ctx, "story-auto")
+	if err != nil || len(nodes) != 3 || len(edges) != 2 {
+		t.Fatalf("stored graph: %v %d nodes %d edges", err, len(nodes), len(edges))
+	}
+	for _, n := range nodes {
+		if n.ID == "ext-2" && n.Label != "ext-2" {
+			t.Errorf("placeholder label = %q, want its id", n.Label)
+		}
+	}
+
+	// Stored nodes count as known on later submits.
+	resp, _ = handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-auto","edges":[{"from":"ext-2","to":"n1"}]}`})
+	if resp.StatusCode != 200 {
+		t.Fatalf("edge between stored nodes rejected: %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestGetHandlerProjectsNodeFields(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	body := `{"storyId":"story-fields","nodes":[{"id":"n1","label":"A","detail":"long text","type":"goal","x":10,"y":20}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	get := func(fields string) events.APIGatewayProxyResponse {
+		resp, _ := getHandler(ctx, events.APIGatewayProxyRequest{
+			PathParameters:        map[string]string{"id": "story-fields"},
+			QueryStringParameters: map[string]string{"fields": fields},
+		})
+		return resp
+	}
+	resp := get("id, x,y,type")
+	if resp.StatusCode != 200 {
+		t.Fatalf("projected get: %d %s", resp.StatusCode, resp.Body)
+	}
+	var out struct {
+		StoryID string                   `json:"storyId"`
+		Nodes   []map[string]interface{} `json:"nodes"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := map[string]interface{}{"id": "n1", "x": 10.0, "y": 20.0, "type": "goal"}
+	if out.StoryID != "story-fields" || len(out.Nodes) != 1 || !reflect.DeepEqual(out.Nodes[0], want) {
+		t.Fatalf("unexpected projection: %s", resp.Body)
+	}
+
+	if resp := get("id,secret"); resp.StatusCode != 400 || !strings.Contains(resp.Body, "secret") {
+		t.Fatalf("expected 400 for unknown field, got %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestGraphSidesEncodeAsEmptyArrays(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-lonely","nodes":[{"id":"n1","label":"Alone"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-lonely"}})
+	if resp.StatusCode != 200 || !strings.Contains(resp.Body, `"edges":[]`) {
+		t.Fatalf("expected \"edges\":[] for a graph without edges: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, _ = batchGraphsHandler(currentStore(), ctx, events.APIGatewayProxyRequest{Body: `{"storyIds":["story-lonely"]}`})
+	if !strings.Contains(resp.Body, `"edges":[]`) || strings.Contains(resp.Body, "null") {
+		t.Fatalf("batch response encodes empty sides as null: %s", resp.Body)
+	}
+}
+
+func TestSubmitPreservesNodeTimestamps(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	body := `{"storyId":"story-ts","nodes":[{"id":"old","label":"Old","createdAt":"2019-03-04T10:00:00+01:00","updatedAt":"2019-05-01T08:00:00Z"},{"id":"new","label":"New"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	byID := func() map[string]Node {
+		nodes, _, err := loadGraph(ctx, "story-ts")
+		if err != nil {
+			t.Fatalf("load graph: %v", err)
+		}
+		out := map[string]Node{}
+		for _, n := range nodes {
+			out[n.ID] = n
+		}
+		return out
+	}
+	nodes := byID()
+	if got := nodes["old"]; got.CreatedAt != "2019-03-04T09:00:00Z" || got.UpdatedAt != "2019-05-01T08:00:00Z" {
+		t.Fatalf("provided timestamps not preserved: %+v", got)
+	}
+	created := nodes["new"].CreatedAt
+	if created == "" || nodes["new"].UpdatedAt == "" {
+		t.Fatalf("server did not stamp a new node: %+v", nodes["new"])
+	}
+
+	// Re-saving without timestamps keeps the creation time.
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-ts","nodes":[{"id":"old","label":"Renamed"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("resubmit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if got := byID()["old"]; got.CreatedAt != "2019-03-04T09:00:00Z" || got.UpdatedAt == "2019-05-01T08:00:00Z" {
+		t.Fatalf("resubmit lost createdAt or kept stale updatedAt: %+v", got)
+	}
+
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-ts","nodes":[{"id":"x","createdAt":"yesterday"}]}`}); resp.StatusCode != 422 {
+		t.Fatalf("expected 422 for a malformed timestamp, got %d", resp.StatusCode)
+	}
+}
+
+func TestNodeAndEdgeMetaRoundTrip(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	body := `{"storyId":"story-meta","nodes":[
+		{"id":"a","label":"A","meta":{"confidence":"0.8","source":"Interview 3"}},
+		{"id":"b","label":"B"}],
+		"edges":[{"from":"a","to":"b","meta":{"evidence":"t1:12"}}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-meta"}})
+	if resp.StatusCode != 200 {
+		t.Fatalf("get failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var raw struct {
+		Nodes []map[string]json.RawMessage `json:"nodes"`
+	}
+	var got Strukturbild
+	_ = json.Unmarshal([]byte(resp.Body), &raw)
+	_ = json.Unmarshal([]byte(resp.Body), &got)
+	for i, n := range got.Nodes {
+		_, hasMeta := raw.Nodes[i]["meta"]
+		switch n.ID {
+		case "a":
+			if !reflect.DeepEqual(n.Meta, map[string]string{"confidence": "0.8", "source": "Interview 3"}) {
+				t.Fatalf("node meta not preserved: %v", n.Meta)
+			}
+		case "b":
+			if hasMeta {
+				t.Fatalf("node without meta should omit the field: %s", raw.Nodes[i]["meta"])
+			}
+		}
+	}
+	if len(got.Edges) != 1 || got.Edges[0].Meta["evidence"] != "t1:12" {
+		t.Fatalf("edge meta not preserved: %+v", got.Edges)
+	}
+
+	patch := events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "story-meta", "edgeId": got.Edges[0].ID}, Body: `{"meta":{}}`}
+	if resp, _ := updateEdgeHandler(ctx, patch); resp.StatusCode != 200 {
+		t.Fatalf("edge patch failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if _, edges, _ := loadGraph(ctx, "story-meta"); edges[0].Meta != nil {
+		t.Fatalf("empty meta patch should clear the map: %v", edges[0].Meta)
+	}
+
+	long := strings.Repeat("x", maxMetaValueLen+1)
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-meta","nodes":[{"id":"a","meta":{"note":"` + long + `"}}]}`}); resp.StatusCode != 422 {
+		t.Fatalf("expected 422 for an oversized meta value, got %d", resp.StatusCode)
+	}
+}
+
+func TestSubmitNodeIDCollisions(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	submit := func(query map[string]string, body string) events.APIGatewayProxyResponse {
+		t.Helper()
+		resp, _ := handler(ctx, events.APIGatewayProxyRequest{QueryStringParameters: query, Body: body})
+		return resp
+	}
+	create := map[string]string{"create": "true"}
+
+	if resp := submit(create, `{"storyId":"story-ids","nodes":[{"id":"n1","label":"Erst"},{"id":"n2"}],"edges":[{"from":"n1","to":"n2"}]}`); resp.StatusCode != 200 {
+		t.Fatalf("initial create failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	// Creating n1 again collides; the stored node is untouched.
+	if resp := submit(create, `{"storyId":"story-ids","nodes":[{"id":"n1","label":"Zweit"},{"id":"n3"}]}`); resp.StatusCode != 409 || !strings.Contains(resp.Body, "n1") {
+		t.Fatalf("expected 409 naming n1, got %d %s", resp.StatusCode, resp.Body)
+	}
+	// A node may never take an edge's id, even as an update.
+	if resp := submit(nil, `{"storyId":"story-ids","nodes":[{"id":"e1","label":"Kante?"}]}`); resp.StatusCode != 409 {
+		t.Fatalf("expected 409 for a node reusing an edge id, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp := submit(nil, `{"storyId":"story-ids","nodes":[{"id":"n4"},{"id":"n4"}]}`); resp.StatusCode != 422 {
+		t.Fatalf("expected 422 for a duplicate id in one submit, got %d", resp.StatusCode)
+	}
+	nodes, edges, _ := loadGraph(ctx, "story-ids")
+	if len(nodes) != 2 || len(edges) != 1 || nodes[0].Label != "Erst" {
+		t.Fatalf("rejected submits changed the graph: %+v %+v", nodes, edges)
+	}
+
+	// Without the flag an existing id is an intentional update.
+	if resp := submit(nil, `{"storyId":"story-ids","nodes":[{"id":"n1","label":"Neu"}]}`); resp.StatusCode != 200 {
+		t.Fatalf("update failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if nodes, _, _ := loadGraph(ctx, "story-ids"); nodes[0].Label != "Neu" {
+		t.Fatalf("update not applied: %+v", nodes[0])
+	}
+
+	// Nodes without an id each get a fresh one and never collide.
+	if resp := submit(create, `{"storyId":"story-ids","nodes":[{"label":"A"},{"label":"B"}]}`); resp.StatusCode != 200 {
+		t.Fatalf("id-less nodes rejected: %d %s", resp.StatusCode, resp.Body)
+	}
+	if nodes, _, _ := loadGraph(ctx, "story-ids"); len(nodes) != 4 {
+		t.Fatalf("expected two new nodes, got %+v", nodes)
+	}
+}
+
+func TestTextLengthLimits(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	storySvc.SetTextLimits(storyapi.TextLimits{Title: 10, BodyMd: 20})
+	long := func(n int) string { return strings.Repeat("ä", n) }
+	expect422 := func(what string, resp events.APIGatewayProxyResponse, field string) {
+		t.Helper()
+		if resp.StatusCode != 422 || !strings.Contains(resp.Body, field) || !strings.Contains(resp.Body, "limit") {
+			t.Fatalf("%s: expected 422 naming %q and the limit, got %d %s", what, field, resp.StatusCode, resp.Body)
+		}
+	}
+
+	resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-len","nodes":[{"id":"a","label":"` + long(maxLabelLen+1) + `"}]}`})
+	expect422("node label", resp, "Node a label")
+	resp, _ = handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-len","nodes":[{"id":"a"},{"id":"b"}],"edges":[{"from":"a","to":"b","detail":"` + long(maxDetailLen+1) + `"}]}`})
+	expect422("edge detail", resp, "Edge a->b detail")
+	// Multi-byte characters count once: exactly at the limit is accepted.
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-len","nodes":[{"id":"a","label":"` + long(maxLabelLen) + `"},{"id":"b"}],"edges":[{"from":"a","to":"b"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("label at the limit rejected: %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ = updateEdgeHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "story-len", "edgeId": "e1"}, Body: `{"label":"` + long(maxLabelLen+1) + `"}`})
+	expect422("edge patch", resp, "Edge e1 label")
+
+	resp, _ = storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-len","schoolId":"s","title":"` + long(11) + `"}`})
+	expect422("story title", resp, "title")
+	if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-len","schoolId":"s","title":"Kurz"}`}); resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	path := map[string]string{"storyId": "story-len"}
+	resp, _ = storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{PathParameters: path, Body: `{"index":1,"bodyMd":"` + long(21) + `"}`})
+	expect422("paragraph body", resp, "bodyMd")
+	resp, _ = storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{PathParameters: path, Body: `{"index":1,"bodyMd":"ok"}`})
+	var created map[string]string
+	_ = json.Unmarshal([]byte(resp.Body), &created)
+	resp, _ = storySvc.HandleUpdateParagraph(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"paragraphId": created["id"]}, Body: `{"storyId":"story-len","title":"` + long(11) + `"}`})
+	expect422("paragraph title update", resp, "title")
+	resp, _ = storySvc.HandleUpdateStory(ctx, events.APIGatewayProxyRequest{PathParameters: path, Body: `{"title":"` + long(11) + `"}`})
+	expect422("story title update", resp, "title")
+	resp, _ = storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: `{"story":{"storyId":"story-len","schoolId":"s","title":"Kurz"},"paragraphs":[{"index":2,"bodyMd":"` + long(21) + `"}]}`})
+	expect422("import body", resp, "paragraph 2 bodyMd")
+}
+
+func TestGetHistoricalGraphVersion(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	for _, body := range []string{
+		`{"storyId":"story-hist","nodes":[{"id":"n1","label":"Eins"}]}`,
+		`{"storyId":"story-hist","nodes":[{"id":"n1","label":"Eins neu"},{"id":"n2","label":"Zwei"}],"edges":[{"from":"n1","to":"n2"}]}`,
+	} {
+		if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+			t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+		}
+	}
+	get := func(version string) (events.APIGatewayProxyResponse, Strukturbild) {
+		t.Helper()
+		req := events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-hist"}}
+		if version != "" {
+			req.QueryStringParameters = map[string]string{"version": version}
+		}
+		resp, _ := getHandler(ctx, req)
+		var sb Strukturbild
+		if resp.StatusCode == 200 {
+			if err := json.Unmarshal([]byte(resp.Body), &sb); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return resp, sb
+	}
+
+	resp, sb := get("1")
+	if resp.StatusCode != 200 || sb.Version != 1 || len(sb.Nodes) != 1 || sb.Nodes[0].Label != "Eins" || len(sb.Edges) != 0 {
+		t.Fatalf("version 1 wrong: %d %+v", resp.StatusCode, sb)
+	}
+	if _, sb := get("2"); len(sb.Nodes) != 2 || len(sb.Edges) != 1 {
+		t.Fatalf("version 2 wrong: %+v", sb)
+	}
+	// Without ?version= the latest graph is returned as before.
+	if resp, sb := get(""); resp.StatusCode != 200 || sb.Version != 0 || len(sb.Nodes) != 2 || strings.Contains(resp.Body, `"version"`) {
+		t.Fatalf("latest graph changed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := get("3"); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for an unknown version, got %d", resp.StatusCode)
+	}
+	if resp, _ := get("zwei"); resp.StatusCode != 400 {
+		t.Fatalf("expected 400 for a malformed version, got %d", resp.StatusCode)
+	}
+}
+
+func TestGraphVersionRetention(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	defer func(n int) { maxGraphVersions = n }(maxGraphVersions)
+	maxGraphVersions = 3
+	for i := 1; i <= 5; i++ {
+		body := fmt.Sprintf(`{"storyId":"story-keepver","nodes":[{"id":"n1","label":"Stand %d"}]}`, i)
+		if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+			t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+		}
+	}
+	keys, err := graphVersionKeys(ctx, "story-keepver")
+	if err != nil || len(keys) != 3 {
+		t.Fatalf("expected 3 versions kept, got %d (%v)", len(keys), err)
+	}
+	if _, _, err := loadGraphVersion(ctx, "story-keepver", 2); !errors.Is(err, errGraphVersionNotFound) {
+		t.Fatalf("version 2 should be pruned, got %v", err)
+	}
+	if nodes, _, err := loadGraphVersion(ctx, "story-keepver", 5); err != nil || nodes[0].Label != "Stand 5" {
+		t.Fatalf("latest version wrong: %+v %v", nodes, err)
+	}
+
+	// The listing pages newest first with the shared envelope and cursor.
+	list := func(query map[string]string) storyapi.ListPage[graphVersionInfo] {
+		t.Helper()
+		resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{QueryStringParameters: query}, "GET", "/api/stories/story-keepver/graph-versions")
+		var page storyapi.ListPage[graphVersionInfo]
+		if resp.StatusCode != 200 || json.Unmarshal([]byte(resp.Body), &page) != nil {
+			t.Fatalf("list versions %v: %d %s", query, resp.StatusCode, resp.Body)
+		}
+		return page
+	}
+	first := list(map[string]string{"limit": "2"})
+	if first.Count != 2 || first.Total != 3 || !first.HasMore || first.Items[0].Version != 5 || first.Items[1].Version != 4 || first.Items[0].CreatedAt == "" {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+	second := list(map[string]string{"limit": "2", "cursor": first.NextCursor})
+	if second.Count != 1 || second.HasMore || second.NextCursor != "" || second.Items[0].Version != 3 {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+
+	// A graph whose snapshot would not fit into one item is not versioned.
+	big := Strukturbild{StoryID: "story-keepver"}
+	for i := 0; i*15000 <= maxGraphVersionBytes; i++ {
+		big.Nodes = append(big.Nodes, Node{ID: fmt.Sprintf("big%d", i), Label: "Gross", Detail: strings.Repeat("x", 15000)})
+	}
+	body, _ := json.Marshal(big)
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: string(body)}); resp.StatusCode != 200 {
+		t.Fatalf("submit of a large graph failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if _, err := recordGraphVersion(ctx, "story-keepver"); !errors.Is(err, errGraphTooLargeToVersion) {
+		t.Fatalf("expected errGraphTooLargeToVersion, got %v", err)
+	}
+	if latest, _ := latestGraphVersion(ctx, "story-keepver"); latest != 5 {
+		t.Fatalf("large graph should not add a version, latest is %d", latest)
+	}
+}
+
+func TestReturnedEdgesHaveStableIDs(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	body := `{"storyId":"story-eid","nodes":[{"id":"n1","label":"A"},{"id":"n2","label":"B"}],
+		"edges":[{"from":"n1","to":"n2","type":"causes"},{"from":"n2","to":"n1"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	// A snapshot written before edges had ids, with one relation twice.
+	graph := `{"nodes":[{"id":"n1","label":"A"},{"id":"n2","label":"B"}],
+		"edges":[{"from":"n1","to":"n2","type":"causes"},{"from":"n1","to":"n2","type":"causes"},{"from":"n2","to":"n1"}]}`
+	av, _ := attributevalue.MarshalMap(graphVersionRecord{
+		Partition: graphVersionPartitionPrefix + "story-eid",
+		SortKey:   graphVersionKey(99),
+		Version:   99,
+		Graph:     graph,
+	})
+	if _, err := svc.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: keySchema.ToItem(av)}); err != nil {
+		t.Fatalf("put snapshot: %v", err)
+	}
+
+	edgeIDs := func(version string) []string {
+		t.Helper()
+		req := events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-eid"}}
+		if version != "" {
+			req.QueryStringParameters = map[string]string{"version": version}
+		}
+		resp, _ := getHandler(ctx, req)
+		var sb Strukturbild
+		if err := json.Unmarshal([]byte(resp.Body), &sb); err != nil || resp.StatusCode != 200 {
+			t.Fatalf("get %q: %d %s", version, resp.StatusCode, resp.Body)
+		}
+		ids := []string{}
+		seen := map[string]bool{}
+		for _, e := range sb.Edges {
+			if e.ID == "" || seen[e.ID] {
+				t.Fatalf("version %q: edge %s->%s has a missing or repeated id %q", version, e.From, e.To, e.ID)
+			}
+			seen[e.ID] = true
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+	for _, version := range []string{"", "99"} {
+		first := edgeIDs(version)
+		if len(first) == 0 {
+			t.Fatalf("version %q returned no edges", version)
+		}
+		if again := edgeIDs(version); !reflect.DeepEqual(first, again) {
+			t.Fatalf("version %q: edge ids changed between reads: %v then %v", version, first, again)
+		}
+	}
+}
+
+func TestNormalizeLegacyGraphItems(t *testing.T) {
+	legacyEdge := map[string]types.AttributeValue{
+		"storyId":   &types.AttributeValueMemberS{Value: "story-legacy"},
+		"id":        &types.AttributeValueMemberS{Value: "e1"},
+		"from":      &types.AttributeValueMemberS{Value: "n1"},
+		"to":        &types.AttributeValueMemberS{Value: "n2"},
+		"label":     &types.AttributeValueMemberS{Value: "kennt"},
+		"timestamp": &types.AttributeValueMemberS{Value: "2023-05-01T10:00:00Z"},
+	}
+	item, legacy, err := normalizeDBItem(legacyEdge)
+	if err != nil || !legacy || item.IsNode || item.From != "n1" || item.Label != "kennt" {
+		t.Fatalf("legacy edge not normalized: %+v legacy=%v err=%v", item, legacy, err)
+	}
+	legacyNode := map[string]types.AttributeValue{
+		"storyId": &types.AttributeValueMemberS{Value: "story-legacy"},
+		"id":      &types.AttributeValueMemberS{Value: "n1"},
+		"label":   &types.AttributeValueMemberS{Value: "Schule"},
+	}
+	if item, legacy, _ := normalizeDBItem(legacyNode); !legacy || !item.IsNode {
+		t.Fatalf("legacy node not normalized: %+v", item)
+	}
+	current := map[string]types.AttributeValue{
+		"storyId": &types.AttributeValueMemberS{Value: "story-x"},
+		"id":      &types.AttributeValueMemberS{Value: "n1"},
+		"isNode":  &types.AttributeValueMemberBOOL{Value: true},
+	}
+	if item, legacy, _ := normalizeDBItem(current); legacy || item.StoryID != "story-x" || !item.IsNode {
+		t.Fatalf("current item misread: %+v legacy=%v", item, legacy)
+	}
+
+	// Items without isNode stored in a story partition load as nodes and edges.
+	setupTestServices()
+	ctx := context.Background()
+	for _, raw := range []map[string]types.AttributeValue{legacyNode, legacyEdge, {
+		"storyId": &types.AttributeValueMemberS{Value: "story-legacy"},
+		"id":      &types.AttributeValueMemberS{Value: "n2"},
+	}} {
+		if _, err := svc.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: cloneAttrMap(raw)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nodes, edges, err := loadGraph(ctx, "story-legacy")
+	if err != nil || len(nodes) != 2 || len(edges) != 1 || edges[0].From != "n1" {
+		t.Fatalf("legacy graph misread: %+v %+v %v", nodes, edges, err)
+	}
+}
+
+func TestRetypeNodes(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	body := `{"storyId":"story-retype","nodes":[{"id":"n1","type":"prozess"},{"id":"n2"},{"id":"n3","type":"praxis"}],"edges":[{"id":"e1","from":"n1","to":"n2"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	retype := func(body string) events.APIGatewayProxyResponse {
+		t.Helper()
+		resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{Body: body}, "POST", "/struktur/story-retype/retype")
+		return resp
+	}
+
+	resp := retype(`{"nodeIds":["n1","n2","e1","ghost"],"type":"ergebnis"}`)
+	if resp.StatusCode != 200 {
+		t.Fatalf("retype failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var out struct {
+		Updated int      `json:"updated"`
+		Unknown []string `json:"unknown"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil || out.Updated != 2 || !reflect.DeepEqual(out.Unknown, []string{"e1", "ghost"}) {
+		t.Fatalf("unexpected result %s (%v)", resp.Body, err)
+	}
+	nodes, _, _ := loadGraph(ctx, "story-retype")
+	got := map[string]string{}
+	for _, n := range nodes {
+		got[n.ID] = n.Type
+	}
+	if !reflect.DeepEqual(got, map[string]string{"n1": "ergebnis", "n2": "ergebnis", "n3": "praxis"}) {
+		t.Fatalf("types after retype: %v", got)
+	}
+
+	if resp := retype(`{"nodeIds":["n1"],"type":"goal"}`); resp.StatusCode != 422 {
+		t.Fatalf("expected 422 for an unknown type, got %d", resp.StatusCode)
+	}
+	if resp := retype(`{"nodeIds":[],"type":"praxis"}`); resp.StatusCode != 422 {
+		t.Fatalf("expected 422 without nodeIds, got %d", resp.StatusCode)
+	}
+}
+
+// blockingDynamo holds every Query until release is closed, ignoring the
+// context, like a dependency that hangs. entered signals each blocked call.
+type blockingDynamo struct {
+	*memoryDynamo
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b blockingDynamo) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	b.entered <- struct{}{}
+	<-b.release
+	return nil, ctx.Err()
+}
+
+func TestRequestTimeoutReturns504(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	defer func(d time.Duration) { requestTimeout = d }(requestTimeout)
+	requestTimeout = 50 * time.Millisecond
+
+	slow := blockingDynamo{memoryDynamo: svc.(*memoryDynamo), entered: make(chan struct{}, 1), release: make(chan struct{})}
+	svc = slow
+
+	start := time.Now()
+	resp, err := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/struktur/story-slow"})
+	<-slow.entered
+	close(slow.release)
+	if err != nil || resp.StatusCode != 504 || !strings.Contains(resp.Body, "timed out") {
+		t.Fatalf("expected 504, got %d %q %v", resp.StatusCode, resp.Body, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("timeout answered after %v", elapsed)
+	}
+
+	// Requests that finish in time are unaffected.
+	svc = slow.memoryDynamo
+	resp, _ = lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/submit", Body: `{"storyId":"story-fast","nodes":[{"id":"n1"}]}`})
+	if resp.StatusCode != 200 {
+		t.Fatalf("fast request failed: %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestTimedOutWriteReleasesStoryLock(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	defer func(d time.Duration) { requestTimeout = d }(requestTimeout)
+	requestTimeout = 50 * time.Millisecond
+	mem := svc.(*memoryDynamo)
+	submit := func(body string) events.APIGatewayProxyResponse {
+		resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/submit", Body: body})
+		return resp
+	}
+
+	slow := blockingDynamo{memoryDynamo: mem, entered: make(chan struct{}, 1), release: make(chan struct{})}
+	svc = slow
+	if resp := submit(`{"storyId":"story-locked","nodes":[{"id":"slow"}]}`); resp.StatusCode != 504 {
+		t.Fatalf("expected 504, got %d %s", resp.StatusCode, resp.Body)
+	}
+	<-slow.entered
+
+	// The timed-out handler is still blocked, but its story is free again.
+	svc = mem
+	if resp := submit(`{"storyId":"story-locked","nodes":[{"id":"next"}]}`); resp.StatusCode != 200 {
+		t.Fatalf("story still locked after the 504: %d %s", resp.StatusCode, resp.Body)
+	}
+	close(slow.release)
+
+	// A handler whose request is already over writes nothing.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	handler(cancelled, events.APIGatewayProxyRequest{Body: `{"storyId":"story-late","nodes":[{"id":"n1"}]}`})
+	if nodes, _, _ := loadGraph(ctx, "story-late"); len(nodes) != 0 {
+		t.Fatalf("write landed after the request was cancelled: %+v", nodes)
+	}
+}
+
+func TestLockStoryFindsTheStory(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	imp := `{"story":{"storyId":"story-held","schoolId":"s","title":"Held"},"paragraphs":[{"paragraphId":"para-held","index":1,"bodyMd":"Eins"}]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: imp}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	unlock, err := storyLocks.lock(ctx, "story-held")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if held, busy := lockStory(waitCtx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-held","nodes":[]}`}, "POST", "/api/validate-bundle"); held != nil || busy != nil {
+		t.Fatalf("validate-bundle must not wait for the story lock")
+	}
+	if _, busy := lockStory(waitCtx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-held"}`}, "POST", "/submit"); busy == nil || busy.StatusCode != 503 {
+		t.Fatalf("a submit must wait for the story lock, got %+v", busy)
+	}
+	// Paragraph writes lock the story of the paragraph record.
+	if _, busy := lockStory(waitCtx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-held","title":"T"}`}, "PATCH", "/api/paragraphs/para-held"); busy == nil {
+		t.Fatalf("a paragraph update must wait for its story's lock")
+	}
+	if held, busy := lockStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-other","title":"T"}`}, "PATCH", "/api/paragraphs/para-held"); held != nil || busy != nil {
+		t.Fatalf("a paragraph outside the named story is rejected unwritten and needs no lock")
+	}
+}
+
+func TestLargeGraphWarning(t *testing.T) {
+	setupTestServices()
+	defer func(n int) { largeGraphNodes = n }(largeGraphNodes)
+	largeGraphNodes = 3
+	ctx := context.Background()
+
+	submit := func(nodes ...string) map[string]json.RawMessage {
+		t.Helper()
+		sb := Strukturbild{StoryID: "story-large"}
+		for _, id := range nodes {
+			sb.Nodes = append(sb.Nodes, Node{ID: id, Label: id})
+		}
+		body, _ := json.Marshal(sb)
+		resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: string(body), Headers: map[string]string{"Accept": "application/json"}})
+		var out map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(resp.Body), &out); err != nil || resp.StatusCode != 200 {
+			t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+		}
+		return out
+	}
+	get := func() Strukturbild {
+		t.Helper()
+		resp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-large"}})
+		var sb Strukturbild
+		if err := json.Unmarshal([]byte(resp.Body), &sb); err != nil || resp.StatusCode != 200 {
+			t.Fatalf("get failed: %d %s", resp.StatusCode, resp.Body)
+		}
+		return sb
+	}
+
+	if out := submit("a", "b", "c"); out["warning"] != nil {
+		t.Fatalf("no warning expected at the threshold, got %s", out["warning"])
+	}
+	if sb := get(); sb.Warning != nil {
+		t.Fatalf("no warning expected at the threshold, got %+v", sb.Warning)
+	}
+	// The board crosses the threshold once the stored nodes are counted.
+	out := submit("d")
+	var w graphWarning
+	if err := json.Unmarshal(out["warning"], &w); err != nil || w != (graphWarning{Code: "LARGE_GRAPH", NodeCount: 4, Threshold: 3}) {
+		t.Fatalf("expected a LARGE_GRAPH warning on submit, got %s", out["warning"])
+	}
+	if sb := get(); sb.Warning == nil || sb.Warning.NodeCount != 4 || len(sb.Nodes) != 4 {
+		t.Fatalf("expected a LARGE_GRAPH warning on get, got %+v", sb)
+	}
+}
+
+func TestTranslateLabelsRoundTrip(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-i18n","nodes":[{"id":"n1","label":"Schule"},{"id":"n2","label":"Lehrer"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	translate := func(body string, query map[string]string) events.APIGatewayProxyResponse {
+		t.Helper()
+		resp, _ := translateLabelsHandler(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"storyId": "story-i18n"}, QueryStringParameters: query, Body: body})
+		return resp
+	}
+	resp := translate(`{"lang":"en","map":{"n1":"School","n2":"Teacher","ghost":"Ghost"}}`, nil)
+	if resp.StatusCode != 200 || !strings.Contains(resp.Body, `"updated":2`) || !strings.Contains(resp.Body, `"unknown":["ghost"]`) {
+		t.Fatalf("translate en: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp := translate(`{"lang":"FR","map":{"n1":"École"}}`, nil); resp.StatusCode != 200 {
+		t.Fatalf("translate fr: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp := translate(`{"map":{"n1":"School"}}`, nil); resp.StatusCode != 422 {
+		t.Fatalf("translation without lang: %d, want 422", resp.StatusCode)
+	}
+	if resp := translate(`{"lang":"english!","map":{"n1":"School"}}`, nil); resp.StatusCode != 422 {
+		t.Fatalf("invalid lang: %d, want 422", resp.StatusCode)
+	}
+
+	labels := func(lang string) map[string]string {
+		t.Helper()
+		req := events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-i18n"}}
+		if lang != "" {
+			req.QueryStringParameters = map[string]string{"lang": lang}
+		}
+		resp, _ := getHandler(ctx, req)
+		if resp.StatusCode != 200 {
+			t.Fatalf("get ?lang=%s: %d %s", lang, resp.StatusCode, resp.Body)
+		}
+		var sb Strukturbild
+		if err := json.Unmarshal([]byte(resp.Body), &sb); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		out := map[string]string{}
+		for _, n := range sb.Nodes {
+			out[n.ID] = n.Label
+		}
+		return out
+	}
+	for _, c := range []struct {
+		lang string
+		want map[string]string
+	}{
+		{"en", map[string]string{"n1": "School", "n2": "Teacher"}},
+		{"fr", map[string]string{"n1": "École", "n2": "Lehrer"}},
+		{"fr-CH", map[string]string{"n1": "École", "n2": "Lehrer"}},
+		{"es", map[string]string{"n1": "Schule", "n2": "Lehrer"}},
+		{"", map[string]string{"n1": "Schule", "n2": "Lehrer"}},
+	} {
+		if got := labels(c.lang); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("labels ?lang=%s = %v, want %v", c.lang, got, c.want)
+		}
+	}
+	if resp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-i18n"}, QueryStringParameters: map[string]string{"lang": "x y"}}); resp.StatusCode != 400 {
+		t.Fatalf("invalid ?lang=: %d, want 400", resp.StatusCode)
+	}
+
+	nodes, _, err := loadGraph(ctx, "story-i18n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"en": "School", "fr": "École"}; !reflect.DeepEqual(nodes[0].LabelI18n, want) {
+		t.Fatalf("stored translations of n1 = %v, want %v", nodes[0].LabelI18n, want)
+	}
+
+	if resp := translate(`{"map":{"n2":"Lehrerin"}}`, map[string]string{"overwrite": "true"}); resp.StatusCode != 200 {
+		t.Fatalf("overwrite: %d %s", resp.StatusCode, resp.Body)
+	}
+	if got := labels(""); got["n2"] != "Lehrerin" {
+		t.Fatalf("default label after overwrite = %q", got["n2"])
+	}
+	if got := labels("en"); got["n2"] != "Teacher" {
+		t.Fatalf("overwrite must keep translations, got %q", got["n2"])
+	}
+
+	// An editor save sends nodes without labelI18n; {} clears on purpose.
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-i18n","nodes":[{"id":"n1","label":"Schule","x":5,"y":5},{"id":"n2","label":"Lehrerin","labelI18n":{}}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("editor save: %d %s", resp.StatusCode, resp.Body)
+	}
+	if got := labels("en"); got["n1"] != "School" || got["n2"] != "Lehrerin" {
+		t.Fatalf("after editor save ?lang=en = %v, want n1 kept and n2 cleared", got)
+	}
+}
+
+func TestCorruptNumberAttributeIsReported(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-corrupt","nodes":[{"id":"n1","x":10,"y":20},{"id":"n2","x":30,"y":40}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	// Corrupt n2's x position behind the handlers' backs.
+	corrupt, _ := attributevalue.MarshalMap(DBItem{ID: "n2", StoryID: "story-corrupt", IsNode: true, Y: 40, Timestamp: "2024-01-01T00:00:00Z"})
+	corrupt["x"] = &types.AttributeValueMemberN{Value: "ten"}
+	if _, err := svc.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: keySchema.ToItem(corrupt)}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := normalizeDBItem(corrupt)
+	if err == nil {
+		t.Fatal("non-numeric x must not unmarshal as 0")
+	}
+	for _, want := range []string{"n2", `x="ten"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q should name %s", err, want)
+		}
+	}
+
+	nodes, _, err := loadGraph(ctx, "story-corrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].ID != "n1" || nodes[0].X != 10 {
+		t.Fatalf("corrupt node must be skipped, not moved to 0: %+v", nodes)
+	}
 }
@@ -0,0 +1,159 @@
+//go:build integration
+
+// Integration tests against DynamoDB Local. They exercise the real SDK
+// marshaling (attributevalue tags, key names, expressions) that the in-memory
+// fake in dynamo_test.go cannot catch.
+//
+// Run with:
+//
+//	make test-integration
+//
+// or manually:
+//
+//	docker run -d -p 8000:8000 amazon/dynamodb-local
+//	DYNAMODB_ENDPOINT=http://localhost:8000 go test -tags integration ./...
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func setupLocalDynamo(t *testing.T) {
+	t.Helper()
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_ENDPOINT not set; see the file header for how to run DynamoDB Local")
+	}
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("local", "local", "")),
+	)
+	if err != nil {
+		t.Fatalf("load AWS config: %v", err)
+	}
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+	})
+
+	table := fmt.Sprintf("strukturbild_it_%d", time.Now().UnixNano())
+	_, err = client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:   aws.String(table),
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String(keySchema.PartitionKey), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String(keySchema.SortKey), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(keySchema.PartitionKey), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String(keySchema.SortKey), KeyType: types.KeyTypeRange},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create table %s: %v", table, err)
+	}
+	t.Cleanup(func() {
+		_, _ = client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(table)})
+	})
+
+	tableName = table
+	if err := useStore(client); err != nil {
+		t.Fatalf("use store: %v", err)
+	}
+}
+
+func TestIntegrationStoryAndGraphRoundTrip(t *testing.T) {
+	setupLocalDynamo(t)
+	ctx := context.Background()
+
+	importJSON := `{
+  "story": { "storyId": "story-it", "schoolId": "it", "title": "Integration" },
+  "paragraphs": [
+    { "index": 1, "title": "Eins", "bodyMd": "Erster", "citations": [{ "transcriptId": "t1", "minutes": [1, 2] }] },
+    { "index": 2, "bodyMd": "Zweiter", "citations": [] }
+  ],
+  "details": [
+    { "paragraphIndex": 1, "kind": "quote", "transcriptId": "t1", "startMinute": 1, "endMinute": 2, "text": "Zitat" }
+  ]
+}`
+	if resp, err := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: importJSON}); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("import failed: %v status=%d body=%s", err, resp.StatusCode, resp.Body)
+	}
+
+	graph := Strukturbild{
+		StoryID: "story-it",
+		Nodes: []Node{
+			{ID: "n1", Label: "Ziel", Type: "ergebnis", Color: "#16a34a", X: 10, Y: 20},
+			{ID: "n2", Label: "Weg", Detail: "Detail", X: -5, Y: 0},
+		},
+		Edges: []Edge{{From: "n2", To: "n1", Label: "führt zu", Type: "supports"}},
+	}
+	body, _ := json.Marshal(graph)
+	if resp, err := handler(ctx, events.APIGatewayProxyRequest{Body: string(body)}); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %v status=%d body=%s", err, resp.StatusCode, resp.Body)
+	}
+
+	resp, err := getHandler(ctx, events.APIGatewayProxyRequest{
+		PathParameters:        map[string]string{"id": "story-it"},
+		QueryStringParameters: map[string]string{"includeDetails": "true"},
+	})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("get failed: %v status=%d body=%s", err, resp.StatusCode, resp.Body)
+	}
+	var got Strukturbild
+	if err := json.Unmarshal([]byte(resp.Body), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got.Nodes) != 2 || len(got.Edges) != 1 {
+		t.Fatalf("unexpected graph: %+v", got)
+	}
+	for _, n := range got.Nodes {
+		if n.ID == "n1" && (n.X != 10 || n.Y != 20 || n.Color != "#16a34a" || n.Type != "ergebnis") {
+			t.Errorf("node n1 did not round-trip: %+v", n)
+		}
+		if n.ID == "n2" && (n.X != -5 || n.Detail != "Detail") {
+			t.Errorf("node n2 did not round-trip: %+v", n)
+		}
+	}
+	if got.Edges[0].ID != "e1" || got.Edges[0].From != "n2" || got.Edges[0].Type != "supports" {
+		t.Errorf("edge did not round-trip: %+v", got.Edges[0])
+	}
+	if got.Story == nil || got.Story.Title != "Integration" {
+		t.Fatalf("story bundle missing: %+v", got.Story)
+	}
+	if len(got.Paragraphs) != 2 || len(got.Paragraphs[0].Citations) != 1 || len(got.Paragraphs[0].Citations[0].Minutes) != 2 {
+		t.Fatalf("paragraphs did not round-trip: %+v", got.Paragraphs)
+	}
+	if len(got.DetailsByParagraph[got.Paragraphs[0].ParagraphID]) != 1 {
+		t.Fatalf("details did not round-trip: %+v", got.DetailsByParagraph)
+	}
+
+	listResp, _ := storySvc.HandleListStories(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"includeDrafts": "true"}})
+	var list struct {
+		Items []storyapi.Story `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(listResp.Body), &list); err != nil || len(list.Items) != 1 {
+		t.Fatalf("list stories failed: %v %s", err, listResp.Body)
+	}
+
+	if resp, _ := deleteEdgeHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "story-it", "edgeId": "e1"}}); resp.StatusCode != 200 {
+		t.Fatalf("delete edge failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := deleteEdgeHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "story-it", "edgeId": "n1"}}); resp.StatusCode == 200 {
+		t.Fatalf("edge delete condition should refuse to delete a node")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// langTag accepts BCP 47 style language tags such as "en", "de-ch" or "pt-br".
+var langTag = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// parseLang normalizes a language tag to lower case; "" stays "".
+func parseLang(v string) (string, error) {
+	lang := strings.ToLower(strings.TrimSpace(v))
+	if lang != "" && !langTag.MatchString(lang) {
+		return "", fmt.Errorf("Invalid language %q", v)
+	}
+	return lang, nil
+}
+
+// validateLabelI18n checks translated labels like the default label; owner
+// names the node in the error.
+func validateLabelI18n(owner string, labels map[string]string) error {
+	for lang, label := range labels {
+		if norm, err := parseLang(lang); err != nil || norm != lang || lang == "" {
+			return fmt.Errorf("%s labelI18n key %q is not a lower-case language tag", owner, lang)
+		}
+		if err := storyapi.CheckLength(fmt.Sprintf("%s label (%s)", owner, lang), label, maxLabelLen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localizedLabel picks the label of lang: an exact translation, then one for
+// the primary language ("de" for "de-ch"), then the default label.
+func localizedLabel(n Node, lang string) string {
+	if label := n.LabelI18n[lang]; label != "" {
+		return label
+	}
+	if primary, _, ok := strings.Cut(lang, "-"); ok {
+		if label := n.LabelI18n[primary]; label != "" {
+			return label
+		}
+	}
+	return n.Label
+}
+
+// localizedNodes returns a copy of nodes labelled in lang; the slice may be
+// shared with strukturCache and is left alone.
+func localizedNodes(nodes []Node, lang string) []Node {
+	out := append([]Node(nil), nodes...)
+	for i := range out {
+		out[i].Label = localizedLabel(out[i], lang)
+	}
+	return out
+}
+
+// translateLabelsHandler sets node labels in bulk from {"lang":"en",
+// "map":{"nodeId":"label"}}. The translations are stored in the nodes'
+// labelI18n under lang, which GET /struktur/{id}?lang= reads; the default
+// labels stay. ?overwrite=true replaces the default labels instead. Node ids
+// not in the graph are reported as unknown.
+// Route: POST /api/stories/{storyId}/translate-labels?overwrite=
+func translateLabelsHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	overwrite := false
+	switch req.QueryStringParameters["overwrite"] {
+	case "", "false":
+	case "true":
+		overwrite = true
+	default:
+		return badInput("overwrite must be true or false"), nil
+	}
+	var in struct {
+		Lang string            `json:"lang"`
+		Map  map[string]string `json:"map"`
+	}
+	if err := storyapi.DecodeJSON(req.Body, &in); err != nil {
+		return badInput(err.Error()), nil
+	}
+	lang, err := parseLang(in.Lang)
+	if err != nil {
+		return unprocessable(err.Error()), nil
+	}
+	if lang == "" && !overwrite {
+		return unprocessable("lang is required unless overwrite=true"), nil
+	}
+	if len(in.Map) == 0 {
+		return unprocessable("map must name at least one node"), nil
+	}
+	if len(in.Map) > maxTransactItems {
+		return unprocessable(fmt.Sprintf("Too many labels: %d (limit %d)", len(in.Map), maxTransactItems)), nil
+	}
+	for id, label := range in.Map {
+		if err := checkGraphText("Node "+id, label, ""); err != nil {
+			return unprocessable(err.Error()), nil
+		}
+	}
+
+	items, err := queryStoryItems(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to query items for %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	nodes := make(map[string]DBItem, len(items))
+	for _, it := range items {
+		if it.IsNode {
+			nodes[it.ID] = it
+		}
+	}
+
+	ids := make([]string, 0, len(in.Map))
+	for id := range in.Map {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	now := storyapi.NowRFC3339UTC()
+	unknown := []string{}
+	var writes []types.TransactWriteItem
+	for _, id := range ids {
+		cur, ok := nodes[id]
+		if !ok {
+			unknown = append(unknown, id)
+			continue
+		}
+		if overwrite {
+			cur.Label = in.Map[id]
+		} else {
+			labels := make(map[string]string, len(cur.LabelI18n)+1)
+			for k, v := range cur.LabelI18n {
+				labels[k] = v
+			}
+			labels[lang] = in.Map[id]
+			cur.LabelI18n = labels
+		}
+		cur.Timestamp = now
+		cur.UpdatedBy = storyapi.ActorFromContext(ctx)
+		av, err := attributevalue.MarshalMap(cur)
+		if err != nil {
+			log.Printf("❌ Marshal node %s for translation failed: %v", id, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to update nodes"}, nil
+		}
+		writes = append(writes, types.TransactWriteItem{Put: &types.Put{
+			TableName: aws.String(tableName),
+			Item:      keySchema.ToItem(av),
+		}})
+	}
+	if len(writes) > 0 {
+		if _, err := svc.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes}); err != nil {
+			log.Printf("❌ Label translation failed for %s: %v", storyID, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to update nodes"}, nil
+		}
+		notifyGraphChange(ctx, storyapi.EventGraphUpdated, storyID)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"lang": lang, "overwritten": overwrite, "updated": len(writes), "unknown": unknown})
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// normalizeDBItem unmarshals a stored graph item (already passed through
+// keySchema.FromItem) into the canonical DBItem. Edges written before isNode
+// existed are told from nodes by their endpoints; legacy reports whether that
+// fallback was needed. An item that does not unmarshal, e.g. because of a
+// non-numeric x, is an error naming the item and attribute rather than a
+// node at 0.
+//
+// Items keyed by personId, from before boards belonged to stories, are not
+// read: they live outside the storyId partitions every graph read queries.
+func normalizeDBItem(raw map[string]types.AttributeValue) (item DBItem, legacy bool, err error) {
+	if err := storyapi.UnmarshalItem(raw, &item); err != nil {
+		return DBItem{}, false, err
+	}
+	if _, ok := raw["isNode"]; !ok {
+		item.IsNode = item.From == "" && item.To == ""
+		legacy = true
+	}
+	return item, legacy, nil
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	storyapi "strukturbild/api"
@@ -24,7 +29,12 @@ import (
 
 var _ storyapi.DynamoClient = (*dynamodb.Client)(nil)
 
+// normalizePath strips a stage prefix ("/dev") and trailing slashes, so
+// "/dev/api/stories/" and "/api/stories" route the same way.
 func normalizePath(p string) string {
+	if trimmed := strings.TrimRight(p, "/"); trimmed != "" {
+		p = trimmed
+	}
 	if idx := strings.Index(p, "/struktur/"); idx >= 0 {
 		return p[idx:]
 	}
@@ -40,6 +50,9 @@ func normalizePath(p string) string {
 var svc storyapi.DynamoClient
 var storySvc *storyapi.StoryService
 
+// keySchema names the table's key attributes (TABLE_PARTITION_KEY / TABLE_SORT_KEY).
+var keySchema = storyapi.KeySchemaFromEnv()
+
 // Resolve DynamoDB table from env (fallback to prod default)
 var tableName = func() string {
 	if v := os.Getenv("TABLE_NAME"); v != "" {
@@ -48,6 +61,124 @@ var tableName = func() string {
 	return "strukturbild_data"
 }()
 
+// Canvas bounds for node coordinates; override with COORD_MIN / COORD_MAX.
+var coordMin, coordMax = envInt("COORD_MIN", -100000), envInt("COORD_MAX", 100000)
+
+// Upper bound on edges per story graph; override with MAX_EDGES.
+var maxEdges = envInt("MAX_EDGES", 2000)
+
+// Boards with more nodes than this get a LARGE_GRAPH warning in submit and
+// GET /struktur responses; override with LARGE_GRAPH_NODES, 0 turns it off.
+// Unlike maxEdges it never rejects anything.
+var largeGraphNodes = envInt("LARGE_GRAPH_NODES", 100)
+
+// graphWarning is an informational notice on a graph response, e.g. so the
+// editor can suggest splitting a large board.
+type graphWarning struct {
+	Code      string `json:"code"`
+	NodeCount int    `json:"nodeCount"`
+	Threshold int    `json:"threshold"`
+}
+
+// largeGraphWarning returns the LARGE_GRAPH warning for a board of nodeCount
+// nodes, or nil below the threshold.
+func largeGraphWarning(nodeCount int) *graphWarning {
+	if largeGraphNodes < 1 || nodeCount <= largeGraphNodes {
+		return nil
+	}
+	return &graphWarning{Code: "LARGE_GRAPH", NodeCount: nodeCount, Threshold: largeGraphNodes}
+}
+
+// Upper bound on waypoints per edge; override with MAX_WAYPOINTS.
+var maxWaypoints = envInt("MAX_WAYPOINTS", 50)
+
+// Limits on node/edge metadata; override with MAX_META_KEYS and MAX_META_VALUE.
+var (
+	maxMetaKeys     = envInt("MAX_META_KEYS", 20)
+	maxMetaValueLen = envInt("MAX_META_VALUE", 1024)
+)
+
+const maxMetaKeyLen = 64
+
+// Length limits, in characters, for node and edge text; override with
+// MAX_LABEL_LENGTH and MAX_DETAIL_LENGTH.
+var (
+	maxLabelLen  = envInt("MAX_LABEL_LENGTH", 500)
+	maxDetailLen = envInt("MAX_DETAIL_LENGTH", 20000)
+)
+
+// checkGraphText applies the label and detail limits; owner names the node or
+// edge in the error.
+func checkGraphText(owner, label, detail string) error {
+	if err := storyapi.CheckLength(owner+" label", label, maxLabelLen); err != nil {
+		return err
+	}
+	return storyapi.CheckLength(owner+" detail", detail, maxDetailLen)
+}
+
+func envInt(name string, fallback int) int {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		log.Printf("⚠️ Ignoring non-numeric %s=%q", name, v)
+	}
+	return fallback
+}
+
+// clampCoord forces v into [coordMin, coordMax] and reports whether it changed.
+func clampCoord(v int) (int, bool) {
+	if v < coordMin {
+		return coordMin, true
+	}
+	if v > coordMax {
+		return coordMax, true
+	}
+	return v, false
+}
+
+// isStrict reports whether the caller asked for out-of-range input to be rejected.
+func isStrict(request events.APIGatewayProxyRequest) bool {
+	return request.QueryStringParameters["strict"] == "true"
+}
+
+// badInput and unprocessable answer rejected requests under the status policy
+// in api/status.go: 400 when the request cannot be read (malformed JSON, a
+// missing path parameter, an invalid query parameter), 422 when its body was
+// read but is not acceptable.
+func badInput(msg string) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{StatusCode: 400, Headers: corsHeaders(), Body: msg}
+}
+
+func unprocessable(msg string) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{StatusCode: 422, Headers: corsHeaders(), Body: msg}
+}
+
+// validateMeta checks free-form metadata against the size limits; owner names
+// the node or edge in the error.
+func validateMeta(owner string, meta map[string]string) error {
+	if len(meta) > maxMetaKeys {
+		return fmt.Errorf("%s has %d meta keys (limit %d)", owner, len(meta), maxMetaKeys)
+	}
+	for k, v := range meta {
+		if strings.TrimSpace(k) == "" || len(k) > maxMetaKeyLen {
+			return fmt.Errorf("%s meta key %q must be 1-%d bytes", owner, k, maxMetaKeyLen)
+		}
+		if len(v) > maxMetaValueLen {
+			return fmt.Errorf("%s meta value for %q exceeds %d bytes", owner, k, maxMetaValueLen)
+		}
+	}
+	return nil
+}
+
+// nilIfEmpty keeps empty metadata out of storage and responses.
+func nilIfEmpty(meta map[string]string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+	return meta
+}
+
 type Node struct {
 	ID     string `json:"id"`
 	Label  string `json:"label"`
@@ -55,17 +186,94 @@ type Node struct {
 	Type   string `json:"type,omitempty"` // promoter|barrier|event|goal|actor|...
 	Time   string `json:"time,omitempty"` // ISO date or relative (T0..Tn)
 	Color  string `json:"color,omitempty"`
-	X      int    `json:"x"` // X position for layout
-	Y      int    `json:"y"` // Y position for layout
+	// Shape and Icon override the defaults of the node's type; see /api/node-styles.
+	Shape string `json:"shape,omitempty"`
+	Icon  string `json:"icon,omitempty"`
+	X     int    `json:"x"` // X position for layout
+	Y     int    `json:"y"` // Y position for layout
+	// UpdatedBy is the caller that last wrote the node (auth claim or X-User).
+	UpdatedBy string `json:"updatedBy,omitempty"`
+	// CreatedAt and UpdatedAt (RFC 3339) are kept when an import sends them,
+	// so reconstructed boards keep their authoring times; otherwise the
+	// server stamps them.
+	CreatedAt string `json:"createdAt,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+	// Meta holds study-specific attributes (e.g. confidence, source).
+	Meta map[string]string `json:"meta,omitempty"`
+	// Evidence lists the paragraphs the node was drawn from. Where set it is
+	// the source the paragraphNodeMap is rebuilt from (rebuild-node-map).
+	Evidence []string `json:"evidence,omitempty"`
+	// LabelI18n holds translated labels by lower-case language tag; Label is
+	// the default. GET /struktur/{id}?lang= picks one.
+	LabelI18n map[string]string `json:"labelI18n,omitempty"`
+}
+
+// Point is an intermediate coordinate an edge is routed through.
+type Point struct {
+	X int `json:"x" dynamodbav:"x"`
+	Y int `json:"y" dynamodbav:"y"`
 }
 
 type Edge struct {
-	ID     string `json:"id,omitempty"`
-	From   string `json:"from"`
-	To     string `json:"to"`
-	Label  string `json:"label"`
-	Detail string `json:"detail,omitempty"`
-	Type   string `json:"type,omitempty"` // supports|blocks|causes|relates|...
+	ID        string `json:"id,omitempty"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Label     string `json:"label"`
+	Detail    string `json:"detail,omitempty"`
+	Type      string `json:"type,omitempty"` // supports|blocks|causes|relates|...
+	UpdatedBy string `json:"updatedBy,omitempty"`
+	// Waypoints bend the edge; without them it is drawn as a straight line.
+	Waypoints []Point `json:"waypoints,omitempty"`
+	// Directed overrides the direction implied by Type; see IsDirected.
+	Directed *bool `json:"directed,omitempty"`
+	// Meta holds study-specific attributes (e.g. confidence, source).
+	Meta map[string]string `json:"meta,omitempty"`
+	// Weight is the strength of the relation in [edgeWeightMin, edgeWeightMax];
+	// absent means defaultEdgeWeight.
+	Weight *float64 `json:"weight,omitempty"`
+	// Dangling is set on edges stored with ?allowDanglingEdges=true; repair
+	// reports them apart and leaves them in place. Ignored on input.
+	Dangling bool `json:"dangling,omitempty"`
+}
+
+// Edge weights rate a relation from 1 (weak) to 5 (strong). An unweighted
+// edge counts as 1, so weighted and plain degree agree on unweighted graphs.
+const (
+	edgeWeightMin     = 1.0
+	edgeWeightMax     = 5.0
+	defaultEdgeWeight = 1.0
+)
+
+// EffectiveWeight returns Weight, or defaultEdgeWeight when it is unset.
+func (e Edge) EffectiveWeight() float64 {
+	if e.Weight == nil {
+		return defaultEdgeWeight
+	}
+	return *e.Weight
+}
+
+// validateWeight rejects weights outside [edgeWeightMin, edgeWeightMax]; nil passes.
+func validateWeight(owner string, w *float64) error {
+	if w == nil || (*w >= edgeWeightMin && *w <= edgeWeightMax) {
+		return nil
+	}
+	return fmt.Errorf("%s weight %g out of range [%g,%g]", owner, *w, edgeWeightMin, edgeWeightMax)
+}
+
+// nodeTypes are the node classifications offered by the editor; "" leaves a
+// node unclassified.
+var nodeTypes = map[string]bool{"": true, "prozess": true, "praxis": true, "ergebnis": true, "schwierigkeit": true, "beschäftigung": true}
+
+// symmetricEdgeTypes are relation types without a direction.
+var symmetricEdgeTypes = map[string]bool{"relates": true}
+
+// IsDirected reports whether the edge points From->To. An explicit Directed
+// wins; otherwise symmetric types such as "relates" are undirected.
+func (e Edge) IsDirected() bool {
+	if e.Directed != nil {
+		return *e.Directed
+	}
+	return !symmetricEdgeTypes[e.Type]
 }
 
 type Strukturbild struct {
@@ -76,24 +284,44 @@ type Strukturbild struct {
 	Story              *storyapi.Story              `json:"story,omitempty"`
 	Paragraphs         []storyapi.Paragraph         `json:"paragraphs,omitempty"`
 	DetailsByParagraph map[string][]storyapi.Detail `json:"detailsByParagraph,omitempty"`
+	// Version is set when the graph is a historical snapshot (?version=).
+	Version int `json:"version,omitempty"`
+	// Warning is set on responses for boards above largeGraphNodes.
+	Warning *graphWarning `json:"warning,omitempty"`
 }
 
 type DBItem struct {
-	ID        string `json:"id" dynamodbav:"id"`
-	StoryID   string `json:"storyId" dynamodbav:"storyId"`
-	Label     string `json:"label" dynamodbav:"label"`
-	Detail    string `json:"detail,omitempty" dynamodbav:"detail,omitempty"`
-	Type      string `json:"type,omitempty" dynamodbav:"type,omitempty"`
-	Time      string `json:"time,omitempty" dynamodbav:"time,omitempty"`
-	Color     string `json:"color,omitempty" dynamodbav:"color,omitempty"`
-	IsNode    bool   `json:"isNode" dynamodbav:"isNode"`
-	X         int    `json:"x,omitempty" dynamodbav:"x,omitempty"`
-	Y         int    `json:"y,omitempty" dynamodbav:"y,omitempty"`
-	From      string `json:"from,omitempty" dynamodbav:"from,omitempty"`
-	To        string `json:"to,omitempty" dynamodbav:"to,omitempty"`
-	Timestamp string `json:"timestamp" dynamodbav:"timestamp"`
+	ID        string            `json:"id" dynamodbav:"id"`
+	StoryID   string            `json:"storyId" dynamodbav:"storyId"`
+	Label     string            `json:"label" dynamodbav:"label"`
+	Detail    string            `json:"detail,omitempty" dynamodbav:"detail,omitempty"`
+	Type      string            `json:"type,omitempty" dynamodbav:"type,omitempty"`
+	Time      string            `json:"time,omitempty" dynamodbav:"time,omitempty"`
+	Color     string            `json:"color,omitempty" dynamodbav:"color,omitempty"`
+	Shape     string            `json:"shape,omitempty" dynamodbav:"shape,omitempty"`
+	Icon      string            `json:"icon,omitempty" dynamodbav:"icon,omitempty"`
+	IsNode    bool              `json:"isNode" dynamodbav:"isNode"`
+	X         int               `json:"x,omitempty" dynamodbav:"x,omitempty"`
+	Y         int               `json:"y,omitempty" dynamodbav:"y,omitempty"`
+	From      string            `json:"from,omitempty" dynamodbav:"from,omitempty"`
+	To        string            `json:"to,omitempty" dynamodbav:"to,omitempty"`
+	Timestamp string            `json:"timestamp" dynamodbav:"timestamp"`
+	CreatedAt string            `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedBy string            `json:"updatedBy,omitempty" dynamodbav:"updatedBy,omitempty"`
+	Waypoints []Point           `json:"waypoints,omitempty" dynamodbav:"waypoints,omitempty"`
+	Directed  *bool             `json:"directed,omitempty" dynamodbav:"directed,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty" dynamodbav:"meta,omitempty"`
+	Evidence  []string          `json:"evidence,omitempty" dynamodbav:"evidence,omitempty"`
+	LabelI18n map[string]string `json:"labelI18n,omitempty" dynamodbav:"labelI18n,omitempty"`
+	Weight    *float64          `json:"weight,omitempty" dynamodbav:"weight,omitempty"`
+	// Dangling marks an edge stored with ?allowDanglingEdges=true.
+	Dangling bool `json:"dangling,omitempty" dynamodbav:"dangling,omitempty"`
 }
 
+// getHandler returns the graph and story bundle of a story. Details (quotes)
+// are only attached with ?includeDetails=true. ?fields=id,x,y trims each node
+// to the listed fields, e.g. for minimap renders. ?lang=en labels nodes in
+// that language where a translation exists (see localizedLabel).
 func getHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	// Use path parameter if present (API Gateway mapping), otherwise try to extract from path
 	id := ""
@@ -107,72 +335,129 @@ func getHandler(ctx context.Context, request events.APIGatewayProxyRequest) (eve
 	}
 	if id == "" {
 		log.Printf("❌ Could not extract ID from request")
-		return events.APIGatewayProxyResponse{
-			StatusCode: 400,
-			Headers:    corsHeaders(),
-			Body:       "Missing ID",
-		}, nil
+		return badInput("Missing ID"), nil
 	}
 
-	// Use global svc directly
+	fields, err := parseNodeFields(request.QueryStringParameters["fields"])
+	if err != nil {
+		return badInput(err.Error()), nil
+	}
 
-	// Scan for all items with storyId = id
-	input := &dynamodb.QueryInput{
-		TableName:              aws.String(tableName),
-		KeyConditionExpression: aws.String("storyId = :sid"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":sid": &types.AttributeValueMemberS{Value: id},
-		},
+	sortKey, err := parseNodeSort(request.QueryStringParameters["sortNodes"])
+	if err != nil {
+		return badInput(err.Error()), nil
 	}
 
-	result, err := svc.Query(ctx, input)
+	lang, err := parseLang(request.QueryStringParameters["lang"])
 	if err != nil {
-		log.Printf("❌ Failed to query items: %v", err)
+		return badInput(err.Error()), nil
+	}
+
+	version, err := parseGraphVersion(request.QueryStringParameters["version"])
+	if err != nil {
+		return badInput(err.Error()), nil
+	}
+	// ?version= swaps in a historical graph; the narrative stays current.
+	var versionNodes []Node
+	var versionEdges []Edge
+	if version > 0 {
+		versionNodes, versionEdges, err = loadGraphVersion(ctx, id, version)
+		if errors.Is(err, errGraphVersionNotFound) {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 404,
+				Headers:    corsHeaders(),
+				Body:       fmt.Sprintf("Version %d not found", version),
+			}, nil
+		}
+		if err != nil {
+			log.Printf("❌ Failed to load version %d of %s: %v", version, id, err)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 500,
+				Headers:    corsHeaders(),
+				Body:       "Failed to fetch data",
+			}, nil
+		}
+	}
+
+	sb, cached := strukturCache.get(id)
+	if !cached {
+		var found bool
+		sb, found, err = assembleStruktur(ctx, id)
+		if err != nil {
+			log.Printf("❌ Failed to query items: %v", err)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 500,
+				Headers:    corsHeaders(),
+				Body:       "Failed to fetch data",
+			}, nil
+		}
+		if found {
+			strukturCache.put(id, sb)
+		} else if version == 0 {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 404,
+				Headers:    corsHeaders(),
+				Body:       "Story not found",
+			}, nil
+		}
+	}
+	if version > 0 {
+		sb.StoryID = id
+		sb.Nodes, sb.Edges, sb.Version = versionNodes, versionEdges, version
+	}
+	if request.QueryStringParameters["includeDetails"] != "true" {
+		sb.DetailsByParagraph = nil
+	}
+	if lang != "" {
+		sb.Nodes = localizedNodes(sb.Nodes, lang)
+	}
+	if sortKey != "" {
+		sb.Nodes = sortedNodes(sb, sortKey)
+	}
+	sb.Warning = largeGraphWarning(len(sb.Nodes))
+
+	if wantsNDJSON(request) {
+		body, err := encodeStrukturNDJSON(sb)
+		if err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 500,
+				Headers:    corsHeaders(),
+				Body:       "Failed to encode response",
+			}, nil
+		}
+		h := corsHeaders()
+		h["Content-Type"] = "application/x-ndjson"
 		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Headers:    corsHeaders(),
-			Body:       "Failed to fetch data",
+			StatusCode: 200,
+			Headers:    h,
+			Body:       body,
 		}, nil
 	}
 
-	if len(result.Items) == 0 {
+	body, err := marshalStruktur(sb, fields)
+	if err != nil {
 		return events.APIGatewayProxyResponse{
-			StatusCode: 404,
+			StatusCode: 500,
 			Headers:    corsHeaders(),
-			Body:       "Not found",
+			Body:       "Failed to encode response",
 		}, nil
 	}
 
-	var nodes []Node
-	var edges []Edge
-	for _, itemMap := range result.Items {
-		var item DBItem
-		err = attributevalue.UnmarshalMap(itemMap, &item)
-		if err != nil {
-			log.Printf("❌ Failed to unmarshal item: %v", err)
-			continue
-		}
-		if item.IsNode {
-			nodes = append(nodes, Node{
-				ID:     item.ID,
-				Label:  item.Label,
-				Detail: item.Detail,
-				Type:   item.Type,
-				Time:   item.Time,
-				Color:  item.Color,
-				X:      item.X,
-				Y:      item.Y,
-			})
-		} else {
-			edges = append(edges, Edge{
-				ID:     item.ID,
-				From:   item.From,
-				To:     item.To,
-				Label:  item.Label,
-				Detail: item.Detail,
-				Type:   item.Type,
-			})
-		}
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    h,
+		Body:       string(body),
+	}, nil
+}
+
+// assembleStruktur loads the graph plus story bundle for GET /struktur/{id};
+// found is false when neither exists.
+func assembleStruktur(ctx context.Context, id string) (Strukturbild, bool, error) {
+	nodes, edges, err := loadGraph(ctx, id)
+	if err != nil {
+		return Strukturbild{}, false, err
 	}
 
 	sb := Strukturbild{
@@ -194,34 +479,106 @@ func getHandler(ctx context.Context, request events.APIGatewayProxyRequest) (eve
 		}
 	}
 
-	body, err := json.Marshal(sb)
-	if err != nil {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Headers:    corsHeaders(),
-			Body:       "Failed to encode response",
-		}, nil
+	// A story without a graph yet is a valid, empty board; only report
+	// not found when neither the graph nor the story record exists.
+	if len(nodes) == 0 && len(edges) == 0 && sb.Story == nil {
+		return Strukturbild{}, false, nil
 	}
+	return sb, true, nil
+}
 
-	h := corsHeaders()
-	h["Content-Type"] = "application/json"
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers:    h,
-		Body:       string(body),
-	}, nil
+// notifyGraphChange records a graph version, drops the cached response for
+// storyID and emits the change event.
+func notifyGraphChange(ctx context.Context, eventType, storyID string) {
+	logGraphVersion(ctx, storyID)
+	strukturCache.invalidate(storyID)
+	storySvc.NotifyChange(ctx, eventType, storyID)
+}
+
+// headerValue looks up a request header case-insensitively.
+func headerValue(request events.APIGatewayProxyRequest, name string) string {
+	return storyapi.HeaderValue(request, name)
+}
+
+// actorFromRequest identifies the caller for updatedBy: a Cognito/JWT claim
+// from the API Gateway authorizer if present, otherwise the X-User header.
+func actorFromRequest(request events.APIGatewayProxyRequest) string {
+	if claims, ok := request.RequestContext.Authorizer["claims"].(map[string]interface{}); ok {
+		for _, name := range []string{"email", "cognito:username", "sub"} {
+			if v, ok := claims[name].(string); ok && v != "" {
+				return v
+			}
+		}
+	}
+	return strings.TrimSpace(headerValue(request, "X-User"))
+}
+
+// wantsNDJSON reports whether the client asked for line-delimited JSON.
+// application/json stays the default unless the Accept header names x-ndjson.
+func wantsNDJSON(request events.APIGatewayProxyRequest) bool {
+	return accepts(request, "application/x-ndjson")
+}
+
+// accepts reports whether the Accept header names mediaType explicitly;
+// wildcards do not count.
+func accepts(request events.APIGatewayProxyRequest, mediaType string) bool {
+	for _, part := range strings.Split(headerValue(request, "Accept"), ",") {
+		if strings.EqualFold(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]), mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeStrukturNDJSON writes one JSON object per line: the story header first,
+// then every node, then every edge, so clients can render incrementally.
+// Lambda proxy responses are buffered, so the lines are assembled up front.
+func encodeStrukturNDJSON(sb Strukturbild) (string, error) {
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	header := struct {
+		Kind               string                       `json:"kind"`
+		StoryID            string                       `json:"storyId"`
+		Story              *storyapi.Story              `json:"story,omitempty"`
+		Paragraphs         []storyapi.Paragraph         `json:"paragraphs,omitempty"`
+		DetailsByParagraph map[string][]storyapi.Detail `json:"detailsByParagraph,omitempty"`
+	}{"story", sb.StoryID, sb.Story, sb.Paragraphs, sb.DetailsByParagraph}
+	if err := enc.Encode(header); err != nil {
+		return "", err
+	}
+	for _, n := range sb.Nodes {
+		if err := enc.Encode(struct {
+			Kind string `json:"kind"`
+			Node Node   `json:"node"`
+		}{"node", n}); err != nil {
+			return "", err
+		}
+	}
+	for _, e := range sb.Edges {
+		if err := enc.Encode(struct {
+			Kind string `json:"kind"`
+			Edge Edge   `json:"edge"`
+		}{"edge", e}); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
 }
 
+// handler stores a submitted graph. Edges must end at a node of the submit
+// or of the stored graph (see planSubmit for ?autoCreateNodes= and
+// ?allowDanglingEdges=). ?dryRun=true runs the same validation and reports
+// the would-be result and its warnings without writing anything.
+// The success body stays the plain-text acknowledgement existing clients
+// expect; a client whose Accept header names application/json gets the JSON
+// summary (message, board size, warning, auto-created nodes, dangling edges).
+// Route: POST /submit
 func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var sb Strukturbild
-	err := json.Unmarshal([]byte(request.Body), &sb)
+	err := storyapi.DecodeJSON(request.Body, &sb)
 	if err != nil {
 		log.Printf("❌ Failed to decode JSON: %v", err)
-		return events.APIGatewayProxyResponse{
-			StatusCode: 400,
-			Headers:    corsHeaders(),
-			Body:       "Invalid JSON",
-		}, nil
+		return badInput(err.Error()), nil
 	}
 
 	if sb.ID == "" {
@@ -230,40 +587,296 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 
 	if sb.StoryID == "" {
 		log.Printf("❌ Missing storyId")
+		return unprocessable("Missing storyId"), nil
+	}
+
+	log.Printf("✅ Received strukturbild for story: %s with %d nodes", sb.StoryID, len(sb.Nodes))
+	plan, rejected := planSubmit(ctx, request, &sb, false)
+	if plan == nil {
+		return rejected, nil
+	}
+	dbItems, nodeCount, edgeCount := plan.items, plan.nodeCount, plan.edgeCount
+	autoCreate, autoCreated := plan.autoCreate, plan.autoCreated
+	if request.QueryStringParameters["dryRun"] == "true" {
+		return dryRunResponse(sb.StoryID, plan), nil
+	}
+
+	if err := currentStore().UpsertGraph(ctx, dbItems); err != nil {
+		log.Printf("❌ Failed to put items in DynamoDB: %v", err)
+	}
+
+	log.Printf("✅ Saved to DynamoDB successfully")
+	notifyGraphChange(ctx, storyapi.EventGraphUpdated, sb.StoryID)
+
+	if !accepts(request, "application/json") {
 		return events.APIGatewayProxyResponse{
-			StatusCode: 400,
+			StatusCode: 200,
 			Headers:    corsHeaders(),
-			Body:       "Missing storyId",
+			Body:       "Strukturbild received successfully",
 		}, nil
 	}
+	result := map[string]interface{}{
+		"message": "Strukturbild received successfully",
+		"storyId": sb.StoryID,
+		"nodes":   nodeCount,
+		"edges":   edgeCount,
+	}
+	if w := largeGraphWarning(nodeCount); w != nil {
+		result["warning"] = w
+	}
+	if autoCreate {
+		if autoCreated == nil {
+			autoCreated = []string{}
+		}
+		result["autoCreatedNodes"] = autoCreated
+	}
+	if plan.allowDangling {
+		result["danglingEdges"] = plan.dangling
+	}
+	body, _ := json.Marshal(result)
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    h,
+		Body:       string(body),
+	}, nil
+}
 
-	log.Printf("✅ Received strukturbild for story: %s with %d nodes", sb.StoryID, len(sb.Nodes))
+// dryRunResponse reports what a submit would have written: the resulting
+// board size, the items it would put and its warnings.
+func dryRunResponse(storyID string, plan *submitPlan) events.APIGatewayProxyResponse {
+	result := map[string]interface{}{
+		"dryRun":   true,
+		"storyId":  storyID,
+		"nodes":    plan.nodeCount,
+		"edges":    plan.edgeCount,
+		"writes":   len(plan.items),
+		"warnings": plan.warnings,
+	}
+	if plan.warnings == nil {
+		result["warnings"] = []string{}
+	}
+	if w := largeGraphWarning(plan.nodeCount); w != nil {
+		result["warning"] = w
+	}
+	if plan.autoCreate {
+		if plan.autoCreated == nil {
+			plan.autoCreated = []string{}
+		}
+		result["autoCreatedNodes"] = plan.autoCreated
+	}
+	if plan.allowDangling {
+		result["danglingEdges"] = plan.dangling
+	}
+	body, _ := json.Marshal(result)
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}
+}
+
+// submitPlan is a validated graph submit: the items to write and the counts
+// reported back to the client.
+type submitPlan struct {
+	items       []DBItem
+	nodeCount   int
+	edgeCount   int
+	autoCreate  bool
+	autoCreated []string
+	// dangling lists the edges ("from->to") stored with an unknown endpoint
+	// under ?allowDanglingEdges=true.
+	allowDangling bool
+	dangling      []string
+	// warnings are things a submit accepts but the client may not expect.
+	warnings []string
+}
+
+// validateNode runs the submit checks on one node that reject it outright.
+func validateNode(n Node) error {
+	owner := "Node " + n.ID
+	if err := validateMeta(owner, n.Meta); err != nil {
+		return err
+	}
+	if err := checkGraphText(owner, n.Label, n.Detail); err != nil {
+		return err
+	}
+	if err := validateLabelI18n(owner, n.LabelI18n); err != nil {
+		return err
+	}
+	return validateNodeStyle(owner, n.Shape, n.Icon)
+}
+
+// validateEdge runs the submit checks on one edge that reject it outright.
+func validateEdge(e Edge) error {
+	owner := fmt.Sprintf("Edge %s->%s", e.From, e.To)
+	if err := validateMeta(owner, e.Meta); err != nil {
+		return err
+	}
+	if err := checkGraphText(owner, e.Label, e.Detail); err != nil {
+		return err
+	}
+	if err := validateWeight(owner, e.Weight); err != nil {
+		return err
+	}
+	if len(e.Waypoints) > maxWaypoints {
+		return fmt.Errorf("%s has %d waypoints (limit %d)", owner, len(e.Waypoints), maxWaypoints)
+	}
+	return nil
+}
+
+// checkUndirectedRepeats rejects an undirected edge listed twice; an
+// undirected edge and its reverse describe the same relation.
+func checkUndirectedRepeats(edges []Edge) error {
+	symmetric := map[[2]string]bool{}
+	for _, e := range edges {
+		if e.IsDirected() {
+			continue
+		}
+		pair := [2]string{min(e.From, e.To), max(e.From, e.To)}
+		if symmetric[pair] {
+			return fmt.Errorf("Undirected edge %s-%s is listed twice", pair[0], pair[1])
+		}
+		symmetric[pair] = true
+	}
+	return nil
+}
+
+// duplicateNodeIDs lists the node ids given more than once, each once. Nodes
+// without an id are skipped: submit gives each of them a fresh uuid.
+func duplicateNodeIDs(nodes []Node) []string {
+	seen := map[string]int{}
+	var dups []string
+	for _, n := range nodes {
+		if n.ID == "" {
+			continue
+		}
+		if seen[n.ID]++; seen[n.ID] == 2 {
+			dups = append(dups, n.ID)
+		}
+	}
+	return dups
+}
+
+// nodeEdgeIDClashes lists the ids that both a node and an edge use. Nodes and
+// edges share the sort key space, so one would overwrite the other.
+func nodeEdgeIDClashes(nodes []Node, edges []Edge) []string {
+	edgeIDs := map[string]bool{}
+	for _, e := range edges {
+		if e.ID != "" {
+			edgeIDs[e.ID] = true
+		}
+	}
+	var clashes []string
+	for _, n := range nodes {
+		if edgeIDs[n.ID] {
+			clashes = append(clashes, n.ID)
+			delete(edgeIDs, n.ID)
+		}
+	}
+	return clashes
+}
+
+// planSubmit validates sb against the stored graph of its story and builds
+// the items a submit writes. With replace sb takes the place of the stored
+// graph, so it is planned as if the story had none. A nil plan comes with the
+// response to return.
+func planSubmit(ctx context.Context, request events.APIGatewayProxyRequest, sb *Strukturbild, replace bool) (*submitPlan, events.APIGatewayProxyResponse) {
+	var warnings []string
+	for i := range sb.Nodes {
+		x, cx := clampCoord(sb.Nodes[i].X)
+		y, cy := clampCoord(sb.Nodes[i].Y)
+		if !cx && !cy {
+			continue
+		}
+		if isStrict(request) {
+			return nil, unprocessable(fmt.Sprintf("Node %s coordinates (%d,%d) out of range [%d,%d]", sb.Nodes[i].ID, sb.Nodes[i].X, sb.Nodes[i].Y, coordMin, coordMax))
+		}
+		log.Printf("⚠️ Clamped node %s coordinates (%d,%d) -> (%d,%d)", sb.Nodes[i].ID, sb.Nodes[i].X, sb.Nodes[i].Y, x, y)
+		warnings = append(warnings, fmt.Sprintf("Node %s coordinates (%d,%d) clamped to (%d,%d)", sb.Nodes[i].ID, sb.Nodes[i].X, sb.Nodes[i].Y, x, y))
+		sb.Nodes[i].X, sb.Nodes[i].Y = x, y
+	}
+
+	for i, n := range sb.Nodes {
+		for _, ts := range []*string{&sb.Nodes[i].CreatedAt, &sb.Nodes[i].UpdatedAt} {
+			if *ts == "" {
+				continue
+			}
+			norm, err := storyapi.NormalizeRFC3339(*ts)
+			if err != nil {
+				return nil, unprocessable(fmt.Sprintf("Node %s has an invalid timestamp %q (want RFC 3339)", n.ID, *ts))
+			}
+			*ts = norm
+		}
+		if err := validateNode(n); err != nil {
+			return nil, unprocessable(err.Error())
+		}
+		if !nodeTypes[n.Type] {
+			warnings = append(warnings, fmt.Sprintf("Node %s has unknown type %q", n.ID, n.Type))
+		}
+	}
+
+	for i, e := range sb.Edges {
+		if err := validateEdge(e); err != nil {
+			return nil, unprocessable(err.Error())
+		}
+		if e.From != "" && e.From == e.To {
+			warnings = append(warnings, fmt.Sprintf("Edge %s->%s is a self-loop", e.From, e.To))
+		}
+		for j, wp := range e.Waypoints {
+			x, cx := clampCoord(wp.X)
+			y, cy := clampCoord(wp.Y)
+			if !cx && !cy {
+				continue
+			}
+			if isStrict(request) {
+				return nil, unprocessable(fmt.Sprintf("Edge %s->%s waypoint %d (%d,%d) out of range [%d,%d]", e.From, e.To, j, wp.X, wp.Y, coordMin, coordMax))
+			}
+			warnings = append(warnings, fmt.Sprintf("Edge %s->%s waypoint %d (%d,%d) clamped to (%d,%d)", e.From, e.To, j, wp.X, wp.Y, x, y))
+			sb.Edges[i].Waypoints[j] = Point{X: x, Y: y}
+		}
+	}
+
+	if err := checkUndirectedRepeats(sb.Edges); err != nil {
+		return nil, unprocessable(err.Error())
+	}
 
 	// Determine next sequential edge id "eN" for this story by scanning existing edges
 	nextEdgeNum := 1
-	{
+	existingNodes := map[string]bool{}
+	existingEdges := map[string]bool{}
+	// storedItems keeps the stored node and edge records, so that fields a
+	// submit leaves out survive it.
+	storedItems := map[string]DBItem{}
+	if !replace {
 		var startKey map[string]types.AttributeValue
 		for {
 			qres, qerr := svc.Query(ctx, &dynamodb.QueryInput{
-				TableName:              aws.String(tableName),
-				KeyConditionExpression: aws.String("storyId = :sid"),
+				TableName:                aws.String(tableName),
+				KeyConditionExpression:   aws.String(keySchema.PartitionCondition()),
+				ExpressionAttributeNames: keySchema.Names(false),
 				ExpressionAttributeValues: map[string]types.AttributeValue{
 					":sid": &types.AttributeValueMemberS{Value: sb.StoryID},
 				},
 				ExclusiveStartKey: startKey,
 			})
+			// Without the stored graph neither ids nor edge endpoints can be
+			// checked, so nothing is written.
 			if qerr != nil {
-				log.Printf("ℹ️ edge id pre-scan failed for %s: %v", sb.StoryID, qerr)
-				break
+				log.Printf("❌ edge id pre-scan failed for %s: %v", sb.StoryID, qerr)
+				return nil, events.APIGatewayProxyResponse{StatusCode: 503, Headers: corsHeaders(), Body: "Stored graph could not be read, try again"}
 			}
 			for _, it := range qres.Items {
-				var cur DBItem
-				if err := attributevalue.UnmarshalMap(it, &cur); err != nil {
+				cur, _, err := normalizeDBItem(keySchema.FromItem(it))
+				if err != nil {
+					log.Printf("⚠️ edge id pre-scan of %s skipped an item: %v", sb.StoryID, err)
 					continue
 				}
+				storedItems[cur.ID] = cur
 				if cur.IsNode {
+					existingNodes[cur.ID] = true
 					continue
 				}
+				existingEdges[cur.ID] = true
 				if strings.HasPrefix(cur.ID, "e") && len(cur.ID) > 1 {
 					if n, err := strconv.Atoi(cur.ID[1:]); err == nil && n >= nextEdgeNum {
 						nextEdgeNum = n + 1
@@ -276,7 +889,84 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 			startKey = qres.LastEvaluatedKey
 		}
 	}
-	// Pre-assign eN to any incoming edge without a valid eN id
+	// Node ids are unique per story and share the sort key space with edges.
+	// A submit upserts by default; ?create=true declares every node new, so an
+	// id that is already stored is a collision rather than an update.
+	createOnly := request.QueryStringParameters["create"] == "true"
+	if dups := duplicateNodeIDs(sb.Nodes); len(dups) > 0 {
+		return nil, unprocessable(fmt.Sprintf("Node id %s appears more than once", dups[0]))
+	}
+	seenNodes := map[string]bool{}
+	for _, n := range sb.Nodes {
+		seenNodes[n.ID] = true
+	}
+
+	// Edges must end at a node that is stored or part of this submit. With
+	// ?autoCreateNodes=true missing endpoints become placeholder nodes instead;
+	// ?allowDanglingEdges=true stores such edges as they are, for callers that
+	// deliberately send partial graphs, and marks them so that repair leaves
+	// them alone.
+	autoCreate := request.QueryStringParameters["autoCreateNodes"] == "true"
+	allowDangling := request.QueryStringParameters["allowDanglingEdges"] == "true"
+	if autoCreate && allowDangling {
+		return nil, badInput("autoCreateNodes and allowDanglingEdges cannot be combined")
+	}
+	var autoCreated []string
+	dangling := []string{}
+	danglingAt := map[int]bool{}
+	known := map[string]bool{}
+	for id := range existingNodes {
+		known[id] = true
+	}
+	for _, n := range sb.Nodes {
+		known[n.ID] = true
+	}
+	var missing []string
+	isMissing := map[string]bool{}
+	for i, e := range sb.Edges {
+		ok := true
+		for _, end := range []string{e.From, e.To} {
+			if end == "" {
+				return nil, unprocessable(fmt.Sprintf("Edge %s->%s is missing an endpoint", e.From, e.To))
+			}
+			if known[end] {
+				continue
+			}
+			ok = false
+			if !isMissing[end] {
+				isMissing[end] = true
+				missing = append(missing, end)
+			}
+		}
+		if !ok {
+			dangling = append(dangling, e.From+"->"+e.To)
+			danglingAt[i] = true
+		}
+	}
+	switch {
+	case len(missing) == 0:
+	case autoCreate:
+		for _, id := range missing {
+			sb.Nodes = append(sb.Nodes, Node{ID: id, Label: id})
+			log.Printf("ℹ️ Auto-created node %s in %s", id, sb.StoryID)
+			warnings = append(warnings, fmt.Sprintf("Node %s is created for an edge endpoint", id))
+		}
+		autoCreated = missing
+	case allowDangling:
+		warnings = append(warnings, fmt.Sprintf("Edges %s reference unknown nodes: %s", strings.Join(dangling, ", "), strings.Join(missing, ", ")))
+	default:
+		return nil, unprocessable(fmt.Sprintf("Edges reference unknown nodes: %s (edges %s)", strings.Join(missing, ", "), strings.Join(dangling, ", ")))
+	}
+
+	// Pre-assign eN to any incoming edge without a valid eN id, skipping
+	// numbers whose id a node already has.
+	nodeIDs := map[string]bool{}
+	for id := range existingNodes {
+		nodeIDs[id] = true
+	}
+	for _, n := range sb.Nodes {
+		nodeIDs[n.ID] = true
+	}
 	for i := range sb.Edges {
 		id := sb.Edges[i].ID
 		valid := false
@@ -286,11 +976,57 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 			}
 		}
 		if !valid {
+			for nodeIDs["e"+strconv.Itoa(nextEdgeNum)] {
+				nextEdgeNum++
+			}
 			sb.Edges[i].ID = "e" + strconv.Itoa(nextEdgeNum)
 			nextEdgeNum++
 		}
 	}
 
+	// Nodes and edges share the sort key space. Checked after auto-creation
+	// and edge id assignment, so placeholders and new edges cannot overwrite
+	// one another or stored items either.
+	clashes := map[string]bool{}
+	for _, id := range nodeEdgeIDClashes(sb.Nodes, sb.Edges) {
+		clashes[id] = true
+	}
+	var taken []string
+	for _, n := range sb.Nodes {
+		if existingEdges[n.ID] || clashes[n.ID] || (createOnly && existingNodes[n.ID]) {
+			taken = append(taken, n.ID)
+		}
+	}
+	for _, e := range sb.Edges {
+		if existingNodes[e.ID] && !seenNodes[e.ID] {
+			taken = append(taken, e.ID)
+		}
+	}
+	if len(taken) > 0 {
+		return nil, events.APIGatewayProxyResponse{StatusCode: 409, Headers: corsHeaders(),
+			Body: fmt.Sprintf("Node ids already exist in story %s: %s", sb.StoryID, strings.Join(taken, ", "))}
+	}
+
+	// Board size after this submit: stored items plus incoming ones not yet
+	// stored. An edge id sent twice is written once, so it counts once.
+	nodeCount := len(existingNodes)
+	for _, n := range sb.Nodes {
+		if n.ID == "" || !existingNodes[n.ID] {
+			nodeCount++
+		}
+	}
+	edgeCount := len(existingEdges)
+	counted := map[string]bool{}
+	for _, e := range sb.Edges {
+		if !existingEdges[e.ID] && !counted[e.ID] {
+			edgeCount++
+			counted[e.ID] = true
+		}
+	}
+	if edgeCount > maxEdges {
+		return nil, unprocessable(fmt.Sprintf("Graph would have %d edges (limit %d, currently %d)", edgeCount, maxEdges, len(existingEdges)))
+	}
+
 	var dbItems []DBItem
 
 	for i := range sb.Nodes {
@@ -298,6 +1034,29 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 			sb.Nodes[i].ID = uuid.New().String()
 		}
 		node := sb.Nodes[i]
+		now := storyapi.NowRFC3339UTC()
+		updatedAt := node.UpdatedAt
+		if updatedAt == "" {
+			updatedAt = now
+		}
+		// Stored nodes keep their creation time; ones stored before createdAt
+		// existed stay without, rather than being stamped as new.
+		createdAt := node.CreatedAt
+		if createdAt == "" {
+			createdAt = storedItems[node.ID].CreatedAt
+		}
+		if createdAt == "" && !existingNodes[node.ID] {
+			createdAt = now
+		}
+		// Translations are set through translate-labels and evidence by the
+		// node map tooling; editor saves send nodes without either. Absent
+		// keeps the stored value, {} or [] clears it.
+		if node.LabelI18n == nil {
+			node.LabelI18n = storedItems[node.ID].LabelI18n
+		}
+		if node.Evidence == nil {
+			node.Evidence = storedItems[node.ID].Evidence
+		}
 		dbItems = append(dbItems, DBItem{
 			ID:        node.ID,
 			StoryID:   sb.StoryID,
@@ -306,15 +1065,26 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 			Type:      node.Type,
 			Time:      node.Time,
 			Color:     node.Color,
+			Shape:     node.Shape,
+			Icon:      node.Icon,
 			IsNode:    true,
 			X:         node.X,
 			Y:         node.Y,
-			Timestamp: time.Now().Format(time.RFC3339),
+			Timestamp: updatedAt,
+			CreatedAt: createdAt,
+			UpdatedBy: storyapi.ActorFromContext(ctx),
+			Meta:      nilIfEmpty(node.Meta),
+			Evidence:  node.Evidence,
+			LabelI18n: nilIfEmpty(node.LabelI18n),
 		})
 	}
 
-	for _, edge := range sb.Edges {
+	for i, edge := range sb.Edges {
 		eid := edge.ID
+		// The edge inspector saves without weight; absent keeps the stored one.
+		if edge.Weight == nil {
+			edge.Weight = storedItems[eid].Weight
+		}
 		dbItems = append(dbItems, DBItem{
 			ID:        eid,
 			StoryID:   sb.StoryID,
@@ -324,35 +1094,26 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 			IsNode:    false,
 			From:      edge.From,
 			To:        edge.To,
-			Timestamp: time.Now().Format(time.RFC3339),
+			Waypoints: edge.Waypoints,
+			Directed:  edge.Directed,
+			Meta:      nilIfEmpty(edge.Meta),
+			Weight:    edge.Weight,
+			Dangling:  allowDangling && danglingAt[i],
+			Timestamp: storyapi.NowRFC3339UTC(),
+			UpdatedBy: storyapi.ActorFromContext(ctx),
 		})
 	}
 
-	for _, item := range dbItems {
-		av, err := attributevalue.MarshalMap(item)
-		if err != nil {
-			log.Printf("❌ Failed to marshal item: %v", err)
-			continue
-		}
-
-		input := &dynamodb.PutItemInput{
-			TableName: aws.String(tableName),
-			Item:      av,
-		}
-
-		_, err = svc.PutItem(ctx, input)
-		if err != nil {
-			log.Printf("❌ Failed to put item in DynamoDB: %v", err)
-		}
-	}
-
-	log.Printf("✅ Saved to DynamoDB successfully")
-
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers:    corsHeaders(),
-		Body:       "Strukturbild received successfully",
-	}, nil
+	return &submitPlan{
+		items:         dbItems,
+		nodeCount:     nodeCount,
+		edgeCount:     edgeCount,
+		autoCreate:    autoCreate,
+		autoCreated:   autoCreated,
+		allowDangling: allowDangling,
+		dangling:      dangling,
+		warnings:      warnings,
+	}, events.APIGatewayProxyResponse{}
 }
 
 func initializeDynamoDB(ctx context.Context) *dynamodb.Client {
@@ -361,6 +1122,13 @@ func initializeDynamoDB(ctx context.Context) *dynamodb.Client {
 		log.Fatalf("Failed to load AWS config: %v", err)
 	}
 	log.Println("✅ DynamoDB client initialized.")
+	// DYNAMODB_ENDPOINT points the client at DynamoDB Local for development.
+	if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" {
+		log.Printf("✅ Using DynamoDB endpoint: %s", endpoint)
+		return dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+		})
+	}
 	return dynamodb.NewFromConfig(cfg)
 }
 
@@ -374,65 +1142,147 @@ func lambdaHandler(ctx context.Context, req events.APIGatewayProxyRequest) (even
 	npath := normalizePath(path)
 	log.Printf("🪵 Method: %s, Path: %s", method, path)
 
+	origin := headerValue(req, "Origin")
 	if method == "OPTIONS" {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 200,
-			Headers:    corsHeaders(),
-			Body:       "",
-		}, nil
+		resp := optionsHandler(npath)
+		setCORSOrigin(resp.Headers, origin)
+		return resp, nil
+	}
+	if err := decodeRequestBody(&req); err != nil {
+		resp := badInput(err.Error())
+		setCORSOrigin(resp.Headers, origin)
+		return resp, nil
 	}
+	ctx = storyapi.WithActor(ctx, actorFromRequest(req))
 
-	switch {
-	case method == "POST" && npath == "/submit":
-		return handler(ctx, req)
-	case method == "GET" && strings.HasPrefix(npath, "/struktur/"):
-		return getHandler(ctx, req)
-	case method == "DELETE" && strings.HasPrefix(npath, "/struktur/"):
-		parts := strings.Split(strings.TrimPrefix(npath, "/struktur/"), "/")
-		if len(parts) == 2 {
-			req.PathParameters = map[string]string{
-				"storyId": parts[0],
-				"nodeId":  parts[1],
-			}
-			return deleteHandler(ctx, req)
+	// Waiting for the story lock counts against the request timeout.
+	if requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+	unlock, busy := lockStory(ctx, req, method, npath)
+	if busy != nil {
+		setCORSOrigin(busy.Headers, origin)
+		return *busy, nil
+	}
+	if unlock != nil {
+		defer unlock()
+	}
+	resp, err := withRequestTimeout(ctx, func(ctx context.Context) (events.APIGatewayProxyResponse, error) {
+		if strings.HasPrefix(npath, "/api/") {
+			return handleStoryRoutes(ctx, req, method, npath)
 		}
-		return events.APIGatewayProxyResponse{
-			StatusCode: 400,
-			Headers:    corsHeaders(),
-			Body:       "Invalid path for DELETE",
-		}, nil
-	case strings.HasPrefix(npath, "/api/"):
-		return handleStoryRoutes(ctx, req, method, npath)
-	default:
-		return events.APIGatewayProxyResponse{
-			StatusCode: 404,
-			Headers:    corsHeaders(),
-			Body:       "Not Found",
-		}, nil
+		return dispatch(ctx, req, method, npath)
+	})
+	if err == nil && wantsPrettyJSON(req) {
+		resp = indentJSONBody(resp)
+	}
+	setCORSOrigin(resp.Headers, origin)
+	return resp, err
+}
+
+// decodeRequestBody undoes the base64 encoding API Gateway applies to binary
+// and some compressed bodies (IsBase64Encoded), so every handler can read
+// req.Body as text.
+func decodeRequestBody(req *events.APIGatewayProxyRequest) error {
+	if !req.IsBase64Encoded {
+		return nil
+	}
+	body, err := base64.StdEncoding.DecodeString(req.Body)
+	if err != nil {
+		return errors.New("Invalid base64 request body")
+	}
+	req.Body, req.IsBase64Encoded = string(body), false
+	return nil
+}
+
+// requestTimeout bounds one request below the Lambda timeout (10 s in
+// terraform) so a slow dependency still gets a response; override with
+// REQUEST_TIMEOUT_MS, 0 disables it.
+var requestTimeout = time.Duration(envInt("REQUEST_TIMEOUT_MS", 9000)) * time.Millisecond
+
+// withRequestTimeout runs fn under requestTimeout and answers 504 if the
+// deadline passes before fn returns. fn keeps running with a cancelled
+// context; its late result is dropped. A result that is ready is always
+// returned, even when the deadline passed at the same moment.
+func withRequestTimeout(ctx context.Context, fn func(context.Context) (events.APIGatewayProxyResponse, error)) (events.APIGatewayProxyResponse, error) {
+	if requestTimeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	type result struct {
+		resp events.APIGatewayProxyResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := fn(ctx)
+		done <- result{resp, err}
+	}()
+	select {
+	case r := <-done:
+		// fn finished, so whatever it wrote is committed; a 504 now would
+		// invite a retry of a write that succeeded.
+		return r.resp, r.err
+	case <-ctx.Done():
+		select {
+		case r := <-done:
+			return r.resp, r.err
+		default:
+		}
+		return timeoutResponse(), nil
 	}
 }
 
-func deleteHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func timeoutResponse() events.APIGatewayProxyResponse {
+	log.Printf("❌ Request exceeded %v", requestTimeout)
+	return events.APIGatewayProxyResponse{StatusCode: 504, Headers: corsHeaders(),
+		Body: fmt.Sprintf("Request timed out after %v", requestTimeout)}
+}
+
+// debugJSON makes every JSON response indented; set DEBUG=true for local work.
+var debugJSON = os.Getenv("DEBUG") == "true"
+
+// wantsPrettyJSON reports whether the response should be indented for reading
+// by hand (?pretty=true or DEBUG=true). Compact JSON stays the default.
+func wantsPrettyJSON(request events.APIGatewayProxyRequest) bool {
+	return debugJSON || request.QueryStringParameters["pretty"] == "true"
+}
+
+// indentJSONBody re-indents a JSON body in place. Responses with another
+// Content-Type (NDJSON, Markdown, SVG, ...) or invalid JSON pass through.
+func indentJSONBody(resp events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	if ct := resp.Headers["Content-Type"]; ct != "" && !strings.HasPrefix(ct, "application/json") {
+		return resp
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(resp.Body), "", "  "); err != nil {
+		return resp
+	}
+	resp.Body = buf.String()
+	return resp
+}
+
+// deleteHandler removes one node (or edge) of a story.
+// Route: DELETE /struktur/{storyId}/{nodeId}
+func deleteHandler(st Store, ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	storyId := request.PathParameters["storyId"]
 	nodeId := request.PathParameters["nodeId"]
 
 	if storyId == "" || nodeId == "" {
+		return badInput("Missing storyId or nodeId"), nil
+	}
+
+	err := st.DeleteNode(ctx, storyId, nodeId)
+	if errors.Is(err, errGraphItemNotFound) {
 		return events.APIGatewayProxyResponse{
-			StatusCode: 400,
+			StatusCode: 404,
 			Headers:    corsHeaders(),
-			Body:       "Missing storyId or nodeId",
+			Body:       fmt.Sprintf("Node %s not found in story %s", nodeId, storyId),
 		}, nil
 	}
-
-	input := &dynamodb.DeleteItemInput{
-		TableName: aws.String(tableName),
-		Key: map[string]types.AttributeValue{
-			"storyId": &types.AttributeValueMemberS{Value: storyId},
-			"id":      &types.AttributeValueMemberS{Value: nodeId},
-		},
-	}
-
-	_, err := svc.DeleteItem(ctx, input)
 	if err != nil {
 		log.Printf("❌ Failed to delete item: %v", err)
 		return events.APIGatewayProxyResponse{
@@ -443,6 +1293,7 @@ func deleteHandler(ctx context.Context, request events.APIGatewayProxyRequest) (
 	}
 
 	log.Printf("✅ Deleted item with storyId: %s, nodeId: %s", storyId, nodeId)
+	notifyGraphChange(ctx, storyapi.EventGraphDeleted, storyId)
 
 	return events.APIGatewayProxyResponse{
 		StatusCode: 200,
@@ -451,33 +1302,352 @@ func deleteHandler(ctx context.Context, request events.APIGatewayProxyRequest) (
 	}, nil
 }
 
+// queryStoryItems loads every graph item stored under the given storyId partition.
+func queryStoryItems(ctx context.Context, storyID string) ([]DBItem, error) {
+	return currentStore().queryItems(ctx, storyID)
+}
+
+// loadGraph returns the nodes and edges stored for a story.
+func loadGraph(ctx context.Context, storyID string) ([]Node, []Edge, error) {
+	return currentStore().GetGraph(ctx, storyID)
+}
+
+// clearGraphHandler removes every node and edge of a story in batched writes
+// and drops the paragraphNodeMap links to them; story, paragraphs and
+// details stay. It
+// lives under /api/stories so it cannot shadow deleting a node named "graph".
+// Route: DELETE /api/stories/{storyId}/graph
+func clearGraphHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	items, err := queryStoryItems(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to query graph %s for clearing: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	nodesRemoved, edgesRemoved := 0, 0
+	keys := make([]map[string]types.AttributeValue, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, keySchema.Key(storyID, item.ID))
+		if item.IsNode {
+			nodesRemoved++
+		} else {
+			edgesRemoved++
+		}
+	}
+	if err := storyapi.BatchDelete(ctx, svc, tableName, keys); err != nil {
+		log.Printf("❌ Failed to clear graph %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to clear graph"}, nil
+	}
+	if storySvc != nil {
+		if err := storySvc.ClearParagraphNodeMap(ctx, storyID); err != nil {
+			log.Printf("❌ Failed to clear paragraphNodeMap of %s: %v", storyID, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to clear paragraphNodeMap"}, nil
+		}
+	}
+	log.Printf("✅ Cleared graph %s (%d nodes, %d edges)", storyID, nodesRemoved, edgesRemoved)
+	notifyGraphChange(ctx, storyapi.EventGraphDeleted, storyID)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"storyId":      storyID,
+		"nodesRemoved": nodesRemoved,
+		"edgesRemoved": edgesRemoved,
+	})
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
+
+// deleteStoryHandler deletes a story with everything attached to it: story
+// record, paragraphs, details, graph and graph versions, in batched writes.
+// Route: DELETE /api/stories/{storyId}
+func deleteStoryHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	items, err := queryStoryItems(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to query graph %s for deletion: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	versionKeys, err := graphVersionKeys(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to list graph versions of %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	removed, err := storySvc.DeleteStory(ctx, storyID)
+	if errors.Is(err, storyapi.ErrStoryNotFound) && len(items) == 0 {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "Story not found"}, nil
+	}
+	if err != nil && !errors.Is(err, storyapi.ErrStoryNotFound) {
+		log.Printf("❌ Failed to delete story %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to delete story"}, nil
+	}
+	keys := versionKeys
+	for _, item := range items {
+		keys = append(keys, keySchema.Key(storyID, item.ID))
+	}
+	if err := storyapi.BatchDelete(ctx, svc, tableName, keys); err != nil {
+		log.Printf("❌ Failed to delete graph of %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to delete graph"}, nil
+	}
+	strukturCache.invalidate(storyID)
+	storySvc.NotifyChange(ctx, storyapi.EventStoryDeleted, storyID)
+	log.Printf("✅ Deleted story %s (%d story items, %d graph items, %d versions)", storyID, removed, len(items), len(versionKeys))
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"storyId":       storyID,
+		"itemsRemoved":  removed + len(keys),
+		"graphItems":    len(items),
+		"graphVersions": len(versionKeys),
+	})
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
+
+// graphNodeIDs lists the node ids of a story graph for the story service,
+// including those of a graph an import is about to write.
+func graphNodeIDs(ctx context.Context, storyID string) ([]string, error) {
+	pending, _ := ctx.Value(pendingGraphKey{}).(pendingGraph)
+	if pending.replace {
+		return pending.nodeIDs, nil
+	}
+	nodes, _, err := loadGraph(ctx, storyID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(nodes), len(nodes)+len(pending.nodeIDs))
+	for i, n := range nodes {
+		ids[i] = n.ID
+	}
+	return append(ids, pending.nodeIDs...), nil
+}
+
+// updatePositionsHandler moves many nodes at once, all or none; only x/y
+// are touched.
+// Route: POST /struktur/{storyId}/positions
+func updatePositionsHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" || strings.Contains(storyID, "/") {
+		return badInput("Missing storyId"), nil
+	}
+
+	var in struct {
+		Positions map[string]struct {
+			X int `json:"x"`
+			Y int `json:"y"`
+		} `json:"positions"`
+	}
+	if err := storyapi.DecodeJSON(req.Body, &in); err != nil {
+		return badInput(err.Error()), nil
+	}
+	if len(in.Positions) == 0 {
+		return unprocessable("No positions given"), nil
+	}
+	if len(in.Positions) > maxTransactItems {
+		return unprocessable(fmt.Sprintf("Too many positions: %d (limit %d)", len(in.Positions), maxTransactItems)), nil
+	}
+
+	items, err := queryStoryItems(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to query items for %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	nodes := make(map[string]DBItem, len(items))
+	for _, it := range items {
+		if it.IsNode {
+			nodes[it.ID] = it
+		}
+	}
+
+	var missing []string
+	for id := range in.Positions {
+		if _, ok := nodes[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return unprocessable("Unknown node ids: " + strings.Join(missing, ", ")), nil
+	}
+
+	for id, pos := range in.Positions {
+		x, cx := clampCoord(pos.X)
+		y, cy := clampCoord(pos.Y)
+		if !cx && !cy {
+			continue
+		}
+		if isStrict(req) {
+			return unprocessable(fmt.Sprintf("Node %s coordinates (%d,%d) out of range [%d,%d]", id, pos.X, pos.Y, coordMin, coordMax)), nil
+		}
+		log.Printf("⚠️ Clamped node %s coordinates (%d,%d) -> (%d,%d)", id, pos.X, pos.Y, x, y)
+		pos.X, pos.Y = x, y
+		in.Positions[id] = pos
+	}
+
+	// One transaction, so a failed save never leaves half a layout behind.
+	now := storyapi.NowRFC3339UTC()
+	var writes []types.TransactWriteItem
+	for id, pos := range in.Positions {
+		cur := nodes[id]
+		cur.X = pos.X
+		cur.Y = pos.Y
+		cur.Timestamp = now
+		cur.UpdatedBy = storyapi.ActorFromContext(ctx)
+		av, err := attributevalue.MarshalMap(cur)
+		if err != nil {
+			log.Printf("❌ Marshal node %s for position update failed: %v", id, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to update positions"}, nil
+		}
+		writes = append(writes, types.TransactWriteItem{Put: &types.Put{
+			TableName: aws.String(tableName),
+			Item:      keySchema.ToItem(av),
+		}})
+	}
+	if _, err := svc.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes}); err != nil {
+		log.Printf("❌ Position transaction failed for %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to update positions"}, nil
+	}
+
+	notifyGraphChange(ctx, storyapi.EventGraphUpdated, storyID)
+	body, _ := json.Marshal(map[string]int{"updated": len(writes)})
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
+
+// retypeHandler sets the type of several nodes in one transaction. Ids that
+// are not nodes of the story are reported back rather than failing the call.
+// Route: POST /struktur/{storyId}/retype  {"nodeIds":[...],"type":"ergebnis"}
+func retypeHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	var in struct {
+		NodeIDs []string `json:"nodeIds"`
+		Type    *string  `json:"type"`
+	}
+	if err := storyapi.DecodeJSON(req.Body, &in); err != nil {
+		return badInput(err.Error()), nil
+	}
+	if len(in.NodeIDs) == 0 || in.Type == nil {
+		return unprocessable("nodeIds and type are required"), nil
+	}
+	if !nodeTypes[*in.Type] {
+		return unprocessable(fmt.Sprintf("Unknown node type %q", *in.Type)), nil
+	}
+	if len(in.NodeIDs) > maxTransactItems {
+		return unprocessable(fmt.Sprintf("Too many nodeIds: %d (limit %d)", len(in.NodeIDs), maxTransactItems)), nil
+	}
+
+	items, err := queryStoryItems(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to query items for %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	nodes := make(map[string]DBItem, len(items))
+	for _, it := range items {
+		if it.IsNode {
+			nodes[it.ID] = it
+		}
+	}
+
+	now := storyapi.NowRFC3339UTC()
+	unknown := []string{}
+	seen := map[string]bool{}
+	var writes []types.TransactWriteItem
+	for _, id := range in.NodeIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		cur, ok := nodes[id]
+		if !ok {
+			unknown = append(unknown, id)
+			continue
+		}
+		cur.Type = *in.Type
+		cur.Timestamp = now
+		cur.UpdatedBy = storyapi.ActorFromContext(ctx)
+		av, err := attributevalue.MarshalMap(cur)
+		if err != nil {
+			log.Printf("❌ Marshal node %s for retype failed: %v", id, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to update nodes"}, nil
+		}
+		writes = append(writes, types.TransactWriteItem{Put: &types.Put{
+			TableName: aws.String(tableName),
+			Item:      keySchema.ToItem(av),
+		}})
+	}
+	if len(writes) > 0 {
+		if _, err := svc.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes}); err != nil {
+			log.Printf("❌ Retype transaction failed for %s: %v", storyID, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to update nodes"}, nil
+		}
+		notifyGraphChange(ctx, storyapi.EventGraphUpdated, storyID)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"updated": len(writes), "unknown": unknown})
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
+
 // updateEdgeHandler updates label/detail/type on an edge item (isNode=false).
 // Route: PATCH /api/stories/{storyId}/edges/{edgeId}
 func updateEdgeHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	storyID := req.PathParameters["storyId"]
 	edgeID := req.PathParameters["edgeId"]
 	if storyID == "" || edgeID == "" {
-		return events.APIGatewayProxyResponse{StatusCode: 400, Headers: corsHeaders(), Body: "Missing storyId or edgeId"}, nil
+		return badInput("Missing storyId or edgeId"), nil
 	}
 
 	// Minimal patch payload
 	type edgePatchInput struct {
-		Label  *string `json:"label"`
-		Detail *string `json:"detail"`
-		Type   *string `json:"type"`
+		Label  *string            `json:"label"`
+		Detail *string            `json:"detail"`
+		Type   *string            `json:"type"`
+		Meta   *map[string]string `json:"meta"` // replaces the whole map; {} clears it
+		Weight *float64           `json:"weight"`
 	}
 	var in edgePatchInput
-	if err := json.Unmarshal([]byte(req.Body), &in); err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 400, Headers: corsHeaders(), Body: "Invalid JSON"}, nil
+	if err := storyapi.DecodeJSON(req.Body, &in); err != nil {
+		return badInput(err.Error()), nil
+	}
+	if in.Meta != nil {
+		if err := validateMeta("Edge "+edgeID, *in.Meta); err != nil {
+			return unprocessable(err.Error()), nil
+		}
+	}
+	if err := validateWeight("Edge "+edgeID, in.Weight); err != nil {
+		return unprocessable(err.Error()), nil
+	}
+	if in.Label != nil || in.Detail != nil {
+		var label, detail string
+		if in.Label != nil {
+			label = *in.Label
+		}
+		if in.Detail != nil {
+			detail = *in.Detail
+		}
+		if err := checkGraphText("Edge "+edgeID, label, detail); err != nil {
+			return unprocessable(err.Error()), nil
+		}
 	}
 
 	// Fetch existing edge (isNode=false) via exact key
 	qres, err := svc.Query(ctx, &dynamodb.QueryInput{
-		TableName:              aws.String(tableName),
-		KeyConditionExpression: aws.String("storyId = :sid AND id = :eid"),
+		TableName:                aws.String(tableName),
+		KeyConditionExpression:   aws.String(keySchema.ItemCondition()),
+		ExpressionAttributeNames: keySchema.Names(true),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":sid": &types.AttributeValueMemberS{Value: storyID},
-			":eid": &types.AttributeValueMemberS{Value: edgeID},
+			":sk":  &types.AttributeValueMemberS{Value: edgeID},
 		},
 		Limit:          aws.Int32(1),
 		ConsistentRead: aws.Bool(true),
@@ -488,12 +1658,12 @@ func updateEdgeHandler(ctx context.Context, req events.APIGatewayProxyRequest) (
 	}
 
 	var cur DBItem
-	if err := attributevalue.UnmarshalMap(qres.Items[0], &cur); err != nil {
-		log.Printf("❌ Unmarshal existing edge failed: %v", err)
+	if err := storyapi.UnmarshalItem(keySchema.FromItem(qres.Items[0]), &cur); err != nil {
+		log.Printf("❌ Unmarshal existing edge of %s failed: %v", storyID, err)
 		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to read edge"}, nil
 	}
 	if cur.IsNode {
-		return events.APIGatewayProxyResponse{StatusCode: 400, Headers: corsHeaders(), Body: "Target item is not an edge"}, nil
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "Edge not found"}, nil
 	}
 
 	// Apply patch fields
@@ -506,7 +1676,14 @@ func updateEdgeHandler(ctx context.Context, req events.APIGatewayProxyRequest) (
 	if in.Type != nil {
 		cur.Type = *in.Type
 	}
-	cur.Timestamp = time.Now().Format(time.RFC3339)
+	if in.Meta != nil {
+		cur.Meta = nilIfEmpty(*in.Meta)
+	}
+	if in.Weight != nil {
+		cur.Weight = in.Weight
+	}
+	cur.Timestamp = storyapi.NowRFC3339UTC()
+	cur.UpdatedBy = storyapi.ActorFromContext(ctx)
 
 	av, err := attributevalue.MarshalMap(cur)
 	if err != nil {
@@ -515,11 +1692,12 @@ func updateEdgeHandler(ctx context.Context, req events.APIGatewayProxyRequest) (
 	}
 	if _, err := svc.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(tableName),
-		Item:      av,
+		Item:      keySchema.ToItem(av),
 	}); err != nil {
 		log.Printf("❌ PutItem edge update failed: %v", err)
 		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to update edge"}, nil
 	}
+	notifyGraphChange(ctx, storyapi.EventGraphUpdated, storyID)
 
 	return events.APIGatewayProxyResponse{
 		StatusCode: 200,
@@ -534,29 +1712,27 @@ func deleteEdgeHandler(ctx context.Context, req events.APIGatewayProxyRequest) (
 	storyId := req.PathParameters["storyId"]
 	edgeId := req.PathParameters["edgeId"]
 	if storyId == "" || edgeId == "" {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 400,
-			Headers:    corsHeaders(),
-			Body:       "Missing storyId or edgeId",
-		}, nil
+		return badInput("Missing storyId or edgeId"), nil
 	}
 
 	_, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
 		TableName: aws.String(tableName),
-		Key: map[string]types.AttributeValue{
-			"storyId": &types.AttributeValueMemberS{Value: storyId},
-			"id":      &types.AttributeValueMemberS{Value: edgeId},
-		},
+		Key:       keySchema.Key(storyId, edgeId),
 		// Ensure we only delete edges
-		ConditionExpression:       aws.String("attribute_exists(storyId) AND attribute_exists(id) AND isNode = :false"),
+		ConditionExpression:       aws.String("attribute_exists(#pk) AND attribute_exists(#sk) AND isNode = :false"),
+		ExpressionAttributeNames:  keySchema.Names(true),
 		ExpressionAttributeValues: map[string]types.AttributeValue{":false": &types.AttributeValueMemberBOOL{Value: false}},
 	})
+	if storyapi.IsConditionalCheckFailed(err) {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "Edge not found"}, nil
+	}
 	if err != nil {
 		log.Printf("❌ Failed to delete edge %s/%s: %v", storyId, edgeId, err)
 		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to delete edge"}, nil
 	}
 
 	log.Printf("✅ Deleted edge storyId=%s, edgeId=%s", storyId, edgeId)
+	notifyGraphChange(ctx, storyapi.EventGraphDeleted, storyId)
 	return events.APIGatewayProxyResponse{
 		StatusCode: 200,
 		Headers:    corsHeaders(),
@@ -564,69 +1740,149 @@ func deleteEdgeHandler(ctx context.Context, req events.APIGatewayProxyRequest) (
 	}, nil
 }
 
+// storyInitOnce guards the one lazy attempt to build a story service that
+// main failed to set up.
+var storyInitOnce sync.Once
+
 func handleStoryRoutes(ctx context.Context, req events.APIGatewayProxyRequest, method, path string) (events.APIGatewayProxyResponse, error) {
+	if storySvc == nil {
+		storyInitOnce.Do(func() {
+			log.Printf("⚠️ Story service missing on first use, initialising lazily")
+			if err := initStoryService(); err != nil {
+				log.Printf("❌ Story service initialisation failed: %v", err)
+			}
+		})
+	}
 	if storySvc == nil {
 		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Story service not initialised"}, nil
 	}
-	normalized := normalizePath(path)
-	trimmed := strings.TrimPrefix(normalized, "/api/")
-	parts := strings.Split(trimmed, "/")
-	switch {
-	case method == "POST" && trimmed == "stories":
-		return storySvc.HandleCreateStory(ctx, req)
-	case method == "POST" && trimmed == "stories/import":
-		return storySvc.HandleImportStory(ctx, req)
-	case method == "PATCH" && len(parts) == 2 && parts[0] == "stories":
-		storyID := parts[1]
-		req.PathParameters = map[string]string{"storyId": storyID}
-		return storySvc.HandleUpdateStory(ctx, req)
-	case method == "GET" && trimmed == "stories":
-		return storySvc.HandleListStories(ctx, req)
-	case method == "POST" && len(parts) == 3 && parts[0] == "stories" && parts[2] == "paragraphs":
-		storyID := parts[1]
-		req.PathParameters = map[string]string{"storyId": storyID}
-		return storySvc.HandleCreateParagraph(ctx, req)
-	case method == "GET" && len(parts) == 3 && parts[0] == "stories" && parts[2] == "full":
-		storyID := parts[1]
-		req.PathParameters = map[string]string{"storyId": storyID}
-		return storySvc.HandleGetFullStory(ctx, req)
-	case method == "PATCH" && len(parts) == 2 && parts[0] == "paragraphs":
-		paragraphID := parts[1]
-		req.PathParameters = map[string]string{"paragraphId": paragraphID}
-		return storySvc.HandleUpdateParagraph(ctx, req)
-	case method == "POST" && len(parts) == 3 && parts[0] == "paragraphs" && parts[2] == "details":
-		paragraphID := parts[1]
-		req.PathParameters = map[string]string{"paragraphId": paragraphID}
-		return storySvc.HandleCreateDetail(ctx, req)
-	case method == "PATCH" && len(parts) == 4 && parts[0] == "stories" && parts[2] == "edges":
-		storyID := parts[1]
-		edgeID := parts[3]
-		req.PathParameters = map[string]string{"storyId": storyID, "edgeId": edgeID}
-		return updateEdgeHandler(ctx, req)
-	case method == "DELETE" && len(parts) == 4 && parts[0] == "stories" && parts[2] == "edges":
-		storyID := parts[1]
-		edgeID := parts[3]
-		req.PathParameters = map[string]string{"storyId": storyID, "edgeId": edgeID}
-		return deleteEdgeHandler(ctx, req)
-	default:
-		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "Not Found"}, nil
+	return dispatch(ctx, req, method, normalizePath(path))
+}
+
+// baseAllowHeaders are the request headers the API reads (X-User for the
+// actor, X-Api-Version for the body shape) plus those API Gateway needs for
+// signed and keyed requests.
+var baseAllowHeaders = []string{"Content-Type", "Authorization", "X-Requested-With", "X-Amz-Date", "X-Api-Key", "X-Amz-Security-Token", "X-User", "X-Api-Version"}
+
+// Preflight settings: CORS_MAX_AGE_SECONDS sets how long browsers may cache a
+// preflight, CORS_ALLOW_HEADERS (comma-separated) adds request headers to
+// baseAllowHeaders, e.g. for a proxy in front of the API.
+var (
+	corsMaxAge       = envInt("CORS_MAX_AGE_SECONDS", 86400)
+	corsAllowHeaders = allowHeaders(os.Getenv("CORS_ALLOW_HEADERS"))
+)
+
+// allowHeaders joins baseAllowHeaders and the extra headers, dropping blanks
+// and case-insensitive duplicates.
+func allowHeaders(extra string) string {
+	seen := map[string]bool{}
+	var out []string
+	for _, h := range append(append([]string(nil), baseAllowHeaders...), strings.Split(extra, ",")...) {
+		h = strings.TrimSpace(h)
+		if h == "" || seen[strings.ToLower(h)] {
+			continue
+		}
+		seen[strings.ToLower(h)] = true
+		out = append(out, h)
+	}
+	return strings.Join(out, ", ")
+}
+
+// allowedOrigins holds the origins of ALLOWED_ORIGINS (comma-separated, e.g.
+// "https://app.example.org,http://localhost:5173"). Browsers refuse
+// credentials with a wildcard origin, so the two CORS modes are:
+//   - unset: Allow-Origin "*" and no Allow-Credentials;
+//   - set: a listed request Origin is echoed with Allow-Credentials "true"
+//     and Vary: Origin; other origins get no Allow-Origin at all.
+var allowedOrigins = parseOrigins(os.Getenv("ALLOWED_ORIGINS"))
+
+// parseOrigins splits a comma-separated origin list, ignoring blanks and a
+// trailing slash.
+func parseOrigins(list string) map[string]bool {
+	origins := map[string]bool{}
+	for _, o := range strings.Split(list, ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			origins[o] = true
+		}
 	}
+	return origins
 }
 
+// corsHeaders are the CORS headers of every response. With ALLOWED_ORIGINS
+// set they lack Allow-Origin, which setCORSOrigin adds per request.
 func corsHeaders() map[string]string {
-	return map[string]string{
-		"Access-Control-Allow-Origin":      "*",
-		"Access-Control-Allow-Headers":     "Content-Type, Authorization, X-Requested-With, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
-		"Access-Control-Allow-Methods":     "OPTIONS,GET,POST,DELETE,PATCH",
-		"Access-Control-Allow-Credentials": "true",
-		"Access-Control-Max-Age":           "86400",
+	h := map[string]string{
+		"Access-Control-Allow-Origin":   "*",
+		"Access-Control-Allow-Headers":  corsAllowHeaders,
+		"Access-Control-Allow-Methods":  "OPTIONS,GET,POST,DELETE,PATCH",
+		"Access-Control-Expose-Headers": "Location, Link, X-Next-Cursor",
 	}
+	if len(allowedOrigins) > 0 {
+		delete(h, "Access-Control-Allow-Origin")
+		h["Access-Control-Allow-Credentials"] = "true"
+		h["Vary"] = "Origin"
+	}
+	return h
+}
+
+// setCORSOrigin echoes origin into response headers h when ALLOWED_ORIGINS
+// lists it. A response for any other origin carries neither Allow-Origin nor
+// Allow-Credentials, so the browser blocks it. Without ALLOWED_ORIGINS h is
+// left alone.
+func setCORSOrigin(h map[string]string, origin string) {
+	if len(allowedOrigins) == 0 || h == nil {
+		return
+	}
+	if allowedOrigins[strings.TrimRight(origin, "/")] {
+		h["Access-Control-Allow-Origin"] = origin
+		h["Access-Control-Allow-Credentials"] = "true"
+		h["Vary"] = "Origin"
+		return
+	}
+	delete(h, "Access-Control-Allow-Origin")
+	delete(h, "Access-Control-Allow-Credentials")
 }
 
 func main() {
-	svc = initializeDynamoDB(context.TODO())
-	log.Printf("✅ Using DynamoDB table: %s", tableName)
-	storySvc = storyapi.NewStoryService(svc, tableName, corsHeaders)
+	store, err := newStore(context.TODO(), os.Getenv("STORE_BACKEND"))
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	log.Printf("✅ Using table: %s", tableName)
+	if err := useStore(store); err != nil {
+		log.Printf("❌ Story service initialisation failed: %v", err)
+	}
 
 	runLambda()
 }
+
+// initStoryService builds storySvc from svc, tableName and the environment.
+func initStoryService() error {
+	s, err := storyapi.NewStoryService(svc, tableName, corsHeaders)
+	if err != nil {
+		return err
+	}
+	s.SetKeySchema(keySchema)
+	s.SetMaxParagraphs(envInt("MAX_PARAGRAPHS", storyapi.DefaultMaxParagraphs))
+	s.SetMaxDetails(envInt("MAX_DETAILS_PER_PARAGRAPH", storyapi.DefaultMaxDetails))
+	s.SetTextLimits(storyapi.TextLimits{
+		Title:  envInt("MAX_TITLE_LENGTH", storyapi.DefaultTextLimits.Title),
+		BodyMd: envInt("MAX_BODY_LENGTH", storyapi.DefaultTextLimits.BodyMd),
+	})
+	s.SetWebhook(os.Getenv("WEBHOOK_URL"), nil)
+	s.SetGraphNodeSource(graphNodeIDs)
+	s.SetChangeListener(func(_, storyID string) { strukturCache.invalidate(storyID) })
+	s.SetStoryIndex(os.Getenv("STORY_INDEX_NAME"))
+	if mode, err := storyapi.ParseHeadingMode(os.Getenv("PARAGRAPH_HEADINGS")); err != nil {
+		log.Printf("⚠️ Ignoring PARAGRAPH_HEADINGS: %v", err)
+	} else {
+		s.SetHeadingMode(mode)
+	}
+	if prefixes, err := storyapi.TenantIDPrefixes(os.Getenv("ID_TENANT")); err != nil {
+		log.Printf("⚠️ Ignoring ID_TENANT: %v", err)
+	} else {
+		s.SetIDPrefixes(prefixes)
+	}
+	storySvc = s
+	return nil
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	storyapi "strukturbild/api"
+)
+
+// memoryDynamo is the STORE_BACKEND=memory table and the tests' stand-in for
+// DynamoDB. It understands the key, condition and filter expressions the
+// handlers use, nothing more. Like the SDK, it refuses writes once the
+// request's context is done. It is sharded by partition: mu only guards
+// which partitions exist, and each partition has its own lock, so requests
+// for different stories do not serialise on one another. Emptied partitions
+// are kept.
+type memoryDynamo struct {
+	mu    sync.RWMutex
+	items map[string]map[string]map[string]types.AttributeValue
+	locks map[string]*sync.RWMutex
+
+	statsMu sync.Mutex
+	// itemsRead counts items examined by Query and Scan, like consumed read capacity.
+	itemsRead int
+	// batchSizes records the number of requests of each BatchWriteItem call.
+	batchSizes []int
+	// throttleBatches makes that many BatchWriteItem calls leave their last
+	// request unprocessed, as DynamoDB does under throttling.
+	throttleBatches int
+}
+
+func newMemoryDynamo() *memoryDynamo {
+	return &memoryDynamo{
+		items: make(map[string]map[string]map[string]types.AttributeValue),
+		locks: make(map[string]*sync.RWMutex),
+	}
+}
+
+// partition returns the bucket for pk and the lock guarding it, creating
+// both if create is set; otherwise bucket is nil for unknown partitions.
+func (m *memoryDynamo) partition(pk string, create bool) (map[string]map[string]types.AttributeValue, *sync.RWMutex) {
+	m.mu.RLock()
+	bucket, lock := m.items[pk], m.locks[pk]
+	m.mu.RUnlock()
+	if bucket != nil || !create {
+		return bucket, lock
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if bucket = m.items[pk]; bucket == nil {
+		bucket = make(map[string]map[string]types.AttributeValue)
+		m.items[pk] = bucket
+		m.locks[pk] = &sync.RWMutex{}
+	}
+	return bucket, m.locks[pk]
+}
+
+func (m *memoryDynamo) countRead(n int) {
+	m.statsMu.Lock()
+	m.itemsRead += n
+	m.statsMu.Unlock()
+}
+
+func cloneAttrMap(src map[string]types.AttributeValue) map[string]types.AttributeValue {
+	cloned := make(map[string]types.AttributeValue, len(src))
+	for k, v := range src {
+		cloned[k] = cloneAttr(v)
+	}
+	return cloned
+}
+
+func cloneAttr(attr types.AttributeValue) types.AttributeValue {
+	switch v := attr.(type) {
+	case *types.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: v.Value}
+	case *types.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: v.Value}
+	case *types.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: v.Value}
+	case *types.AttributeValueMemberL:
+		out := make([]types.AttributeValue, len(v.Value))
+		for i, child := range v.Value {
+			out[i] = cloneAttr(child)
+		}
+		return &types.AttributeValueMemberL{Value: out}
+	case *types.AttributeValueMemberM:
+		return &types.AttributeValueMemberM{Value: cloneAttrMap(v.Value)}
+	default:
+		return attr
+	}
+}
+
+func (m *memoryDynamo) PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pk := getStringAttr(input.Item[keySchema.PartitionKey])
+	sk := getStringAttr(input.Item[keySchema.SortKey])
+	if pk == "" || sk == "" {
+		return nil, fmt.Errorf("missing keys")
+	}
+	bucket, lock := m.partition(pk, true)
+	lock.Lock()
+	defer lock.Unlock()
+	if !conditionHolds(bucket[sk], input.ConditionExpression, input.ExpressionAttributeValues) {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	bucket[sk] = cloneAttrMap(input.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *memoryDynamo) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if input.IndexName != nil {
+		return m.queryIndex(input)
+	}
+	pk := getStringAttr(input.ExpressionAttributeValues[":sid"])
+	bucket, lock := m.partition(pk, false)
+	if bucket == nil {
+		return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{}}, nil
+	}
+	lock.RLock()
+	defer lock.RUnlock()
+	m.countRead(len(bucket))
+	items := make([]map[string]types.AttributeValue, 0, len(bucket))
+	// keySchema.ItemCondition binds the sort key to ":sk".
+	sk, exact := input.ExpressionAttributeValues[":sk"]
+	// keySchema.PrefixCondition binds it to ":skPrefix".
+	prefix, prefixed := input.ExpressionAttributeValues[":skPrefix"]
+	for key, item := range bucket {
+		if exact && key != getStringAttr(sk) {
+			continue
+		}
+		if prefixed && !strings.HasPrefix(key, getStringAttr(prefix)) {
+			continue
+		}
+		if matchesFilter(item, input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues) {
+			items = append(items, cloneAttrMap(item))
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return getStringAttr(items[i][keySchema.SortKey]) < getStringAttr(items[j][keySchema.SortKey])
+	})
+	if input.ScanIndexForward != nil && !*input.ScanIndexForward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if start := getStringAttr(input.ExclusiveStartKey[keySchema.SortKey]); start != "" {
+		forward := input.ScanIndexForward == nil || *input.ScanIndexForward
+		i := 0
+		for i < len(items) {
+			sk := getStringAttr(items[i][keySchema.SortKey])
+			if (forward && sk > start) || (!forward && sk < start) {
+				break
+			}
+			i++
+		}
+		items = items[i:]
+	}
+	out := &dynamodb.QueryOutput{Items: items}
+	if input.Limit != nil && int(*input.Limit) < len(items) {
+		out.Items = items[:*input.Limit]
+		last := out.Items[len(out.Items)-1]
+		out.LastEvaluatedKey = map[string]types.AttributeValue{
+			keySchema.PartitionKey: last[keySchema.PartitionKey],
+			keySchema.SortKey:      last[keySchema.SortKey],
+		}
+	}
+	return out, nil
+}
+
+// queryIndex emulates a sparse GSI whose key condition is "#name = :value":
+// only items carrying that attribute value are examined.
+func (m *memoryDynamo) queryIndex(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	parts := strings.SplitN(aws.ToString(input.KeyConditionExpression), "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("unsupported index key condition %q", aws.ToString(input.KeyConditionExpression))
+	}
+	attr := strings.TrimSpace(parts[0])
+	if resolved, ok := input.ExpressionAttributeNames[attr]; ok {
+		attr = resolved
+	}
+	want := getStringAttr(input.ExpressionAttributeValues[strings.TrimSpace(parts[1])])
+	var items []map[string]types.AttributeValue
+	m.eachPartition(func(bucket map[string]map[string]types.AttributeValue) {
+		for _, item := range bucket {
+			if getStringAttr(item[attr]) == want {
+				m.countRead(1)
+				items = append(items, cloneAttrMap(item))
+			}
+		}
+	})
+	sort.Slice(items, func(i, j int) bool {
+		return getStringAttr(items[i][keySchema.SortKey]) < getStringAttr(items[j][keySchema.SortKey])
+	})
+	return &dynamodb.QueryOutput{Items: items}, nil
+}
+
+func (m *memoryDynamo) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pk := getStringAttr(input.Key[keySchema.PartitionKey])
+	sk := getStringAttr(input.Key[keySchema.SortKey])
+	bucket, lock := m.partition(pk, false)
+	var current map[string]types.AttributeValue
+	if bucket != nil {
+		lock.Lock()
+		defer lock.Unlock()
+		current = bucket[sk]
+	}
+	if !conditionHolds(current, input.ConditionExpression, input.ExpressionAttributeValues) {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	if bucket != nil {
+		delete(bucket, sk)
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// BatchWriteItem applies the puts and deletes of every table; with
+// throttleBatches set it hands the last request back as unprocessed.
+func (m *memoryDynamo) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	unprocessed := map[string][]types.WriteRequest{}
+	for table, requests := range input.RequestItems {
+		if len(requests) > 25 {
+			return nil, fmt.Errorf("too many requests in batch: %d", len(requests))
+		}
+		m.statsMu.Lock()
+		m.batchSizes = append(m.batchSizes, len(requests))
+		throttle := m.throttleBatches > 0 && len(requests) > 0
+		if throttle {
+			m.throttleBatches--
+		}
+		m.statsMu.Unlock()
+		if throttle {
+			unprocessed[table] = requests[len(requests)-1:]
+			requests = requests[:len(requests)-1]
+		}
+		for _, r := range requests {
+			switch {
+			case r.PutRequest != nil:
+				if _, err := m.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(table), Item: r.PutRequest.Item}); err != nil {
+					return nil, err
+				}
+			case r.DeleteRequest != nil:
+				if _, err := m.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: aws.String(table), Key: r.DeleteRequest.Key}); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: unprocessed}, nil
+}
+
+// TransactWriteItems checks every Put condition first and cancels the whole
+// transaction if one fails; otherwise it applies Puts and Deletes in order.
+func (m *memoryDynamo) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	reasons := make([]types.CancellationReason, len(input.TransactItems))
+	cancelled := false
+	for i, op := range input.TransactItems {
+		reasons[i] = types.CancellationReason{Code: aws.String("None")}
+		if op.Put == nil || op.Put.ConditionExpression == nil {
+			continue
+		}
+		current, err := m.GetItem(ctx, &dynamodb.GetItemInput{TableName: op.Put.TableName, Key: map[string]types.AttributeValue{
+			keySchema.PartitionKey: op.Put.Item[keySchema.PartitionKey],
+			keySchema.SortKey:      op.Put.Item[keySchema.SortKey],
+		}})
+		if err != nil {
+			return nil, err
+		}
+		if !conditionHolds(current.Item, op.Put.ConditionExpression, op.Put.ExpressionAttributeValues) {
+			reasons[i] = types.CancellationReason{Code: aws.String("ConditionalCheckFailed")}
+			cancelled = true
+		}
+	}
+	if cancelled {
+		return nil, &types.TransactionCanceledException{Message: aws.String("Transaction cancelled"), CancellationReasons: reasons}
+	}
+	for _, op := range input.TransactItems {
+		switch {
+		case op.Put != nil:
+			if _, err := m.PutItem(ctx, &dynamodb.PutItemInput{TableName: op.Put.TableName, Item: op.Put.Item}); err != nil {
+				return nil, err
+			}
+		case op.Delete != nil:
+			if _, err := m.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: op.Delete.TableName, Key: op.Delete.Key}); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported transact item")
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (m *memoryDynamo) GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	pk := getStringAttr(input.Key[keySchema.PartitionKey])
+	sk := getStringAttr(input.Key[keySchema.SortKey])
+	if bucket, lock := m.partition(pk, false); bucket != nil {
+		lock.RLock()
+		defer lock.RUnlock()
+		if item, ok := bucket[sk]; ok {
+			return &dynamodb.GetItemOutput{Item: cloneAttrMap(item)}, nil
+		}
+	}
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+// Scan evaluates items in (partition, sort key) order. Like DynamoDB, Limit
+// counts evaluated items before the filter, and a truncated scan returns the
+// last evaluated key to resume after.
+func (m *memoryDynamo) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	var all []map[string]types.AttributeValue
+	m.eachPartition(func(bucket map[string]map[string]types.AttributeValue) {
+		m.countRead(len(bucket))
+		for _, item := range bucket {
+			all = append(all, item)
+		}
+	})
+	sort.Slice(all, func(i, j int) bool {
+		pi, pj := getStringAttr(all[i][keySchema.PartitionKey]), getStringAttr(all[j][keySchema.PartitionKey])
+		if pi != pj {
+			return pi < pj
+		}
+		return getStringAttr(all[i][keySchema.SortKey]) < getStringAttr(all[j][keySchema.SortKey])
+	})
+	if start := input.ExclusiveStartKey; len(start) > 0 {
+		after := [2]string{getStringAttr(start[keySchema.PartitionKey]), getStringAttr(start[keySchema.SortKey])}
+		i := 0
+		for i < len(all) {
+			cur := [2]string{getStringAttr(all[i][keySchema.PartitionKey]), getStringAttr(all[i][keySchema.SortKey])}
+			if cur[0] > after[0] || (cur[0] == after[0] && cur[1] > after[1]) {
+				break
+			}
+			i++
+		}
+		all = all[i:]
+	}
+	out := &dynamodb.ScanOutput{}
+	if input.Limit != nil && int(*input.Limit) < len(all) {
+		all = all[:*input.Limit]
+		last := all[len(all)-1]
+		out.LastEvaluatedKey = map[string]types.AttributeValue{
+			keySchema.PartitionKey: last[keySchema.PartitionKey],
+			keySchema.SortKey:      last[keySchema.SortKey],
+		}
+	}
+	items := []map[string]types.AttributeValue{}
+	for _, item := range all {
+		if matchesFilter(item, input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues) {
+			items = append(items, cloneAttrMap(item))
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return getStringAttr(items[i][keySchema.SortKey]) < getStringAttr(items[j][keySchema.SortKey])
+	})
+	out.Items = items
+	return out, nil
+}
+
+// eachPartition calls fn for every partition while holding its read lock.
+func (m *memoryDynamo) eachPartition(fn func(map[string]map[string]types.AttributeValue)) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for pk, bucket := range m.items {
+		lock := m.locks[pk]
+		lock.RLock()
+		fn(bucket)
+		lock.RUnlock()
+	}
+}
+
+// conditionHolds evaluates the ConditionExpressions the handlers use against
+// the stored item (nil if absent); other expressions pass.
+func conditionHolds(current map[string]types.AttributeValue, cond *string, values map[string]types.AttributeValue) bool {
+	switch strings.TrimSpace(aws.ToString(cond)) {
+	case "attribute_not_exists(#pk)":
+		return current == nil
+	case "attribute_exists(#pk)":
+		return current != nil
+	case "attribute_not_exists(#pk) OR expiresAt < :now":
+		return current == nil || numberAttr(current["expiresAt"]) < numberAttr(values[":now"])
+	case "attribute_not_exists(#pk) OR ownerId = :sid":
+		return current == nil || getStringAttr(current["ownerId"]) == getStringAttr(values[":sid"])
+	case "ownerId = :owner":
+		return current != nil && getStringAttr(current["ownerId"]) == getStringAttr(values[":owner"])
+	case "leaseOwner = :owner":
+		return current != nil && getStringAttr(current["leaseOwner"]) == getStringAttr(values[":owner"])
+	case "attribute_exists(#pk) AND attribute_exists(#sk) AND isNode = :false":
+		isNode, _ := current["isNode"].(*types.AttributeValueMemberBOOL)
+		want, _ := values[":false"].(*types.AttributeValueMemberBOOL)
+		return current != nil && isNode != nil && want != nil && isNode.Value == want.Value
+	default:
+		return true
+	}
+}
+
+func matchesFilter(item map[string]types.AttributeValue, filter *string, names map[string]string, expr map[string]types.AttributeValue) bool {
+	if filter == nil || *filter == "" {
+		return true
+	}
+	trimmed := strings.TrimSpace(*filter)
+	switch {
+	case trimmed == "paragraphId = :paragraphId":
+		want := getStringAttr(expr[":paragraphId"])
+		return getStringAttr(item["paragraphId"]) == want
+	case strings.HasPrefix(trimmed, "begins_with(") && strings.HasSuffix(trimmed, ")"):
+		inner := strings.TrimSuffix(strings.TrimPrefix(trimmed, "begins_with("), ")")
+		parts := strings.Split(inner, ",")
+		if len(parts) != 2 {
+			return true
+		}
+		field := strings.TrimSpace(parts[0])
+		if resolved, ok := names[field]; ok {
+			field = resolved
+		}
+		token := strings.TrimSpace(parts[1])
+		attr := item[field]
+		prefix := getStringAttr(expr[token])
+		if v, ok := attr.(*types.AttributeValueMemberS); ok {
+			return strings.HasPrefix(v.Value, prefix)
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func numberAttr(attr types.AttributeValue) int64 {
+	if v, ok := attr.(*types.AttributeValueMemberN); ok {
+		n, _ := strconv.ParseInt(v.Value, 10, 64)
+		return n
+	}
+	return 0
+}
+
+func getStringAttr(attr types.AttributeValue) string {
+	if v, ok := attr.(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+var _ storyapi.DynamoClient = (*memoryDynamo)(nil)
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// nodeMapDiff lists the links a rebuild adds to and removes from the stored
+// paragraphNodeMap.
+type nodeMapDiff struct {
+	Added   []nodeLink `json:"added"`
+	Removed []nodeLink `json:"removed"`
+}
+
+// rebuildNodeMap derives the paragraphNodeMap from the graph. A node with
+// evidence is linked to exactly the paragraphs its evidence names; a node
+// without evidence keeps the links the stored map has for it, as there is
+// nothing to rebuild them from. Links to missing paragraphs or nodes are
+// dropped. Evidence naming a missing paragraph is returned as unknown.
+func rebuildNodeMap(snap storySnapshot) (map[string][]string, []nodeLink) {
+	paragraphIDs := make(map[string]bool, len(snap.full.Paragraphs))
+	for _, p := range snap.full.Paragraphs {
+		paragraphIDs[p.ParagraphID] = true
+	}
+	nodeIDs := make(map[string]bool, len(snap.nodes))
+	withEvidence := map[string]bool{}
+	links := map[nodeLink]bool{}
+	unknown := []nodeLink{}
+	for _, n := range snap.nodes {
+		nodeIDs[n.ID] = true
+		if len(n.Evidence) == 0 {
+			continue
+		}
+		withEvidence[n.ID] = true
+		for _, pid := range n.Evidence {
+			if !paragraphIDs[pid] {
+				unknown = append(unknown, nodeLink{pid, n.ID})
+				continue
+			}
+			links[nodeLink{pid, n.ID}] = true
+		}
+	}
+	for pid, nids := range snap.full.Story.ParagraphNodeMap {
+		for _, nid := range nids {
+			if paragraphIDs[pid] && nodeIDs[nid] && !withEvidence[nid] {
+				links[nodeLink{pid, nid}] = true
+			}
+		}
+	}
+
+	pnm := map[string][]string{}
+	for l := range links {
+		pnm[l.ParagraphID] = append(pnm[l.ParagraphID], l.NodeID)
+	}
+	for _, nids := range pnm {
+		sort.Strings(nids)
+	}
+	sortNodeLinks(unknown)
+	return pnm, unknown
+}
+
+// diffNodeMaps compares two paragraphNodeMaps link by link.
+func diffNodeMaps(before, after map[string][]string) nodeMapDiff {
+	d := nodeMapDiff{Added: []nodeLink{}, Removed: []nodeLink{}}
+	old, rebuilt := map[nodeLink]bool{}, map[nodeLink]bool{}
+	for pid, nids := range before {
+		for _, nid := range nids {
+			old[nodeLink{pid, nid}] = true
+		}
+	}
+	for pid, nids := range after {
+		for _, nid := range nids {
+			rebuilt[nodeLink{pid, nid}] = true
+		}
+	}
+	for l := range rebuilt {
+		if !old[l] {
+			d.Added = append(d.Added, l)
+		}
+	}
+	for l := range old {
+		if !rebuilt[l] {
+			d.Removed = append(d.Removed, l)
+		}
+	}
+	sortNodeLinks(d.Added)
+	sortNodeLinks(d.Removed)
+	return d
+}
+
+func sortNodeLinks(links []nodeLink) {
+	sort.Slice(links, func(i, j int) bool {
+		a, b := links[i], links[j]
+		return a.ParagraphID < b.ParagraphID || (a.ParagraphID == b.ParagraphID && a.NodeID < b.NodeID)
+	})
+}
+
+// rebuildNodeMapHandler recomputes a story's paragraphNodeMap from node
+// evidence and reports the rebuilt map with its diff from the stored one.
+// It only previews; ?apply=true also saves the rebuilt map.
+// Route: POST /api/stories/{storyId}/rebuild-node-map
+func rebuildNodeMapHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	snap, _, err := loadSnapshot(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Node map rebuild of %s failed: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	if snap.full == nil {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "Story not found"}, nil
+	}
+
+	pnm, unknown := rebuildNodeMap(snap)
+	out := struct {
+		StoryID         string              `json:"storyId"`
+		Applied         bool                `json:"applied"`
+		NodeMap         map[string][]string `json:"paragraphNodeMap"`
+		Diff            nodeMapDiff         `json:"diff"`
+		UnknownEvidence []nodeLink          `json:"unknownEvidence"`
+	}{StoryID: storyID, NodeMap: pnm, Diff: diffNodeMaps(snap.full.Story.ParagraphNodeMap, pnm), UnknownEvidence: unknown}
+
+	if req.QueryStringParameters["apply"] == "true" && (len(out.Diff.Added) > 0 || len(out.Diff.Removed) > 0) {
+		if err := storySvc.SetParagraphNodeMap(ctx, storyID, pnm); err != nil {
+			log.Printf("❌ Saving rebuilt node map of %s failed: %v", storyID, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to save node map"}, nil
+		}
+		log.Printf("✅ Rebuilt node map of %s: %d links added, %d removed", storyID, len(out.Diff.Added), len(out.Diff.Removed))
+		storySvc.NotifyChange(ctx, storyapi.EventStoryUpdated, storyID)
+		out.Applied = true
+	}
+
+	body, _ := json.Marshal(out)
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	storyapi "strukturbild/api"
+)
+
+// nodeSortKeys are the orders GET /struktur/{id}?sortNodes= accepts. Without
+// the parameter nodes keep the store's order.
+var nodeSortKeys = map[string]bool{"label": true, "type": true, "time": true, "degree": true}
+
+func parseNodeSort(raw string) (string, error) {
+	if raw == "" || nodeSortKeys[raw] {
+		return raw, nil
+	}
+	return "", fmt.Errorf("sortNodes must be one of label, type, time, degree")
+}
+
+// sortedNodes returns a sorted copy of sb's nodes; the board itself may be
+// shared with strukturCache and is left alone. Ties fall back to label, then id.
+//   - label: case-insensitive, A to Z
+//   - type: grouped by type, untyped nodes last
+//   - time: calendar order with relative tokens resolved against the story's
+//     time anchor; unresolved tokens follow in T order, then other values,
+//     then nodes without a time
+//   - degree: most connected first, counting each relation once
+func sortedNodes(sb Strukturbild, key string) []Node {
+	nodes := append([]Node(nil), sb.Nodes...)
+	byLabel := func(a, b Node) bool {
+		la, lb := strings.ToLower(a.Label), strings.ToLower(b.Label)
+		if la != lb {
+			return la < lb
+		}
+		return a.ID < b.ID
+	}
+	var less func(a, b Node) bool
+	switch key {
+	case "label":
+		less = byLabel
+	case "type":
+		less = func(a, b Node) bool {
+			if (a.Type == "") != (b.Type == "") {
+				return b.Type == ""
+			}
+			if a.Type != b.Type {
+				return a.Type < b.Type
+			}
+			return byLabel(a, b)
+		}
+	case "time":
+		anchor := ""
+		if sb.Story != nil {
+			anchor = sb.Story.TimeAnchor
+		}
+		keys := make(map[string]nodeTimeKey, len(nodes))
+		for _, n := range nodes {
+			keys[n.ID] = timeSortKey(n.Time, anchor)
+		}
+		less = func(a, b Node) bool {
+			ka, kb := keys[a.ID], keys[b.ID]
+			if ka.group != kb.group {
+				return ka.group < kb.group
+			}
+			if !ka.at.Equal(kb.at) {
+				return ka.at.Before(kb.at)
+			}
+			if ka.step != kb.step {
+				return ka.step < kb.step
+			}
+			if a.Time != b.Time {
+				return a.Time < b.Time
+			}
+			return byLabel(a, b)
+		}
+	case "degree":
+		degrees := graphDegrees(sb.Edges)
+		less = func(a, b Node) bool {
+			if degrees[a.ID] != degrees[b.ID] {
+				return degrees[a.ID] > degrees[b.ID]
+			}
+			return byLabel(a, b)
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return less(nodes[i], nodes[j]) })
+	return nodes
+}
+
+type nodeTimeKey struct {
+	group int // 0 calendar, 1 unresolved relative token, 2 other value, 3 none
+	at    time.Time
+	step  int
+}
+
+func timeSortKey(v, anchor string) nodeTimeKey {
+	if strings.TrimSpace(v) == "" {
+		return nodeTimeKey{group: 3}
+	}
+	if t, ok := storyapi.ResolveTime(v, anchor); ok {
+		return nodeTimeKey{group: 0, at: t}
+	}
+	if n, ok := storyapi.ParseRelativeToken(v); ok {
+		return nodeTimeKey{group: 1, step: n}
+	}
+	return nodeTimeKey{group: 2}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// nodeShapes are the shapes a node may ask for; the names are Cytoscape's.
+var nodeShapes = map[string]bool{"rectangle": true, "round-rectangle": true, "ellipse": true, "diamond": true, "hexagon": true}
+
+// nodeIcons are the icon names the renderer ships glyphs for.
+var nodeIcons = map[string]bool{"cog": true, "hand": true, "flag": true, "warning": true, "briefcase": true, "person": true, "school": true}
+
+// defaultNodeShape is used for untyped nodes and matches the editor's default.
+const defaultNodeShape = "round-rectangle"
+
+// nodeStyle is the default look of a node type.
+type nodeStyle struct {
+	Shape string `json:"shape"`
+	Icon  string `json:"icon,omitempty"`
+	Color string `json:"color"`
+}
+
+// typeStyles gives each node type its default shape and icon; colors come
+// from typeColors.
+var typeStyles = map[string]nodeStyle{
+	"prozess":       {Shape: "round-rectangle", Icon: "cog"},
+	"praxis":        {Shape: "ellipse", Icon: "hand"},
+	"ergebnis":      {Shape: "hexagon", Icon: "flag"},
+	"schwierigkeit": {Shape: "diamond", Icon: "warning"},
+	"beschäftigung": {Shape: "rectangle", Icon: "briefcase"},
+}
+
+// styleFor returns the effective style of n: its own shape, icon and color
+// where set, otherwise the defaults of its type.
+func styleFor(n Node) nodeStyle {
+	st := typeStyles[strings.ToLower(strings.TrimSpace(n.Type))]
+	st.Color = nodeFill(n)
+	if st.Shape == "" {
+		st.Shape = defaultNodeShape
+	}
+	if n.Shape != "" {
+		st.Shape = n.Shape
+	}
+	if n.Icon != "" {
+		st.Icon = n.Icon
+	}
+	return st
+}
+
+// validateNodeStyle rejects a shape or icon outside the allowed sets; empty passes.
+func validateNodeStyle(owner, shape, icon string) error {
+	if shape != "" && !nodeShapes[shape] {
+		return fmt.Errorf("%s shape %q is not one of %s", owner, shape, strings.Join(sortedKeys(nodeShapes), ", "))
+	}
+	if icon != "" && !nodeIcons[icon] {
+		return fmt.Errorf("%s icon %q is not one of %s", owner, icon, strings.Join(sortedKeys(nodeIcons), ", "))
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// nodeStylesHandler returns the default style per node type plus the allowed
+// shapes and icons, so renderers need not hardcode them.
+// Route: GET /api/node-styles
+func nodeStylesHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	types := map[string]nodeStyle{}
+	for t := range typeStyles {
+		types[t] = styleFor(Node{Type: t})
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"types":   types,
+		"default": styleFor(Node{}),
+		"shapes":  sortedKeys(nodeShapes),
+		"icons":   sortedKeys(nodeIcons),
+	})
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
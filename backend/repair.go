@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// nodeLink is one paragraphNodeMap entry.
+type nodeLink struct {
+	ParagraphID string `json:"paragraphId"`
+	NodeID      string `json:"nodeId"`
+}
+
+// detailRef identifies a detail record.
+type detailRef struct {
+	ParagraphID string `json:"paragraphId"`
+	DetailID    string `json:"detailId"`
+}
+
+// consistencyReport lists the drift found in one story.
+//   - DanglingEdges: edges whose from or to node does not exist.
+//   - AllowedDanglingEdges: such edges stored with ?allowDanglingEdges=true.
+//     They are reported but neither repaired nor counted as drift.
+//   - StaleNodeLinks: paragraphNodeMap entries naming a node that does not
+//     exist. Like the import check, only reported once the story has a graph.
+//   - StaleParagraphs: paragraphNodeMap keys naming a missing paragraph.
+//   - OrphanDetails: details whose paragraph is gone.
+type consistencyReport struct {
+	DanglingEdges        []string    `json:"danglingEdges"`
+	AllowedDanglingEdges []string    `json:"allowedDanglingEdges"`
+	StaleNodeLinks       []nodeLink  `json:"staleNodeLinks"`
+	StaleParagraphs      []string    `json:"staleParagraphs"`
+	OrphanDetails        []detailRef `json:"orphanDetails"`
+}
+
+func (r consistencyReport) clean() bool {
+	return len(r.DanglingEdges) == 0 && len(r.StaleNodeLinks) == 0 && len(r.StaleParagraphs) == 0 && len(r.OrphanDetails) == 0
+}
+
+// storySnapshot is what the checker reads: the graph and, if present, the story bundle.
+type storySnapshot struct {
+	nodes []Node
+	edges []Edge
+	full  *storyapi.StoryFull
+}
+
+func loadSnapshot(ctx context.Context, storyID string) (storySnapshot, bool, error) {
+	nodes, edges, err := loadGraph(ctx, storyID)
+	if err != nil {
+		return storySnapshot{}, false, err
+	}
+	snap := storySnapshot{nodes: nodes, edges: edges}
+	full, err := storySvc.GetFullStory(ctx, storyID)
+	switch {
+	case err == nil:
+		snap.full = full
+	case !errors.Is(err, storyapi.ErrStoryNotFound):
+		return storySnapshot{}, false, err
+	}
+	found := snap.full != nil || len(nodes) > 0 || len(edges) > 0
+	return snap, found, nil
+}
+
+func checkConsistency(snap storySnapshot) consistencyReport {
+	r := consistencyReport{DanglingEdges: []string{}, AllowedDanglingEdges: []string{}, StaleNodeLinks: []nodeLink{}, StaleParagraphs: []string{}, OrphanDetails: []detailRef{}}
+	nodeIDs := make(map[string]bool, len(snap.nodes))
+	for _, n := range snap.nodes {
+		nodeIDs[n.ID] = true
+	}
+	for _, e := range snap.edges {
+		switch {
+		case nodeIDs[e.From] && nodeIDs[e.To]:
+		case e.Dangling:
+			r.AllowedDanglingEdges = append(r.AllowedDanglingEdges, e.ID)
+		default:
+			r.DanglingEdges = append(r.DanglingEdges, e.ID)
+		}
+	}
+	if snap.full == nil {
+		return r
+	}
+
+	paragraphIDs := make(map[string]bool, len(snap.full.Paragraphs))
+	for _, p := range snap.full.Paragraphs {
+		paragraphIDs[p.ParagraphID] = true
+	}
+	for pid, nids := range snap.full.Story.ParagraphNodeMap {
+		if !paragraphIDs[pid] {
+			r.StaleParagraphs = append(r.StaleParagraphs, pid)
+			continue
+		}
+		if len(snap.nodes) == 0 {
+			continue
+		}
+		for _, nid := range nids {
+			if !nodeIDs[nid] {
+				r.StaleNodeLinks = append(r.StaleNodeLinks, nodeLink{pid, nid})
+			}
+		}
+	}
+	for pid, details := range snap.full.DetailsByParagraph {
+		if paragraphIDs[pid] {
+			continue
+		}
+		for _, d := range details {
+			r.OrphanDetails = append(r.OrphanDetails, detailRef{pid, d.DetailID})
+		}
+	}
+
+	sort.Strings(r.DanglingEdges)
+	sort.Strings(r.AllowedDanglingEdges)
+	sort.Strings(r.StaleParagraphs)
+	sortNodeLinks(r.StaleNodeLinks)
+	sort.Slice(r.OrphanDetails, func(i, j int) bool {
+		a, b := r.OrphanDetails[i], r.OrphanDetails[j]
+		return a.ParagraphID < b.ParagraphID || (a.ParagraphID == b.ParagraphID && a.DetailID < b.DetailID)
+	})
+	return r
+}
+
+// applyRepair drops dangling edges, prunes stale map entries and deletes orphan details.
+func applyRepair(ctx context.Context, storyID string, snap storySnapshot, r consistencyReport) error {
+	for _, edgeID := range r.DanglingEdges {
+		if _, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(tableName),
+			Key:       keySchema.Key(storyID, edgeID),
+		}); err != nil {
+			return err
+		}
+	}
+	if len(r.StaleNodeLinks) > 0 || len(r.StaleParagraphs) > 0 {
+		drop := map[nodeLink]bool{}
+		for _, l := range r.StaleNodeLinks {
+			drop[l] = true
+		}
+		stale := map[string]bool{}
+		for _, pid := range r.StaleParagraphs {
+			stale[pid] = true
+		}
+		pnm := map[string][]string{}
+		for pid, nids := range snap.full.Story.ParagraphNodeMap {
+			if stale[pid] {
+				continue
+			}
+			kept := []string{}
+			for _, nid := range nids {
+				if !drop[nodeLink{pid, nid}] {
+					kept = append(kept, nid)
+				}
+			}
+			pnm[pid] = kept
+		}
+		if err := storySvc.SetParagraphNodeMap(ctx, storyID, pnm); err != nil {
+			return err
+		}
+	}
+	for _, d := range r.OrphanDetails {
+		if err := storySvc.DeleteDetail(ctx, storyID, d.ParagraphID, d.DetailID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repairHandler reports data drift in a story; ?apply=true also fixes it and
+// reports the state afterwards.
+// Route: POST /api/stories/{storyId}/repair
+func repairHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	snap, found, err := loadSnapshot(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Repair scan of %s failed: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	if !found {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "Story not found"}, nil
+	}
+
+	before := checkConsistency(snap)
+	out := struct {
+		StoryID string             `json:"storyId"`
+		Applied bool               `json:"applied"`
+		Before  consistencyReport  `json:"before"`
+		After   *consistencyReport `json:"after,omitempty"`
+	}{StoryID: storyID, Before: before}
+
+	if req.QueryStringParameters["apply"] == "true" && !before.clean() {
+		if err := applyRepair(ctx, storyID, snap, before); err != nil {
+			log.Printf("❌ Repair of %s failed: %v", storyID, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to repair story"}, nil
+		}
+		log.Printf("✅ Repaired %s: %d edges, %d links, %d paragraphs, %d details", storyID,
+			len(before.DanglingEdges), len(before.StaleNodeLinks), len(before.StaleParagraphs), len(before.OrphanDetails))
+		notifyGraphChange(ctx, storyapi.EventGraphUpdated, storyID)
+		out.Applied = true
+		snap, _, err = loadSnapshot(ctx, storyID)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+		}
+		after := checkConsistency(snap)
+		out.After = &after
+	}
+
+	body, _ := json.Marshal(out)
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func TestRepairReportsAndFixesDrift(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	const storyID = "story-repair"
+
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: `{"story":{"storyId":"story-repair","schoolId":"s","title":"Repair"},
+		"paragraphs":[{"index":1,"title":"One","bodyMd":"x"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-repair","nodes":[{"id":"n1"},{"id":"n2"}],"edges":[{"id":"e1","from":"n1","to":"n2"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	full, err := storySvc.GetFullStory(ctx, storyID)
+	if err != nil {
+		t.Fatalf("get story: %v", err)
+	}
+	pid := full.Paragraphs[0].ParagraphID
+
+	// Seed one of each inconsistency behind the handlers' backs.
+	dangling, _ := attributevalue.MarshalMap(DBItem{ID: "e2", StoryID: storyID, From: "n1", To: "n-deleted"})
+	if _, err := svc.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: keySchema.ToItem(dangling)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storySvc.SetParagraphNodeMap(ctx, storyID, map[string][]string{pid: {"n1", "n-deleted"}, "para-gone": {"n2"}}); err != nil {
+		t.Fatal(err)
+	}
+	// The detail handler refuses unknown paragraphs, so write the orphan directly.
+	orphan, _ := attributevalue.MarshalMap(map[string]interface{}{
+		"storyId": "STORY#" + storyID, "id": "DET#para-gone#det-lost", "detailId": "det-lost",
+		"paragraphId": "para-gone", "kind": "quote", "transcriptId": "t1", "text": "lost",
+	})
+	if _, err := svc.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: keySchema.ToItem(orphan)}); err != nil {
+		t.Fatal(err)
+	}
+
+	type report struct {
+		Applied bool               `json:"applied"`
+		Before  consistencyReport  `json:"before"`
+		After   *consistencyReport `json:"after"`
+	}
+	repair := func(apply bool) report {
+		t.Helper()
+		req := events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": storyID}}
+		if apply {
+			req.QueryStringParameters = map[string]string{"apply": "true"}
+		}
+		resp, _ := repairHandler(ctx, req)
+		if resp.StatusCode != 200 {
+			t.Fatalf("repair: %d %s", resp.StatusCode, resp.Body)
+		}
+		var r report
+		if err := json.Unmarshal([]byte(resp.Body), &r); err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+		return r
+	}
+
+	want := consistencyReport{
+		DanglingEdges:        []string{"e2"},
+		AllowedDanglingEdges: []string{},
+		StaleNodeLinks:       []nodeLink{{pid, "n-deleted"}},
+		StaleParagraphs:      []string{"para-gone"},
+		OrphanDetails:        []detailRef{{"para-gone", "det-lost"}},
+	}
+	dry := repair(false)
+	if dry.Applied || dry.After != nil || !reflect.DeepEqual(dry.Before, want) {
+		t.Fatalf("dry run report = %+v, want before %+v", dry, want)
+	}
+	if _, edges, _ := loadGraph(ctx, storyID); len(edges) != 2 {
+		t.Fatalf("dry run changed the graph: %d edges", len(edges))
+	}
+
+	applied := repair(true)
+	if !applied.Applied || !reflect.DeepEqual(applied.Before, want) || applied.After == nil || !applied.After.clean() {
+		t.Fatalf("apply report = %+v", applied)
+	}
+	_, edges, _ := loadGraph(ctx, storyID)
+	if len(edges) != 1 || edges[0].ID != "e1" {
+		t.Fatalf("expected only e1 to remain, got %+v", edges)
+	}
+	full, _ = storySvc.GetFullStory(ctx, storyID)
+	if !reflect.DeepEqual(full.Story.ParagraphNodeMap, map[string][]string{pid: {"n1"}}) {
+		t.Fatalf("paragraphNodeMap not pruned: %v", full.Story.ParagraphNodeMap)
+	}
+	if len(full.DetailsByParagraph["para-gone"]) != 0 {
+		t.Fatalf("orphan detail survived: %+v", full.DetailsByParagraph)
+	}
+
+	if resp, _ := repairHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "nope"}}); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for unknown story, got %d", resp.StatusCode)
+	}
+}
+
+func TestRebuildNodeMapFromEvidence(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	const storyID = "story-rebuild"
+
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: `{"story":{"storyId":"story-rebuild","schoolId":"s","title":"Rebuild"},
+		"paragraphs":[{"index":1,"title":"One","bodyMd":"x"},{"index":2,"title":"Two","bodyMd":"y"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	full, err := storySvc.GetFullStory(ctx, storyID)
+	if err != nil {
+		t.Fatalf("get story: %v", err)
+	}
+	p1, p2 := full.Paragraphs[0].ParagraphID, full.Paragraphs[1].ParagraphID
+	submit := `{"storyId":"story-rebuild","nodes":[
+		{"id":"n1","evidence":["` + p1 + `","` + p2 + `"]},
+		{"id":"n2","evidence":["` + p2 + `","para-gone"]},
+		{"id":"n3"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: submit}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	// A layout save sends positions only; the evidence must survive it.
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-rebuild","nodes":[{"id":"n1","x":40,"y":40},{"id":"n2","x":80,"y":40}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("layout save failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	// Drift: n1 lost its p2 link, n2 is linked to the wrong paragraph. n3 has
+	// no evidence, so its hand-made link must survive.
+	if err := storySvc.SetParagraphNodeMap(ctx, storyID, map[string][]string{p1: {"n1", "n2", "n3"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		Applied         bool                `json:"applied"`
+		NodeMap         map[string][]string `json:"paragraphNodeMap"`
+		Diff            nodeMapDiff         `json:"diff"`
+		UnknownEvidence []nodeLink          `json:"unknownEvidence"`
+	}
+	rebuild := func(apply bool) result {
+		t.Helper()
+		req := events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": storyID}}
+		if apply {
+			req.QueryStringParameters = map[string]string{"apply": "true"}
+		}
+		resp, _ := rebuildNodeMapHandler(ctx, req)
+		if resp.StatusCode != 200 {
+			t.Fatalf("rebuild: %d %s", resp.StatusCode, resp.Body)
+		}
+		var r result
+		if err := json.Unmarshal([]byte(resp.Body), &r); err != nil {
+			t.Fatalf("decode result: %v", err)
+		}
+		return r
+	}
+
+	wantMap := map[string][]string{p1: {"n1", "n3"}, p2: {"n1", "n2"}}
+	wantDiff := nodeMapDiff{
+		Added:   []nodeLink{{p2, "n1"}, {p2, "n2"}},
+		Removed: []nodeLink{{p1, "n2"}},
+	}
+	preview := rebuild(false)
+	if preview.Applied || !reflect.DeepEqual(preview.NodeMap, wantMap) || !reflect.DeepEqual(preview.Diff, wantDiff) {
+		t.Fatalf("preview = %+v, want map %v and diff %+v", preview, wantMap, wantDiff)
+	}
+	if want := []nodeLink{{"para-gone", "n2"}}; !reflect.DeepEqual(preview.UnknownEvidence, want) {
+		t.Fatalf("unknownEvidence = %v, want %v", preview.UnknownEvidence, want)
+	}
+	full, _ = storySvc.GetFullStory(ctx, storyID)
+	if !reflect.DeepEqual(full.Story.ParagraphNodeMap, map[string][]string{p1: {"n1", "n2", "n3"}}) {
+		t.Fatalf("preview changed the stored map: %v", full.Story.ParagraphNodeMap)
+	}
+
+	if applied := rebuild(true); !applied.Applied {
+		t.Fatalf("apply was not applied: %+v", applied)
+	}
+	full, _ = storySvc.GetFullStory(ctx, storyID)
+	if !reflect.DeepEqual(full.Story.ParagraphNodeMap, wantMap) {
+		t.Fatalf("stored map = %v, want %v", full.Story.ParagraphNodeMap, wantMap)
+	}
+	again := rebuild(false)
+	if len(again.Diff.Added) != 0 || len(again.Diff.Removed) != 0 {
+		t.Fatalf("rebuild after apply still drifts: %+v", again.Diff)
+	}
+
+	resp, _ := rebuildNodeMapHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "missing"}})
+	if resp.StatusCode != 404 {
+		t.Fatalf("unknown story: %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestValidateBundleReportsEveryProblem(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	importBody := `{"story":{"storyId":"story-vb","schoolId":"s","title":"VB","paragraphNodeMap":{"para-1":["n1"]}},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins","citations":[{"transcriptId":"t","minutes":[1]}]}],
+		"details":[{"paragraphIndex":1,"kind":"quote","transcriptId":"t","startMinute":1,"endMinute":2,"text":"Zitat"}],
+		"nodes":[{"id":"n1","label":"A"},{"id":"n2","label":"B"}],"edges":[{"from":"n1","to":"n2"}]}`
+	if resp, _ := importStoryHandler(ctx, events.APIGatewayProxyRequest{Body: importBody}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	full, err := storySvc.GetFullStory(ctx, "story-vb")
+	if err != nil {
+		t.Fatalf("full story: %v", err)
+	}
+	nodes, edges, _ := loadGraph(ctx, "story-vb")
+	exported, _ := json.Marshal(storyBundle{StoryFull: *full, Nodes: nodes, Edges: edges})
+
+	validate := func(body string) (int, bundleReport) {
+		t.Helper()
+		resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/api/validate-bundle", Body: body})
+		var report bundleReport
+		if resp.StatusCode == 200 {
+			if err := json.Unmarshal([]byte(resp.Body), &report); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return resp.StatusCode, report
+	}
+	if status, report := validate(string(exported)); status != 200 || !report.Valid || len(report.Problems)+len(report.Warnings) != 0 {
+		t.Fatalf("exported bundle should validate cleanly: %d %+v", status, report)
+	}
+
+	broken := `{"story":{"storyId":"story-vb2","schoolId":"s","title":"","paragraphNodeMap":{"para-1":["ghost"],"para-9":["n1"]}},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins","citations":[{"transcriptId":"","minutes":[1]}]},
+			{"paragraphId":"para-2","index":1,"bodyMd":"Zwei","citations":[]},
+			{"paragraphId":"para-2","index":3,"bodyMd":"Drei","citations":[]}],
+		"detailsByParagraph":{"para-1":[{"detailId":"d1","kind":"note"}],"para-7":[{"detailId":"d2","kind":"quote"}]},
+		"nodes":[{"id":"n1","label":"A","shape":"star","x":999999999},{"id":"n2","label":"B","type":"mystery"},{"id":"n2","label":"B"},{"id":"e2","label":"C"}],
+		"edges":[{"id":"e1","from":"n1","to":"n3"},{"id":"e2","from":"n1","to":"n2","weight":9}]}`
+	status, report := validate(broken)
+	if status != 200 || report.Valid {
+		t.Fatalf("broken bundle should be invalid: %d %+v", status, report)
+	}
+	for _, want := range []string{"story.title", "duplicate paragraph index 1", "citations require transcriptId", "detail d1", "shape \"star\"", "Edge n1->n2 weight",
+		"Node id n2 appears more than once", "Node id e2 is also the id of an edge"} {
+		found := false
+		for _, p := range report.Problems {
+			found = found || strings.Contains(p, want)
+		}
+		if !found {
+			t.Errorf("problems lack %q: %v", want, report.Problems)
+		}
+	}
+	for _, p := range report.Problems {
+		if strings.Contains(p, "paragraphId") {
+			t.Errorf("a repeated paragraphId does not fail the import: %v", report.Problems)
+		}
+	}
+	for _, want := range []string{"coordinates", "unknown type \"mystery\"", "paragraphId para-2 appears more than once"} {
+		found := false
+		for _, w := range report.Warnings {
+			found = found || strings.Contains(w, want)
+		}
+		if !found {
+			t.Errorf("warnings lack %q: %v", want, report.Warnings)
+		}
+	}
+	c := report.Consistency
+	if !reflect.DeepEqual(c.DanglingEdges, []string{"e1"}) || !reflect.DeepEqual(c.StaleParagraphs, []string{"para-9"}) ||
+		!reflect.DeepEqual(c.StaleNodeLinks, []nodeLink{{"para-1", "ghost"}}) || !reflect.DeepEqual(c.OrphanDetails, []detailRef{{"para-7", "d2"}}) {
+		t.Fatalf("consistency wrong: %+v", c)
+	}
+	if _, err := storySvc.GetFullStory(ctx, "story-vb2"); !errors.Is(err, storyapi.ErrStoryNotFound) {
+		t.Fatalf("validation must not write the story: %v", err)
+	}
+
+	if status, _ := validate(`{"story":`); status != 400 {
+		t.Fatalf("malformed bundle should be 400, got %d", status)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type handlerFunc func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// route binds a method and a path pattern to a handler. Pattern segments in
+// braces ("{storyId}") are captured into the request's PathParameters.
+type route struct {
+	method  string
+	pattern string
+	handle  handlerFunc
+}
+
+// routes is the single source of truth for dispatching and for the Allow
+// header on OPTIONS. First match wins, so literal paths precede wildcards.
+var routes = []route{
+	{"POST", "/submit", handler},
+	{"GET", "/struktur/{id}", getHandler},
+	{"POST", "/struktur/{storyId}/positions", updatePositionsHandler},
+	{"POST", "/struktur/{storyId}/retype", retypeHandler},
+	{"DELETE", "/struktur/{storyId}/{nodeId}", withStore(deleteHandler)},
+
+	{"GET", "/api/stories", storyRoute((*storyapi.StoryService).HandleListStories)},
+	{"POST", "/api/stories", storyRoute((*storyapi.StoryService).HandleCreateStory)},
+	{"POST", "/api/stories/import", importStoryHandler},
+	{"POST", "/api/stories/with-graph", createStoryWithGraphHandler},
+	{"PATCH", "/api/stories/{storyId}", storyRoute((*storyapi.StoryService).HandleUpdateStory)},
+	{"DELETE", "/api/stories/{storyId}", deleteStoryHandler},
+	{"POST", "/api/stories/{storyId}/publish", storyRoute((*storyapi.StoryService).HandlePublishStory)},
+	{"POST", "/api/stories/{storyId}/paragraphs", storyRoute((*storyapi.StoryService).HandleCreateParagraph)},
+	{"GET", "/api/stories/{storyId}/full", getFullStoryHandler},
+	{"GET", "/api/stories/{storyId}/reader.md", storyRoute((*storyapi.StoryService).HandleReaderMarkdown)},
+	{"GET", "/api/stories/{storyId}/coverage", storyRoute((*storyapi.StoryService).HandleCoverage)},
+	{"GET", "/api/stories/{storyId}/outline", storyRoute((*storyapi.StoryService).HandleOutline)},
+	{"GET", "/api/stories/{storyId}/unlinked-paragraphs", storyRoute((*storyapi.StoryService).HandleUnlinkedParagraphs)},
+	{"GET", "/api/stories/{storyId}/node-map", storyRoute((*storyapi.StoryService).HandleNodeMap)},
+	{"POST", "/api/stories/{storyId}/repair", repairHandler},
+	{"POST", "/api/stories/{storyId}/rebuild-node-map", rebuildNodeMapHandler},
+	{"POST", "/api/stories/{storyId}/translate-labels", translateLabelsHandler},
+	{"GET", "/api/stories/{storyId}/reader.html", readerHTMLHandler},
+	{"GET", "/api/stories/{storyId}/graph.svg", graphSVGHandler},
+	{"GET", "/api/stories/{storyId}/timeline", timelineHandler},
+	{"GET", "/api/stories/{storyId}/adjacency", adjacencyHandler},
+	{"GET", "/api/stories/{storyId}/graph-versions", graphVersionsHandler},
+	{"DELETE", "/api/stories/{storyId}/graph", clearGraphHandler},
+	{"PATCH", "/api/stories/{storyId}/edges/{edgeId}", updateEdgeHandler},
+	{"DELETE", "/api/stories/{storyId}/edges/{edgeId}", deleteEdgeHandler},
+	{"PATCH", "/api/paragraphs/{paragraphId}", storyRoute((*storyapi.StoryService).HandleUpdateParagraph)},
+	{"GET", "/api/paragraphs/{paragraphId}/history", storyRoute((*storyapi.StoryService).HandleParagraphHistory)},
+	{"GET", "/api/paragraphs/{paragraphId}/details", storyRoute((*storyapi.StoryService).HandleListDetails)},
+	{"POST", "/api/paragraphs/{paragraphId}/details", storyRoute((*storyapi.StoryService).HandleCreateDetail)},
+	{"GET", "/api/schools/{schoolId}/graphs", withStore(schoolGraphsHandler)},
+	{"GET", "/api/schools/{schoolId}/export.zip", withStore(schoolExportZipHandler)},
+	{"GET", "/api/schools/{schoolId}/stories/{slug}", storyRoute((*storyapi.StoryService).HandleGetStoryBySlug)},
+	{"POST", "/api/validate-bundle", validateBundleHandler},
+	{"GET", "/api/transcripts/{transcriptId}/paragraphs", storyRoute((*storyapi.StoryService).HandleTranscriptParagraphs)},
+	{"GET", "/api/admin/stories/{storyId}/items", adminStoryItemsHandler},
+	{"GET", "/api/export/all.ndjson", exportAllNDJSONHandler},
+	{"POST", "/api/graphs/batch", withStore(batchGraphsHandler)},
+	{"GET", "/api/analytics/summary", analyticsSummaryHandler},
+	{"GET", "/api/node-styles", nodeStylesHandler},
+	{"POST", "/api/dev/seed", devSeedHandler},
+	{"GET", "/api/version", versionHandler},
+}
+
+// storyRoute defers the lookup of the global story service to request time.
+func storyRoute(fn func(*storyapi.StoryService, context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)) handlerFunc {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return fn(storySvc, ctx, req)
+	}
+}
+
+// matchPattern reports whether path fits pattern and returns the captured parameters.
+func matchPattern(pattern, path string) (map[string]string, bool) {
+	pp := strings.Split(strings.Trim(pattern, "/"), "/")
+	sp := strings.Split(strings.Trim(path, "/"), "/")
+	if len(pp) != len(sp) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, seg := range pp {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if sp[i] == "" {
+				return nil, false
+			}
+			params[seg[1:len(seg)-1]] = sp[i]
+			continue
+		}
+		if seg != sp[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// findRoute returns the first route matching method and path with its parameters.
+func findRoute(method, path string) (route, map[string]string, bool) {
+	for _, r := range routes {
+		if r.method != method {
+			continue
+		}
+		if params, ok := matchPattern(r.pattern, path); ok {
+			return r, params, true
+		}
+	}
+	return route{}, nil, false
+}
+
+// dispatch runs the first route matching method and path. The story lock is
+// taken before, by lockStory.
+func dispatch(ctx context.Context, req events.APIGatewayProxyRequest, method, path string) (events.APIGatewayProxyResponse, error) {
+	r, params, ok := findRoute(method, path)
+	if !ok {
+		// Node deletes have always answered a path without exactly a story
+		// and a node id with 400; no route is added for them so that OPTIONS
+		// does not advertise DELETE there.
+		if method == "DELETE" && strings.HasPrefix(path, "/struktur/") {
+			return badInput("Invalid path for DELETE"), nil
+		}
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "Not Found"}, nil
+	}
+	req.PathParameters = params
+	return r.handle(ctx, req)
+}
+
+// readOnlyRoutes are the routes besides GETs that write nothing and so take
+// no story lock.
+var readOnlyRoutes = map[string]bool{
+	"POST /api/validate-bundle": true,
+	"POST /api/graphs/batch":    true,
+}
+
+// lockStory takes the lock of the story a write to method and path changes
+// and returns the function that releases it; nil if nothing was locked.
+// lambdaHandler calls it before the request timeout starts the handler, so
+// the lock is released when the invocation returns, after a 504 as well. A
+// non-nil response means the story stayed busy.
+func lockStory(ctx context.Context, req events.APIGatewayProxyRequest, method, path string) (func(), *events.APIGatewayProxyResponse) {
+	r, params, ok := findRoute(method, path)
+	if !ok || r.method == "GET" || readOnlyRoutes[r.method+" "+r.pattern] {
+		return nil, nil
+	}
+	req.PathParameters = params
+	storyID := mutationStoryID(ctx, req)
+	if storyID == "" {
+		return nil, nil
+	}
+	unlock, err := storyLocks.lock(ctx, storyID)
+	if err != nil {
+		return nil, &events.APIGatewayProxyResponse{StatusCode: 503, Headers: corsHeaders(), Body: "Story is busy, try again"}
+	}
+	return unlock, nil
+}
+
+// allowedMethods lists the methods registered for path, OPTIONS included.
+func allowedMethods(path string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, r := range routes {
+		if seen[r.method] {
+			continue
+		}
+		if _, ok := matchPattern(r.pattern, path); ok {
+			seen[r.method] = true
+			out = append(out, r.method)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return append(out, "OPTIONS")
+}
+
+// optionsHandler answers preflight requests with the methods actually routed for the path.
+func optionsHandler(path string) events.APIGatewayProxyResponse {
+	methods := allowedMethods(path)
+	if methods == nil {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "Not Found"}
+	}
+	allow := strings.Join(methods, ",")
+	h := corsHeaders()
+	h["Access-Control-Allow-Methods"] = allow
+	h["Allow"] = allow
+	// Only preflights are cached, so only they carry a max age.
+	h["Access-Control-Max-Age"] = strconv.Itoa(corsMaxAge)
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: ""}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func TestOptionsPreflightSettings(t *testing.T) {
+	setupTestServices()
+	defer func(age int, headers string) { corsMaxAge, corsAllowHeaders = age, headers }(corsMaxAge, corsAllowHeaders)
+	corsMaxAge = 600
+	corsAllowHeaders = allowHeaders("Idempotency-Key, if-match, x-user, ")
+
+	resp, _ := lambdaHandler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "OPTIONS", Path: "/api/stories/s1/full"})
+	if got := resp.Headers["Access-Control-Max-Age"]; got != "600" {
+		t.Fatalf("expected the configured max age, got %q", got)
+	}
+	allowed := strings.Split(resp.Headers["Access-Control-Allow-Headers"], ", ")
+	for _, want := range []string{"Content-Type", "Authorization", "X-User", "X-Api-Version", "Idempotency-Key", "if-match"} {
+		found := 0
+		for _, h := range allowed {
+			if strings.EqualFold(h, want) {
+				found++
+			}
+		}
+		if found != 1 {
+			t.Fatalf("expected %s exactly once in %q", want, allowed)
+		}
+	}
+	if len(allowed) != len(baseAllowHeaders)+2 {
+		t.Fatalf("unexpected allowed headers %q", allowed)
+	}
+	resp, _ = lambdaHandler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/api/stories/s1/full"})
+	if _, ok := resp.Headers["Access-Control-Max-Age"]; ok {
+		t.Fatalf("max age belongs on preflights only: %+v", resp.Headers)
+	}
+}
+
+func TestCORSCredentialsModes(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	defer func(origins map[string]bool) { allowedOrigins = origins }(allowedOrigins)
+	request := func(method, origin string) map[string]string {
+		t.Helper()
+		resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: method, Path: "/api/stories",
+			Headers: map[string]string{"Origin": origin}})
+		return resp.Headers
+	}
+
+	// Wildcard mode: "*" must never be combined with credentials.
+	allowedOrigins = parseOrigins("")
+	for _, method := range []string{"OPTIONS", "GET"} {
+		h := request(method, "https://app.example.org")
+		if h["Access-Control-Allow-Origin"] != "*" {
+			t.Fatalf("%s without ALLOWED_ORIGINS: Allow-Origin %q, want *", method, h["Access-Control-Allow-Origin"])
+		}
+		if _, ok := h["Access-Control-Allow-Credentials"]; ok {
+			t.Fatalf("%s without ALLOWED_ORIGINS sends credentials with a wildcard: %+v", method, h)
+		}
+	}
+
+	// Listed origins are echoed with credentials; others get no Allow-Origin.
+	allowedOrigins = parseOrigins(" https://app.example.org/, ,http://localhost:5173")
+	for _, method := range []string{"OPTIONS", "GET"} {
+		h := request(method, "https://app.example.org")
+		if h["Access-Control-Allow-Origin"] != "https://app.example.org" || h["Access-Control-Allow-Credentials"] != "true" || h["Vary"] != "Origin" {
+			t.Fatalf("%s from a listed origin: %+v", method, h)
+		}
+		h = request(method, "https://evil.example.com")
+		if _, ok := h["Access-Control-Allow-Origin"]; ok {
+			t.Fatalf("%s from an unlisted origin must not be allowed: %+v", method, h)
+		}
+		if _, ok := h["Access-Control-Allow-Credentials"]; ok {
+			t.Fatalf("%s from an unlisted origin must not allow credentials: %+v", method, h)
+		}
+		if h := request(method, ""); h["Access-Control-Allow-Origin"] == "*" {
+			t.Fatalf("%s without Origin fell back to a wildcard: %+v", method, h)
+		}
+	}
+	if h := request("GET", "http://localhost:5173"); h["Access-Control-Allow-Origin"] != "http://localhost:5173" {
+		t.Fatalf("second listed origin not echoed: %+v", h)
+	}
+}
+
+func TestOptionsAllowMethodsPerRoute(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	resp, err := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "OPTIONS", Path: "/api/stories/s1/full"})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("OPTIONS failed: %v status=%d", err, resp.StatusCode)
+	}
+	if got := resp.Headers["Allow"]; got != "GET,OPTIONS" {
+		t.Fatalf("GET-only route advertised %q", got)
+	}
+	if resp.Headers["Access-Control-Allow-Methods"] != resp.Headers["Allow"] {
+		t.Fatalf("Allow and Access-Control-Allow-Methods differ: %+v", resp.Headers)
+	}
+
+	resp, _ = lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "OPTIONS", Path: "/dev/api/stories/s1/edges/e1"})
+	if got := resp.Headers["Allow"]; got != "PATCH,DELETE,OPTIONS" {
+		t.Fatalf("unexpected methods for edge route: %q", got)
+	}
+
+	resp, _ = lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "OPTIONS", Path: "/api/nothing/here"})
+	if resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for unknown path, got %d", resp.StatusCode)
+	}
+}
+
+func TestBase64EncodedRequestBody(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	body := `{"storyId":"story-b64","nodes":[{"id":"n1","label":"Größe"}]}`
+	resp, err := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/submit",
+		Body: base64.StdEncoding.EncodeToString([]byte(body)), IsBase64Encoded: true})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("base64 submit: %d %s %v", resp.StatusCode, resp.Body, err)
+	}
+	nodes, _, err := loadGraph(ctx, "story-b64")
+	if err != nil || len(nodes) != 1 || nodes[0].Label != "Größe" {
+		t.Fatalf("stored nodes = %+v, %v", nodes, err)
+	}
+
+	resp, _ = lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/submit", Body: "not base64!", IsBase64Encoded: true})
+	if resp.StatusCode != 400 || !strings.Contains(resp.Body, "base64") {
+		t.Fatalf("invalid base64 body: %d %s, want 400", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestTrailingSlashRoutesLikeBarePath(t *testing.T) {
+	for _, r := range routes {
+		concrete := r.pattern
+		for strings.Contains(concrete, "{") {
+			start, end := strings.Index(concrete, "{"), strings.Index(concrete, "}")
+			concrete = concrete[:start] + "x" + concrete[end+1:]
+		}
+		for _, raw := range []string{concrete, concrete + "/", "/dev" + concrete + "/"} {
+			got, params, ok := findRoute(r.method, normalizePath(raw))
+			if !ok {
+				t.Errorf("%s %s did not match any route", r.method, raw)
+				continue
+			}
+			want, _, _ := findRoute(r.method, concrete)
+			if got.pattern != want.pattern {
+				t.Errorf("%s %s matched %s, want %s", r.method, raw, got.pattern, want.pattern)
+			}
+			for name, v := range params {
+				if v != "x" {
+					t.Errorf("%s %s captured %s=%q", r.method, raw, name, v)
+				}
+			}
+		}
+	}
+
+	setupTestServices()
+	ctx := context.Background()
+	for _, path := range []string{"/api/stories", "/api/stories/"} {
+		resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: path})
+		if resp.StatusCode != 200 {
+			t.Errorf("GET %s: status %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestPrettyJSONOnRequest(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-pretty","nodes":[{"id":"n1","label":"A"}],"edges":[]}`}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	compact, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/struktur/story-pretty"})
+	if strings.Contains(compact.Body, "\n") {
+		t.Fatalf("default response should be compact: %q", compact.Body)
+	}
+
+	pretty, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/struktur/story-pretty",
+		QueryStringParameters: map[string]string{"pretty": "true"}})
+	if !strings.Contains(pretty.Body, "\n  \"nodes\": [") {
+		t.Fatalf("expected indented JSON, got %q", pretty.Body)
+	}
+	var a, b interface{}
+	if json.Unmarshal([]byte(compact.Body), &a) != nil || json.Unmarshal([]byte(pretty.Body), &b) != nil || !reflect.DeepEqual(a, b) {
+		t.Fatalf("pretty output must carry the same document")
+	}
+
+	svg, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/api/stories/story-pretty/graph.svg",
+		QueryStringParameters: map[string]string{"pretty": "true"}})
+	if !strings.HasPrefix(svg.Body, "<svg") {
+		t.Fatalf("non-JSON responses must pass through unchanged")
+	}
+}
+
+func TestVersionDefaultsToDev(t *testing.T) {
+	setupTestServices()
+	resp, _ := lambdaHandler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/api/version"})
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET /api/version: %d %s", resp.StatusCode, resp.Body)
+	}
+	var got map[string]string
+	if err := json.Unmarshal([]byte(resp.Body), &got); err != nil {
+		t.Fatalf("decode version: %v", err)
+	}
+	want := map[string]string{"version": "dev", "gitCommit": "dev", "builtAt": "dev"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("version = %v, want %v", got, want)
+	}
+}
+
+func TestStoryRoutesInitialiseServiceLazily(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	storySvc = nil
+	storyInitOnce = sync.Once{}
+
+	resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories")
+	if resp.StatusCode != 200 || storySvc == nil {
+		t.Fatalf("expected the service to be built on first use, got %d %s", resp.StatusCode, resp.Body)
+	}
+
+	// Without a client the single attempt fails and the route keeps answering 500.
+	svc, storySvc = nil, nil
+	storyInitOnce = sync.Once{}
+	for i := 0; i < 2; i++ {
+		if resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories"); resp.StatusCode != 500 {
+			t.Fatalf("expected 500 without a client, got %d", resp.StatusCode)
+		}
+	}
+}
+
+func TestKeyedMutex(t *testing.T) {
+	locks := newKeyedMutex()
+	ctx := context.Background()
+
+	unlockA, err := locks.lock(ctx, "a")
+	if err != nil {
+		t.Fatalf("lock a: %v", err)
+	}
+	unlockB, err := locks.lock(ctx, "b")
+	if err != nil {
+		t.Fatalf("another key must not wait: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := locks.lock(waitCtx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a held key to block until the deadline, got %v", err)
+	}
+	unlockA()
+	unlockB()
+	if len(locks.locks) != 0 {
+		t.Fatalf("released keys should be forgotten, got %d", len(locks.locks))
+	}
+}
+
+func TestStoryLeaseSpansInstances(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	// Two instances: separate in-process locks, one table.
+	instance := func(lease time.Duration) *storyLocker {
+		return &storyLocker{local: newKeyedMutex(), lease: lease, retry: time.Millisecond}
+	}
+	a, b := instance(time.Minute), instance(time.Minute)
+
+	unlockA, err := a.lock(ctx, "story-lease")
+	if err != nil {
+		t.Fatalf("lock on a: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := b.lock(waitCtx, "story-lease"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("b should wait for the lease held by a, got %v", err)
+	}
+	if unlockOther, err := b.lock(ctx, "story-other"); err != nil {
+		t.Fatalf("another story must not wait: %v", err)
+	} else {
+		unlockOther()
+	}
+	unlockA()
+	unlockB, err := b.lock(ctx, "story-lease")
+	if err != nil {
+		t.Fatalf("b should get the released lease: %v", err)
+	}
+	unlockB()
+
+	// An expired lease is taken over, and its old owner cannot delete the
+	// new owner's lease.
+	expired := instance(-time.Minute)
+	unlockExpired, err := expired.lock(ctx, "story-lease")
+	if err != nil {
+		t.Fatalf("lock with expired lease: %v", err)
+	}
+	unlockB, err = b.lock(ctx, "story-lease")
+	if err != nil {
+		t.Fatalf("expired lease should be taken over: %v", err)
+	}
+	unlockExpired()
+	lease, _ := svc.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(tableName), Key: keySchema.Key(storyLeasePrefix+"story-lease", storyLeaseSortKey)})
+	if lease.Item == nil {
+		t.Fatalf("the old owner released the new owner's lease")
+	}
+	unlockB()
+	if lease, _ := svc.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(tableName), Key: keySchema.Key(storyLeasePrefix+"story-lease", storyLeaseSortKey)}); lease.Item != nil {
+		t.Fatalf("lease left behind after release: %v", lease.Item)
+	}
+}
+
+func TestConcurrentImportAndSubmitStayConsistent(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	for round := 0; round < 10; round++ {
+		storyID := fmt.Sprintf("story-race-%d", round)
+		imports := []string{
+			fmt.Sprintf(`{"story":{"storyId":%q,"schoolId":"s","title":"Race"},"paragraphs":[{"index":1,"bodyMd":"A1"},{"index":2,"bodyMd":"A2"},{"index":3,"bodyMd":"A3"}]}`, storyID),
+			fmt.Sprintf(`{"story":{"storyId":%q,"schoolId":"s","title":"Race"},"paragraphs":[{"index":1,"bodyMd":"B1"},{"index":2,"bodyMd":"B2"}]}`, storyID),
+		}
+		graph := fmt.Sprintf(`{"storyId":%q,"nodes":[{"id":"n1","label":"A"},{"id":"n2","label":"B"}],"edges":[{"from":"n1","to":"n2"}]}`, storyID)
+		var wg sync.WaitGroup
+		for _, body := range imports {
+			wg.Add(1)
+			go func(body string) {
+				defer wg.Done()
+				resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/api/stories/import", Body: body})
+				if resp.StatusCode != 200 {
+					t.Errorf("import failed: %d %s", resp.StatusCode, resp.Body)
+				}
+			}(body)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/submit", Body: graph})
+			if resp.StatusCode != 200 {
+				t.Errorf("submit failed: %d %s", resp.StatusCode, resp.Body)
+			}
+		}()
+		wg.Wait()
+
+		full, err := storySvc.GetFullStory(ctx, storyID)
+		if err != nil {
+			t.Fatalf("round %d: load story: %v", round, err)
+		}
+		// Exactly one import must have won; a mix means they interleaved.
+		var bodies []string
+		for _, p := range full.Paragraphs {
+			bodies = append(bodies, p.BodyMd)
+		}
+		if got := strings.Join(bodies, ","); got != "A1,A2,A3" && got != "B1,B2" {
+			t.Fatalf("round %d: paragraphs from interleaved imports: %s", round, got)
+		}
+		nodes, edges, err := loadGraph(ctx, storyID)
+		if err != nil || len(nodes) != 2 || len(edges) != 1 {
+			t.Fatalf("round %d: expected the submitted graph, got %d nodes, %d edges (%v)", round, len(nodes), len(edges), err)
+		}
+	}
+}
+
+func TestStatusPolicy(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-status","schoolId":"s","title":"T"}`}); resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	cases := []struct {
+		name, method, path, body string
+		query                    map[string]string
+		want                     int
+	}{
+		// 400: the request cannot be read.
+		{"malformed story", "POST", "/api/stories", `{"schoolId":`, nil, 400},
+		{"mistyped field", "POST", "/api/stories", `{"schoolId":1,"title":"T"}`, nil, 400},
+		{"malformed import", "POST", "/api/stories/import", `[`, nil, 400},
+		{"invalid query", "GET", "/api/stories/story-status/full", "", map[string]string{"detailLimit": "0"}, 400},
+		{"missing query", "GET", "/api/paragraphs/p1/details", "", nil, 400},
+		{"malformed submit", "POST", "/submit", `{"nodes":{}}`, nil, 400},
+		{"invalid graph query", "GET", "/struktur/story-status", "", map[string]string{"sortNodes": "color"}, 400},
+		{"node delete without node", "DELETE", "/struktur/story-status", "", nil, 400},
+		// 422: the body was read, its content is not acceptable.
+		{"story without school", "POST", "/api/stories", `{"title":"T"}`, nil, 422},
+		{"import without title", "POST", "/api/stories/import", `{"story":{"schoolId":"s"}}`, nil, 422},
+		{"paragraph index", "POST", "/api/stories/story-status/paragraphs", `{"index":0,"bodyMd":"x"}`, nil, 422},
+		{"citation without transcript", "POST", "/api/stories/story-status/paragraphs", `{"index":1,"bodyMd":"x","citations":[{"minutes":[1]}]}`, nil, 422},
+		{"empty title", "PATCH", "/api/stories/story-status", `{"title":" "}`, nil, 422},
+		{"detail without story", "POST", "/api/paragraphs/p1/details", `{"kind":"quote"}`, nil, 422},
+		{"submit without story", "POST", "/submit", `{"nodes":[]}`, nil, 422},
+		{"empty batch", "POST", "/api/graphs/batch", `{"storyIds":[]}`, nil, 422},
+	}
+	for _, c := range cases {
+		resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: c.method, Path: c.path, Body: c.body, QueryStringParameters: c.query})
+		if resp.StatusCode != c.want {
+			t.Errorf("%s: expected %d, got %d %s", c.name, c.want, resp.StatusCode, resp.Body)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Store covers the story and graph reads and writes most handlers share.
+// Only the routes wrapped in withStore get it as an argument, so a test can
+// call those handlers with a store of its own. Every other handler still
+// works on the table useStore installed (svc, tableName, keySchema and
+// storySvc), so one process serves one table at a time.
+type Store interface {
+	// ListStories returns every story header, sorted by title, then storyId.
+	ListStories(ctx context.Context) ([]storyapi.Story, error)
+	// GetStoryFull returns a story with its paragraphs and details, or
+	// storyapi.ErrStoryNotFound.
+	GetStoryFull(ctx context.Context, storyID string) (*storyapi.StoryFull, error)
+	// SetStoryBundle stores a story as GetStoryFull returns it in place of
+	// the stored one. The graph is not touched.
+	SetStoryBundle(ctx context.Context, full *storyapi.StoryFull) error
+	// GetGraph returns the nodes and edges of a story, empty if it has none.
+	GetGraph(ctx context.Context, storyID string) ([]Node, []Edge, error)
+	// UpsertGraph writes graph items as given, over stored ones with the
+	// same id.
+	UpsertGraph(ctx context.Context, items []DBItem) error
+	// DeleteNode removes one graph item, or fails with errGraphItemNotFound.
+	DeleteNode(ctx context.Context, storyID, nodeID string) error
+}
+
+var errGraphItemNotFound = errors.New("graph item not found")
+
+// tableStore is the Store over one table, DynamoDB or the in-process table
+// of STORE_BACKEND=memory.
+type tableStore struct {
+	db      storyapi.DynamoClient
+	table   string
+	keys    storyapi.KeySchema
+	stories *storyapi.StoryService
+}
+
+// currentStore is the store of the table useStore installed; it changes
+// with the next useStore.
+func currentStore() *tableStore {
+	return &tableStore{db: svc, table: tableName, keys: keySchema, stories: storySvc}
+}
+
+// withStore hands a handler the current store at request time, like
+// storyRoute does with the story service.
+func withStore(fn func(Store, context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)) handlerFunc {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return fn(currentStore(), ctx, req)
+	}
+}
+
+func (t *tableStore) ListStories(ctx context.Context) ([]storyapi.Story, error) {
+	return t.stories.ListStories(ctx)
+}
+
+func (t *tableStore) GetStoryFull(ctx context.Context, storyID string) (*storyapi.StoryFull, error) {
+	return t.stories.GetFullStory(ctx, storyID)
+}
+
+func (t *tableStore) SetStoryBundle(ctx context.Context, full *storyapi.StoryFull) error {
+	return t.stories.PutStoryFull(ctx, full)
+}
+
+// queryItems loads every graph item stored under the storyId partition.
+func (t *tableStore) queryItems(ctx context.Context, storyID string) ([]DBItem, error) {
+	var out []DBItem
+	var startKey map[string]types.AttributeValue
+	legacy := 0
+	for {
+		qres, err := t.db.Query(ctx, &dynamodb.QueryInput{
+			TableName:                aws.String(t.table),
+			KeyConditionExpression:   aws.String(t.keys.PartitionCondition()),
+			ExpressionAttributeNames: t.keys.Names(false),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":sid": &types.AttributeValueMemberS{Value: storyID},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, it := range qres.Items {
+			cur, old, err := normalizeDBItem(t.keys.FromItem(it))
+			if err != nil {
+				log.Printf("❌ Skipping unreadable graph item of %s: %v", storyID, err)
+				continue
+			}
+			if old {
+				legacy++
+			}
+			out = append(out, cur)
+		}
+		if len(qres.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = qres.LastEvaluatedKey
+	}
+	if legacy > 0 {
+		log.Printf("ℹ️ Story %s: normalized %d legacy graph items", storyID, legacy)
+	}
+	return out, nil
+}
+
+func (t *tableStore) GetGraph(ctx context.Context, storyID string) ([]Node, []Edge, error) {
+	items, err := t.queryItems(ctx, storyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Non-nil so that an empty side encodes as [] rather than null.
+	nodes := []Node{}
+	edges := []Edge{}
+	for _, item := range items {
+		if item.IsNode {
+			nodes = append(nodes, Node{
+				ID:        item.ID,
+				Label:     item.Label,
+				Detail:    item.Detail,
+				Type:      item.Type,
+				Time:      item.Time,
+				Color:     item.Color,
+				Shape:     item.Shape,
+				Icon:      item.Icon,
+				X:         item.X,
+				Y:         item.Y,
+				UpdatedBy: item.UpdatedBy,
+				CreatedAt: item.CreatedAt,
+				UpdatedAt: item.Timestamp,
+				Meta:      item.Meta,
+				Evidence:  item.Evidence,
+				LabelI18n: item.LabelI18n,
+			})
+		} else {
+			edges = append(edges, Edge{
+				ID:        item.ID,
+				From:      item.From,
+				To:        item.To,
+				Label:     item.Label,
+				Detail:    item.Detail,
+				Type:      item.Type,
+				UpdatedBy: item.UpdatedBy,
+				Waypoints: item.Waypoints,
+				Directed:  item.Directed,
+				Meta:      item.Meta,
+				Weight:    item.Weight,
+				Dangling:  item.Dangling,
+			})
+		}
+	}
+	return nodes, edges, nil
+}
+
+// UpsertGraph writes every item, also after one failed, and reports all
+// failures together.
+func (t *tableStore) UpsertGraph(ctx context.Context, items []DBItem) error {
+	var errs []error
+	for _, item := range items {
+		av, err := attributevalue.MarshalMap(item)
+		if err == nil {
+			_, err = t.db.PutItem(ctx, &dynamodb.PutItemInput{
+				TableName: aws.String(t.table),
+				Item:      t.keys.ToItem(av),
+			})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", item.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeleteNode deletes under a condition, which turns a delete of an unknown id
+// into errGraphItemNotFound instead of a silent no-op, without a separate read.
+func (t *tableStore) DeleteNode(ctx context.Context, storyID, nodeID string) error {
+	_, err := t.db.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                aws.String(t.table),
+		Key:                      t.keys.Key(storyID, nodeID),
+		ConditionExpression:      aws.String("attribute_exists(#pk)"),
+		ExpressionAttributeNames: t.keys.Names(false),
+	})
+	if storyapi.IsConditionalCheckFailed(err) {
+		return errGraphItemNotFound
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	storyapi "strukturbild/api"
+)
+
+// Values of STORE_BACKEND.
+const (
+	storeDynamo = "dynamo"
+	storeMemory = "memory"
+	// storeHybrid, an in-memory layer in front of DynamoDB, is not offered:
+	// Lambda instances do not share memory, so such a layer would serve
+	// stale graphs after a write elsewhere. The only in-process layer is the
+	// response cache of GET /struktur/{id}, which every change invalidates.
+	storeHybrid = "hybrid"
+)
+
+// newStore returns the table the handlers read and write, chosen by
+// STORE_BACKEND:
+//   - "dynamo" (the default) is DynamoDB, at DYNAMODB_ENDPOINT if set;
+//   - "memory" keeps every item in this process and loses it on exit, for
+//     local development and tests.
+//
+// "hybrid" and anything else is an error rather than a silent fallback to
+// DynamoDB.
+func newStore(ctx context.Context, backend string) (storyapi.DynamoClient, error) {
+	switch strings.ToLower(strings.TrimSpace(backend)) {
+	case "", storeDynamo:
+		return initializeDynamoDB(ctx), nil
+	case storeMemory:
+		log.Println("⚠️ STORE_BACKEND=memory: data is kept in this process only.")
+		return newMemoryDynamo(), nil
+	case storeHybrid:
+		return nil, fmt.Errorf("STORE_BACKEND %q is not supported, use %s", backend, storeDynamo)
+	default:
+		return nil, fmt.Errorf("Unknown STORE_BACKEND %q (supported: %s, %s)", backend, storeDynamo, storeMemory)
+	}
+}
+
+// useStore points the handlers at db: the graph handlers through svc and a
+// story service built for it. main, the tests and the integration tests all
+// install their table this way, so each runs the configuration it sets up.
+func useStore(db storyapi.DynamoClient) error {
+	svc = db
+	return initStoryService()
+}
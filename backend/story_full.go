@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// getFullStoryHandler serves the full story of package api and adds the graph
+// when ?include= names it; the graph lives in its own partition, which the
+// story service does not read. Without ?include= the response is unchanged.
+//
+// Route: GET /api/stories/{storyId}/full?include=paragraphs,details,graph,nodeMap
+func getFullStoryHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	include, err := storyapi.ParseFullStoryInclude(req.QueryStringParameters)
+	if err != nil {
+		return badInput(err.Error()), nil
+	}
+	resp, err := storySvc.HandleGetFullStory(ctx, req)
+	if err != nil || resp.StatusCode != 200 || !include[storyapi.SectionGraph] {
+		return resp, err
+	}
+
+	storyID := req.PathParameters["storyId"]
+	nodes, edges, err := loadGraph(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to load graph of %s for full story: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	result := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(resp.Body), &result); err != nil {
+		return resp, nil
+	}
+	result["nodes"], result["edges"] = nodes, edges
+	body, _ := json.Marshal(result)
+	resp.Body = string(body)
+	return resp, nil
+}
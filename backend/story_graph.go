@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxTransactItems is DynamoDB's limit on items per transaction. The story
+// record and every node and edge have to fit into one.
+const maxTransactItems = 100
+
+// createStoryWithGraphHandler creates a story together with its graph. Both
+// parts are validated before anything is written and then stored in a single
+// transaction, so a failure never leaves a story without its graph or a graph
+// without its story.
+// Route: POST /api/stories/with-graph  {"storyId","schoolId","title","nodes":[...],"edges":[...]}
+func createStoryWithGraphHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var in struct {
+		StoryID  string `json:"storyId"`
+		SchoolID string `json:"schoolId"`
+		Title    string `json:"title"`
+		Nodes    []Node `json:"nodes"`
+		Edges    []Edge `json:"edges"`
+	}
+	if err := storyapi.DecodeJSON(req.Body, &in); err != nil {
+		return badInput(err.Error()), nil
+	}
+	if storySvc == nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Story service not initialised"}, nil
+	}
+
+	storyID, storyPut, err := storySvc.NewStoryPut(ctx, in.StoryID, in.SchoolID, in.Title)
+	var lengthErr *storyapi.LengthError
+	switch {
+	case errors.Is(err, storyapi.ErrStoryIncomplete):
+		return unprocessable(err.Error()), nil
+	case errors.As(err, &lengthErr):
+		return unprocessable(err.Error()), nil
+	case err != nil:
+		log.Printf("❌ Failed to prepare story: %v", err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to prepare story"}, nil
+	}
+
+	// Every node is new to a new story: ?create=true turns ids already stored
+	// under this storyId into a 409 instead of a silent merge.
+	graphReq := req
+	graphReq.QueryStringParameters = map[string]string{"create": "true"}
+	for k, v := range req.QueryStringParameters {
+		if k != "create" {
+			graphReq.QueryStringParameters[k] = v
+		}
+	}
+	sb := Strukturbild{StoryID: storyID, Nodes: in.Nodes, Edges: in.Edges}
+	plan, rejected := planSubmit(ctx, graphReq, &sb, false)
+	if plan == nil {
+		return rejected, nil
+	}
+	if n := 1 + len(plan.items); n > maxTransactItems {
+		return unprocessable(fmt.Sprintf("Story and graph need %d writes (limit %d)", n, maxTransactItems)), nil
+	}
+
+	writes := []types.TransactWriteItem{{Put: storyPut}}
+	for _, item := range plan.items {
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			log.Printf("❌ Failed to marshal item: %v", err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to marshal graph"}, nil
+		}
+		writes = append(writes, types.TransactWriteItem{Put: &types.Put{
+			TableName: aws.String(tableName),
+			Item:      keySchema.ToItem(av),
+		}})
+	}
+	_, err = svc.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+	if storyapi.IsConditionalCheckFailed(err) {
+		return events.APIGatewayProxyResponse{StatusCode: 409, Headers: corsHeaders(), Body: fmt.Sprintf("Story %s already exists", storyID)}, nil
+	}
+	if err != nil {
+		log.Printf("❌ Failed to write story %s with graph: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to save story"}, nil
+	}
+
+	log.Printf("✅ Created story %s with %d nodes and %d edges", storyID, len(in.Nodes), len(in.Edges))
+	storySvc.NotifyChange(ctx, storyapi.EventStoryCreated, storyID)
+	notifyGraphChange(ctx, storyapi.EventGraphUpdated, storyID)
+
+	result := map[string]interface{}{
+		"storyId": storyID,
+		"nodes":   plan.nodeCount,
+		"edges":   plan.edgeCount,
+	}
+	if plan.autoCreate {
+		if plan.autoCreated == nil {
+			plan.autoCreated = []string{}
+		}
+		result["autoCreatedNodes"] = plan.autoCreated
+	}
+	if plan.allowDangling {
+		result["danglingEdges"] = plan.dangling
+	}
+	body, _ := json.Marshal(result)
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	h["Location"] = storyapi.StoryLocation(storyID)
+	h["Link"] = fmt.Sprintf("<%s>; rel=\"related\"", storyapi.GraphLocation(storyID))
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
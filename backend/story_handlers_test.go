@@ -3,9 +3,20 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	storyapi "strukturbild/api"
 )
 
@@ -58,6 +69,54 @@ func TestStoryCreateParagraphAndFetch(t *testing.T) {
 	}
 }
 
+func TestParagraphCitationsSerializeAsEmptyArray(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	resp, err := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-cite","schoolId":"rychenberg","title":"Citations"}`})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %v status=%d", err, resp.StatusCode)
+	}
+	resp, err = storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{Body: `{"index":1,"bodyMd":"No citations"}`,
+		PathParameters: map[string]string{"storyId": "story-cite"}})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("create paragraph failed: %v status=%d", err, resp.StatusCode)
+	}
+	resp, err = storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{Body: `{"index":2,"bodyMd":"Null citations","citations":null}`,
+		PathParameters: map[string]string{"storyId": "story-cite"}})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("create paragraph failed: %v status=%d", err, resp.StatusCode)
+	}
+	var created map[string]string
+	if err := json.Unmarshal([]byte(resp.Body), &created); err != nil {
+		t.Fatalf("unmarshal paragraph response: %v", err)
+	}
+	resp, err = storySvc.HandleUpdateParagraph(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-cite","bodyMd":"Still none"}`,
+		PathParameters: map[string]string{"paragraphId": created["id"]}})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("update paragraph failed: %v status=%d body=%s", err, resp.StatusCode, resp.Body)
+	}
+
+	importJSON := `{"story":{"storyId":"story-cite-import","schoolId":"rychenberg","title":"Imported"},"paragraphs":[{"index":1,"bodyMd":"No citations"}]}`
+	resp, err = storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: importJSON})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("import failed: %v status=%d", err, resp.StatusCode)
+	}
+
+	for storyID, want := range map[string]int{"story-cite": 2, "story-cite-import": 1} {
+		resp, err = storySvc.HandleGetFullStory(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": storyID}})
+		if err != nil || resp.StatusCode != 200 {
+			t.Fatalf("get full story %s failed: %v status=%d", storyID, err, resp.StatusCode)
+		}
+		if strings.Contains(resp.Body, `"citations":null`) {
+			t.Fatalf("%s: citations serialized as null: %s", storyID, resp.Body)
+		}
+		if got := strings.Count(resp.Body, `"citations":[]`); got != want {
+			t.Fatalf("%s: expected %d empty citation arrays, got %d: %s", storyID, want, got, resp.Body)
+		}
+	}
+}
+
 func TestUpdateParagraphReorder(t *testing.T) {
 	setupTestServices()
 	ctx := context.Background()
@@ -93,15 +152,16 @@ func TestUpdateParagraphReorder(t *testing.T) {
 	}
 	body, _ := json.Marshal(patchPayload)
 	patchReq := events.APIGatewayProxyRequest{
-		Body:           string(body),
-		PathParameters: map[string]string{"paragraphId": target.ParagraphID},
+		Body:                  string(body),
+		PathParameters:        map[string]string{"paragraphId": target.ParagraphID},
+		QueryStringParameters: map[string]string{"swap": "true"},
 	}
 	resp, err := storySvc.HandleUpdateParagraph(ctx, patchReq)
 	if err != nil || resp.StatusCode != 200 {
 		t.Fatalf("patch failed: %v status=%d", err, resp.StatusCode)
 	}
 
-	// swap second paragraph to index 1 to simulate reorder conflict resolution
+	// the swap already moved the second paragraph to index 1; repeating it is a no-op
 	other := full.Paragraphs[1]
 	patchPayload = map[string]interface{}{
 		"storyId": storyID,
@@ -131,6 +191,38 @@ func TestUpdateParagraphReorder(t *testing.T) {
 	}
 }
 
+func TestCreateParagraphNeedsReadableStory(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	para := func(storyID string) events.APIGatewayProxyResponse {
+		t.Helper()
+		resp, _ := storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"storyId": storyID}, Body: `{"index":1,"bodyMd":"Eins"}`})
+		return resp
+	}
+	if resp := para("missing"); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for an unknown story, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-para","schoolId":"s","title":"P"}`}); resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	// Without the story the paragraph limit cannot be checked.
+	mem := svc.(*memoryDynamo)
+	if err := useStore(failingQueryDynamo{mem}); err != nil {
+		t.Fatal(err)
+	}
+	resp := para("story-para")
+	if err := useStore(mem); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 500 {
+		t.Fatalf("expected 500 when the story cannot be read, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if n := len(mem.items["STORY#story-para"]); n != 1 {
+		t.Fatalf("paragraph written without a limit check: %d items", n)
+	}
+}
+
 func TestImportStory(t *testing.T) {
 	setupTestServices()
 	ctx := context.Background()
@@ -207,22 +299,22 @@ func TestListStories(t *testing.T) {
 		}
 	}
 
-	resp, err := storySvc.HandleListStories(ctx, events.APIGatewayProxyRequest{})
+	resp, err := storySvc.HandleListStories(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"includeDrafts": "true"}})
 	if err != nil || resp.StatusCode != 200 {
 		t.Fatalf("list stories failed: %v status=%d", err, resp.StatusCode)
 	}
 
 	var payload struct {
-		Stories []storyapi.Story `json:"stories"`
+		Items []storyapi.Story `json:"items"`
 	}
 	if err := json.Unmarshal([]byte(resp.Body), &payload); err != nil {
 		t.Fatalf("unmarshal list response: %v", err)
 	}
-	if len(payload.Stories) != len(stories) {
-		t.Fatalf("expected %d stories, got %d", len(stories), len(payload.Stories))
+	if len(payload.Items) != len(stories) {
+		t.Fatalf("expected %d stories, got %d", len(stories), len(payload.Items))
 	}
 	ids := make(map[string]bool)
-	for _, s := range payload.Stories {
+	for _, s := range payload.Items {
 		ids[s.StoryID] = true
 	}
 	for _, expected := range stories {
@@ -349,7 +441,7 @@ func TestHandleStoryRoutesWithStagePrefix(t *testing.T) {
 		t.Fatalf("failed to seed story: %v status=%d", err, createResp.StatusCode)
 	}
 
-	resp, err := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/dev/api/stories")
+	resp, err := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"includeDrafts": "true"}}, "GET", "/dev/api/stories")
 	if err != nil {
 		t.Fatalf("handleStoryRoutes returned error: %v", err)
 	}
@@ -358,12 +450,1999 @@ func TestHandleStoryRoutesWithStagePrefix(t *testing.T) {
 	}
 
 	var payload struct {
-		Stories []storyapi.Story `json:"stories"`
+		Items []storyapi.Story `json:"items"`
 	}
 	if err := json.Unmarshal([]byte(resp.Body), &payload); err != nil {
 		t.Fatalf("failed to parse response: %v", err)
 	}
-	if len(payload.Stories) == 0 {
+	if len(payload.Items) == 0 {
 		t.Fatalf("expected at least one story in response")
 	}
 }
+
+func TestImportStoryOverParagraphLimit(t *testing.T) {
+	setupTestServices()
+	storySvc.SetMaxParagraphs(2)
+	ctx := context.Background()
+
+	importJSON := `{
+  "story": { "storyId": "story-limit", "schoolId": "rychenberg", "title": "Limit" },
+  "paragraphs": [
+    { "index": 1, "bodyMd": "One", "citations": [] },
+    { "index": 2, "bodyMd": "Two", "citations": [] },
+    { "index": 3, "bodyMd": "Three", "citations": [] }
+  ]
+}`
+	resp, err := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: importJSON})
+	if err != nil {
+		t.Fatalf("import returned error: %v", err)
+	}
+	if resp.StatusCode != 422 {
+		t.Fatalf("expected 422 over the paragraph limit, got %d body=%s", resp.StatusCode, resp.Body)
+	}
+
+	storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-limit","schoolId":"s","title":"Limit"}`})
+	for i := 1; i <= 2; i++ {
+		body, _ := json.Marshal(map[string]interface{}{"index": i, "bodyMd": "p", "citations": []storyapi.Citation{}})
+		resp, _ = storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{Body: string(body), PathParameters: map[string]string{"storyId": "story-limit"}})
+		if resp.StatusCode != 200 {
+			t.Fatalf("paragraph %d should be accepted, got %d", i, resp.StatusCode)
+		}
+	}
+	resp, _ = storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{Body: `{"index":3,"bodyMd":"p","citations":[]}`, PathParameters: map[string]string{"storyId": "story-limit"}})
+	if resp.StatusCode != 422 {
+		t.Fatalf("expected 422 for third paragraph, got %d", resp.StatusCode)
+	}
+}
+
+func TestReaderMarkdown(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	importJSON := `{
+  "story": { "storyId": "story-reader", "schoolId": "rychenberg", "title": "Reader" },
+  "paragraphs": [
+    { "index": 2, "title": "Second", "bodyMd": "Zwei", "citations": [{ "transcriptId":"t1", "minutes":[3] }] },
+    { "index": 1, "title": "First", "bodyMd": "Eins", "citations": [] }
+  ],
+  "details": [
+    { "paragraphIndex": 2, "kind": "quote", "transcriptId": "t1", "startMinute": 3, "endMinute": 4, "text": "Ein Zitat" }
+  ]
+}`
+	if resp, err := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: importJSON}); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("import failed: %v status=%d", err, resp.StatusCode)
+	}
+
+	resp, err := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/story-reader/reader.md")
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("reader.md failed: %v status=%d body=%s", err, resp.StatusCode, resp.Body)
+	}
+	if !strings.HasPrefix(resp.Headers["Content-Type"], "text/markdown") {
+		t.Fatalf("unexpected content type: %s", resp.Headers["Content-Type"])
+	}
+	md := resp.Body
+	first, second := strings.Index(md, "## First"), strings.Index(md, "## Second")
+	if first < 0 || second < 0 || first > second {
+		t.Fatalf("paragraph headings missing or out of order:\n%s", md)
+	}
+	if !strings.Contains(md, "> Ein Zitat") {
+		t.Fatalf("quote not rendered as blockquote:\n%s", md)
+	}
+	if !strings.Contains(md, "Zwei[^1]") || !strings.Contains(md, "[^1]: t1, min. 3") {
+		t.Fatalf("citation footnote missing:\n%s", md)
+	}
+
+	if resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/missing/reader.md"); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for unknown story, got %d", resp.StatusCode)
+	}
+	mem := svc.(*memoryDynamo)
+	if err := useStore(failingQueryDynamo{mem}); err != nil {
+		t.Fatal(err)
+	}
+	defer useStore(mem)
+	if resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/story-reader/reader.md"); resp.StatusCode != 500 {
+		t.Fatalf("expected 500 when the story cannot be read, got %d", resp.StatusCode)
+	}
+}
+
+func TestCustomKeySchema(t *testing.T) {
+	setupTestServices()
+	keySchema = storyapi.KeySchema{PartitionKey: "pk", SortKey: "sk"}
+	storySvc.SetKeySchema(keySchema)
+	defer func() { keySchema = storyapi.DefaultKeySchema }()
+	ctx := context.Background()
+
+	resp, err := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-keys","schoolId":"s","title":"Keys"}`})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %v status=%d", err, resp.StatusCode)
+	}
+	graph := `{"storyId":"story-keys","nodes":[{"id":"n1","label":"A"}],"edges":[{"from":"n1","to":"n1","label":"loop"}]}`
+	if resp, err := handler(ctx, events.APIGatewayProxyRequest{Body: graph}); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %v status=%d", err, resp.StatusCode)
+	}
+
+	mem := svc.(*memoryDynamo)
+	for pk, bucket := range mem.items {
+		for sk, item := range bucket {
+			if _, ok := item["storyId"]; ok {
+				t.Fatalf("item %s/%s still uses the logical partition key name", pk, sk)
+			}
+			if getStringAttr(item["pk"]) != pk || getStringAttr(item["sk"]) != sk {
+				t.Fatalf("item %s/%s not stored under configured key names: %+v", pk, sk, item)
+			}
+		}
+	}
+
+	listResp, _ := storySvc.HandleListStories(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"includeDrafts": "true"}})
+	if !strings.Contains(listResp.Body, "story-keys") {
+		t.Fatalf("story missing from list: %s", listResp.Body)
+	}
+	getResp, _ := getHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": "story-keys"}})
+	var sb Strukturbild
+	if err := json.Unmarshal([]byte(getResp.Body), &sb); err != nil {
+		t.Fatalf("decode graph: %v", err)
+	}
+	if len(sb.Nodes) != 1 || len(sb.Edges) != 1 || sb.Story == nil {
+		t.Fatalf("round trip with custom keys failed: %+v", sb)
+	}
+}
+
+func TestDecodeErrorsNameFieldAndPosition(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: "{\n  \"schoolId\": \"s\",\n  \"title\": x\n}"})
+	if resp.StatusCode != 400 {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(resp.Body, "line 3, column 12") {
+		t.Fatalf("syntax error should carry line/column: %s", resp.Body)
+	}
+
+	resp, _ = storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{
+		Body:           `{"index":"one","bodyMd":"x"}`,
+		PathParameters: map[string]string{"storyId": "s"},
+	})
+	if resp.StatusCode != 400 {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(resp.Body, `field \"index\" must be int`) || !strings.Contains(resp.Body, "line 1") {
+		t.Fatalf("type error should name the field: %s", resp.Body)
+	}
+
+	sresp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"s","nodes":[{"id":"a","x":"left"}]}`})
+	if sresp.StatusCode != 400 || !strings.Contains(sresp.Body, `field "nodes.`) || !strings.Contains(sresp.Body, `x" must be int`) {
+		t.Fatalf("submit should name the nested field: %d %s", sresp.StatusCode, sresp.Body)
+	}
+}
+
+func TestDraftVisibilityAndPublish(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-draft","schoolId":"s","title":"Draft"}`})
+
+	list := func(includeDrafts bool) []storyapi.Story {
+		req := events.APIGatewayProxyRequest{}
+		if includeDrafts {
+			req.QueryStringParameters = map[string]string{"includeDrafts": "true"}
+		}
+		resp, _ := storySvc.HandleListStories(ctx, req)
+		var payload struct {
+			Items []storyapi.Story `json:"items"`
+		}
+		if err := json.Unmarshal([]byte(resp.Body), &payload); err != nil {
+			t.Fatalf("unmarshal list response: %v", err)
+		}
+		return payload.Items
+	}
+
+	if got := list(false); len(got) != 0 {
+		t.Fatalf("draft should be hidden by default, got %+v", got)
+	}
+	if got := list(true); len(got) != 1 || got[0].Status != storyapi.StoryStatusDraft {
+		t.Fatalf("draft should be listed with includeDrafts, got %+v", got)
+	}
+
+	resp, err := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "POST", "/api/stories/story-draft/publish")
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("publish failed: %v status=%d body=%s", err, resp.StatusCode, resp.Body)
+	}
+	if got := list(false); len(got) != 1 || got[0].Status != storyapi.StoryStatusPublished {
+		t.Fatalf("published story should be listed, got %+v", got)
+	}
+
+	resp, _ = handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "POST", "/api/stories/missing/publish")
+	if resp.StatusCode != 404 {
+		t.Fatalf("expected 404 publishing unknown story, got %d", resp.StatusCode)
+	}
+}
+
+func TestUpdatedByIsPersistedAndReturned(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	asAlice := map[string]string{"X-User": "alice"}
+
+	resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/api/stories", Headers: asAlice,
+		Body: `{"storyId":"story-actor","schoolId":"s","title":"Actor"}`})
+	if resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ = lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/api/stories/story-actor/paragraphs", Headers: asAlice,
+		Body: `{"index":1,"bodyMd":"Eins","citations":[]}`})
+	if resp.StatusCode != 200 {
+		t.Fatalf("create paragraph failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	submit := events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/submit",
+		Body: `{"storyId":"story-actor","nodes":[{"id":"n1","label":"A"}],"edges":[]}`}
+	submit.RequestContext.Authorizer = map[string]interface{}{"claims": map[string]interface{}{"email": "bob@example.org"}}
+	if resp, _ = lambdaHandler(ctx, submit); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, _ = lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/struktur/story-actor"})
+	var got Strukturbild
+	if err := json.Unmarshal([]byte(resp.Body), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Story == nil || got.Story.UpdatedBy != "alice" {
+		t.Errorf("story updatedBy not returned: %+v", got.Story)
+	}
+	if len(got.Paragraphs) != 1 || got.Paragraphs[0].UpdatedBy != "alice" {
+		t.Errorf("paragraph updatedBy not returned: %+v", got.Paragraphs)
+	}
+	if len(got.Nodes) != 1 || got.Nodes[0].UpdatedBy != "bob@example.org" {
+		t.Errorf("node updatedBy should come from the authorizer claim: %+v", got.Nodes)
+	}
+}
+
+type recordingDoer struct {
+	requests []*http.Request
+	bodies   []string
+}
+
+func (d *recordingDoer) Do(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	d.requests = append(d.requests, req)
+	d.bodies = append(d.bodies, string(body))
+	return &http.Response{StatusCode: 204, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func TestWebhookOnImport(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	doer := &recordingDoer{}
+	storySvc.SetWebhook("https://hooks.example.org/strukturbild", doer)
+
+	resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{
+		Body: `{"story":{"storyId":"story-hook","schoolId":"s","title":"Hook"},"paragraphs":[]}`,
+	})
+	if resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if len(doer.requests) != 1 {
+		t.Fatalf("expected one webhook call, got %d", len(doer.requests))
+	}
+	if r := doer.requests[0]; r.Method != http.MethodPost || r.URL.String() != "https://hooks.example.org/strukturbild" {
+		t.Fatalf("unexpected webhook request: %s %s", r.Method, r.URL)
+	}
+	var ev storyapi.ChangeEvent
+	if err := json.Unmarshal([]byte(doer.bodies[0]), &ev); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if ev.Type != storyapi.EventStoryImported || ev.StoryID != "story-hook" || ev.At == "" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	// A rejected import must not notify.
+	storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: `{"story":{}}`})
+	if len(doer.requests) != 1 {
+		t.Fatalf("failed import should not dispatch, got %d calls", len(doer.requests))
+	}
+}
+
+func TestImportLargeStoryWritesEveryItem(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	importBody := func(n int, text string) string {
+		var paras, dets []string
+		for i := 1; i <= n; i++ {
+			paras = append(paras, fmt.Sprintf(`{"index":%d,"bodyMd":"%s %d","citations":[]}`, i, text, i))
+			dets = append(dets, fmt.Sprintf(`{"paragraphIndex":%d,"kind":"quote","transcriptId":"t","startMinute":1,"endMinute":2,"text":"%s"}`, i, text))
+		}
+		return fmt.Sprintf(`{"story":{"storyId":"story-big","schoolId":"s","title":"Big"},"paragraphs":[%s],"details":[%s]}`,
+			strings.Join(paras, ","), strings.Join(dets, ","))
+	}
+
+	for _, run := range []struct {
+		n    int
+		text string
+	}{{120, "first"}, {80, "second"}} {
+		resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: importBody(run.n, run.text)})
+		if resp.StatusCode != 200 {
+			t.Fatalf("import %s failed: %d %s", run.text, resp.StatusCode, resp.Body)
+		}
+		full, err := storySvc.GetFullStory(ctx, "story-big")
+		if err != nil {
+			t.Fatalf("get full story: %v", err)
+		}
+		if len(full.Paragraphs) != run.n {
+			t.Fatalf("%s import: expected %d paragraphs, got %d", run.text, run.n, len(full.Paragraphs))
+		}
+		details := 0
+		for _, p := range full.Paragraphs {
+			if !strings.HasPrefix(p.BodyMd, run.text) {
+				t.Fatalf("%s import: stale paragraph %+v", run.text, p)
+			}
+			for _, d := range full.DetailsByParagraph[p.ParagraphID] {
+				if d.Text != run.text {
+					t.Fatalf("%s import: stale detail %+v", run.text, d)
+				}
+				details++
+			}
+		}
+		if details != run.n {
+			t.Fatalf("%s import: expected %d details, got %d", run.text, run.n, details)
+		}
+	}
+}
+
+func TestImportRequireContiguousIndexes(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	contiguous := map[string]string{"requireContiguous": "true"}
+	importWith := func(indexes string, query map[string]string) events.APIGatewayProxyResponse {
+		t.Helper()
+		var paragraphs []string
+		for _, idx := range strings.Split(indexes, ",") {
+			paragraphs = append(paragraphs, `{"index":`+idx+`,"bodyMd":"x"}`)
+		}
+		body := `{"story":{"storyId":"story-contig","schoolId":"s","title":"Contiguous"},"paragraphs":[` + strings.Join(paragraphs, ",") + `]}`
+		resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: body, QueryStringParameters: query})
+		return resp
+	}
+
+	for _, c := range []struct {
+		name, indexes string
+		want          []int
+	}{
+		{"gap", "1,2,4", []int{1, 2, 4}},
+		{"duplicate", "2,1,2", []int{1, 2, 2}},
+		{"late start", "5,6", []int{5, 6}},
+	} {
+		resp := importWith(c.indexes, contiguous)
+		if resp.StatusCode != 422 {
+			t.Fatalf("%s: expected 422, got %d %s", c.name, resp.StatusCode, resp.Body)
+		}
+		var out struct {
+			Error   string `json:"error"`
+			Indexes []int  `json:"indexes"`
+		}
+		if err := json.Unmarshal([]byte(resp.Body), &out); err != nil {
+			t.Fatalf("%s: decode: %v", c.name, err)
+		}
+		if out.Error == "" || !reflect.DeepEqual(out.Indexes, c.want) {
+			t.Fatalf("%s: got %+v, want indexes %v", c.name, out, c.want)
+		}
+	}
+	if _, err := storySvc.GetFullStory(ctx, "story-contig"); err == nil {
+		t.Fatalf("rejected import must not write the story")
+	}
+
+	if resp := importWith("3,1,2", contiguous); resp.StatusCode != 200 {
+		t.Fatalf("contiguous import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp := importWith("1,2,4", nil); resp.StatusCode != 200 {
+		t.Fatalf("gaps are allowed by default, got %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestImportRejectsDuplicateIndex(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	body := `{"story":{"storyId":"story-dup","schoolId":"s","title":"Dup"},
+		"paragraphs":[{"index":1,"bodyMd":"Eins"},{"index":2,"bodyMd":"Zwei"},{"index":2,"bodyMd":"Auch zwei"}],
+		"nodes":[{"id":"n1"}]}`
+	resp, _ := importStoryHandler(ctx, events.APIGatewayProxyRequest{Body: body})
+	if resp.StatusCode != 422 || !strings.Contains(resp.Body, "duplicate paragraph index 2") {
+		t.Fatalf("expected 422 naming index 2, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if _, err := storySvc.GetFullStory(ctx, "story-dup"); !errors.Is(err, storyapi.ErrStoryNotFound) {
+		t.Fatalf("rejected import must not write the story, got %v", err)
+	}
+	if nodes, edges, err := loadGraph(ctx, "story-dup"); err != nil || len(nodes)+len(edges) != 0 {
+		t.Fatalf("rejected import must not write the graph: %v %v %v", nodes, edges, err)
+	}
+}
+
+// headerlessDynamo fails every write of a story record, like an import cut
+// off after its paragraphs.
+type headerlessDynamo struct {
+	*memoryDynamo
+}
+
+func (d headerlessDynamo) PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if sk, ok := input.Item["id"].(*types.AttributeValueMemberS); ok && strings.HasPrefix(sk.Value, "STORY#") {
+		return nil, errors.New("request timed out")
+	}
+	return d.memoryDynamo.PutItem(ctx, input, optFns...)
+}
+
+func TestImportWritesStoryRecordLast(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	mem := svc.(*memoryDynamo)
+	body := `{"story":{"storyId":"story-cut","schoolId":"s","title":"Cut"},
+		"paragraphs":[{"index":1,"bodyMd":"Eins"},{"index":2,"bodyMd":"Zwei"}],
+		"details":[{"paragraphIndex":1,"kind":"quote","transcriptId":"t1","text":"a"}]}`
+	if err := useStore(headerlessDynamo{mem}); err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: body})
+	if err := useStore(mem); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 500 {
+		t.Fatalf("expected 500 for the failed import, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if _, err := storySvc.GetFullStory(ctx, "story-cut"); !errors.Is(err, storyapi.ErrStoryNotFound) {
+		t.Fatalf("a failed import must not list the story, got %v", err)
+	}
+
+	// Repeating the import replaces what the failed one left behind.
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("repeated import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	full, err := storySvc.GetFullStory(ctx, "story-cut")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(full.Paragraphs) != 2 {
+		t.Fatalf("expected 2 paragraphs, got %d", len(full.Paragraphs))
+	}
+	// The story record, two paragraphs and one detail.
+	if n := len(mem.items["STORY#story-cut"]); n != 4 {
+		t.Fatalf("expected 4 items in the story partition, got %d", n)
+	}
+}
+
+func TestFullStoryIncludeProjection(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	body := `{"story":{"storyId":"story-proj","schoolId":"s","title":"Proj","paragraphNodeMap":{"para-1":["n1"]}},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins"}],
+		"details":[{"paragraphIndex":1,"kind":"quote","transcriptId":"t","startMinute":1,"endMinute":2,"text":"Zitat"}],
+		"nodes":[{"id":"n1","label":"A"}]}`
+	if resp, _ := importStoryHandler(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	get := func(include string) (int, map[string]json.RawMessage) {
+		req := events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/api/stories/story-proj/full"}
+		if include != "" {
+			req.QueryStringParameters = map[string]string{"include": include}
+		}
+		resp, _ := lambdaHandler(ctx, req)
+		out := map[string]json.RawMessage{}
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return resp.StatusCode, out
+	}
+	hasNodeMap := func(out map[string]json.RawMessage) bool {
+		var st struct {
+			ParagraphNodeMap map[string][]string `json:"paragraphNodeMap"`
+		}
+		_ = json.Unmarshal(out["story"], &st)
+		return len(st.ParagraphNodeMap) > 0
+	}
+
+	status, out := get("paragraphs")
+	if status != 200 || out["paragraphs"] == nil || out["story"] == nil {
+		t.Fatalf("include=paragraphs: %d %v", status, out)
+	}
+	if out["detailsByParagraph"] != nil || out["nodes"] != nil || hasNodeMap(out) {
+		t.Fatalf("include=paragraphs sent other sections: %v", out)
+	}
+
+	status, out = get("graph")
+	if status != 200 || !strings.Contains(string(out["nodes"]), `"n1"`) || out["edges"] == nil {
+		t.Fatalf("include=graph: %d %v", status, out)
+	}
+	if out["paragraphs"] != nil || out["detailsByParagraph"] != nil || hasNodeMap(out) {
+		t.Fatalf("include=graph sent other sections: %v", out)
+	}
+
+	status, out = get("")
+	if status != 200 || out["paragraphs"] == nil || out["detailsByParagraph"] == nil || !hasNodeMap(out) || out["nodes"] != nil {
+		t.Fatalf("default response changed: %d %v", status, out)
+	}
+
+	if status, _ = get("paragraphs,comments"); status != 400 {
+		t.Fatalf("unknown include should be 400, got %d", status)
+	}
+}
+
+func TestImportFlagsUnknownParagraphNodes(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-pnm","nodes":[{"id":"n1","label":"A"}],"edges":[]}`}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	body := `{"story":{"storyId":"story-pnm","schoolId":"s","title":"PNM","paragraphNodeMap":{"para-1":["n1","ghost"]}},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins","citations":[]}]}`
+
+	resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: body, QueryStringParameters: map[string]string{"strict": "true"}})
+	if resp.StatusCode != 422 || !strings.Contains(resp.Body, "ghost") {
+		t.Fatalf("strict import should reject unknown node, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if _, err := storySvc.GetFullStory(ctx, "story-pnm"); err == nil {
+		t.Fatalf("rejected import must not write the story")
+	}
+
+	resp, _ = storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: body})
+	if resp.StatusCode != 200 {
+		t.Fatalf("lenient import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var out struct {
+		ID       string   `json:"id"`
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "ghost") || strings.Contains(out.Warnings[0], "n1") {
+		t.Fatalf("expected a warning naming only the unknown node, got %+v", out.Warnings)
+	}
+}
+
+func TestListStoriesReadsOnlyStoryHeaders(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	mem := svc.(*memoryDynamo)
+
+	for _, id := range []string{"story-1", "story-2"} {
+		imp := fmt.Sprintf(`{"story":{"storyId":%q,"schoolId":"s","title":%q},
+			"paragraphs":[{"index":1,"bodyMd":"Eins","citations":[]},{"index":2,"bodyMd":"Zwei","citations":[]}],
+			"details":[{"paragraphIndex":1,"kind":"quote","transcriptId":"t","startMinute":1,"endMinute":2,"text":"Zitat"}]}`, id, id)
+		if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: imp}); resp.StatusCode != 200 {
+			t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+		}
+		graph := fmt.Sprintf(`{"storyId":%q,"nodes":[{"id":"n1","label":"A"},{"id":"n2","label":"B"}],"edges":[{"from":"n1","to":"n2"}]}`, id)
+		if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: graph}); resp.StatusCode != 200 {
+			t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+		}
+	}
+
+	storySvc.SetStoryIndex("stories-by-type")
+	mem.itemsRead = 0
+	stories, err := storySvc.ListStories(ctx)
+	if err != nil {
+		t.Fatalf("list stories: %v", err)
+	}
+	if len(stories) != 2 || stories[0].StoryID != "story-1" || stories[1].StoryID != "story-2" {
+		t.Fatalf("unexpected stories: %+v", stories)
+	}
+	if mem.itemsRead != 2 {
+		t.Fatalf("index query should read only the 2 story headers, read %d items", mem.itemsRead)
+	}
+
+	storySvc.SetStoryIndex("")
+	mem.itemsRead = 0
+	if scanned, err := storySvc.ListStories(ctx); err != nil || len(scanned) != 2 {
+		t.Fatalf("scan fallback: %v %+v", err, scanned)
+	}
+	if mem.itemsRead <= 2 {
+		t.Fatalf("scan fallback should examine the whole table, read %d items", mem.itemsRead)
+	}
+}
+
+func TestParagraphHeadingNormalization(t *testing.T) {
+	ctx := context.Background()
+	body := "# Auslöser\n\nErster Abschnitt.\n\n## Hintergrund\nMehr."
+
+	cases := []struct {
+		mode storyapi.HeadingMode
+		want string
+	}{
+		{storyapi.HeadingsKeep, body},
+		{storyapi.HeadingsStrip, "Erster Abschnitt.\n\n## Hintergrund\nMehr."},
+		{storyapi.HeadingsDemote, "### Auslöser\n\nErster Abschnitt.\n\n## Hintergrund\nMehr."},
+	}
+	for _, tc := range cases {
+		setupTestServices()
+		storySvc.SetHeadingMode(tc.mode)
+		payload, _ := json.Marshal(map[string]interface{}{
+			"story":      map[string]string{"storyId": "story-h", "schoolId": "s", "title": "H"},
+			"paragraphs": []map[string]interface{}{{"index": 1, "title": "auslöser", "bodyMd": body, "citations": []string{}}},
+		})
+		if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: string(payload)}); resp.StatusCode != 200 {
+			t.Fatalf("%q: import failed: %d %s", tc.mode, resp.StatusCode, resp.Body)
+		}
+		full, err := storySvc.GetFullStory(ctx, "story-h")
+		if err != nil || len(full.Paragraphs) != 1 {
+			t.Fatalf("%q: get full story: %v", tc.mode, err)
+		}
+		if got := full.Paragraphs[0].BodyMd; got != tc.want {
+			t.Errorf("%q: body = %q, want %q", tc.mode, got, tc.want)
+		}
+	}
+
+	// A leading heading that differs from the title is kept in both modes.
+	for _, mode := range []storyapi.HeadingMode{storyapi.HeadingsStrip, storyapi.HeadingsDemote} {
+		if got := storyapi.NormalizeHeadings("Umsetzung", body, mode); got != body {
+			t.Errorf("%q must only touch a heading matching the title, got %q", mode, got)
+		}
+	}
+}
+
+func TestStoryCoverage(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	imp := `{"story":{"storyId":"story-cov","schoolId":"s","title":"Coverage"},
+		"paragraphs":[
+			{"index":1,"bodyMd":"Eins","citations":[{"transcriptId":"t1","minutes":[2,3]},{"transcriptId":"t2","minutes":[10]}]},
+			{"index":2,"bodyMd":"Zwei","citations":[{"transcriptId":"t1","minutes":[12]}]}
+		],
+		"details":[
+			{"paragraphIndex":1,"kind":"quote","transcriptId":"t1","startMinute":4,"endMinute":6,"text":"a"},
+			{"paragraphIndex":2,"kind":"quote","transcriptId":"t1","startMinute":9,"endMinute":11,"text":"b"}
+		]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: imp}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, _ := dispatch(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/story-cov/coverage")
+	if resp.StatusCode != 200 {
+		t.Fatalf("coverage failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var out struct {
+		Transcripts []storyapi.TranscriptCoverage `json:"transcripts"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(out.Transcripts) != 2 || out.Transcripts[0].TranscriptID != "t1" || out.Transcripts[1].TranscriptID != "t2" {
+		t.Fatalf("unexpected transcripts: %+v", out.Transcripts)
+	}
+	t1 := out.Transcripts[0]
+	wantCovered := []storyapi.MinuteRange{{2, 6}, {9, 12}}
+	if fmt.Sprint(t1.Covered) != fmt.Sprint(wantCovered) || fmt.Sprint(t1.Gaps) != fmt.Sprint([]storyapi.MinuteRange{{7, 8}}) || t1.MinutesCovered != 9 {
+		t.Fatalf("unexpected t1 coverage: %+v", t1)
+	}
+
+	if resp, _ := dispatch(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/missing/coverage"); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for unknown story, got %d", resp.StatusCode)
+	}
+	mem := svc.(*memoryDynamo)
+	if err := useStore(failingQueryDynamo{mem}); err != nil {
+		t.Fatal(err)
+	}
+	defer useStore(mem)
+	if resp, _ := dispatch(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/story-cov/coverage"); resp.StatusCode != 500 {
+		t.Fatalf("expected 500 when the story cannot be read, got %d", resp.StatusCode)
+	}
+}
+
+// stuckScanDynamo hands out the same page and LastEvaluatedKey forever, like a
+// corrupt index.
+type stuckScanDynamo struct {
+	*memoryDynamo
+	scans int
+}
+
+func (d *stuckScanDynamo) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	d.scans++
+	if d.scans > 10 {
+		return nil, fmt.Errorf("scan called %d times", d.scans)
+	}
+	out, err := d.memoryDynamo.Scan(ctx, input, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	out.LastEvaluatedKey = map[string]types.AttributeValue{
+		"storyId": &types.AttributeValueMemberS{Value: "STORY#stuck"},
+		"id":      &types.AttributeValueMemberS{Value: "STORY#stuck"},
+	}
+	return out, nil
+}
+
+func TestListStoriesStopsOnRepeatingKey(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	body := `{"storyId":"story-stuck","schoolId":"school-1","title":"Stuck"}`
+	if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 && resp.StatusCode != 201 {
+		t.Fatalf("create story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	stuck := &stuckScanDynamo{memoryDynamo: svc.(*memoryDynamo)}
+	storySvc, _ = storyapi.NewStoryService(stuck, tableName, corsHeaders)
+	stories, err := storySvc.ListStories(ctx)
+	if err != nil {
+		t.Fatalf("list stories: %v", err)
+	}
+	if len(stories) != 1 || stories[0].StoryID != "story-stuck" {
+		t.Fatalf("unexpected stories: %+v", stories)
+	}
+	if stuck.scans != 2 {
+		t.Fatalf("expected listing to stop after the key repeated, got %d scans", stuck.scans)
+	}
+}
+
+func TestListStoriesPaginationEnvelope(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	for _, id := range []string{"story-a", "story-b", "story-c"} {
+		body := fmt.Sprintf(`{"storyId":%q,"schoolId":"school-1","title":%q}`, id, id)
+		if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode >= 300 {
+			t.Fatalf("create %s failed: %d %s", id, resp.StatusCode, resp.Body)
+		}
+	}
+
+	list := func(query map[string]string) storyapi.ListPage[storyapi.Story] {
+		t.Helper()
+		query["includeDrafts"] = "true"
+		resp, _ := storySvc.HandleListStories(ctx, events.APIGatewayProxyRequest{QueryStringParameters: query})
+		if resp.StatusCode != 200 {
+			t.Fatalf("list %v: %d %s", query, resp.StatusCode, resp.Body)
+		}
+		var page storyapi.ListPage[storyapi.Story]
+		if err := json.Unmarshal([]byte(resp.Body), &page); err != nil {
+			t.Fatalf("decode page: %v", err)
+		}
+		return page
+	}
+
+	first := list(map[string]string{"limit": "2"})
+	if first.Count != 2 || first.Total != 3 || !first.HasMore || first.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+	second := list(map[string]string{"limit": "2", "cursor": first.NextCursor})
+	if second.Count != 1 || second.HasMore || second.NextCursor != "" || second.Items[0].StoryID != "story-c" {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+	if all := list(map[string]string{}); all.Count != 3 || all.HasMore {
+		t.Fatalf("unpaged list should return everything: %+v", all)
+	}
+
+	resp, _ := storySvc.HandleListStories(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"includeDrafts": "true", "legacy": "true"}})
+	var legacy map[string][]storyapi.Story
+	if err := json.Unmarshal([]byte(resp.Body), &legacy); err != nil || len(legacy["stories"]) != 3 {
+		t.Fatalf("legacy shape broken: %v %s", err, resp.Body)
+	}
+
+	if resp, _ := storySvc.HandleListStories(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"limit": "0"}}); resp.StatusCode != 400 {
+		t.Fatalf("expected 400 for limit=0, got %d", resp.StatusCode)
+	}
+}
+
+func TestUpdateParagraphIndexCollision(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-move","schoolId":"s","title":"Move"}`})
+	if resp.StatusCode >= 300 {
+		t.Fatalf("create story: %d %s", resp.StatusCode, resp.Body)
+	}
+	ids := map[int]string{}
+	for i, text := range []string{"One", "Two", "Three"} {
+		resp, _ := storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{
+			Body:           fmt.Sprintf(`{"index":%d,"bodyMd":%q}`, i+1, text),
+			PathParameters: map[string]string{"storyId": "story-move"},
+		})
+		var created map[string]string
+		_ = json.Unmarshal([]byte(resp.Body), &created)
+		ids[i+1] = created["id"]
+	}
+	move := func(paragraphID string, index int, swap bool) events.APIGatewayProxyResponse {
+		req := events.APIGatewayProxyRequest{
+			Body:           fmt.Sprintf(`{"storyId":"story-move","index":%d}`, index),
+			PathParameters: map[string]string{"paragraphId": paragraphID},
+		}
+		if swap {
+			req.QueryStringParameters = map[string]string{"swap": "true"}
+		}
+		resp, _ := storySvc.HandleUpdateParagraph(ctx, req)
+		return resp
+	}
+	order := func() []string {
+		full, err := storySvc.GetFullStory(ctx, "story-move")
+		if err != nil {
+			t.Fatalf("get full story: %v", err)
+		}
+		var out []string
+		for _, p := range full.Paragraphs {
+			out = append(out, fmt.Sprintf("%d:%s", p.Index, p.BodyMd))
+		}
+		return out
+	}
+
+	if resp := move(ids[1], 3, false); resp.StatusCode != 409 || !strings.Contains(resp.Body, ids[3]) {
+		t.Fatalf("expected 409 naming the occupant, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if got := strings.Join(order(), ","); got != "1:One,2:Two,3:Three" {
+		t.Fatalf("rejected move changed the story: %s", got)
+	}
+
+	if resp := move(ids[1], 3, true); resp.StatusCode != 200 || !strings.Contains(resp.Body, ids[3]) {
+		t.Fatalf("swap failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if got := strings.Join(order(), ","); got != "1:Three,2:Two,3:One" {
+		t.Fatalf("unexpected order after swap: %s", got)
+	}
+
+	// A free index needs no swap.
+	if resp := move(ids[2], 7, false); resp.StatusCode != 200 {
+		t.Fatalf("move to free index: %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestConditionalCheckFailedMapping(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	wrapped := fmt.Errorf("put story: %w", &types.ConditionalCheckFailedException{})
+	if !storyapi.IsConditionalCheckFailed(wrapped) || storyapi.IsConditionalCheckFailed(fmt.Errorf("throttled")) {
+		t.Fatal("IsConditionalCheckFailed must match the typed SDK error, wrapped or not, and nothing else")
+	}
+
+	body := `{"storyId":"story-once","schoolId":"s","title":"Once"}`
+	if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("first create: %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-once","schoolId":"s","title":"Overwrite"}`})
+	if resp.StatusCode != 409 {
+		t.Fatalf("expected 409 for an existing storyId, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if full, _ := storySvc.GetFullStory(ctx, "story-once"); full.Story.Title != "Once" {
+		t.Fatalf("existing story was overwritten: %+v", full.Story)
+	}
+
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-once","nodes":[{"id":"n1"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("submit: %d %s", resp.StatusCode, resp.Body)
+	}
+	for _, edgeID := range []string{"e404", "n1"} {
+		resp, _ := deleteEdgeHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "story-once", "edgeId": edgeID}})
+		if resp.StatusCode != 404 {
+			t.Errorf("DELETE edge %s: expected 404, got %d %s", edgeID, resp.StatusCode, resp.Body)
+		}
+	}
+	if nodes, _, _ := loadGraph(ctx, "story-once"); len(nodes) != 1 {
+		t.Fatal("deleting a node through the edge route must not remove it")
+	}
+}
+
+func TestCitationPayloadVersions(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-v","schoolId":"s","title":"Versions"}`}); resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	path := map[string]string{"storyId": "story-v"}
+
+	v1 := events.APIGatewayProxyRequest{PathParameters: path,
+		Body: `{"index":1,"bodyMd":"Eins","citations":[{"transcriptId":"t1","minutes":[4,5]}]}`}
+	if resp, _ := storySvc.HandleCreateParagraph(ctx, v1); resp.StatusCode != 200 {
+		t.Fatalf("v1 paragraph failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	v2 := events.APIGatewayProxyRequest{PathParameters: path, Headers: map[string]string{"x-api-version": "2"},
+		Body: `{"index":2,"bodyMd":"Zwei","citations":[{"transcriptId":"t2","ranges":[{"start":"PT1M","end":"PT3M30S"},{"start":"PT3M","end":"PT4M"}]}]}`}
+	if resp, _ := storySvc.HandleCreateParagraph(ctx, v2); resp.StatusCode != 200 {
+		t.Fatalf("v2 paragraph failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	full, err := storySvc.GetFullStory(ctx, "story-v")
+	if err != nil || len(full.Paragraphs) != 2 {
+		t.Fatalf("get story: %v %+v", err, full)
+	}
+	if got := full.Paragraphs[0].Citations; len(got) != 1 || fmt.Sprint(got[0].Minutes) != "[4 5]" {
+		t.Fatalf("v1 citation decoded wrong: %+v", got)
+	}
+	if got := full.Paragraphs[1].Citations; len(got) != 1 || got[0].TranscriptID != "t2" || fmt.Sprint(got[0].Minutes) != "[1 2 3 4]" {
+		t.Fatalf("v2 citation decoded wrong: %+v", got)
+	}
+
+	detail := events.APIGatewayProxyRequest{PathParameters: map[string]string{"paragraphId": full.Paragraphs[1].ParagraphID},
+		QueryStringParameters: map[string]string{"v": "v2"},
+		Body:                  `{"storyId":"story-v","kind":"quote","transcriptId":"t2","range":{"start":"PT2M","end":"PT1H"},"text":"Zitat"}`}
+	if resp, _ := storySvc.HandleCreateDetail(ctx, detail); resp.StatusCode != 200 {
+		t.Fatalf("v2 detail failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	full, _ = storySvc.GetFullStory(ctx, "story-v")
+	if d := full.DetailsByParagraph[full.Paragraphs[1].ParagraphID]; len(d) != 1 || d[0].StartMinute != 2 || d[0].EndMinute != 60 {
+		t.Fatalf("v2 detail range decoded wrong: %+v", d)
+	}
+
+	// An unknown version is a bad header, a bad range a readable body with an unusable value.
+	for _, c := range []struct {
+		req  events.APIGatewayProxyRequest
+		want int
+	}{
+		{events.APIGatewayProxyRequest{PathParameters: path, Headers: map[string]string{"X-Api-Version": "3"}, Body: `{"index":3,"bodyMd":"x"}`}, 400},
+		{events.APIGatewayProxyRequest{PathParameters: path, QueryStringParameters: map[string]string{"v": "2"}, Body: `{"index":3,"bodyMd":"x","citations":[{"transcriptId":"t","ranges":[{"start":"1 min","end":"PT2M"}]}]}`}, 422},
+	} {
+		if resp, _ := storySvc.HandleCreateParagraph(ctx, c.req); resp.StatusCode != c.want {
+			t.Fatalf("expected %d, got %d %s", c.want, resp.StatusCode, resp.Body)
+		}
+	}
+}
+
+func TestCrossStoryParagraphAccess(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	paragraphOf := func(storyID string) string {
+		t.Helper()
+		if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: fmt.Sprintf(`{"storyId":%q,"schoolId":"s","title":"T"}`, storyID)}); resp.StatusCode != 200 {
+			t.Fatalf("create story %s failed: %d %s", storyID, resp.StatusCode, resp.Body)
+		}
+		resp, _ := storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"storyId": storyID}, Body: `{"index":1,"bodyMd":"Original"}`})
+		var out map[string]string
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return out["id"]
+	}
+	paraA := paragraphOf("story-a")
+	paraB := paragraphOf("story-b")
+
+	// A detail under paragraph A must not be mistaken for the paragraph.
+	detail := events.APIGatewayProxyRequest{PathParameters: map[string]string{"paragraphId": paraA},
+		Body: `{"storyId":"story-a","kind":"quote","transcriptId":"t","startMinute":1,"endMinute":2,"text":"Zitat"}`}
+	if resp, _ := storySvc.HandleCreateDetail(ctx, detail); resp.StatusCode != 200 {
+		t.Fatalf("create detail failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := storySvc.HandleUpdateParagraph(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"paragraphId": paraA},
+		Body: `{"storyId":"story-a","bodyMd":"Edited"}`}); resp.StatusCode != 200 {
+		t.Fatalf("same-story update failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	// Pairing story A with paragraph B is not found, and B stays untouched.
+	if resp, _ := storySvc.HandleUpdateParagraph(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"paragraphId": paraB},
+		Body: `{"storyId":"story-a","bodyMd":"Hijacked"}`}); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for cross-story update, got %d %s", resp.StatusCode, resp.Body)
+	}
+	detail.PathParameters = map[string]string{"paragraphId": paraB}
+	if resp, _ := storySvc.HandleCreateDetail(ctx, detail); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for cross-story detail, got %d %s", resp.StatusCode, resp.Body)
+	}
+	fullA, _ := storySvc.GetFullStory(ctx, "story-a")
+	fullB, _ := storySvc.GetFullStory(ctx, "story-b")
+	if fullA.Paragraphs[0].BodyMd != "Edited" || len(fullA.Paragraphs) != 1 || len(fullA.DetailsByParagraph[paraB]) != 0 {
+		t.Fatalf("story A changed unexpectedly: %+v", fullA)
+	}
+	if fullB.Paragraphs[0].BodyMd != "Original" {
+		t.Fatalf("story B paragraph was modified: %+v", fullB.Paragraphs[0])
+	}
+}
+
+func TestDetailPagination(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-d","schoolId":"s","title":"Details"}`}); resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ := storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"storyId": "story-d"}, Body: `{"index":1,"bodyMd":"Viel zitiert"}`})
+	var created map[string]string
+	_ = json.Unmarshal([]byte(resp.Body), &created)
+	pid := created["id"]
+	for i := 0; i < 12; i++ {
+		body := fmt.Sprintf(`{"storyId":"story-d","kind":"quote","transcriptId":"t","startMinute":%d,"endMinute":%d,"text":"Zitat %d"}`, i, i, i)
+		if resp, _ := storySvc.HandleCreateDetail(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"paragraphId": pid}, Body: body}); resp.StatusCode != 200 {
+			t.Fatalf("create detail %d failed: %d %s", i, resp.StatusCode, resp.Body)
+		}
+	}
+
+	fullReq := events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "story-d"}}
+	resp, _ = storySvc.HandleGetFullStory(ctx, fullReq)
+	var full storyapi.StoryFull
+	_ = json.Unmarshal([]byte(resp.Body), &full)
+	if len(full.DetailsByParagraph[pid]) != 12 || full.DetailTotals != nil {
+		t.Fatalf("without a limit all details are expected: %d %v", len(full.DetailsByParagraph[pid]), full.DetailTotals)
+	}
+	fullReq.QueryStringParameters = map[string]string{"detailLimit": "5"}
+	resp, _ = storySvc.HandleGetFullStory(ctx, fullReq)
+	full = storyapi.StoryFull{}
+	_ = json.Unmarshal([]byte(resp.Body), &full)
+	if len(full.DetailsByParagraph[pid]) != 5 || full.DetailTotals[pid] != 12 {
+		t.Fatalf("detailLimit not honored: %d %v", len(full.DetailsByParagraph[pid]), full.DetailTotals)
+	}
+
+	var seen []string
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		q := map[string]string{"storyId": "story-d", "limit": "5", "cursor": cursor}
+		resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{QueryStringParameters: q}, "GET", "/api/paragraphs/"+pid+"/details")
+		if resp.StatusCode != 200 {
+			t.Fatalf("list details failed: %d %s", resp.StatusCode, resp.Body)
+		}
+		var page storyapi.ListPage[storyapi.Detail]
+		_ = json.Unmarshal([]byte(resp.Body), &page)
+		if page.Count > 5 || page.Total != 12 {
+			t.Fatalf("unexpected page: %+v", page)
+		}
+		for _, d := range page.Items {
+			seen = append(seen, d.DetailID)
+		}
+		if !page.HasMore {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(seen) != 12 {
+		t.Fatalf("expected 12 details across pages, got %d", len(seen))
+	}
+
+	if resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"storyId": "other"}}, "GET", "/api/paragraphs/"+pid+"/details"); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for a paragraph of another story, got %d", resp.StatusCode)
+	}
+}
+
+func TestTimelineMixesTokensAndDates(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	seedSchoolStory(t, ctx, "story-time", "s", []Node{
+		{ID: "a", Time: "T2"}, {ID: "b", Time: "2024-01-10"}, {ID: "c", Time: "T0"},
+		{ID: "d", Time: "2024-W03"}, {ID: "e", Time: "T1"}, {ID: "f", Time: "irgendwann"}, {ID: "g"},
+	}, nil)
+
+	timeline := func() (entries, unresolved []timelineBucket) {
+		t.Helper()
+		resp, _ := timelineHandler(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "story-time"}})
+		if resp.StatusCode != 200 {
+			t.Fatalf("timeline failed: %d %s", resp.StatusCode, resp.Body)
+		}
+		var out struct {
+			Entries    []timelineBucket `json:"entries"`
+			Unresolved []timelineBucket `json:"unresolved"`
+		}
+		if err := json.Unmarshal([]byte(resp.Body), &out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return out.Entries, out.Unresolved
+	}
+	times := func(buckets []timelineBucket) string {
+		var out []string
+		for _, b := range buckets {
+			out = append(out, b.Time+"@"+b.Date)
+		}
+		return strings.Join(out, " ")
+	}
+
+	// Without an anchor only calendar values are placed.
+	entries, unresolved := timeline()
+	if got := times(entries); got != "2024-01-10@2024-01-10 2024-W03@2024-01-15" {
+		t.Fatalf("unanchored entries = %s", got)
+	}
+	if got := times(unresolved); got != "T0@ T1@ T2@ irgendwann@" {
+		t.Fatalf("unanchored unresolved = %s", got)
+	}
+
+	patch := func(anchor string) int {
+		resp, _ := storySvc.HandleUpdateStory(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"storyId": "story-time"}, Body: fmt.Sprintf(`{"timeAnchor":%q}`, anchor)})
+		return resp.StatusCode
+	}
+	if code := patch("next monday"); code != 422 {
+		t.Fatalf("expected 422 for an invalid anchor, got %d", code)
+	}
+	if code := patch("2024-01-08"); code != 200 {
+		t.Fatalf("set anchor failed: %d", code)
+	}
+	entries, unresolved = timeline()
+	if got := times(entries); got != "T0@2024-01-08 2024-01-10@2024-01-10 2024-W03@2024-01-15 T1@2024-01-15 T2@2024-01-22" {
+		t.Fatalf("anchored entries = %s", got)
+	}
+	if got := times(unresolved); got != "irgendwann@" {
+		t.Fatalf("anchored unresolved = %s", got)
+	}
+	if entries[4].Week != "2024-W04" {
+		t.Fatalf("expected T2 in week 2024-W04, got %s", entries[4].Week)
+	}
+}
+
+func TestNewStoryServiceValidation(t *testing.T) {
+	if _, err := storyapi.NewStoryService(nil, tableName, corsHeaders); err == nil {
+		t.Fatalf("expected an error for a nil client")
+	}
+	if _, err := storyapi.NewStoryService(newMemoryDynamo(), " ", corsHeaders); err == nil {
+		t.Fatalf("expected an error for an empty table name")
+	}
+
+	s, err := storyapi.NewStoryService(newMemoryDynamo(), tableName, nil)
+	if err != nil {
+		t.Fatalf("nil cors should fall back to defaults: %v", err)
+	}
+	resp, _ := s.HandleGetFullStory(context.Background(), events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "missing"}})
+	if resp.StatusCode != 404 || resp.Headers["Access-Control-Allow-Origin"] != "*" {
+		t.Fatalf("expected 404 with default CORS headers, got %d %v", resp.StatusCode, resp.Headers)
+	}
+}
+
+func TestStoryOutlineOmitsBodies(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	outline := func() (string, []storyapi.OutlineEntry) {
+		t.Helper()
+		resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/story-o/outline")
+		if resp.StatusCode != 200 {
+			t.Fatalf("outline failed: %d %s", resp.StatusCode, resp.Body)
+		}
+		var entries []storyapi.OutlineEntry
+		if err := json.Unmarshal([]byte(resp.Body), &entries); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Body, entries
+	}
+
+	if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-o","schoolId":"s","title":"Outline"}`}); resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %d", resp.StatusCode)
+	}
+	if body, _ := outline(); strings.TrimSpace(body) != "[]" {
+		t.Fatalf("expected [] for a story without paragraphs, got %s", body)
+	}
+
+	importBody := `{"story":{"storyId":"story-o","schoolId":"s","title":"Outline"},
+		"paragraphs":[{"index":1,"title":"Anfang","bodyMd":"Ein sehr langer geheimer Text"},{"index":2,"title":"Leer","bodyMd":"  "}],
+		"details":[{"paragraphIndex":1,"kind":"quote","transcriptId":"t","text":"a"},{"paragraphIndex":1,"kind":"quote","transcriptId":"t","text":"b"}]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: importBody}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	body, entries := outline()
+	if strings.Contains(body, "geheimer") || strings.Contains(body, "bodyMd") {
+		t.Fatalf("outline leaked paragraph bodies: %s", body)
+	}
+	if len(entries) != 2 || entries[0].Title != "Anfang" || !entries[0].HasBody || entries[0].DetailCount != 2 ||
+		entries[1].Index != 2 || entries[1].HasBody || entries[1].DetailCount != 0 {
+		t.Fatalf("unexpected outline: %+v", entries)
+	}
+
+	if resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/nope/outline"); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for an unknown story, got %d", resp.StatusCode)
+	}
+}
+
+func TestCreateStoryWithGraph(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	post := func(body string) events.APIGatewayProxyResponse {
+		t.Helper()
+		resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{Body: body}, "POST", "/api/stories/with-graph")
+		return resp
+	}
+
+	resp := post(`{"schoolId":"school-a","title":"Mit Graph","nodes":[{"id":"n1","label":"Start"},{"id":"n2"}],"edges":[{"from":"n1","to":"n2"}]}`)
+	if resp.StatusCode != 200 {
+		t.Fatalf("create failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var out struct {
+		StoryID string `json:"storyId"`
+		Nodes   int    `json:"nodes"`
+		Edges   int    `json:"edges"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil || out.StoryID == "" || out.Nodes != 2 || out.Edges != 1 {
+		t.Fatalf("unexpected response %s (%v)", resp.Body, err)
+	}
+	full, err := storySvc.GetFullStory(ctx, out.StoryID)
+	if err != nil || full.Story.Title != "Mit Graph" || full.Story.SchoolID != "school-a" {
+		t.Fatalf("story not stored: %+v %v", full, err)
+	}
+	nodes, edges, _ := loadGraph(ctx, out.StoryID)
+	if len(nodes) != 2 || len(edges) != 1 {
+		t.Fatalf("graph not stored: %+v %+v", nodes, edges)
+	}
+
+	// An invalid graph rejects the whole request: no story is written.
+	resp = post(`{"storyId":"story-half","schoolId":"school-a","title":"Halb","nodes":[{"id":"n1"}],"edges":[{"from":"n1","to":"missing"}]}`)
+	if resp.StatusCode != 422 {
+		t.Fatalf("expected 422 for a dangling edge, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if _, err := storySvc.GetFullStory(ctx, "story-half"); !errors.Is(err, storyapi.ErrStoryNotFound) {
+		t.Fatalf("rejected request left a story behind: %v", err)
+	}
+	if resp := post(`{"storyId":"story-half","title":"Ohne Schule"}`); resp.StatusCode != 422 {
+		t.Fatalf("expected 422 without schoolId, got %d", resp.StatusCode)
+	}
+
+	// Reusing an id fails in the transaction and leaves the first graph alone.
+	resp = post(`{"storyId":"` + out.StoryID + `","schoolId":"school-b","title":"Kopie","nodes":[{"id":"n9"}]}`)
+	if resp.StatusCode != 409 {
+		t.Fatalf("expected 409 for an existing story, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if nodes, _, _ := loadGraph(ctx, out.StoryID); len(nodes) != 2 {
+		t.Fatalf("cancelled transaction wrote nodes: %+v", nodes)
+	}
+}
+
+func TestUnlinkedParagraphs(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	unlinked := func(query map[string]string) []storyapi.UnlinkedParagraph {
+		t.Helper()
+		resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{QueryStringParameters: query}, "GET", "/api/stories/story-ul/unlinked-paragraphs")
+		if resp.StatusCode != 200 {
+			t.Fatalf("unlinked-paragraphs failed: %d %s", resp.StatusCode, resp.Body)
+		}
+		var out []storyapi.UnlinkedParagraph
+		if err := json.Unmarshal([]byte(resp.Body), &out); err != nil || out == nil {
+			t.Fatalf("decode %s: %v", resp.Body, err)
+		}
+		return out
+	}
+
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-ul","nodes":[{"id":"n1"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	body := `{"story":{"storyId":"story-ul","schoolId":"s","title":"QA","paragraphNodeMap":{"p1":["n1"],"p2":["gone"]}},
+		"paragraphs":[{"paragraphId":"p1","index":1,"bodyMd":"A"},{"paragraphId":"p2","index":2,"bodyMd":"B"},{"paragraphId":"p3","index":3,"title":"Offen","bodyMd":"C"}]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	got := unlinked(nil)
+	if len(got) != 1 || got[0] != (storyapi.UnlinkedParagraph{ParagraphID: "p3", Index: 3, Title: "Offen", Reason: storyapi.UnlinkedUnmapped}) {
+		t.Fatalf("unexpected unlinked paragraphs: %+v", got)
+	}
+	got = unlinked(map[string]string{"includeDeleted": "true"})
+	if len(got) != 2 || got[0].ParagraphID != "p2" || got[0].Reason != storyapi.UnlinkedNodesDeleted || got[1].ParagraphID != "p3" {
+		t.Fatalf("expected p2 (deleted nodes) and p3: %+v", got)
+	}
+
+	linked := `{"story":{"storyId":"story-ul","schoolId":"s","title":"QA","paragraphNodeMap":{"p1":["n1"]}},
+		"paragraphs":[{"paragraphId":"p1","index":1,"bodyMd":"A"}]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: linked}); resp.StatusCode != 200 {
+		t.Fatalf("re-import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if got := unlinked(map[string]string{"includeDeleted": "true"}); len(got) != 0 {
+		t.Fatalf("expected an empty list once every paragraph is linked: %+v", got)
+	}
+	if resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/nope/unlinked-paragraphs"); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for an unknown story, got %d", resp.StatusCode)
+	}
+}
+
+func TestCreateAndImportSetLocation(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	call := func(path, body string) events.APIGatewayProxyResponse {
+		t.Helper()
+		resp, err := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: path, Body: body,
+			QueryStringParameters: map[string]string{"pretty": "true"}})
+		if err != nil || resp.StatusCode != 200 {
+			t.Fatalf("POST %s failed: %d %s %v", path, resp.StatusCode, resp.Body, err)
+		}
+		return resp
+	}
+
+	resp := call("/api/stories", `{"schoolId":"s","title":"Neu"}`)
+	var out struct {
+		ID      string `json:"id"`
+		StoryID string `json:"storyId"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil || out.ID == "" || out.StoryID != out.ID {
+		t.Fatalf("create should echo the id as id and storyId: %s", resp.Body)
+	}
+	if loc := resp.Headers["Location"]; loc != "/api/stories/"+out.ID+"/full" {
+		t.Fatalf("unexpected Location %q", loc)
+	}
+	if link := resp.Headers["Link"]; link != `</struktur/`+out.ID+`>; rel="related"` {
+		t.Fatalf("unexpected Link %q", link)
+	}
+	// The header points at a route that serves the new story.
+	full, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: resp.Headers["Location"]})
+	if full.StatusCode != 200 {
+		t.Fatalf("Location not followable: %d %s", full.StatusCode, full.Body)
+	}
+
+	resp = call("/api/stories/import", `{"story":{"storyId":"story mit leerzeichen","schoolId":"s","title":"Import"},"paragraphs":[]}`)
+	if loc := resp.Headers["Location"]; loc != "/api/stories/story%20mit%20leerzeichen/full" {
+		t.Fatalf("unexpected Location after import %q", loc)
+	}
+	if !strings.Contains(resp.Headers["Access-Control-Expose-Headers"], "Location") {
+		t.Fatalf("Location is not exposed to browsers: %v", resp.Headers)
+	}
+}
+
+func TestDeleteStoryBatchesDeletes(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	mem := svc.(*memoryDynamo)
+
+	var paragraphs, details []string
+	for i := 1; i <= 30; i++ {
+		paragraphs = append(paragraphs, fmt.Sprintf(`{"paragraphId":"p%d","index":%d,"bodyMd":"Absatz %d"}`, i, i, i))
+		for j := 0; j < 2; j++ {
+			details = append(details, fmt.Sprintf(`{"paragraphIndex":%d,"kind":"quote","transcriptId":"t","text":"Zitat %d"}`, i, j))
+		}
+	}
+	body := `{"story":{"storyId":"story-del","schoolId":"s","title":"Weg"},"paragraphs":[` + strings.Join(paragraphs, ",") + `],"details":[` + strings.Join(details, ",") + `]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-del","nodes":[{"id":"n1"},{"id":"n2"}],"edges":[{"from":"n1","to":"n2"}]}`}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	mem.batchSizes = nil
+	mem.throttleBatches = 1
+	resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "DELETE", "/api/stories/story-del")
+	if resp.StatusCode != 200 {
+		t.Fatalf("delete failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	// 1 story + 30 paragraphs + 60 details, 3 graph items and 1 graph version.
+	var out struct {
+		ItemsRemoved int `json:"itemsRemoved"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil || out.ItemsRemoved != 95 {
+		t.Fatalf("unexpected result %s (%v)", resp.Body, err)
+	}
+	total := 0
+	for _, n := range mem.batchSizes {
+		if n > 25 {
+			t.Fatalf("batch of %d exceeds 25: %v", n, mem.batchSizes)
+		}
+		total += n
+	}
+	// The throttled request is sent twice.
+	if total != 96 || len(mem.batchSizes) != 6 {
+		t.Fatalf("expected 96 requests in 6 batches, got %v", mem.batchSizes)
+	}
+	for _, pk := range []string{"STORY#story-del", "story-del", graphVersionPartitionPrefix + "story-del"} {
+		if bucket, _ := mem.partition(pk, false); len(bucket) != 0 {
+			t.Fatalf("partition %s still holds %d items", pk, len(bucket))
+		}
+	}
+	if resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "DELETE", "/api/stories/story-del"); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for a deleted story, got %d", resp.StatusCode)
+	}
+}
+
+func TestTenantIDPrefixes(t *testing.T) {
+	setupTestServices()
+	t.Setenv("ID_TENANT", "staging")
+	if err := initStoryService(); err != nil {
+		t.Fatalf("init story service: %v", err)
+	}
+	ctx := context.Background()
+
+	resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"schoolId":"rychenberg","title":"Tenant"}`})
+	var created map[string]string
+	if err := json.Unmarshal([]byte(resp.Body), &created); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	storyID := created["id"]
+	if !strings.HasPrefix(storyID, "staging-story-") {
+		t.Fatalf("story id %q lacks tenant prefix", storyID)
+	}
+
+	resp, _ = storySvc.HandleCreateParagraph(ctx, events.APIGatewayProxyRequest{Body: `{"index":1,"bodyMd":"Text"}`,
+		PathParameters: map[string]string{"storyId": storyID}})
+	if err := json.Unmarshal([]byte(resp.Body), &created); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("create paragraph failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	paragraphID := created["id"]
+	if !strings.HasPrefix(paragraphID, "staging-para-") {
+		t.Fatalf("paragraph id %q lacks tenant prefix", paragraphID)
+	}
+
+	resp, _ = storySvc.HandleCreateDetail(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"paragraphId": paragraphID},
+		Body: fmt.Sprintf(`{"storyId":"%s","kind":"quote","transcriptId":"t","startMinute":1,"endMinute":2,"text":"Zitat"}`, storyID)})
+	if err := json.Unmarshal([]byte(resp.Body), &created); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("create detail failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if !strings.HasPrefix(created["id"], "staging-det-") {
+		t.Fatalf("detail id %q lacks tenant prefix", created["id"])
+	}
+
+	if _, err := storyapi.TenantIDPrefixes("a#b"); err == nil {
+		t.Fatalf("expected tenant with '#' to be rejected")
+	}
+}
+
+func TestBodyPreview(t *testing.T) {
+	cases := []struct {
+		body  string
+		limit int
+		want  string
+		cut   bool
+	}{
+		{"kurz", 10, "kurz", false},
+		{"äöü", 3, "äöü", false},
+		{"Grüße aus Zürich und Köln", 8, "Grüße", true},
+		{"🙂🙂🙂🙂🙂", 3, "🙂🙂🙂", true},
+		{"Siehe [den Bericht](https://example.org/x) hier", 20, "Siehe", true},
+		{"Das ist **sehr wichtig** ja", 15, "Das ist sehr", true},
+	}
+	for _, c := range cases {
+		got, cut := storyapi.TruncateBody(c.body, c.limit)
+		if got != c.want || cut != c.cut {
+			t.Errorf("TruncateBody(%q, %d) = %q, %v; want %q, %v", c.body, c.limit, got, cut, c.want, c.cut)
+		}
+		if !utf8.ValidString(got) || utf8.RuneCountInString(got) > c.limit {
+			t.Errorf("TruncateBody(%q, %d) = %q is not a valid preview", c.body, c.limit, got)
+		}
+	}
+
+	setupTestServices()
+	ctx := context.Background()
+	imp := `{"story":{"storyId":"story-preview","schoolId":"s","title":"Vorschau"},
+		"paragraphs":[{"index":1,"bodyMd":"Grüße aus Zürich und Köln"},{"index":2,"bodyMd":"kurz"}]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: imp}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	path := map[string]string{"storyId": "story-preview"}
+	query := map[string]string{"bodyPreview": "8"}
+
+	resp, _ := storySvc.HandleOutline(ctx, events.APIGatewayProxyRequest{PathParameters: path, QueryStringParameters: query})
+	var outline []storyapi.OutlineEntry
+	if err := json.Unmarshal([]byte(resp.Body), &outline); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("outline failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if len(outline) != 2 || outline[0].BodyPreview != "Grüße" || !outline[0].Truncated || outline[1].BodyPreview != "kurz" || outline[1].Truncated {
+		t.Fatalf("unexpected outline previews: %+v", outline)
+	}
+
+	resp, _ = storySvc.HandleGetFullStory(ctx, events.APIGatewayProxyRequest{PathParameters: path, QueryStringParameters: query})
+	var full storyapi.StoryFull
+	if err := json.Unmarshal([]byte(resp.Body), &full); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("full story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if full.Paragraphs[0].BodyMd != "Grüße" || !full.Paragraphs[0].Truncated || full.Paragraphs[1].Truncated {
+		t.Fatalf("unexpected full story previews: %+v", full.Paragraphs)
+	}
+
+	resp, _ = storySvc.HandleOutline(ctx, events.APIGatewayProxyRequest{PathParameters: path, QueryStringParameters: map[string]string{"bodyPreview": "0"}})
+	if resp.StatusCode != 400 {
+		t.Fatalf("expected 400 for bodyPreview=0, got %d", resp.StatusCode)
+	}
+}
+
+func TestNodeMap(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	graph := `{"storyId":"story-map","nodes":[{"id":"n1","label":"A"},{"id":"n2","label":"B"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: graph}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	imp := `{"story":{"storyId":"story-map","schoolId":"s","title":"Map","paragraphNodeMap":{"para-1":["n1","n2"],"para-2":["n1"]}},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins"},{"paragraphId":"para-2","index":2,"bodyMd":"Zwei"}]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: imp}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/story-map/node-map")
+	var got storyapi.NodeMap
+	if err := json.Unmarshal([]byte(resp.Body), &got); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("node map failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if len(got.ParagraphNodeMap) != 2 || len(got.ParagraphNodeMap["para-1"]) != 2 {
+		t.Fatalf("unexpected paragraphNodeMap %+v", got.ParagraphNodeMap)
+	}
+	if strings.Join(got.NodeParagraphs["n1"], ",") != "para-1,para-2" || strings.Join(got.NodeParagraphs["n2"], ",") != "para-1" {
+		t.Fatalf("unexpected reverse index %+v", got.NodeParagraphs)
+	}
+
+	// A story without links answers empty maps, not null.
+	if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: `{"storyId":"story-nomap","schoolId":"s","title":"Leer"}`}); resp.StatusCode != 200 {
+		t.Fatalf("create story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ = handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/story-nomap/node-map")
+	if resp.StatusCode != 200 || !strings.Contains(resp.Body, `"paragraphNodeMap":{}`) || !strings.Contains(resp.Body, `"nodeParagraphs":{}`) {
+		t.Fatalf("expected empty maps, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/stories/story-none/node-map"); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for unknown story, got %d", resp.StatusCode)
+	}
+}
+
+func TestImportKeepsGraph(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	importStory := func(query, body string) map[string]interface{} {
+		t.Helper()
+		req := events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/api/stories/import", Body: body}
+		if query != "" {
+			req.QueryStringParameters = map[string]string{"keepGraph": query}
+		}
+		resp, _ := lambdaHandler(ctx, req)
+		if resp.StatusCode != 200 {
+			t.Fatalf("import (keepGraph=%q) failed: %d %s", query, resp.StatusCode, resp.Body)
+		}
+		var out map[string]interface{}
+		if err := json.Unmarshal([]byte(resp.Body), &out); err != nil {
+			t.Fatalf("unmarshal import response: %v", err)
+		}
+		return out
+	}
+	nodeIDs := func() string {
+		t.Helper()
+		ids, err := graphNodeIDs(ctx, "story-keep")
+		if err != nil {
+			t.Fatalf("load graph: %v", err)
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+
+	graph := `{"storyId":"story-keep","nodes":[{"id":"n1","label":"A"},{"id":"n2","label":"B"}],"edges":[{"from":"n1","to":"n2"}]}`
+	if resp, _ := handler(ctx, events.APIGatewayProxyRequest{Body: graph}); resp.StatusCode != 200 {
+		t.Fatalf("submit failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	narrative := `{"story":{"storyId":"story-keep","schoolId":"s","title":"Keep","paragraphNodeMap":{"para-1":["n1"]}},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins"}]}`
+
+	// Re-importing the narrative alone leaves the graph untouched.
+	importStory("", narrative)
+	importStory("", narrative)
+	if got := nodeIDs(); got != "n1,n2" {
+		t.Fatalf("graph should survive a narrative re-import, got %q", got)
+	}
+
+	// Nodes in the payload replace the graph; links to them are not unknown.
+	withGraph := `{"story":{"storyId":"story-keep","schoolId":"s","title":"Keep","paragraphNodeMap":{"para-1":["n3"]}},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins"}],
+		"nodes":[{"id":"n1","label":"A"},{"id":"n3","label":"C"}],"edges":[{"from":"n1","to":"n3"}]}`
+	out := importStory("", withGraph)
+	if got := nodeIDs(); got != "n1,n3" {
+		t.Fatalf("payload graph should replace the stored one, got %q", got)
+	}
+	if out["graphKept"] != false || out["nodesRemoved"] != float64(1) || out["warnings"] != nil {
+		t.Fatalf("unexpected replace result %v", out)
+	}
+
+	// keepGraph=true merges payload nodes instead.
+	importStory("true", strings.Replace(withGraph, `{"id":"n3","label":"C"}`, `{"id":"n4","label":"D"}`, 1))
+	if got := nodeIDs(); got != "n1,n3,n4" {
+		t.Fatalf("keepGraph=true should merge, got %q", got)
+	}
+
+	// A replacing graph is checked on its own: the stored edges neither count
+	// towards the limit nor reserve their ids.
+	defer func(limit int) { maxEdges = limit }(maxEdges)
+	maxEdges = 1
+	out = importStory("false", `{"story":{"storyId":"story-keep","schoolId":"s","title":"Keep"},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins"}],
+		"nodes":[{"id":"e1","label":"E"},{"id":"n5","label":"F"}],"edges":[{"from":"e1","to":"n5"}]}`)
+	if got := nodeIDs(); got != "e1,n5" {
+		t.Fatalf("replacing import should leave only its graph, got %q", got)
+	}
+	if out["nodes"] != float64(2) || out["edges"] != float64(1) {
+		t.Fatalf("unexpected replace counts %v", out)
+	}
+
+	// keepGraph=false without nodes drops the graph and its links.
+	importStory("false", narrative)
+	if got := nodeIDs(); got != "" {
+		t.Fatalf("keepGraph=false should drop the graph, got %q", got)
+	}
+	full, _ := storySvc.GetFullStory(ctx, "story-keep")
+	if len(full.Story.ParagraphNodeMap) != 0 || len(full.Paragraphs) != 1 {
+		t.Fatalf("expected narrative without links, got %+v", full)
+	}
+}
+
+func TestParagraphHistory(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	imp := `{"story":{"storyId":"story-hist","schoolId":"s","title":"History"},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins"},{"paragraphId":"para-2","index":2,"bodyMd":"Zwei"}]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: imp}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	update := func(body string) {
+		t.Helper()
+		resp, _ := storySvc.HandleUpdateParagraph(ctx, events.APIGatewayProxyRequest{Body: body,
+			PathParameters: map[string]string{"paragraphId": "para-1"}})
+		if resp.StatusCode != 200 {
+			t.Fatalf("update failed: %d %s", resp.StatusCode, resp.Body)
+		}
+	}
+	history := func() []storyapi.ParagraphChange {
+		t.Helper()
+		resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"storyId": "story-hist"}},
+			"GET", "/api/paragraphs/para-1/history")
+		var changes []storyapi.ParagraphChange
+		if err := json.Unmarshal([]byte(resp.Body), &changes); err != nil || resp.StatusCode != 200 {
+			t.Fatalf("history failed: %d %s", resp.StatusCode, resp.Body)
+		}
+		return changes
+	}
+
+	if got := history(); len(got) != 0 {
+		t.Fatalf("expected no history yet, got %+v", got)
+	}
+	update(`{"storyId":"story-hist","bodyMd":"Eins, überarbeitet"}`)
+	got := history()
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Fields, []string{storyapi.FieldBody}) || got[0].ChangedAt == "" {
+		t.Fatalf("expected one bodyMd change, got %+v", got)
+	}
+	// An update that changes nothing leaves no entry.
+	update(`{"storyId":"story-hist","bodyMd":"Eins, überarbeitet"}`)
+	if got := history(); len(got) != 1 {
+		t.Fatalf("no-op update should not add history, got %+v", got)
+	}
+	update(`{"storyId":"story-hist","title":"Neu","index":3}`)
+	got = history()
+	if len(got) != 2 || !reflect.DeepEqual(got[1].Fields, []string{storyapi.FieldTitle, storyapi.FieldIndex}) {
+		t.Fatalf("expected title and index change last, got %+v", got)
+	}
+	full, _ := storySvc.GetFullStory(ctx, "story-hist")
+	if len(full.Paragraphs) != 2 {
+		t.Fatalf("history items must not show up as paragraphs: %+v", full.Paragraphs)
+	}
+
+	// History has its own partition, so reading the story does not read it,
+	// and it is deleted with the story.
+	mem := svc.(*memoryDynamo)
+	if n := len(mem.items["STORY#story-hist"]); n != 3 {
+		t.Fatalf("story partition should hold story and paragraphs only, has %d items", n)
+	}
+	if n := len(mem.items["HIST#story-hist"]); n != 2 {
+		t.Fatalf("expected 2 history items, got %d", n)
+	}
+	if removed, err := storySvc.DeleteStory(ctx, "story-hist"); err != nil || removed != 5 {
+		t.Fatalf("delete story: removed %d, %v", removed, err)
+	}
+	if n := len(mem.items["HIST#story-hist"]); n != 0 {
+		t.Fatalf("history should go with the story, %d items left", n)
+	}
+}
+
+func TestAttachmentDetail(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	imp := `{"story":{"storyId":"story-att","schoolId":"s","title":"Anhang"},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins"}]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: imp}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	create := func(body string) events.APIGatewayProxyResponse {
+		resp, _ := storySvc.HandleCreateDetail(ctx, events.APIGatewayProxyRequest{Body: body,
+			PathParameters: map[string]string{"paragraphId": "para-1"}})
+		return resp
+	}
+	if resp := create(`{"storyId":"story-att","kind":"attachment","text":"Foto vom Hof",
+		"attachment":{"s3Key":"uploads/hof.jpg","mimeType":"image/jpeg"}}`); resp.StatusCode != 200 {
+		t.Fatalf("create attachment failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp := create(`{"storyId":"story-att","kind":"quote","transcriptId":"t","startMinute":1,"endMinute":2,"text":"Zitat"}`); resp.StatusCode != 200 {
+		t.Fatalf("create quote failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	for _, bad := range []string{
+		`{"storyId":"story-att","kind":"attachment","attachment":{"url":"ftp://example.org/a.png","mimeType":"image/png"}}`,
+		`{"storyId":"story-att","kind":"attachment","attachment":{"s3Key":"../secret","mimeType":"image/png"}}`,
+		`{"storyId":"story-att","kind":"attachment","attachment":{"url":"https://example.org/a.png","mimeType":"png"}}`,
+		`{"storyId":"story-att","kind":"attachment"}`,
+		`{"storyId":"story-att","kind":"quote","attachment":{"url":"https://example.org/a.png","mimeType":"image/png"}}`,
+	} {
+		if resp := create(bad); resp.StatusCode != 422 {
+			t.Fatalf("expected 422 for %s, got %d %s", bad, resp.StatusCode, resp.Body)
+		}
+	}
+
+	resp, _ := storySvc.HandleGetFullStory(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "story-att"}})
+	var full storyapi.StoryFull
+	if err := json.Unmarshal([]byte(resp.Body), &full); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("get story failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var attachments, quotes int
+	for _, d := range full.DetailsByParagraph["para-1"] {
+		switch d.Kind {
+		case storyapi.DetailKindAttachment:
+			attachments++
+			if d.Attachment == nil || *d.Attachment != (storyapi.Attachment{S3Key: "uploads/hof.jpg", MimeType: "image/jpeg"}) {
+				t.Fatalf("attachment did not round-trip: %+v", d.Attachment)
+			}
+		case storyapi.DetailKindQuote:
+			quotes++
+			if d.Attachment != nil {
+				t.Fatalf("quote gained an attachment: %+v", d)
+			}
+		}
+	}
+	if attachments != 1 || quotes != 1 {
+		t.Fatalf("expected one attachment and one quote, got %+v", full.DetailsByParagraph)
+	}
+	if strings.Count(resp.Body, `"attachment":`) != 1 {
+		t.Fatalf("quote details should omit the attachment field: %s", resp.Body)
+	}
+}
+
+func TestDetailsOrderedByMinute(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+
+	imp := `{"story":{"storyId":"story-order","schoolId":"s","title":"Order"},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins"}],
+		"details":[
+			{"paragraphIndex":1,"kind":"quote","transcriptId":"t","startMinute":30,"endMinute":31,"text":"spät"},
+			{"paragraphIndex":1,"kind":"quote","transcriptId":"t","startMinute":5,"endMinute":6,"text":"früh a"},
+			{"paragraphIndex":1,"kind":"quote","transcriptId":"t","startMinute":12,"endMinute":14,"text":"mitte"},
+			{"paragraphIndex":1,"kind":"quote","transcriptId":"t","startMinute":5,"endMinute":9,"text":"früh b"}]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: imp}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	var first []storyapi.Detail
+	for round := 0; round < 3; round++ {
+		full, err := storySvc.GetFullStory(ctx, "story-order")
+		if err != nil {
+			t.Fatalf("get story: %v", err)
+		}
+		details := full.DetailsByParagraph["para-1"]
+		if len(details) != 4 {
+			t.Fatalf("expected 4 details, got %+v", details)
+		}
+		for i := 1; i < len(details); i++ {
+			a, b := details[i-1], details[i]
+			if a.StartMinute > b.StartMinute || (a.StartMinute == b.StartMinute && a.DetailID > b.DetailID) {
+				t.Fatalf("details out of order: %+v", details)
+			}
+		}
+		if first == nil {
+			first = details
+		} else if !reflect.DeepEqual(first, details) {
+			t.Fatalf("order changed between fetches: %+v vs %+v", first, details)
+		}
+	}
+}
+
+func TestDetailLimitPerParagraph(t *testing.T) {
+	setupTestServices()
+	storySvc.SetMaxDetails(2)
+	ctx := context.Background()
+
+	imp := `{"story":{"storyId":"story-dlimit","schoolId":"s","title":"Limit"},
+		"paragraphs":[{"paragraphId":"para-1","index":1,"bodyMd":"Eins"},{"paragraphId":"para-2","index":2,"bodyMd":"Zwei"}],
+		"details":[%s]}`
+	quote := `{"paragraphIndex":1,"kind":"quote","transcriptId":"t","startMinute":1,"endMinute":2,"text":"Zitat"}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: fmt.Sprintf(imp, strings.Join([]string{quote, quote, quote}, ","))}); resp.StatusCode != 422 {
+		t.Fatalf("expected 422 for an import over the detail limit, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: fmt.Sprintf(imp, quote)}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	create := func(paragraphID string) int {
+		resp, _ := storySvc.HandleCreateDetail(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"paragraphId": paragraphID},
+			Body: `{"storyId":"story-dlimit","kind":"quote","transcriptId":"t","startMinute":3,"endMinute":4,"text":"Zitat"}`})
+		return resp.StatusCode
+	}
+	if code := create("para-1"); code != 200 {
+		t.Fatalf("detail up to the limit should be accepted, got %d", code)
+	}
+	if code := create("para-1"); code != 422 {
+		t.Fatalf("expected 422 over the detail limit, got %d", code)
+	}
+	// The limit counts per paragraph.
+	if code := create("para-2"); code != 200 {
+		t.Fatalf("other paragraph should still accept details, got %d", code)
+	}
+	full, _ := storySvc.GetFullStory(ctx, "story-dlimit")
+	if len(full.DetailsByParagraph["para-1"]) != 2 || len(full.DetailsByParagraph["para-2"]) != 1 {
+		t.Fatalf("unexpected details: %+v", full.DetailsByParagraph)
+	}
+}
+
+func TestStorySlugs(t *testing.T) {
+	for title, want := range map[string]string{
+		"Soziokratie: Prüfstein":   "soziokratie-pruefstein",
+		"  Große Pause -- 2024!  ": "grosse-pause-2024",
+		"Café & Crème":             "cafe-creme",
+		"???":                      "story",
+	} {
+		if got := storyapi.Slugify(title); got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", title, got, want)
+		}
+	}
+
+	setupTestServices()
+	ctx := context.Background()
+	create := func(storyID, schoolID, title string) {
+		t.Helper()
+		body := fmt.Sprintf(`{"storyId":%q,"schoolId":%q,"title":%q}`, storyID, schoolID, title)
+		if resp, _ := storySvc.HandleCreateStory(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+			t.Fatalf("create %s failed: %d %s", storyID, resp.StatusCode, resp.Body)
+		}
+	}
+	create("story-1", "rychenberg", "Soziokratie: Prüfstein")
+	create("story-2", "rychenberg", "Soziokratie – Prüfstein")
+	create("story-3", "other", "Soziokratie: Prüfstein")
+	imp := `{"story":{"storyId":"story-4","schoolId":"rychenberg","title":"Soziokratie Prüfstein"},"paragraphs":[]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: imp}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	resolve := func(schoolID, slug string) (string, int) {
+		t.Helper()
+		resp, _ := handleStoryRoutes(ctx, events.APIGatewayProxyRequest{}, "GET", "/api/schools/"+schoolID+"/stories/"+slug)
+		var full storyapi.StoryFull
+		_ = json.Unmarshal([]byte(resp.Body), &full)
+		return full.Story.StoryID, resp.StatusCode
+	}
+	for _, c := range []struct{ school, slug, want string }{
+		{"rychenberg", "soziokratie-pruefstein", "story-1"},
+		{"rychenberg", "soziokratie-pruefstein-2", "story-2"},
+		{"rychenberg", "soziokratie-pruefstein-3", "story-4"},
+		// Slugs only need to be unique within a school.
+		{"other", "soziokratie-pruefstein", "story-3"},
+	} {
+		if got, code := resolve(c.school, c.slug); code != 200 || got != c.want {
+			t.Errorf("%s/%s resolved to %q (%d), want %s", c.school, c.slug, got, code, c.want)
+		}
+	}
+	if _, code := resolve("rychenberg", "unbekannt"); code != 404 {
+		t.Fatalf("expected 404 for an unknown slug, got %d", code)
+	}
+
+	// Re-importing and renaming keep the slug.
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: imp}); resp.StatusCode != 200 {
+		t.Fatalf("re-import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := storySvc.HandleUpdateStory(ctx, events.APIGatewayProxyRequest{PathParameters: map[string]string{"storyId": "story-1"},
+		Body: `{"title":"Neuer Titel"}`}); resp.StatusCode != 200 {
+		t.Fatalf("rename failed: %d %s", resp.StatusCode, resp.Body)
+	}
+	if got, _ := resolve("rychenberg", "soziokratie-pruefstein-3"); got != "story-4" {
+		t.Fatalf("re-import changed the slug, resolved to %q", got)
+	}
+	if got, _ := resolve("rychenberg", "soziokratie-pruefstein"); got != "story-1" {
+		t.Fatalf("rename changed the slug, resolved to %q", got)
+	}
+
+	// A story that cannot be loaded is a server error, not an unknown slug.
+	mem := svc.(*memoryDynamo)
+	if err := useStore(failingQueryDynamo{mem}); err != nil {
+		t.Fatal(err)
+	}
+	_, code := resolve("rychenberg", "soziokratie-pruefstein")
+	if err := useStore(mem); err != nil {
+		t.Fatal(err)
+	}
+	if code != 500 {
+		t.Fatalf("expected 500 when the story cannot be read, got %d", code)
+	}
+
+	// Deleting a story frees its slug for the next story of that title.
+	if _, err := storySvc.DeleteStory(ctx, "story-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, code := resolve("rychenberg", "soziokratie-pruefstein"); code != 404 {
+		t.Fatalf("expected 404 for the slug of a deleted story, got %d", code)
+	}
+	create("story-5", "rychenberg", "Soziokratie: Prüfstein")
+	if got, _ := resolve("rychenberg", "soziokratie-pruefstein"); got != "story-5" {
+		t.Fatalf("freed slug resolved to %q, want story-5", got)
+	}
+}
+
+func TestTranscriptParagraphsAcrossStories(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	for _, body := range []string{
+		`{"story":{"storyId":"story-t-b","schoolId":"s","title":"B"},"paragraphs":[
+			{"paragraphId":"b2","index":2,"bodyMd":"x","citations":[{"transcriptId":"tr-1","minutes":[9,4]},{"transcriptId":"tr-1","minutes":[4]}]},
+			{"paragraphId":"b1","index":1,"bodyMd":"x","citations":[{"transcriptId":"tr-1","minutes":[1]}]}]}`,
+		`{"story":{"storyId":"story-t-a","schoolId":"s","title":"A"},"paragraphs":[
+			{"paragraphId":"a1","index":1,"bodyMd":"x","citations":[{"transcriptId":"tr-1","minutes":[7]},{"transcriptId":"tr-2","minutes":[2]}]},
+			{"paragraphId":"a2","index":2,"bodyMd":"x","citations":[{"transcriptId":"tr-2","minutes":[3]}]}]}`,
+	} {
+		if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+			t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+		}
+	}
+	// Enough unrelated items that the lookup needs several scan pages.
+	for i := 0; i < 2500; i++ {
+		if _, err := svc.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: map[string]types.AttributeValue{
+			"storyId": &types.AttributeValueMemberS{Value: fmt.Sprintf("filler-%02d", i%40)},
+			"id":      &types.AttributeValueMemberS{Value: fmt.Sprintf("n%04d", i)},
+		}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type page struct {
+		Stories    []storyapi.CitingStory `json:"stories"`
+		Count      int                    `json:"count"`
+		HasMore    bool                   `json:"hasMore"`
+		NextCursor string                 `json:"nextCursor"`
+	}
+	lookup := func(transcriptID string) (map[string][]storyapi.CitingParagraph, int) {
+		t.Helper()
+		found := map[string][]storyapi.CitingParagraph{}
+		pages, cursor := 0, ""
+		for {
+			req := events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/api/transcripts/" + transcriptID + "/paragraphs"}
+			if cursor != "" {
+				req.QueryStringParameters = map[string]string{"cursor": cursor}
+			}
+			resp, _ := lambdaHandler(ctx, req)
+			if resp.StatusCode != 200 {
+				t.Fatalf("lookup %s: %d %s", transcriptID, resp.StatusCode, resp.Body)
+			}
+			var p page
+			if err := json.Unmarshal([]byte(resp.Body), &p); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			for _, st := range p.Stories {
+				found[st.StoryID] = append(found[st.StoryID], st.Paragraphs...)
+			}
+			pages++
+			if !p.HasMore {
+				return found, pages
+			}
+			if pages > 10 {
+				t.Fatal("lookup does not terminate")
+			}
+			cursor = p.NextCursor
+		}
+	}
+
+	found, pages := lookup("tr-1")
+	if pages < 3 {
+		t.Fatalf("expected the scan to span several pages, got %d", pages)
+	}
+	want := map[string][]storyapi.CitingParagraph{
+		"story-t-a": {{ParagraphID: "a1", Index: 1, Minutes: []int{7}}},
+		"story-t-b": {{ParagraphID: "b1", Index: 1, Minutes: []int{1}}, {ParagraphID: "b2", Index: 2, Minutes: []int{4, 9}}},
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Fatalf("tr-1 paragraphs = %+v, want %+v", found, want)
+	}
+	if found, _ := lookup("tr-unknown"); len(found) != 0 {
+		t.Fatalf("unreferenced transcript: %+v", found)
+	}
+
+	resp, _ := lambdaHandler(ctx, events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/api/transcripts/tr-1/paragraphs",
+		QueryStringParameters: map[string]string{"cursor": "garbage"}})
+	if resp.StatusCode != 400 {
+		t.Fatalf("invalid cursor: %d, want 400", resp.StatusCode)
+	}
+}
+
+// pagedQueryDynamo answers every unlimited Query in pages of pageSize items,
+// as DynamoDB does once a partition passes 1 MB.
+type pagedQueryDynamo struct {
+	*memoryDynamo
+	pageSize int32
+}
+
+func (d pagedQueryDynamo) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if input.Limit == nil {
+		paged := *input
+		paged.Limit = aws.Int32(d.pageSize)
+		input = &paged
+	}
+	return d.memoryDynamo.Query(ctx, input, optFns...)
+}
+
+func TestFullStoryReadsEveryPage(t *testing.T) {
+	setupTestServices()
+	ctx := context.Background()
+	mem := svc.(*memoryDynamo)
+	body := `{"story":{"storyId":"story-pages","schoolId":"s","title":"Pages"},
+		"paragraphs":[{"index":1,"bodyMd":"Eins"},{"index":2,"bodyMd":"Zwei"},{"index":3,"bodyMd":"Drei"}],
+		"details":[{"paragraphIndex":1,"kind":"quote","transcriptId":"t1","text":"a"},
+			{"paragraphIndex":3,"kind":"quote","transcriptId":"t1","text":"b"}]}`
+	if resp, _ := storySvc.HandleImportStory(ctx, events.APIGatewayProxyRequest{Body: body}); resp.StatusCode != 200 {
+		t.Fatalf("import failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	if err := useStore(pagedQueryDynamo{mem, 2}); err != nil {
+		t.Fatal(err)
+	}
+	defer useStore(mem)
+	full, err := storySvc.GetFullStory(ctx, "story-pages")
+	if err != nil {
+		t.Fatalf("get full story: %v", err)
+	}
+	details := 0
+	for _, ds := range full.DetailsByParagraph {
+		details += len(ds)
+	}
+	if full.Story.Title != "Pages" || len(full.Paragraphs) != 3 || details != 2 {
+		t.Fatalf("story read from one page only: %d paragraphs, %d details", len(full.Paragraphs), details)
+	}
+}
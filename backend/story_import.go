@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// importStoryHandler imports a story's narrative and decides what happens to
+// its graph, which lives in a separate partition:
+//   - a payload without nodes or edges leaves the stored graph alone;
+//   - "nodes"/"edges" in the payload replace the stored graph, validated like
+//     a submit before anything is written;
+//   - ?keepGraph=true merges payload nodes into the stored graph instead, and
+//     ?keepGraph=false without nodes removes the stored graph (and with it the
+//     paragraphNodeMap, which would only point at deleted nodes).
+//
+// Route: POST /api/stories/import
+func importStoryHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var in struct {
+		Story struct {
+			StoryID string `json:"storyId"`
+		} `json:"story"`
+		Nodes []Node `json:"nodes"`
+		Edges []Edge `json:"edges"`
+	}
+	// Malformed bodies are reported by the narrative import below.
+	_ = json.Unmarshal([]byte(req.Body), &in)
+	hasGraph := len(in.Nodes) > 0 || len(in.Edges) > 0
+
+	keepGraph := !hasGraph
+	switch req.QueryStringParameters["keepGraph"] {
+	case "":
+	case "true":
+		keepGraph = true
+	case "false":
+		keepGraph = false
+	default:
+		return badInput("keepGraph must be true or false"), nil
+	}
+	storyID := in.Story.StoryID
+	if !hasGraph && (keepGraph || storyID == "") {
+		// Nothing to write, or a new story with no graph to drop.
+		return storySvc.HandleImportStory(ctx, req)
+	}
+	if storyID == "" {
+		return unprocessable("story.storyId is required to import a graph"), nil
+	}
+
+	var plan *submitPlan
+	if hasGraph {
+		sb := Strukturbild{StoryID: storyID, Nodes: in.Nodes, Edges: in.Edges}
+		if !keepGraph {
+			if missing := unknownEndpoints(sb); len(missing) > 0 && req.QueryStringParameters["autoCreateNodes"] != "true" && req.QueryStringParameters["allowDanglingEdges"] != "true" {
+				return unprocessable(fmt.Sprintf("Edges reference nodes not in the import: %s", strings.Join(missing, ", "))), nil
+			}
+		}
+		var rejected events.APIGatewayProxyResponse
+		plan, rejected = planSubmit(ctx, req, &sb, !keepGraph)
+		if plan == nil {
+			return rejected, nil
+		}
+		ids := make([]string, 0, len(sb.Nodes))
+		for _, n := range sb.Nodes {
+			ids = append(ids, n.ID)
+		}
+		ctx = withPendingGraph(ctx, pendingGraph{nodeIDs: ids, replace: !keepGraph})
+	}
+
+	resp, err := storySvc.HandleImportStory(ctx, req)
+	if err != nil || resp.StatusCode >= 300 {
+		return resp, err
+	}
+
+	result := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(resp.Body), &result); err != nil {
+		return resp, nil
+	}
+	result["graphKept"] = keepGraph
+	// New items are written before the old ones are removed, so a failed
+	// write leaves the previous graph in place rather than a partial one.
+	if plan != nil {
+		if err := currentStore().UpsertGraph(ctx, plan.items); err != nil {
+			log.Printf("❌ Failed to write graph items of %s on import: %v", storyID, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Story imported, but its graph could not be saved"}, nil
+		}
+		if keepGraph {
+			result["nodes"], result["edges"] = plan.nodeCount, plan.edgeCount
+		} else {
+			// A replaced graph is exactly the import's items.
+			result["nodes"], result["edges"] = countPlanItems(plan)
+		}
+	}
+	if !keepGraph {
+		keep := map[string]bool{}
+		if plan != nil {
+			for _, item := range plan.items {
+				keep[item.ID] = true
+			}
+		}
+		nodesRemoved, edgesRemoved, err := removeGraphItems(ctx, storyID, keep)
+		if err != nil {
+			log.Printf("❌ Failed to remove graph of %s on import: %v", storyID, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Story imported, but its old graph could not be removed"}, nil
+		}
+		result["nodesRemoved"], result["edgesRemoved"] = nodesRemoved, edgesRemoved
+		if plan == nil {
+			if err := storySvc.ClearParagraphNodeMap(ctx, storyID); err != nil {
+				log.Printf("❌ Failed to clear paragraphNodeMap of %s: %v", storyID, err)
+			}
+		}
+	}
+	notifyGraphChange(ctx, storyapi.EventGraphUpdated, storyID)
+
+	body, _ := json.Marshal(result)
+	resp.Body = string(body)
+	return resp, nil
+}
+
+// removeGraphItems deletes the graph items of storyID except those in keep.
+func removeGraphItems(ctx context.Context, storyID string, keep map[string]bool) (nodes, edges int, err error) {
+	items, err := queryStoryItems(ctx, storyID)
+	if err != nil {
+		return 0, 0, err
+	}
+	var keys []map[string]types.AttributeValue
+	for _, item := range items {
+		if keep[item.ID] {
+			continue
+		}
+		keys = append(keys, keySchema.Key(storyID, item.ID))
+		if item.IsNode {
+			nodes++
+		} else {
+			edges++
+		}
+	}
+	if err := storyapi.BatchDelete(ctx, svc, tableName, keys); err != nil {
+		return 0, 0, err
+	}
+	return nodes, edges, nil
+}
+
+// unknownEndpoints lists edge endpoints that are not among sb's nodes.
+func unknownEndpoints(sb Strukturbild) []string {
+	known := map[string]bool{}
+	for _, n := range sb.Nodes {
+		known[n.ID] = true
+	}
+	var missing []string
+	for _, e := range sb.Edges {
+		for _, end := range []string{e.From, e.To} {
+			if end != "" && !known[end] {
+				known[end] = true
+				missing = append(missing, end)
+			}
+		}
+	}
+	return missing
+}
+
+func countPlanItems(plan *submitPlan) (nodes, edges int) {
+	for _, item := range plan.items {
+		if item.IsNode {
+			nodes++
+		} else {
+			edges++
+		}
+	}
+	return nodes, edges
+}
+
+// pendingGraph is a graph an import is about to write. graphNodeIDs reports
+// its nodes so the paragraphNodeMap check accepts links to them; with replace
+// the stored nodes no longer count.
+type pendingGraph struct {
+	nodeIDs []string
+	replace bool
+}
+
+type pendingGraphKey struct{}
+
+func withPendingGraph(ctx context.Context, g pendingGraph) context.Context {
+	return context.WithValue(ctx, pendingGraphKey{}, g)
+}
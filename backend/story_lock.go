@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// storyLocks orders the writes to one story, so that an import deleting
+// paragraphs and a submit writing the graph of the same story cannot
+// interleave; different stories still proceed in parallel. Requests in one
+// process queue on a keyedMutex; across Lambda instances each writer then
+// holds a lease item in the table (see storyLease).
+var storyLocks = &storyLocker{
+	local: newKeyedMutex(),
+	lease: time.Duration(envInt("STORY_LOCK_LEASE_MS", 30000)) * time.Millisecond,
+	retry: 20 * time.Millisecond,
+}
+
+// A lease is the item LOCK#<storyId>/LOCK. It names its owner and expires at
+// expiresAt (Unix seconds), so a writer that died holding it blocks the story
+// for one lease at most. expiresAt is also the table's TTL attribute, which
+// clears leftover leases; the lock does not depend on it.
+const (
+	storyLeasePrefix  = "LOCK#"
+	storyLeaseSortKey = "LOCK"
+	storyLeaseMaxWait = 500 * time.Millisecond
+)
+
+// storyLocker takes the in-process lock of a story, then its lease.
+type storyLocker struct {
+	local *keyedMutex
+	lease time.Duration
+	retry time.Duration
+}
+
+// lock blocks until the story is free or ctx is done. On success it returns
+// the function that releases it.
+func (l *storyLocker) lock(ctx context.Context, storyID string) (func(), error) {
+	unlockLocal, err := l.local.lock(ctx, storyID)
+	if err != nil {
+		return nil, err
+	}
+	owner := uuid.New().String()
+	wait := l.retry
+	for {
+		err := l.acquire(ctx, storyID, owner)
+		if err == nil {
+			break
+		}
+		if !storyapi.IsConditionalCheckFailed(err) {
+			unlockLocal()
+			return nil, err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			unlockLocal()
+			return nil, ctx.Err()
+		}
+		wait = min(wait*2, storyLeaseMaxWait)
+	}
+	return func() {
+		l.releaseLease(context.WithoutCancel(ctx), storyID, owner)
+		unlockLocal()
+	}, nil
+}
+
+// acquire writes the lease unless another owner holds one that has not expired.
+func (l *storyLocker) acquire(ctx context.Context, storyID, owner string) error {
+	now := time.Now()
+	item := keySchema.Key(storyLeasePrefix+storyID, storyLeaseSortKey)
+	item["leaseOwner"] = &types.AttributeValueMemberS{Value: owner}
+	item["expiresAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(l.lease).Unix(), 10)}
+	_, err := svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(tableName),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#pk) OR expiresAt < :now"),
+		ExpressionAttributeNames: keySchema.Names(false),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+	return err
+}
+
+// releaseLease deletes the lease if it is still ours; one that expired and
+// was taken over belongs to its new owner.
+func (l *storyLocker) releaseLease(ctx context.Context, storyID, owner string) {
+	_, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       keySchema.Key(storyLeasePrefix+storyID, storyLeaseSortKey),
+		ConditionExpression:       aws.String("leaseOwner = :owner"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":owner": &types.AttributeValueMemberS{Value: owner}},
+	})
+	if storyapi.IsConditionalCheckFailed(err) {
+		log.Printf("⚠️ Lease of story %s expired before the write finished", storyID)
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to release lease of story %s: %v", storyID, err)
+	}
+}
+
+// keyedMutex hands out one lock per key and forgets keys nobody holds or waits for.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	ch   chan struct{} // holds a token while the key is locked
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: map[string]*keyedLock{}}
+}
+
+// lock blocks until key is free or ctx is done. On success it returns the
+// function that releases the key.
+func (k *keyedMutex) lock(ctx context.Context, key string) (func(), error) {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{ch: make(chan struct{}, 1)}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	select {
+	case l.ch <- struct{}{}:
+		return func() {
+			<-l.ch
+			k.release(key, l)
+		}, nil
+	case <-ctx.Done():
+		k.release(key, l)
+		return nil, ctx.Err()
+	}
+}
+
+func (k *keyedMutex) release(key string, l *keyedLock) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(k.locks, key)
+	}
+}
+
+// mutationStoryID names the story a write request changes: the storyId path
+// parameter, else "storyId" or "story.storyId" in the JSON body. Paragraph
+// routes lock the story of the paragraph record; paragraph records can only
+// be found within their story's partition, so the body's storyId says where
+// to look. Requests with no story to find write nothing (they create a story
+// with a generated id or are rejected) and need no lock.
+func mutationStoryID(ctx context.Context, req events.APIGatewayProxyRequest) string {
+	if id := req.PathParameters["storyId"]; id != "" {
+		return id
+	}
+	var body struct {
+		StoryID string `json:"storyId"`
+		Story   struct {
+			StoryID string `json:"storyId"`
+		} `json:"story"`
+	}
+	if json.Unmarshal([]byte(req.Body), &body) != nil {
+		return ""
+	}
+	if paragraphID := req.PathParameters["paragraphId"]; paragraphID != "" {
+		if body.StoryID == "" || storySvc == nil {
+			return ""
+		}
+		storyID, err := storySvc.ParagraphStoryID(ctx, body.StoryID, paragraphID)
+		if err != nil {
+			return ""
+		}
+		return storyID
+	}
+	if body.StoryID != "" {
+		return body.StoryID
+	}
+	return body.Story.StoryID
+}
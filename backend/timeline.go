@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// timelineBucket groups the nodes that share one Time value. Date and Week
+// are set when the value resolves onto the calendar.
+type timelineBucket struct {
+	Time  string   `json:"time"`
+	Date  string   `json:"date,omitempty"`
+	Week  string   `json:"week,omitempty"`
+	Nodes []string `json:"nodes"`
+
+	at time.Time
+}
+
+// timelineHandler buckets a story's nodes by Time on a single date axis.
+// Relative tokens (T0..Tn) resolve against the story's timeAnchor; values that
+// cannot be resolved are listed under "unresolved", relative ones in token
+// order. Nodes without a time are left out.
+// Route: GET /api/stories/{storyId}/timeline
+func timelineHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	storyID := req.PathParameters["storyId"]
+	if storyID == "" {
+		return badInput("Missing storyId"), nil
+	}
+	anchor := ""
+	full, err := storySvc.GetFullStory(ctx, storyID)
+	switch {
+	case err == nil:
+		anchor = full.Story.TimeAnchor
+	case !errors.Is(err, storyapi.ErrStoryNotFound):
+		log.Printf("❌ Failed to load story %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	nodes, _, err := loadGraph(ctx, storyID)
+	if err != nil {
+		log.Printf("❌ Failed to load graph for %s: %v", storyID, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Headers: corsHeaders(), Body: "Failed to fetch data"}, nil
+	}
+	if full == nil && len(nodes) == 0 {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: corsHeaders(), Body: "Story not found"}, nil
+	}
+
+	byTime := map[string]*timelineBucket{}
+	var order []string
+	for _, n := range nodes {
+		if n.Time == "" {
+			continue
+		}
+		b, ok := byTime[n.Time]
+		if !ok {
+			b = &timelineBucket{Time: n.Time}
+			if t, ok := storyapi.ResolveTime(n.Time, anchor); ok {
+				b.at = t
+				b.Date = t.Format("2006-01-02")
+				y, w := t.ISOWeek()
+				b.Week = fmt.Sprintf("%04d-W%02d", y, w)
+			}
+			byTime[n.Time] = b
+			order = append(order, n.Time)
+		}
+		b.Nodes = append(b.Nodes, n.ID)
+	}
+
+	entries, unresolved := []timelineBucket{}, []timelineBucket{}
+	for _, key := range order {
+		if b := byTime[key]; b.Date != "" {
+			entries = append(entries, *b)
+		} else {
+			unresolved = append(unresolved, *b)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].at.Equal(entries[j].at) {
+			return entries[i].at.Before(entries[j].at)
+		}
+		return entries[i].Time < entries[j].Time
+	})
+	sort.SliceStable(unresolved, func(i, j int) bool {
+		a, aRel := storyapi.ParseRelativeToken(unresolved[i].Time)
+		b, bRel := storyapi.ParseRelativeToken(unresolved[j].Time)
+		if aRel != bRel {
+			return aRel
+		}
+		if aRel && a != b {
+			return a < b
+		}
+		return unresolved[i].Time < unresolved[j].Time
+	})
+
+	body, _ := json.Marshal(struct {
+		StoryID    string           `json:"storyId"`
+		TimeAnchor string           `json:"timeAnchor,omitempty"`
+		Entries    []timelineBucket `json:"entries"`
+		Unresolved []timelineBucket `json:"unresolved"`
+	}{storyID, anchor, entries, unresolved})
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	storyapi "strukturbild/api"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// bundleReport is the answer of validateBundleHandler. Problems would make
+// the import or the submit of the graph fail; warnings are accepted by
+// default. Consistency lists the broken references between the parts.
+type bundleReport struct {
+	Valid       bool              `json:"valid"`
+	Problems    []string          `json:"problems"`
+	Warnings    []string          `json:"warnings"`
+	Consistency consistencyReport `json:"consistency"`
+}
+
+// validateBundleHandler checks a story bundle as the school export writes it
+// (story with paragraphNodeMap, paragraphs, detailsByParagraph, nodes,
+// edges) before it is imported elsewhere. It runs the import checks on the
+// narrative, the submit checks on the graph and the repair checks across
+// both, and reports everything it finds. Nothing is read or written.
+// Route: POST /api/validate-bundle
+func validateBundleHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var bundle storyBundle
+	if err := storyapi.DecodeJSON(req.Body, &bundle); err != nil {
+		return badInput(err.Error()), nil
+	}
+	problems, warnings := storySvc.CheckStoryFull(&bundle.StoryFull)
+
+	for _, n := range bundle.Nodes {
+		if err := validateNode(n); err != nil {
+			problems = append(problems, err.Error())
+		}
+		for _, ts := range []string{n.CreatedAt, n.UpdatedAt} {
+			if _, err := storyapi.NormalizeRFC3339(ts); ts != "" && err != nil {
+				problems = append(problems, fmt.Sprintf("Node %s has an invalid timestamp %q (want RFC 3339)", n.ID, ts))
+			}
+		}
+		_, cx := clampCoord(n.X)
+		_, cy := clampCoord(n.Y)
+		if cx || cy {
+			warnings = append(warnings, fmt.Sprintf("Node %s coordinates (%d,%d) out of range [%d,%d]", n.ID, n.X, n.Y, coordMin, coordMax))
+		}
+		if !nodeTypes[n.Type] {
+			warnings = append(warnings, fmt.Sprintf("Node %s has unknown type %q", n.ID, n.Type))
+		}
+	}
+	for _, id := range duplicateNodeIDs(bundle.Nodes) {
+		problems = append(problems, fmt.Sprintf("Node id %s appears more than once", id))
+	}
+	for _, id := range nodeEdgeIDClashes(bundle.Nodes, bundle.Edges) {
+		problems = append(problems, fmt.Sprintf("Node id %s is also the id of an edge", id))
+	}
+	if len(bundle.Edges) > maxEdges {
+		problems = append(problems, fmt.Sprintf("Graph has %d edges (limit %d)", len(bundle.Edges), maxEdges))
+	}
+	for _, e := range bundle.Edges {
+		if err := validateEdge(e); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if e.From != "" && e.From == e.To {
+			warnings = append(warnings, fmt.Sprintf("Edge %s->%s is a self-loop", e.From, e.To))
+		}
+		for j, wp := range e.Waypoints {
+			_, cx := clampCoord(wp.X)
+			_, cy := clampCoord(wp.Y)
+			if cx || cy {
+				warnings = append(warnings, fmt.Sprintf("Edge %s->%s waypoint %d (%d,%d) out of range [%d,%d]", e.From, e.To, j, wp.X, wp.Y, coordMin, coordMax))
+			}
+		}
+	}
+	if err := checkUndirectedRepeats(bundle.Edges); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	report := bundleReport{
+		Problems:    problems,
+		Warnings:    warnings,
+		Consistency: checkConsistency(storySnapshot{nodes: bundle.Nodes, edges: bundle.Edges, full: &bundle.StoryFull}),
+	}
+	if report.Problems == nil {
+		report.Problems = []string{}
+	}
+	if report.Warnings == nil {
+		report.Warnings = []string{}
+	}
+	report.Valid = len(report.Problems) == 0 && report.Consistency.clean()
+	body, _ := json.Marshal(report)
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Build metadata, set by `make build` through
+// -ldflags "-X main.version=... -X main.gitCommit=... -X main.builtAt=...".
+var (
+	version   = "dev"
+	gitCommit = "dev"
+	builtAt   = "dev"
+)
+
+// versionHandler reports which build is deployed.
+// Route: GET /api/version
+func versionHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	body, _ := json.Marshal(map[string]string{
+		"version":   version,
+		"gitCommit": gitCommit,
+		"builtAt":   builtAt,
+	})
+	h := corsHeaders()
+	h["Content-Type"] = "application/json"
+	return events.APIGatewayProxyResponse{StatusCode: 200, Headers: h, Body: string(body)}, nil
+}
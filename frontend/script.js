@@ -91,12 +91,14 @@ async function fetchAndRenderStory(storyId) {
 
 async function fetchStoryList() {
   const base = (API_BASE_URL || '').replace(/\/+$/, '');
-  const res = await fetch(`${base}/api/stories`);
+  // The editor lists its own drafts too.
+  const res = await fetch(`${base}/api/stories?includeDrafts=true`);
   if (!res.ok) {
     throw new Error(`HTTP ${res.status}`);
   }
   const data = await res.json();
-  const storiesArray = data && Array.isArray(data.stories) ? data.stories : null;
+  const storiesArray = data && Array.isArray(data.items) ? data.items
+    : data && Array.isArray(data.stories) ? data.stories : null;
   const collection = storiesArray || (Array.isArray(data) ? data : []);
   return collection
     .filter(item => item && (item.storyId || item.storyID))
@@ -681,7 +683,8 @@ deleteSelectedBtn?.addEventListener('click', async () => {
       const n = selectedNodes[i];
       try {
         const res = await fetch(`${API_BASE_URL}/struktur/${storyId}/${n.id()}`, { method: 'DELETE' });
-        if (!res.ok) throw new Error(await res.text());
+        // 404: the node was never saved, removing it locally is enough
+        if (!res.ok && res.status !== 404) throw new Error(await res.text());
         n.remove();
 
         // Sync in-memory dataset
@@ -831,6 +834,8 @@ function cancelConnectMode() {
           time: fieldTime.value || '',
           color: fieldColor.value.trim(),
           detail: fieldDetail.value.trim(),
+          shape: inspectorSelection.data('shape') || '',
+          icon: inspectorSelection.data('icon') || '',
           x: Math.round(pos.x), y: Math.round(pos.y),
           storyId, isNode: true
         }],
@@ -910,6 +915,8 @@ function cancelConnectMode() {
         time: n.data('time')||'',
         color: n.data('color')||'',
         detail: n.data('detail')||'',
+        shape: n.data('shape')||'',
+        icon: n.data('icon')||'',
         x: Math.round(p.x), y: Math.round(p.y),
         storyId, isNode: true
       };
@@ -1008,7 +1015,7 @@ cy.nodes().forEach(n => n.data('hasXY', true));
       const id = inspectorSelection.id();
       try {
         const res = await fetch(`${API_BASE_URL}/struktur/${storyId}/${id}`, { method: 'DELETE' });
-        if (!res.ok) throw new Error(await res.text());
+        if (!res.ok && res.status !== 404) throw new Error(await res.text());
         lastNodes = lastNodes.filter(n => n.id !== id);
         lastEdges = lastEdges.filter(e => e.from !== id && e.to !== id);
         inspectorSelection.remove();
@@ -1160,6 +1167,10 @@ cy.nodes().forEach(n => n.data('hasXY', true));
               'overlay-opacity': 0
             }
           },
+          {
+            selector: 'node[shape != ""]',
+            style: { 'shape': 'data(shape)' }
+          },
           {
             selector: 'node:selected',
             style: { 'border-width': 3, 'border-color': '#FFD700' }
@@ -1239,6 +1250,12 @@ cy.nodes().forEach(n => n.data('hasXY', true));
               'text-background-opacity': 1,
               'text-background-padding': 2
             }
+          },
+          {
+            selector: 'edge.undirected',
+            style: {
+              'target-arrow-shape': 'none'
+            }
           }
         ],
         elements: cyElements(nodes, edges)
@@ -1373,7 +1390,7 @@ cy.nodes().forEach(n => n.data('hasXY', true));
               if (!storyId) { alert('Set Story ID first'); return; }
               fetch(`${API_BASE_URL}/struktur/${storyId}/${node.id()}`, { method: 'DELETE' })
                 .then(res => {
-                  if (!res.ok) return res.text().then(t => { throw new Error(`Delete failed ${res.status}: ${t}`); });
+                  if (!res.ok && res.status !== 404) return res.text().then(t => { throw new Error(`Delete failed ${res.status}: ${t}`); });
                   node.remove();
                 })
                 .catch(err => {
@@ -1482,8 +1499,9 @@ cy.nodes().forEach(n => n.data('hasXY', true));
             // Update in-memory dataset
             const nodeObj = { id, label:'', type:'', time:'', color:'', detail:'', x:Math.round(p.x), y:Math.round(p.y), storyId, isNode:true };
             lastNodes.push(nodeObj);
-            // Persist basic node immediately
-            fetch(`${API_BASE_URL}/submit`, {
+            // Persist basic node immediately; create=true refuses to overwrite
+            // a node another editor already saved under the same id.
+            fetch(`${API_BASE_URL}/submit?create=true`, {
               method:'POST', headers:{'Content-Type':'application/json'},
               body: JSON.stringify({ storyId, nodes:[nodeObj], edges:[] })
             });
@@ -1540,7 +1558,9 @@ cy.nodes().forEach(n => n.data('hasXY', true));
           type: n.type || '',
           time: n.time || '',
           color,
-          detail: n.detail || ''
+          detail: n.detail || '',
+          shape: n.shape || '',
+          icon: n.icon || ''
         }
       };
       if (hasXY) {
@@ -1566,7 +1586,9 @@ const cyEdges = (edges || [])
         label: e.label || '',
         type: e.type || '',
         detail: e.detail || ''
-      }
+      },
+      // Symmetric relations ("relates", or directed:false) have no arrowhead.
+      classes: (e.directed === false || (e.directed === undefined && e.type === 'relates')) ? 'undirected' : ''
     };
   });
 
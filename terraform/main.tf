@@ -44,28 +44,22 @@ resource "aws_lambda_function" "strukturbild_api" {
     variables = {
       ENV        = local.env
       TABLE_NAME = local.env == "prod" ? "strukturbild_data" : "strukturbild_data_${local.env}"
+      # The Lambda answers CORS itself; see the http_api below.
+      ALLOWED_ORIGINS      = join(",", var.allowed_origins)
+      CORS_MAX_AGE_SECONDS = tostring(var.cors_max_age_seconds)
+      CORS_ALLOW_HEADERS   = join(",", var.cors_allow_headers)
     }
   }
 }
 
+# No cors_configuration: API Gateway would answer preflights and overwrite
+# the CORS headers of every response with its own fixed settings. The Lambda
+# owns CORS instead (ALLOWED_ORIGINS, CORS_MAX_AGE_SECONDS, CORS_ALLOW_HEADERS,
+# per-path Allow-Methods, exposed Location/Link/X-Next-Cursor), and
+# preflights reach it through the options_route.
 resource "aws_apigatewayv2_api" "http_api" {
   name          = "strukturbild-http-api${local.name_suffix}"
   protocol_type = "HTTP"
-  cors_configuration {
-    allow_origins     = ["*"]
-    allow_methods     = ["OPTIONS", "GET", "POST", "DELETE", "PATCH", "PUT"]
-    allow_headers     = [
-      "content-type",
-      "authorization",
-      "x-requested-with",
-      "x-amz-date",
-      "x-api-key",
-      "x-amz-security-token"
-    ]
-    expose_headers    = []
-    max_age           = 86400
-    allow_credentials = false
-  }
 }
 
 resource "aws_lambda_permission" "apigw" {
@@ -204,6 +198,29 @@ resource "aws_dynamodb_table" "struktur_data" {
     type = "S"
   }
 
+  attribute {
+    name = "recordType"
+    type = "S"
+  }
+
+  # Sparse index: only story headers carry recordType, so ListStories reads
+  # just those instead of scanning paragraphs, details and graph items.
+  # Set STORY_INDEX_NAME=stories-by-type on the Lambda once story records
+  # written before this index (without recordType) have been re-saved.
+  global_secondary_index {
+    name            = "stories-by-type"
+    hash_key        = "recordType"
+    range_key       = "id"
+    projection_type = "ALL"
+  }
+
+  # Story write leases (LOCK#<storyId>) expire at expiresAt; TTL clears the
+  # ones a crashed writer left behind.
+  ttl {
+    attribute_name = "expiresAt"
+    enabled        = true
+  }
+
   tags = {
     Project = "strukturbild"
   }
@@ -221,10 +238,15 @@ resource "aws_iam_policy" "dynamodb_access" {
         "dynamodb:GetItem",
         "dynamodb:Query",
         "dynamodb:DeleteItem",
+        "dynamodb:BatchWriteItem",
+        "dynamodb:TransactWriteItems",
         "dynamodb:Scan"
       ],
       Effect   = "Allow",
-      Resource = aws_dynamodb_table.struktur_data.arn
+      Resource = [
+        aws_dynamodb_table.struktur_data.arn,
+        "${aws_dynamodb_table.struktur_data.arn}/index/*"
+      ]
     }]
   })
 }
@@ -246,6 +268,27 @@ resource "aws_apigatewayv2_route" "get_route" {
   authorization_type = "NONE"
 }
 
+resource "aws_apigatewayv2_route" "positions_route" {
+  api_id             = aws_apigatewayv2_api.http_api.id
+  route_key          = "POST /struktur/{storyId}/positions"
+  target             = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_route" "retype_route" {
+  api_id             = aws_apigatewayv2_api.http_api.id
+  route_key          = "POST /struktur/{storyId}/retype"
+  target             = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_route" "options_route" {
+  api_id             = aws_apigatewayv2_api.http_api.id
+  route_key          = "OPTIONS /{proxy+}"
+  target             = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
+  authorization_type = "NONE"
+}
+
 resource "aws_apigatewayv2_route" "api_proxy" {
   api_id             = aws_apigatewayv2_api.http_api.id
   route_key          = "ANY /api/{proxy+}"
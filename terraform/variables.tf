@@ -2,4 +2,22 @@ variable "env" {
   description = "Environment name (dev|prod)"
   type        = string
   default     = "prod"
-}
\ No newline at end of file
+}
+
+variable "allowed_origins" {
+  description = "Origins allowed to call the API with credentials; empty allows any origin without them"
+  type        = list(string)
+  default     = []
+}
+
+variable "cors_max_age_seconds" {
+  description = "How long browsers may cache a preflight response"
+  type        = number
+  default     = 86400
+}
+
+variable "cors_allow_headers" {
+  description = "Request headers allowed in addition to the ones the API reads"
+  type        = list(string)
+  default     = []
+}